@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,6 +14,7 @@ import (
 	"github.com/JWhist/AT_Proto_PubSub/internal/api"
 	"github.com/JWhist/AT_Proto_PubSub/internal/config"
 	"github.com/JWhist/AT_Proto_PubSub/internal/firehose"
+	"github.com/JWhist/AT_Proto_PubSub/internal/logging"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
@@ -22,29 +24,70 @@ func main() {
 	flag.Parse()
 
 	// Load configuration
-	cfg, err := config.LoadConfigWithDefaults(*configFile)
-	if err != nil {
-		log.Printf("Failed to load config from %s, using defaults: %v", *configFile, err)
+	cfg, loadErr := config.LoadConfigWithDefaults(*configFile)
+	if loadErr != nil {
 		cfg = config.GetDefaultConfig()
 	}
 
-	// Print startup information with config values
-	fmt.Println("AT Protocol Firehose Filter Server with WebSocket Subscriptions")
-	fmt.Printf("Configuration loaded from: %s\n", *configFile)
-	fmt.Printf("Server will start on: %s\n", cfg.GetBaseURL())
-	fmt.Println("Use the API endpoints to create filter subscriptions:")
-	fmt.Printf("  GET  %s/api/status\n", cfg.GetBaseURL())
-	fmt.Printf("  GET  %s/api/subscriptions\n", cfg.GetBaseURL())
-	fmt.Printf("  POST %s/api/filters/create\n", cfg.GetBaseURL())
-	fmt.Printf("  GET  %s/api/subscriptions/{filterKey}\n", cfg.GetBaseURL())
-	fmt.Printf("  GET  %s/api/stats\n", cfg.GetBaseURL())
-	fmt.Println("")
-	fmt.Println("WebSocket connection:")
-	fmt.Printf("  ws://%s:%s/ws/{filterKey}\n", cfg.Server.Host, cfg.Server.Port)
-	fmt.Println("")
-	fmt.Println("API Documentation:")
-	fmt.Printf("  %s/swagger/\n", cfg.GetBaseURL())
-	fmt.Println()
+	// Route server logs through slog as configured (level, text/json, output)
+	logOutput, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		log.Printf("Failed to configure logging, using defaults: %v", err)
+	} else {
+		defer func() {
+			if err := logOutput.Close(); err != nil {
+				log.Printf("Failed to close log output: %v", err)
+			}
+		}()
+	}
+	if loadErr != nil {
+		slog.Warn("Failed to load config, using defaults", "config", *configFile, "error", loadErr)
+	}
+
+	// Startup information goes through the logger too, so JSON logs stay machine-readable
+	baseURL := cfg.GetBaseURL()
+	wsBaseURL := cfg.GetWebSocketBaseURL()
+	slog.Info("AT Protocol Firehose Filter Server with WebSocket Subscriptions", "config", *configFile, "baseURL", baseURL)
+	slog.Info("Use the API endpoints to create filter subscriptions", "endpoints", []string{
+		"GET /api/status",
+		"GET /api/version",
+		"GET /api/subscriptions",
+		"POST /api/filters/create",
+		"POST /api/filters/batch",
+		"POST /api/filters/test",
+		"POST /api/filters/validate",
+		"DELETE /api/filters/delete/{filterKey}",
+		"GET /api/subscriptions/{filterKey}",
+		"PUT /api/subscriptions/{filterKey}",
+		"GET /api/subscriptions/{filterKey}/connections",
+		"GET /api/subscriptions/{filterKey}/stats",
+		"POST /api/subscriptions/{filterKey}/pause",
+		"POST /api/subscriptions/{filterKey}/token",
+		"GET /api/subscriptions/{filterKey}/recent",
+		"GET /api/stats",
+		"GET /api/stats/detailed",
+		"GET /api/keywords",
+		"GET /healthz",
+		"GET /readyz",
+	})
+	slog.Info("Streaming endpoints",
+		"websocket", wsBaseURL+"/ws/{filterKey}",
+		"websocketMsgpack", wsBaseURL+"/ws/{filterKey}?format=msgpack",
+		"sse", baseURL+"/sse/{filterKey}",
+		"stats", wsBaseURL+"/ws/stats")
+	if cfg.Server.Auth.Enabled {
+		slog.Info(`API key auth enabled: send "Authorization: Bearer <key>" to create, update or delete filters`,
+			"apiKeys", len(cfg.Server.Auth.APIKeys),
+			"adminEndpoints", []string{
+				"DELETE /api/admin/filters/{filterKey}",
+				"DELETE /api/admin/connections?remoteIp=&filterKey=",
+				"GET /ws/tap?rate=",
+			})
+	}
+	if !cfg.Server.RequireKeyword {
+		slog.Info("Keywords are optional: filters may match on repositories or collections alone")
+	}
+	slog.Info("API documentation", "url", baseURL+"/swagger/")
 
 	// Create firehose client instance with configuration
 	firehoseClient := firehose.NewClientWithConfig(cfg)
@@ -63,10 +106,19 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload the hot-reloadable settings on SIGHUP, keeping subscriptions and connections
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			reloadConfig(*configFile, cfg, apiServer, firehoseClient)
+		}
+	}()
+
 	// Start API server in a goroutine
 	go func() {
 		if err := apiServer.Start(); err != nil && err != http.ErrServerClosed {
-			log.Printf("API server error: %v", err)
+			slog.Error("API server error", "error", err)
 			cancel()
 		}
 	}()
@@ -74,9 +126,10 @@ func main() {
 	// Start metrics server in a goroutine
 	go func() {
 		http.Handle("/metrics", promhttp.Handler())
-		fmt.Printf("Starting metrics server on %s:%s\n", cfg.Server.MetricsHost, cfg.Server.MetricsPort)
-		if err := http.ListenAndServe(fmt.Sprintf("%s:%s", cfg.Server.MetricsHost, cfg.Server.MetricsPort), nil); err != nil {
-			log.Printf("Metrics server error: %v", err)
+		metricsAddr := net.JoinHostPort(cfg.Server.MetricsHost, cfg.Server.MetricsPort)
+		slog.Info("Starting metrics server", "addr", metricsAddr)
+		if err := http.ListenAndServe(metricsAddr, nil); err != nil {
+			slog.Error("Metrics server error", "error", err)
 			cancel()
 		}
 	}()
@@ -88,26 +141,63 @@ func main() {
 				// Expected shutdown
 				return
 			}
-			log.Printf("Firehose client error: %v", err)
+			slog.Error("Firehose client error", "error", err)
 			cancel()
 		}
 	}()
 
 	// Wait for shutdown signal
 	<-sigChan
-	fmt.Println("\nReceived shutdown signal...")
+	slog.Info("Received shutdown signal")
 	cancel()
 
 	// Graceful shutdown with configured timeout
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer shutdownCancel()
 
-	// Shutdown subscription manager
-	apiServer.GetSubscriptionManager().Shutdown()
+	// Stop forwarding events first, so none are broadcast while the manager drains
+	firehoseClient.ClearEventCallback()
+
+	// Shutdown subscription manager, flushing queued deliveries and giving WebSocket clients time
+	// to close cleanly. The drain timeout is capped at the shutdown timeout, so this fits in shutdownCtx.
+	if dropped := apiServer.GetSubscriptionManager().ShutdownWithDrain(cfg.Server.DrainTimeout); dropped > 0 {
+		slog.Warn("Dropped undelivered events on shutdown", "dropped", dropped)
+	}
 
 	if err := apiServer.Stop(shutdownCtx); err != nil {
-		log.Printf("API server shutdown error: %v", err)
+		slog.Error("API server shutdown error", "error", err)
+	}
+
+	slog.Info("Server stopped")
+}
+
+// reloadConfig re-reads the config file and applies the settings that can change at runtime:
+// logging.level, server.cors, server.max_connections, the WebSocket ping interval, pong wait and
+// write wait, and the firehose URLs. Everything else keeps its startup value until a restart.
+// If the file can't be loaded, the current settings stay in effect.
+func reloadConfig(configFile string, startup *config.Config, apiServer *api.Server, firehoseClient *firehose.Client) {
+	cfg, err := config.LoadConfigWithDefaults(configFile)
+	if err != nil {
+		slog.Error("Failed to reload config, keeping current settings", "config", configFile, "error", err)
+		return
+	}
+
+	var changed []string
+	previousLevel := logging.Level()
+	if err := logging.SetLevel(cfg.Logging.Level); err != nil {
+		slog.Warn("Not changing the log level", "error", err)
+	} else if logging.Level() != previousLevel {
+		changed = append(changed, "logging.level")
+	}
+
+	changed = append(changed, apiServer.ReloadConfig(cfg)...)
+
+	// Changing the source needs a restart, since the URLs would then speak another protocol
+	if cfg.Firehose.Source != startup.Firehose.Source {
+		slog.Warn("Not changing firehose.source until restart", "source", startup.Firehose.Source)
+	} else if firehoseClient.SwitchUpstreams(cfg.Firehose.UpstreamURLs()) {
+		changed = append(changed, "firehose.url")
 	}
 
-	fmt.Println("Server stopped")
+	slog.Info("Reloaded config", "config", configFile, "changed", changed)
 }
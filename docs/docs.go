@@ -45,6 +45,127 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/admin/connections": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Close every WebSocket connection matching all given criteria with a policy-violation (1008) close frame, removing it from all of its filters. At least one criterion is required. Only available when API key auth is enabled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Close Connections (admin)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Close connections from this client IP address",
+                        "name": "remoteIp",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Close connections subscribed to this filter",
+                        "name": "filterKey",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Connections closed",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or invalid criteria",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "API key auth is not enabled",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/admin/filters/{filterKey}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete a filter subscription and close every WebSocket connection subscribed to it, including connections also subscribed to other filters, with a policy-violation (1008) close frame. Only available when API key auth is enabled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Force-Delete Filter Subscription (admin)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Filter subscription force-deleted",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Filter key required",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "API key auth is not enabled",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Filter subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/api/filters": {
             "get": {
                 "description": "Retrieve the current global filter settings",
@@ -68,9 +189,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/filters/create": {
+        "/api/filters/batch": {
             "post": {
-                "description": "Create a new filter subscription for receiving real-time events. At least one filter criteria must be provided to prevent forwarding the entire firehose.",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create up to 100 filter subscriptions in one request. Every entry is validated first, with the same rules as /api/filters/create; if any entry is invalid nothing is created and data lists the rejected entries.",
                 "consumes": [
                     "application/json"
                 ],
@@ -80,27 +206,54 @@ const docTemplate = `{
                 "tags": [
                     "Subscriptions"
                 ],
-                "summary": "Create Filter Subscription",
+                "summary": "Create Filter Subscriptions in Bulk",
                 "parameters": [
                     {
-                        "description": "Filter creation request",
+                        "description": "Filter creation requests",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.CreateFilterRequest"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CreateFilterRequest"
+                            }
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Filter subscription created successfully",
+                        "description": "Filter subscriptions created successfully, in request order",
                         "schema": {
-                            "$ref": "#/definitions/models.CreateFilterResponse"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CreateFilterResponse"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Invalid request - no filter criteria provided",
+                        "description": "Invalid request or entries; nothing was created",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/models.BatchFilterError"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled)",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
@@ -108,9 +261,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/filters/update": {
+        "/api/filters/create": {
             "post": {
-                "description": "Update the global filter settings (legacy endpoint)",
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create a new filter subscription for receiving real-time events. Keyword filter is required and must contain at least 3 letters to prevent forwarding the entire firehose; with server.require_keyword off, a repository, repositoryPrefix or collections filter will do instead. An optional expiresAt removes the filter and closes its connections at that time. An optional label and metadata are stored with the filter for organization and don't affect matching.\nWith an Idempotency-Key header (or idempotencyKey field), retrying the request with the same key and options within server.idempotency_ttl returns the filter created by the first request, with an Idempotent-Replayed: true header, instead of creating a duplicate. Keys are namespaced by API key, or by client IP when auth is disabled.\nWith requireToken set, the response carries a connectToken valid for server.connect_token_ttl (default 5m) that /ws and /sse connections to the filter must present, so a leaked filter key alone doesn't grant access. POST /api/subscriptions/{filterKey}/token issues new ones.",
                 "consumes": [
                     "application/json"
                 ],
@@ -118,29 +276,53 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Filters"
+                    "Subscriptions"
                 ],
-                "summary": "Update Global Filters",
+                "summary": "Create Filter Subscription",
                 "parameters": [
                     {
-                        "description": "Filter update request",
+                        "description": "Filter creation request",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.FilterUpdateRequest"
+                            "$ref": "#/definitions/models.CreateFilterRequest"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client-chosen unique key (at most 255 characters) that makes retries return the same filter",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Filters updated successfully",
+                        "description": "Filter subscription created successfully",
                         "schema": {
-                            "$ref": "#/definitions/models.APIResponse"
+                            "$ref": "#/definitions/models.CreateFilterResponse"
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid request - keyword filter required or insufficient letters; data.reason is no_keyword, too_short, invalid_did or invalid_option",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled)",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The idempotency key was already used with different options, expiresAt, requireToken, label or metadata",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "The connect token couldn't be issued (with requireToken)",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
@@ -148,9 +330,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/stats": {
-            "get": {
-                "description": "Get subscription manager statistics and metrics",
+        "/api/filters/delete/{filterKey}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete a filter subscription by key. All WebSocket connections subscribed to the filter are closed. When API key auth is disabled, filters created with requireToken also need a connect token, as ?token= or X-Connect-Token.",
                 "consumes": [
                     "application/json"
                 ],
@@ -160,10 +347,49 @@ const docTemplate = `{
                 "tags": [
                     "Subscriptions"
                 ],
-                "summary": "Get Statistics",
+                "summary": "Delete Filter Subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "Statistics retrieved successfully",
+                        "description": "Filter subscription deleted successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Filter key required",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled), or connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Filter subscription not found",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
@@ -171,9 +397,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/status": {
-            "get": {
-                "description": "Get the current server status and active filters",
+        "/api/filters/test": {
+            "post": {
+                "description": "Check whether a sample record would match the given filter options and which keywords hit. No subscription is created.",
                 "consumes": [
                     "application/json"
                 ],
@@ -181,12 +407,29 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Health"
+                    "Filters"
+                ],
+                "summary": "Test Filter",
+                "parameters": [
+                    {
+                        "description": "Filter options and sample record",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.TestFilterRequest"
+                        }
+                    }
                 ],
-                "summary": "Server Status",
                 "responses": {
                     "200": {
-                        "description": "Server status retrieved successfully",
+                        "description": "Filter evaluated",
+                        "schema": {
+                            "$ref": "#/definitions/models.TestFilterResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request - keyword filter required, invalid options or missing record",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
@@ -194,9 +437,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/subscriptions": {
-            "get": {
-                "description": "Retrieve all active filter subscriptions",
+        "/api/filters/update": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update the global filter settings (legacy endpoint)",
                 "consumes": [
                     "application/json"
                 ],
@@ -204,12 +452,35 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Subscriptions"
+                    "Filters"
+                ],
+                "summary": "Update Global Filters",
+                "parameters": [
+                    {
+                        "description": "Filter update request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.FilterUpdateRequest"
+                        }
+                    }
                 ],
-                "summary": "Get All Subscriptions",
                 "responses": {
                     "200": {
-                        "description": "Subscriptions retrieved successfully",
+                        "description": "Filters updated successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled)",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
@@ -217,9 +488,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/subscriptions/{filterKey}": {
-            "get": {
-                "description": "Get detailed information about a specific filter subscription",
+        "/api/filters/validate": {
+            "post": {
+                "description": "Run every check filter creation applies, including resolving handles in the repository option, and report the validity of each option with its specific error and rejection reason. Invalid options still return 200 with valid set to false. No subscription is created.",
                 "consumes": [
                     "application/json"
                 ],
@@ -227,27 +498,29 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Subscriptions"
+                    "Filters"
                 ],
-                "summary": "Get Subscription Details",
+                "summary": "Validate Filter",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "The unique filter key for the subscription",
-                        "name": "filterKey",
-                        "in": "path",
-                        "required": true
+                        "description": "Filter options to validate",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidateFilterRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Subscription details retrieved successfully",
+                        "description": "Options validated",
                         "schema": {
-                            "$ref": "#/definitions/models.APIResponse"
+                            "$ref": "#/definitions/models.FilterValidationResponse"
                         }
                     },
-                    "404": {
-                        "description": "Subscription not found",
+                    "400": {
+                        "description": "Invalid JSON in request body",
                         "schema": {
                             "$ref": "#/definitions/models.APIResponse"
                         }
@@ -255,20 +528,924 @@ const docTemplate = `{
                 }
             }
         },
-        "/ws/{filterKey}": {
+        "/api/keywords": {
             "get": {
-                "description": "Establish a WebSocket connection to receive real-time filtered events. Connect to /ws/{filterKey} with the filter key obtained from creating a subscription.",
+                "description": "Get every keyword term configured across filter subscriptions with the number of filters using it, sorted by popularity. Plain keywords are lowercased; regex patterns are listed as written.",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "WebSocket"
+                    "Subscriptions"
                 ],
-                "summary": "WebSocket Connection",
-                "parameters": [
-                    {
+                "summary": "List Active Keywords",
+                "responses": {
+                    "200": {
+                        "description": "Keywords retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/stats": {
+            "get": {
+                "description": "Get subscription manager statistics and metrics",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Get Statistics",
+                "responses": {
+                    "200": {
+                        "description": "Statistics retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/stats/detailed": {
+            "get": {
+                "description": "Get subscription manager statistics plus the messages sent per keyword over the last minute and the resulting rate, busiest keywords first. Meant for dashboards that can't query Prometheus.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Get Detailed Statistics",
+                "responses": {
+                    "200": {
+                        "description": "Detailed statistics retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/status": {
+            "get": {
+                "description": "Get the current server status, active filters, the current firehose cursor (last seen sequence number of the first upstream), the rolling firehose lag in seconds and the connection status of each firehose upstream, with credentials in its URL redacted",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Server Status",
+                "responses": {
+                    "200": {
+                        "description": "Server status retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions": {
+            "get": {
+                "description": "Retrieve active filter subscriptions, oldest first. Without limit or offset the response data is the array of all matching subscriptions; with either, it is a page object holding the page and the total number of matching subscriptions. Filters created with requireToken are only listed when the request carries a valid API key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Get All Subscriptions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Maximum subscriptions returned (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Matching subscriptions to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only subscriptions whose keyword option contains this text (case-insensitive)",
+                        "name": "keyword",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscriptions retrieved successfully (data is a models.SubscriptionPage when paging)",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/models.FilterSubscription"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid limit or offset",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions/{filterKey}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get detailed information about a specific filter subscription. Filters created with requireToken also need a connect token, as ?token= or X-Connect-Token, or a valid API key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Get Subscription Details",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription details retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Replace the filter options of an existing subscription without dropping its connections. Connected clients receive a filter_updated message. The same validation as filter creation applies. When API key auth is disabled, filters created with requireToken also need a connect token, as ?token= or X-Connect-Token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Update Subscription Filter",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New filter options",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateSubscriptionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription updated successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request - keyword filter required or invalid options",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled), or connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "410": {
+                        "description": "Filter has passed its expiresAt",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions/{filterKey}/connections": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "List each client connected to a filter subscription with its remote address and connection time, oldest first. When API key auth is enabled a valid key is required; otherwise remote addresses are omitted, and filters created with requireToken need a connect token, as ?token= or X-Connect-Token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "List Subscription Connections",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Connections retrieved successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled), or connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions/{filterKey}/pause": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Temporarily stop (paused=true) or restart (paused=false) event delivery to a filter subscription without dropping the filter or its connections. Connected clients receive a paused or resumed message when the state changes. Events matched while paused are not delivered, buffered for replay or sent to the webhook. A paused filter is kept while it still has connections. When API key auth is disabled, filters created with requireToken also need a connect token, as ?token= or X-Connect-Token.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Pause or Resume Subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Whether to pause or resume delivery",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PauseSubscriptionRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription paused or resumed",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.FilterSubscription"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid JSON in request body",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth is enabled), or connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions/{filterKey}/recent": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get the events a filter matched most recently, oldest first, for clients that poll instead of holding a WebSocket open. Events come from the filter's replay buffer (server.replay_buffer_size, default 100), so at most that many are available and none when replay is disabled; events are buffered while nobody is connected too. Polling counts as activity, so a filter without connections isn't cleaned up while it is polled at least every 10 minutes. Filters created with requireToken also need a connect token, as ?token= or X-Connect-Token, or a valid API key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Recent Subscription Events",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of events to return (1-1000, default 50)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Recent events retrieved successfully",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.RecentEvents"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid limit",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions/{filterKey}/stats": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Get one filter's throughput: the total messages delivered to its connections and webhook, the messages forwarded per second averaged over the last 1, 5 and 15 minutes, when a message was last forwarded and how many clients are connected. Filters created with requireToken also need a connect token, as ?token= or X-Connect-Token, or a valid API key.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Subscription Statistics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription statistics retrieved successfully",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.SubscriptionStats"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/subscriptions/{filterKey}/token": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Issue a new connect token for a filter created with requireToken, valid for server.connect_token_ttl (default 5m), e.g. for reconnecting after the one returned at creation expired. Other filters are refused with 403. When API key auth is enabled a valid key is required; otherwise the request must carry a current connect token as ?token= or X-Connect-Token, so the filter key alone can't mint one.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Subscriptions"
+                ],
+                "summary": "Issue Connect Token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key for the subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "A current connect token, when API key auth is disabled",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "A current connect token, when API key auth is disabled",
+                        "name": "X-Connect-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Connect token issued",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.ConnectTokenResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key or connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Filter wasn't created with requireToken",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/version": {
+            "get": {
+                "description": "Get the build version, git commit and build date injected at compile time, the Go runtime version and the firehose URLs in use, with any credentials redacted. Useful to verify what a deployment is running.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Version",
+                "responses": {
+                    "200": {
+                        "description": "Version information",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/models.APIResponse"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.VersionResponse"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Report that the server process is alive. Always returns 200 while the HTTP server is serving.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Liveness Probe",
+                "responses": {
+                    "200": {
+                        "description": "Server is alive",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Report whether the server is ready for traffic: the firehose must be connected and have delivered a message within the configured readiness window (firehose.readiness_window, default 30s).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Readiness Probe",
+                "responses": {
+                    "200": {
+                        "description": "Server is ready",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Firehose not connected or idle",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/sse/{filterKey}": {
+            "get": {
+                "description": "Stream real-time filtered events as text/event-stream, for clients that can't use WebSockets. Messages carry the same JSON as the WebSocket endpoint, with the message type as the SSE event name.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "WebSocket"
+                ],
+                "summary": "Server-Sent Events Stream",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The unique filter key obtained from creating a subscription",
+                        "name": "filterKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key, when auth.require_for_streams is enabled",
+                        "name": "api_key",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event stream established"
+                    },
+                    "400": {
+                        "description": "Filter key required"
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth.require_for_streams is enabled), or invalid or expired connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Invalid filter key"
+                    },
+                    "503": {
+                        "description": "Maximum connections reached"
+                    }
+                }
+            }
+        },
+        "/ws/stats": {
+            "get": {
+                "description": "Stream the same statistics as /api/stats over WebSocket as {\"type\":\"stats\"} messages: one on connect and then one every server.stats_stream_interval (default 5s). Stats connections aren't attached to a filter, so they don't count against the connection limits. Messages sent by the client are ignored.",
+                "tags": [
+                    "WebSocket"
+                ],
+                "summary": "Statistics Stream",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key, when auth.require_for_streams is enabled",
+                        "name": "api_key",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "WebSocket connection established"
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth.require_for_streams is enabled)",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/tap": {
+            "get": {
+                "description": "Stream a deterministic sample of every event the server receives over WebSocket, bypassing filters and the requirement that they have criteria. The sample rate is capped at 0.01 and at most 5 taps may be open at once; taps don't count against the connection limits. Admin-only: API key auth must be enabled and the key is sent as a bearer token or ?api_key=. Messages sent by the client are ignored.",
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Firehose Tap",
+                "parameters": [
+                    {
+                        "type": "number",
+                        "default": 0.001,
+                        "description": "Share of events to receive, greater than 0 and at most 0.01",
+                        "name": "rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key, if not sent as a bearer token",
+                        "name": "api_key",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "WebSocket connection established"
+                    },
+                    "400": {
+                        "description": "Invalid rate",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "API key auth is disabled",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Too many taps are open",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ws/{filterKey}": {
+            "get": {
+                "description": "Establish a WebSocket connection to receive real-time filtered events. Connect to /ws/{filterKey} with the filter key obtained from creating a subscription.\nEvents are JSON text frames by default; with format=msgpack they are MessagePack binary frames with the same fields.\nFilters created with requireToken also need a connect token, as ?token= or a \"token.\u003ctoken\u003e\" subprotocol (Sec-WebSocket-Protocol), which the server then selects.",
+                "tags": [
+                    "WebSocket"
+                ],
+                "summary": "WebSocket Connection",
+                "parameters": [
+                    {
                         "type": "string",
                         "description": "The unique filter key obtained from creating a subscription",
                         "name": "filterKey",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Event encoding: json (default) or msgpack",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Connect token, when the filter was created with requireToken",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "API key, when auth.require_for_streams is enabled",
+                        "name": "api_key",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -276,7 +1453,13 @@ const docTemplate = `{
                         "description": "WebSocket connection established"
                     },
                     "400": {
-                        "description": "Filter key required or invalid"
+                        "description": "Filter key required or invalid, or unsupported format"
+                    },
+                    "401": {
+                        "description": "Invalid or missing API key (when auth.require_for_streams is enabled), or invalid or expired connect token",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIResponse"
+                        }
                     },
                     "404": {
                         "description": "Invalid filter key"
@@ -298,43 +1481,375 @@ const docTemplate = `{
                 }
             }
         },
+        "models.BatchFilterError": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "Keyword filter is required. Filters must include keywords to prevent forwarding the entire firehose."
+                },
+                "index": {
+                    "description": "Index is the entry's position in the request array",
+                    "type": "integer",
+                    "example": 2
+                },
+                "reason": {
+                    "description": "Reason is no_keyword, too_short, invalid_did or invalid_option",
+                    "type": "string",
+                    "example": "no_keyword"
+                }
+            }
+        },
+        "models.ConnectTokenResponse": {
+            "type": "object",
+            "properties": {
+                "expiresAt": {
+                    "type": "string",
+                    "example": "2025-01-01T12:05:00Z"
+                },
+                "filterKey": {
+                    "type": "string",
+                    "example": "8a3ce5f31b47d4788df91aeb38a565fe"
+                },
+                "token": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                }
+            }
+        },
         "models.CreateFilterRequest": {
             "type": "object",
             "properties": {
+                "expiresAt": {
+                    "description": "ExpiresAt removes the filter and closes its connections at this time (omit to keep it until unused)",
+                    "type": "string",
+                    "example": "2025-01-01T13:00:00Z"
+                },
+                "idempotencyKey": {
+                    "description": "IdempotencyKey makes retries return the filter created by the first request (the Idempotency-Key header takes precedence)",
+                    "type": "string",
+                    "example": "6f1c0a52-3e4b-4d8f-9a7e-2b5c8d1e0f93"
+                },
+                "label": {
+                    "description": "Label and Metadata describe what the filter is for; they're returned with the filter but\ndon't affect matching",
+                    "type": "string",
+                    "example": "Launch day mentions"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "options": {
                     "$ref": "#/definitions/models.FilterOptions"
+                },
+                "requireToken": {
+                    "description": "RequireToken makes connections to the filter present a short-lived connect token, returned\nas connectToken, so the filter key alone doesn't grant access to its events",
+                    "type": "boolean",
+                    "example": false
                 }
             }
         },
         "models.CreateFilterResponse": {
             "type": "object",
             "properties": {
+                "connectToken": {
+                    "description": "ConnectToken must be sent when connecting to a filter created with requireToken",
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "connectTokenExpiresAt": {
+                    "type": "string",
+                    "example": "2025-01-01T12:05:00Z"
+                },
                 "createdAt": {
                     "type": "string"
                 },
+                "expiresAt": {
+                    "type": "string"
+                },
                 "filterKey": {
                     "type": "string"
                 },
+                "label": {
+                    "type": "string",
+                    "example": "Launch day mentions"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "options": {
                     "$ref": "#/definitions/models.FilterOptions"
                 }
             }
         },
+        "models.FieldValidation": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Why the option is invalid",
+                    "type": "string",
+                    "example": "Keyword 'hi' must contain at least 3 letters"
+                },
+                "field": {
+                    "description": "JSON name of the option",
+                    "type": "string",
+                    "example": "keyword"
+                },
+                "reason": {
+                    "description": "no_keyword, too_short, invalid_did or invalid_option",
+                    "type": "string",
+                    "example": "too_short"
+                },
+                "valid": {
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
         "models.FilterOptions": {
             "type": "object",
             "properties": {
+                "actions": {
+                    "description": "Actions restricts matching to operations with these actions (empty means all actions)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "create",
+                        "delete"
+                    ]
+                },
+                "caseSensitive": {
+                    "description": "CaseSensitive matches keywords (and regex keywords) with exact case instead of ignoring it",
+                    "type": "boolean",
+                    "example": false
+                },
+                "collections": {
+                    "description": "Collections restricts matching to operations in exactly these collections (empty means all collections)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "app.bsky.feed.like",
+                        "app.bsky.feed.repost"
+                    ]
+                },
+                "deepTextSearch": {
+                    "description": "DeepTextSearch also matches keywords against link cards, quoted records and facets",
+                    "type": "boolean",
+                    "example": false
+                },
+                "embedTypes": {
+                    "description": "EmbedTypes restricts matching to records with one of these embed types (empty means any record)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "app.bsky.embed.images",
+                        "app.bsky.embed.video"
+                    ]
+                },
+                "eventKinds": {
+                    "description": "EventKinds opts in to firehose event kinds beyond commits (empty means commits only)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "commit",
+                        "account"
+                    ]
+                },
+                "includeRawRecord": {
+                    "description": "IncludeRawRecord attaches each op's original DAG-CBOR record block to forwarded events",
+                    "type": "boolean",
+                    "example": false
+                },
                 "keyword": {
                     "description": "Comma-separated list of keywords (e.g., \"hello,world,test\")",
                     "type": "string",
                     "example": "hello,world,test"
                 },
+                "keywordMatchMode": {
+                    "description": "KeywordMatchMode controls how multiple keywords are combined: \"any\" (default) or \"all\"",
+                    "type": "string",
+                    "example": "any"
+                },
+                "keywordRegex": {
+                    "description": "KeywordRegex treats each comma-separated keyword as a regular expression",
+                    "type": "boolean",
+                    "example": false
+                },
+                "langs": {
+                    "description": "Langs restricts matching to records tagged with one of these languages (empty means all languages)",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "en",
+                        "ja"
+                    ]
+                },
+                "matchType": {
+                    "description": "MatchType is how a plain keyword must appear in the text: \"substring\" (default), \"word\" or \"exact-text\"",
+                    "type": "string",
+                    "example": "word"
+                },
+                "maxMessagesPerConnection": {
+                    "description": "MaxMessagesPerConnection closes each WebSocket connection after it was sent this many events (0 means no limit)",
+                    "type": "integer",
+                    "example": 1
+                },
+                "maxTextLength": {
+                    "type": "integer",
+                    "example": 300
+                },
+                "minLinks": {
+                    "description": "MinLinks and MinMentions require at least this many link or mention facets in the record (0 means no minimum)",
+                    "type": "integer",
+                    "example": 1
+                },
+                "minMentions": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "minTextLength": {
+                    "description": "MinTextLength and MaxTextLength bound the record text length in characters (0 means no bound)",
+                    "type": "integer",
+                    "example": 10
+                },
+                "normalizeUnicode": {
+                    "description": "NormalizeUnicode folds compatibility forms and diacritics before matching (\"cafe\" matches \"café\")",
+                    "type": "boolean",
+                    "example": false
+                },
                 "pathPrefix": {
                     "type": "string",
                     "example": "app.bsky.feed.post"
                 },
+                "postType": {
+                    "description": "PostType restricts matching to posts of one kind: \"top\", \"reply\" or \"quote\" (empty means any record)",
+                    "type": "string",
+                    "example": "top"
+                },
+                "replyRootUri": {
+                    "description": "ReplyRootURI restricts matching to one thread: the post with this AT URI and the replies whose reply.root.uri is it",
+                    "type": "string",
+                    "example": "at://did:plc:example123/app.bsky.feed.post/3k2a4b5c6d7e8"
+                },
                 "repository": {
+                    "description": "Comma-separated list of DIDs",
                     "type": "string",
-                    "example": "did:plc:example123"
+                    "example": "did:plc:example123,did:plc:example456"
+                },
+                "repositoryPrefix": {
+                    "description": "RepositoryPrefix matches every repository whose DID starts with it, e.g. all accounts on one did:web domain",
+                    "type": "string",
+                    "example": "did:web:example.com"
+                },
+                "sampleRate": {
+                    "description": "SampleRate forwards only this fraction of matching events, chosen deterministically per event (0 means all)",
+                    "type": "number",
+                    "example": 0.1
+                },
+                "since": {
+                    "description": "Since and Until bound the record's createdAt as RFC3339 timestamps (empty means no bound)",
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "stripNonMatchingOps": {
+                    "description": "StripNonMatchingOps forwards only the ops of a matched commit that match the filter on their own",
+                    "type": "boolean",
+                    "example": false
+                },
+                "textFields": {
+                    "description": "TextFields lists the record fields searched for keywords, overriding the server's default field list",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "text",
+                        "body"
+                    ]
+                },
+                "until": {
+                    "type": "string",
+                    "example": "2025-01-01T00:00:00Z"
+                },
+                "webhookUrl": {
+                    "description": "WebhookURL receives matching enriched events as JSON POSTs, in addition to any WebSocket connections",
+                    "type": "string",
+                    "example": "https://example.com/hooks/bluesky"
+                },
+                "wholeWord": {
+                    "description": "WholeWord only matches keywords that aren't part of a longer word (\"cat\" won't match \"category\")",
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
+        "models.FilterSubscription": {
+            "type": "object",
+            "properties": {
+                "connections": {
+                    "type": "integer"
+                },
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "description": "When the filter is removed regardless of connections",
+                    "type": "string"
+                },
+                "filterKey": {
+                    "type": "string"
+                },
+                "label": {
+                    "description": "Informational label and metadata given when the filter was created",
+                    "type": "string",
+                    "example": "Launch day mentions"
+                },
+                "messagesDelivered": {
+                    "description": "Messages sent to this filter's connections and webhook",
+                    "type": "integer"
+                },
+                "metadata": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "options": {
+                    "$ref": "#/definitions/models.FilterOptions"
+                },
+                "paused": {
+                    "description": "Event delivery is paused; connections stay open",
+                    "type": "boolean"
+                },
+                "repositories": {
+                    "description": "Individual DIDs from Options.Repository",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "requiresToken": {
+                    "description": "Connections must present a connect token",
+                    "type": "boolean"
+                },
+                "webhookDisabled": {
+                    "description": "Webhook paused after too many consecutive failures until its next retry",
+                    "type": "boolean"
                 }
             }
         },
@@ -351,6 +1866,198 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "models.FilterValidationResponse": {
+            "type": "object",
+            "properties": {
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FieldValidation"
+                    }
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.PauseSubscriptionRequest": {
+            "type": "object",
+            "properties": {
+                "paused": {
+                    "description": "true pauses event delivery, false resumes it",
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "models.RecentEvents": {
+            "type": "object",
+            "properties": {
+                "count": {
+                    "description": "Number of events returned",
+                    "type": "integer",
+                    "example": 2
+                },
+                "events": {
+                    "description": "\"event\" and \"delete\" messages, oldest first, as sent over WebSocket",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.WSMessage"
+                    }
+                },
+                "filterKey": {
+                    "type": "string",
+                    "example": "8a3ce5f31b47d4788df91aeb38a565fe"
+                }
+            }
+        },
+        "models.SubscriptionStats": {
+            "type": "object",
+            "properties": {
+                "connections": {
+                    "description": "Clients connected to the filter",
+                    "type": "integer",
+                    "example": 2
+                },
+                "filterKey": {
+                    "type": "string",
+                    "example": "8a3ce5f31b47d4788df91aeb38a565fe"
+                },
+                "lastDeliveredAt": {
+                    "description": "When a message was last forwarded, omitted if none was",
+                    "type": "string"
+                },
+                "messagesDelivered": {
+                    "description": "Messages sent to this filter's connections and webhook",
+                    "type": "integer",
+                    "example": 1523
+                },
+                "rate15m": {
+                    "description": "Messages forwarded per second, averaged over the last 15 minutes",
+                    "type": "number",
+                    "example": 1.2
+                },
+                "rate1m": {
+                    "description": "Messages forwarded per second, averaged over the last minute",
+                    "type": "number",
+                    "example": 2.5
+                },
+                "rate5m": {
+                    "description": "Messages forwarded per second, averaged over the last 5 minutes",
+                    "type": "number",
+                    "example": 1.8
+                }
+            }
+        },
+        "models.TestFilterRequest": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "description": "Defaults to create",
+                    "type": "string",
+                    "example": "create"
+                },
+                "did": {
+                    "description": "Repository DID of the sample event",
+                    "type": "string",
+                    "example": "did:plc:example123"
+                },
+                "options": {
+                    "$ref": "#/definitions/models.FilterOptions"
+                },
+                "path": {
+                    "description": "Defaults to app.bsky.feed.post/test",
+                    "type": "string",
+                    "example": "app.bsky.feed.post/abc123"
+                },
+                "record": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "models.TestFilterResponse": {
+            "type": "object",
+            "properties": {
+                "matched": {
+                    "type": "boolean"
+                },
+                "matchedKeywords": {
+                    "description": "Keywords (or patterns) found in the record, even if the filter didn't match",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.UpdateSubscriptionRequest": {
+            "type": "object",
+            "properties": {
+                "options": {
+                    "$ref": "#/definitions/models.FilterOptions"
+                }
+            }
+        },
+        "models.ValidateFilterRequest": {
+            "type": "object",
+            "properties": {
+                "options": {
+                    "$ref": "#/definitions/models.FilterOptions"
+                }
+            }
+        },
+        "models.VersionResponse": {
+            "type": "object",
+            "properties": {
+                "buildDate": {
+                    "type": "string",
+                    "example": "2025-01-01T12:00:00Z"
+                },
+                "commit": {
+                    "type": "string",
+                    "example": "735f879"
+                },
+                "firehoseUrls": {
+                    "description": "User info is replaced with \"redacted\"",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"
+                    ]
+                },
+                "goVersion": {
+                    "type": "string",
+                    "example": "go1.24.4"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "v1.2.0"
+                }
+            }
+        },
+        "models.WSMessage": {
+            "type": "object",
+            "properties": {
+                "data": {},
+                "timestamp": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "Only enforced when server.auth is enabled. Use the form \"Bearer {api_key}\".",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     },
     "tags": [
@@ -380,7 +2087,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/",
 	Schemes:          []string{},
 	Title:            "AT Protocol PubSub API",
-	Description:      "A real-time AT Protocol firehose filtering and subscription service.\n\n## Overview\nThis API provides filtering and subscription capabilities for the AT Protocol firehose, allowing clients to:\n- Create filtered subscriptions for specific repositories, content types, or keywords (comma-separated)\n- Subscribe to real-time events via WebSocket connections\n- Monitor subscription statistics and health\n\n## Safety Features\n- **Filter Validation**: All filters must specify at least one criteria to prevent forwarding the entire firehose\n- **Enhanced Timestamps**: All forwarded events include detailed timing metadata for observability\n- **Thread Safety**: All operations are thread-safe and tested with race condition detection\n\n## WebSocket Protocol\nConnect to `/ws/{filterKey}` to receive real-time filtered events with ping/pong support.",
+	Description:      "A real-time AT Protocol firehose filtering and subscription service.\n\n## Overview\nThis API provides filtering and subscription capabilities for the AT Protocol firehose, allowing clients to:\n- Create filtered subscriptions for specific repositories, content types, or keywords (comma-separated)\n- Subscribe to real-time events via WebSocket connections\n- Monitor subscription statistics and health\n\n## Safety Features\n- **Filter Validation**: All filters must specify at least one criteria to prevent forwarding the entire firehose\n- **Enhanced Timestamps**: All forwarded events include detailed timing metadata for observability\n- **Thread Safety**: All operations are thread-safe and tested with race condition detection\n\n## WebSocket Protocol\nConnect to `/ws/{filterKey}` to receive real-time filtered events with ping/pong support.\nClients behind proxies that block WebSocket upgrades can use `/sse/{filterKey}` (Server-Sent Events) instead.",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
@@ -1,17 +1,28 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"regexp"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/websocket"
 
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
 	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/subscription"
 )
 
 // @title AT Protocol PubSub API
@@ -31,6 +42,7 @@ import (
 // @description
 // @description ## WebSocket Protocol
 // @description Connect to `/ws/{filterKey}` to receive real-time filtered events with ping/pong support.
+// @description Clients behind proxies that block WebSocket upgrades can use `/sse/{filterKey}` (Server-Sent Events) instead.
 
 // @contact.name AT Protocol PubSub
 // @contact.url https://github.com/JWhist/AT_Proto_PubSub
@@ -41,6 +53,11 @@ import (
 // @host localhost:8080
 // @BasePath /
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Only enforced when server.auth is enabled. Use the form "Bearer {api_key}".
+
 // @tag.name Health
 // @tag.description Server health and status endpoints
 
@@ -67,25 +84,79 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	keywordRequirement := "Keyword filter is required for all subscriptions"
+	if cfg := s.currentConfig(); cfg != nil && !cfg.Server.RequireKeyword {
+		keywordRequirement = "Every subscription needs a keyword, repository or collection filter"
+	}
+
 	response := models.APIResponse{
 		Success: true,
 		Message: "AT Protocol Firehose Filter Server API",
 		Data: map[string]interface{}{
 			"endpoints": []string{
 				"GET /api/status - Get server status",
+				"GET /api/version - Get the build version, commit, build date and Go version",
+				"GET /healthz - Liveness probe",
+				"GET /readyz - Readiness probe (firehose connected and receiving messages)",
 				"GET /api/filters - Get current filters",
 				"POST /api/filters/create - Create new filter subscription",
+				"POST /api/filters/batch - Create several filter subscriptions at once (all or none)",
+				"POST /api/filters/test - Test filter options against a sample record",
+				"POST /api/filters/validate - Check filter options field by field without creating a filter",
+				"DELETE /api/filters/delete/{filterKey} - Delete a filter subscription",
+				"GET /api/subscriptions?limit=&offset=&keyword= - List subscriptions a page at a time",
 				"GET /api/subscriptions/{filterKey} - Get subscription details",
+				"PUT /api/subscriptions/{filterKey} - Update a subscription's filter options",
+				"GET /api/subscriptions/{filterKey}/connections - List a subscription's connected clients",
+				"GET /api/subscriptions/{filterKey}/stats - Get a subscription's delivery totals and 1/5/15 minute rates",
+				"POST /api/subscriptions/{filterKey}/pause - Pause or resume event delivery without dropping connections",
+				"POST /api/subscriptions/{filterKey}/token - Issue a short-lived connect token for /ws and /sse",
+				"GET /api/subscriptions/{filterKey}/recent?limit= - Get the events the filter matched most recently",
+				"DELETE /api/admin/filters/{filterKey} - Force-delete a filter and kick its connections (admin, requires auth)",
+				"DELETE /api/admin/connections?remoteIp=&filterKey= - Kick connections by client IP and/or filter (admin, requires auth)",
 				"GET /api/stats - Get subscription statistics",
+				"GET /api/stats/detailed - Get statistics with per-keyword throughput over the last minute",
+				"GET /api/keywords - List keyword terms across filters by popularity",
+				"GET /sse/{filterKey} - Stream filtered events as Server-Sent Events",
+				"GET /ws/stats - Stream statistics snapshots over WebSocket for dashboards",
+				"GET /ws/tap?rate= - Stream an unfiltered sample of every event (admin, requires auth)",
 			},
 			"filters": map[string]string{
-				"repository": "Filter by repository DID (e.g., 'did:plc:abc123')",
-				"pathPrefix": "Filter by operation path prefix (e.g., 'app.bsky.feed.post')",
-				"keyword":    "Filter by keywords in text content (comma-separated, e.g., 'hello,world,test')",
+				"repository":               "Filter by repository DIDs or handles (comma-separated, e.g., 'did:plc:abc123,alice.bsky.social')",
+				"repositoryPrefix":         "Filter by DID prefix (e.g., 'did:web:example.com' for every account on that domain)",
+				"pathPrefix":               "Filter by operation path prefix (e.g., 'app.bsky.feed.post') or collection glob (e.g., 'app.bsky.feed.*')",
+				"collections":              "Filter by exact collection NSID (e.g., ['app.bsky.feed.like']; empty means all collections)",
+				"keyword":                  "Filter by keywords in text content (comma-separated, e.g., 'hello,world,test')",
+				"keywordMatchMode":         "How multiple keywords are combined: 'any' (default) or 'all'",
+				"keywordRegex":             "Treat each comma-separated keyword as a case-insensitive regular expression",
+				"actions":                  "Filter by operation action (e.g., ['create','delete']; empty means all actions)",
+				"stripNonMatchingOps":      "Forward only the ops that match the filter on their own, not every op in a matched commit",
+				"eventKinds":               "Firehose event kinds to receive (e.g., ['commit','account']; empty means commits only)",
+				"deepTextSearch":           "Also match keywords in link cards, quoted records, facet links and hashtags",
+				"langs":                    "Filter by record languages (e.g., ['en','ja']; 'en' also matches 'en-US')",
+				"embedTypes":               "Filter by embed type (e.g., ['app.bsky.embed.images','app.bsky.embed.video']; records without embeds never match)",
+				"replyRootUri":             "Follow a thread: match the post with this AT URI and replies whose reply.root.uri equals it",
+				"postType":                 "Only match posts of one kind: 'top' (not a reply or quote), 'reply' or 'quote'",
+				"wholeWord":                "Only match whole words, so 'cat' doesn't match 'category'",
+				"matchType":                "How a keyword must appear: 'substring' (default), 'word' or 'exact-text' (a field's entire text)",
+				"caseSensitive":            "Match keywords with exact case, so '$AAPL' doesn't match '$aapl'",
+				"normalizeUnicode":         "Fold diacritics and full-width characters before matching, so 'cafe' matches 'café'",
+				"minTextLength":            "Only match records whose text has at least this many characters (0 means no minimum)",
+				"maxTextLength":            "Only match records whose text has at most this many characters (0 means no maximum)",
+				"minLinks":                 "Only match records with at least this many link facets (0 means no minimum)",
+				"minMentions":              "Only match records with at least this many mention facets (0 means no minimum)",
+				"since":                    "Only match records created at or after this RFC3339 time (e.g., '2024-01-01T00:00:00Z')",
+				"until":                    "Only match records created before this RFC3339 time",
+				"textFields":               "Record fields searched for keywords (e.g., ['text','body']; empty means the server default)",
+				"includeRawRecord":         "Attach each op's original DAG-CBOR record block as base64 'rawRecord' (relay firehose only)",
+				"sampleRate":               "Forward only this fraction (0-1) of matching events, e.g. 0.1; 0 or 1 forwards every event",
+				"maxMessagesPerConnection": "Close each WebSocket connection once it has been sent this many events, e.g. 1 (0 means no limit)",
+				"webhookUrl":               "POST matching events as JSON to this public http(s) URL (paused with backoff after repeated failures)",
 			},
 			"requirements": []string{
-				"Keyword filter is required for all subscriptions",
-				"Each filter field (repository, pathPrefix, keyword) must contain at least 3 letters",
+				keywordRequirement,
+				"Path prefixes must contain at least 3 letters",
+				"Repository entries must be did:plc or did:web DIDs, or handles",
 				"Keywords are comma-separated and each must have at least 3 letters",
 			},
 		},
@@ -100,7 +171,7 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 
 // handleStatus returns the current server status
 // @Summary Server Status
-// @Description Get the current server status and active filters
+// @Description Get the current server status, active filters, the current firehose cursor (last seen sequence number of the first upstream), the rolling firehose lag in seconds and the connection status of each firehose upstream, with credentials in its URL redacted
 // @Tags Health
 // @Accept json
 // @Produce json
@@ -118,8 +189,14 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		Success: true,
 		Message: "Server is running",
 		Data: map[string]interface{}{
-			"status":  "active",
-			"filters": filters,
+			"status":      "active",
+			"filters":     filters,
+			"cursor":      s.firehoseClient.GetCursor(),
+			"lag_seconds": s.firehoseClient.GetLag().Seconds(),
+			// Commit events seen from the firehose since startup, and how many matched the filters above
+			"events_seen":    s.firehoseClient.GetEventsSeen(),
+			"events_matched": s.firehoseClient.GetEventsMatched(),
+			"upstreams":      s.upstreamStatuses(),
 		},
 	}
 
@@ -130,6 +207,80 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// defaultReadinessWindow is used when no firehose readiness window is configured
+const defaultReadinessWindow = 30 * time.Second
+
+// handleHealthz is the liveness probe; it succeeds whenever the server can respond
+// @Summary Liveness Probe
+// @Description Report that the server process is alive. Always returns 200 while the HTTP server is serving.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} models.APIResponse "Server is alive"
+// @Router /healthz [get]
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := models.APIResponse{
+		Success: true,
+		Message: "ok",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleReadyz is the readiness probe; it fails until the firehose is connected and delivering messages
+// @Summary Readiness Probe
+// @Description Report whether the server is ready for traffic: the firehose must be connected and have delivered a message within the configured readiness window (firehose.readiness_window, default 30s).
+// @Tags Health
+// @Produce json
+// @Success 200 {object} models.APIResponse "Server is ready"
+// @Failure 503 {object} models.APIResponse "Firehose not connected or idle"
+// @Router /readyz [get]
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := defaultReadinessWindow
+	if cfg := s.currentConfig(); cfg != nil && cfg.Firehose.ReadinessWindow > 0 {
+		window = cfg.Firehose.ReadinessWindow
+	}
+
+	var response models.APIResponse
+	w.Header().Set("Content-Type", "application/json")
+	if s.firehoseClient == nil {
+		response = models.APIResponse{Success: false, Message: "firehose client not configured"}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		data := map[string]interface{}{
+			"connected": s.firehoseClient.IsConnected(),
+		}
+		if lastMessageAt := s.firehoseClient.LastMessageAt(); !lastMessageAt.IsZero() {
+			data["lastMessageAt"] = lastMessageAt
+		}
+
+		if err := s.firehoseClient.CheckReady(window); err != nil {
+			response = models.APIResponse{Success: false, Message: err.Error(), Data: data}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			response = models.APIResponse{Success: true, Message: "ready", Data: data}
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
 // handleFilters returns the current filter settings
 // @Summary Get Current Filters
 // @Description Retrieve the current global filter settings
@@ -165,56 +316,1312 @@ func (s *Server) handleFilters(w http.ResponseWriter, r *http.Request) {
 // @Tags Filters
 // @Accept json
 // @Produce json
-// @Param request body models.FilterUpdateRequest true "Filter update request"
-// @Success 200 {object} models.APIResponse "Filters updated successfully"
-// @Failure 400 {object} models.APIResponse "Invalid request body"
-// @Router /api/filters/update [post]
-func (s *Server) handleUpdateFilters(w http.ResponseWriter, r *http.Request) {
+// @Param request body models.FilterUpdateRequest true "Filter update request"
+// @Success 200 {object} models.APIResponse "Filters updated successfully"
+// @Failure 400 {object} models.APIResponse "Invalid request body"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled)"
+// @Security BearerAuth
+// @Router /api/filters/update [post]
+func (s *Server) handleUpdateFilters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.FilterUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response := models.APIResponse{
+			Success: false,
+			Message: "Invalid JSON in request body: " + err.Error(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Get current filters
+	currentFilters := s.firehoseClient.GetFilters()
+
+	// Update only the provided fields
+	if req.Repository != nil {
+		currentFilters.Repository = *req.Repository
+	}
+	if req.PathPrefix != nil {
+		currentFilters.PathPrefix = *req.PathPrefix
+	}
+	if req.Keyword != nil {
+		currentFilters.Keyword = *req.Keyword
+	}
+
+	// Apply the updated filters
+	s.firehoseClient.UpdateFilters(currentFilters)
+
+	log.Printf("Filters updated via API: Repository=%s, PathPrefix=%s, Keyword=%s",
+		getFilterString(currentFilters.Repository),
+		getFilterString(currentFilters.PathPrefix),
+		getFilterString(currentFilters.Keyword))
+
+	response := models.APIResponse{
+		Success: true,
+		Message: "Filters updated successfully",
+		Data:    currentFilters,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// getFilterString returns "ALL" if filter is empty, otherwise returns the filter value
+func getFilterString(filter string) string {
+	if filter == "" {
+		return "ALL"
+	}
+	return filter
+}
+
+// handleCreateFilter creates a new filter subscription and returns a filter key
+// @Summary Create Filter Subscription
+// @Description Create a new filter subscription for receiving real-time events. Keyword filter is required and must contain at least 3 letters to prevent forwarding the entire firehose; with server.require_keyword off, a repository, repositoryPrefix or collections filter will do instead. An optional expiresAt removes the filter and closes its connections at that time. An optional label and metadata are stored with the filter for organization and don't affect matching.
+// @Description With an Idempotency-Key header (or idempotencyKey field), retrying the request with the same key and options within server.idempotency_ttl returns the filter created by the first request, with an Idempotent-Replayed: true header, instead of creating a duplicate. Keys are namespaced by API key, or by client IP when auth is disabled.
+// @Description With requireToken set, the response carries a connectToken valid for server.connect_token_ttl (default 5m) that /ws and /sse connections to the filter must present, so a leaked filter key alone doesn't grant access. POST /api/subscriptions/{filterKey}/token issues new ones.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param request body models.CreateFilterRequest true "Filter creation request"
+// @Param Idempotency-Key header string false "Client-chosen unique key (at most 255 characters) that makes retries return the same filter"
+// @Success 200 {object} models.CreateFilterResponse "Filter subscription created successfully"
+// @Failure 400 {object} models.APIResponse "Invalid request - keyword filter required or insufficient letters; data.reason is no_keyword, too_short, invalid_did or invalid_option"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled)"
+// @Failure 409 {object} models.APIResponse "The idempotency key was already used with different options, expiresAt, requireToken, label or metadata"
+// @Failure 500 {object} models.APIResponse "The connect token couldn't be issued (with requireToken)"
+// @Security BearerAuth
+// @Router /api/filters/create [post]
+func (s *Server) handleCreateFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.CreateFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response := models.APIResponse{
+			Success: false,
+			Message: "Invalid JSON in request body: " + err.Error(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Handles are resolved once, here; the filter stores and matches on the DID
+	options, resolveErr := s.resolveRepositoryHandles(r.Context(), req.Options)
+	if resolveErr != "" {
+		metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidDID).Inc()
+		response := models.APIResponse{
+			Success: false,
+			Message: resolveErr,
+			Data:    map[string]string{"reason": subscription.FilterRejectedInvalidDID},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+	req.Options = options
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		idempotencyKey = req.IdempotencyKey
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidOption).Inc()
+		response := models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Idempotency key must be at most %d characters", maxIdempotencyKeyLength),
+			Data:    map[string]string{"reason": subscription.FilterRejectedInvalidOption},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if expiryErr := validateExpiresAt(req.ExpiresAt); expiryErr != "" {
+		metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidOption).Inc()
+		response := models.APIResponse{
+			Success: false,
+			Message: expiryErr,
+			Data:    map[string]string{"reason": subscription.FilterRejectedInvalidOption},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if labelErr := validateLabel(req.Label, req.Metadata); labelErr != "" {
+		metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidOption).Inc()
+		response := models.APIResponse{
+			Success: false,
+			Message: labelErr,
+			Data:    map[string]string{"reason": subscription.FilterRejectedInvalidOption},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The manager validates the options, so the response carries the same reason it logs and counts
+	var result subscription.FilterResult
+	if idempotencyKey == "" {
+		result = s.subscriptions.CreateFilterWithResult(req.Options)
+	} else {
+		var err error
+		result, err = s.subscriptions.CreateFilterIdempotent(s.idempotencyScope(r), idempotencyKey, req)
+		if err != nil {
+			response := models.APIResponse{
+				Success: false,
+				Message: "Idempotency key was already used to create a filter with a different request",
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+				http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	if !result.Success {
+		response := models.APIResponse{
+			Success: false,
+			Message: result.ErrorMessage,
+			Data:    map[string]string{"reason": result.Reason},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := models.CreateFilterResponse{
+		FilterKey: result.FilterKey,
+		Options:   req.Options,
+		CreatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+		Label:     req.Label,
+		Metadata:  req.Metadata,
+	}
+
+	// A retry gets the original filter as it was created, without applying its expiry or label again
+	if result.Reused {
+		if existing, exists := s.subscriptions.GetSubscription(result.FilterKey); exists {
+			response.CreatedAt = existing.CreatedAt
+			response.ExpiresAt = existing.ExpiresAt
+			response.Label = existing.Label
+			response.Metadata = existing.Metadata
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+	} else {
+		s.setFilterExpiry(result.FilterKey, req.ExpiresAt)
+		s.setFilterLabel(result.FilterKey, req.Label, req.Metadata)
+	}
+
+	// A retry gets a fresh token too, since the first response may have been lost
+	if req.RequireToken {
+		if err := s.attachConnectToken(&response); err != nil {
+			writeConnectTokenError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// maxIdempotencyKeyLength bounds the idempotency keys clients may send with filter creation
+const maxIdempotencyKeyLength = 255
+
+// idempotencyScope returns the namespace of a request's idempotency keys, so one client can't
+// replay or block another's: a hash of the API key when auth is enabled, or the client IP otherwise
+func (s *Server) idempotencyScope(r *http.Request) string {
+	if s.authEnabled() {
+		sum := sha256.Sum256([]byte(bearerToken(r)))
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// validateExpiresAt checks that a requested filter expiry, if any, is still in the future
+func validateExpiresAt(expiresAt *time.Time) string {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return fmt.Sprintf("expiresAt %s is not in the future", expiresAt.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// Bounds for the informational label and metadata of a filter
+const (
+	maxLabelLength         = 200 // Characters in a label
+	maxMetadataEntries     = 32  // Key/value pairs in metadata
+	maxMetadataKeyLength   = 64  // Characters in a metadata key
+	maxMetadataValueLength = 512 // Characters in a metadata value
+)
+
+// validateLabel checks a requested filter label and metadata against their bounds
+func validateLabel(label string, metadata map[string]string) string {
+	if utf8.RuneCountInString(label) > maxLabelLength {
+		return fmt.Sprintf("label must be at most %d characters", maxLabelLength)
+	}
+	if len(metadata) > maxMetadataEntries {
+		return fmt.Sprintf("metadata must have at most %d entries", maxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if strings.TrimSpace(key) == "" {
+			return "metadata keys must not be empty"
+		}
+		if utf8.RuneCountInString(key) > maxMetadataKeyLength {
+			return fmt.Sprintf("metadata key %q must be at most %d characters", key, maxMetadataKeyLength)
+		}
+		if utf8.RuneCountInString(value) > maxMetadataValueLength {
+			return fmt.Sprintf("metadata value for %q must be at most %d characters", key, maxMetadataValueLength)
+		}
+	}
+	return ""
+}
+
+// attachConnectToken issues a connect token for a filter created with requireToken, which makes
+// the filter require one from then on
+func (s *Server) attachConnectToken(response *models.CreateFilterResponse) error {
+	token, expiresAt, err := s.subscriptions.IssueConnectToken(response.FilterKey)
+	if err != nil {
+		return err
+	}
+	response.ConnectToken = token
+	response.ConnectTokenExpiresAt = &expiresAt
+	return nil
+}
+
+// writeConnectTokenError reports a connect token that couldn't be issued for a new filter
+func writeConnectTokenError(w http.ResponseWriter, err error) {
+	log.Printf("Failed to issue connect token: %v", err)
+	response := models.APIResponse{
+		Success: false,
+		Message: "Failed to issue connect token",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+		http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+	}
+}
+
+// setFilterExpiry applies a requested expiry to a newly created filter
+func (s *Server) setFilterExpiry(filterKey string, expiresAt *time.Time) {
+	if expiresAt == nil {
+		return
+	}
+	if err := s.subscriptions.SetFilterExpiry(filterKey, *expiresAt); err != nil {
+		log.Printf("Failed to set expiry for filter %s: %v", filterKey[:8]+"...", err)
+	}
+}
+
+// setFilterLabel attaches a newly created filter's label and metadata, if it was given any
+func (s *Server) setFilterLabel(filterKey, label string, metadata map[string]string) {
+	if label == "" && len(metadata) == 0 {
+		return
+	}
+	if err := s.subscriptions.SetFilterLabel(filterKey, label, metadata); err != nil {
+		log.Printf("Failed to set label for filter %s: %v", filterKey[:8]+"...", err)
+	}
+}
+
+// maxBatchFilters bounds how many filters one batch request may create
+const maxBatchFilters = 100
+
+// handleCreateFilters creates several filter subscriptions at once, all or none
+// @Summary Create Filter Subscriptions in Bulk
+// @Description Create up to 100 filter subscriptions in one request. Every entry is validated first, with the same rules as /api/filters/create; if any entry is invalid nothing is created and data lists the rejected entries.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param request body []models.CreateFilterRequest true "Filter creation requests"
+// @Success 200 {array} models.CreateFilterResponse "Filter subscriptions created successfully, in request order"
+// @Failure 400 {object} models.APIResponse{data=[]models.BatchFilterError} "Invalid request or entries; nothing was created"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled)"
+// @Security BearerAuth
+// @Router /api/filters/batch [post]
+func (s *Server) handleCreateFilters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeError := func(message string, data interface{}) {
+		response := models.APIResponse{
+			Success: false,
+			Message: message,
+			Data:    data,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+	}
+
+	var reqs []models.CreateFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		writeError("Invalid JSON in request body: "+err.Error(), nil)
+		return
+	}
+	if len(reqs) == 0 {
+		writeError("At least one filter is required", nil)
+		return
+	}
+	if len(reqs) > maxBatchFilters {
+		writeError(fmt.Sprintf("At most %d filters may be created per batch", maxBatchFilters), nil)
+		return
+	}
+
+	// Resolve every entry's handles before creating anything, as handleCreateFilter does
+	batch := make([]models.FilterOptions, len(reqs))
+	var rejected []models.BatchFilterError
+	for i, req := range reqs {
+		options, resolveErr := s.resolveRepositoryHandles(r.Context(), req.Options)
+		if resolveErr != "" {
+			metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidDID).Inc()
+			rejected = append(rejected, models.BatchFilterError{Index: i, Error: resolveErr, Reason: subscription.FilterRejectedInvalidDID})
+		} else if expiryErr := validateExpiresAt(req.ExpiresAt); expiryErr != "" {
+			metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidOption).Inc()
+			rejected = append(rejected, models.BatchFilterError{Index: i, Error: expiryErr, Reason: subscription.FilterRejectedInvalidOption})
+		} else if labelErr := validateLabel(req.Label, req.Metadata); labelErr != "" {
+			metriks.FiltersRejected.WithLabelValues(subscription.FilterRejectedInvalidOption).Inc()
+			rejected = append(rejected, models.BatchFilterError{Index: i, Error: labelErr, Reason: subscription.FilterRejectedInvalidOption})
+		}
+		batch[i] = options
+	}
+
+	if len(rejected) == 0 {
+		results, ok := s.subscriptions.CreateFilters(batch)
+		if ok {
+			createdAt := time.Now()
+			response := make([]models.CreateFilterResponse, len(results))
+			for i, result := range results {
+				s.setFilterExpiry(result.FilterKey, reqs[i].ExpiresAt)
+				s.setFilterLabel(result.FilterKey, reqs[i].Label, reqs[i].Metadata)
+				response[i] = models.CreateFilterResponse{
+					FilterKey: result.FilterKey,
+					Options:   batch[i],
+					CreatedAt: createdAt,
+					ExpiresAt: reqs[i].ExpiresAt,
+					Label:     reqs[i].Label,
+					Metadata:  reqs[i].Metadata,
+				}
+				if reqs[i].RequireToken {
+					if err := s.attachConnectToken(&response[i]); err != nil {
+						writeConnectTokenError(w, err)
+						return
+					}
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(response); err != nil {
+				http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			}
+			return
+		}
+		for i, result := range results {
+			if result.ErrorMessage != "" {
+				rejected = append(rejected, models.BatchFilterError{Index: i, Error: result.ErrorMessage, Reason: result.Reason})
+			}
+		}
+	}
+
+	writeError(fmt.Sprintf("%d of %d filters are invalid; none were created", len(rejected), len(reqs)), rejected)
+}
+
+// handleTestFilter evaluates a sample record against filter options without creating a subscription
+// @Summary Test Filter
+// @Description Check whether a sample record would match the given filter options and which keywords hit. No subscription is created.
+// @Tags Filters
+// @Accept json
+// @Produce json
+// @Param request body models.TestFilterRequest true "Filter options and sample record"
+// @Success 200 {object} models.TestFilterResponse "Filter evaluated"
+// @Failure 400 {object} models.APIResponse "Invalid request - keyword filter required, invalid options or missing record"
+// @Router /api/filters/test [post]
+func (s *Server) handleTestFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeError := func(message string) {
+		response := models.APIResponse{
+			Success: false,
+			Message: message,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+	}
+
+	var req models.TestFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError("Invalid JSON in request body: " + err.Error())
+		return
+	}
+
+	// Apply the same validation as filter creation
+	if criteriaErr := s.subscriptions.CheckRequiredCriteria(req.Options); criteriaErr != "" {
+		writeError(criteriaErr)
+		return
+	}
+	if _, validationErr := subscription.ValidateFilterContent(req.Options); validationErr != "" {
+		writeError(validationErr)
+		return
+	}
+	options, resolveErr := s.resolveRepositoryHandles(r.Context(), req.Options)
+	if resolveErr != "" {
+		writeError(resolveErr)
+		return
+	}
+	req.Options = options
+	if req.Record == nil {
+		writeError("Sample record is required")
+		return
+	}
+
+	if req.Path == "" {
+		req.Path = "app.bsky.feed.post/test"
+	}
+	if req.Action == "" {
+		req.Action = models.ActionCreate
+	}
+
+	collection, rkey, _ := strings.Cut(req.Path, "/")
+	event := &models.ATEvent{
+		Did:  req.Did,
+		Time: time.Now().UTC().Format(time.RFC3339),
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{{
+			Action:     req.Action,
+			Path:       req.Path,
+			Collection: collection,
+			Rkey:       rkey,
+			Record:     req.Record,
+		}},
+	}
+
+	matched, matchedKeywords, err := s.subscriptions.EvaluateFilter(req.Options, event)
+	if err != nil {
+		writeError(err.Error())
+		return
+	}
+	if matchedKeywords == nil {
+		matchedKeywords = []string{}
+	}
+
+	response := models.TestFilterResponse{
+		Matched:         matched,
+		MatchedKeywords: matchedKeywords,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleValidateFilter checks filter options without creating a subscription
+// @Summary Validate Filter
+// @Description Run every check filter creation applies, including resolving handles in the repository option, and report the validity of each option with its specific error and rejection reason. Invalid options still return 200 with valid set to false. No subscription is created.
+// @Tags Filters
+// @Accept json
+// @Produce json
+// @Param request body models.ValidateFilterRequest true "Filter options to validate"
+// @Success 200 {object} models.FilterValidationResponse "Options validated"
+// @Failure 400 {object} models.APIResponse "Invalid JSON in request body"
+// @Router /api/filters/validate [post]
+func (s *Server) handleValidateFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.ValidateFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response := models.APIResponse{
+			Success: false,
+			Message: "Invalid JSON in request body: " + err.Error(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := s.subscriptions.ValidateFilterFields(req.Options)
+
+	// Handles only count as valid if they resolve, as they must when the filter is created
+	for i, field := range response.Fields {
+		if field.Field != "repository" || !field.Valid {
+			continue
+		}
+		if _, resolveErr := s.resolveRepositoryHandles(r.Context(), req.Options); resolveErr != "" {
+			response.Fields[i] = models.FieldValidation{
+				Field:  field.Field,
+				Error:  resolveErr,
+				Reason: subscription.FilterRejectedInvalidDID,
+			}
+			response.Valid = false
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDeleteFilter removes a filter subscription and closes its connections
+// @Summary Delete Filter Subscription
+// @Description Delete a filter subscription by key. All WebSocket connections subscribed to the filter are closed. When API key auth is disabled, filters created with requireToken also need a connect token, as ?token= or X-Connect-Token.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse "Filter subscription deleted successfully"
+// @Failure 400 {object} models.APIResponse "Filter key required"
+// @Failure 404 {object} models.APIResponse "Filter subscription not found"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled), or connect token"
+// @Security BearerAuth
+// @Router /api/filters/delete/{filterKey} [delete]
+func (s *Server) handleDeleteFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract filter key from URL path
+	filterKey := strings.TrimPrefix(r.URL.Path, "/api/filters/delete/")
+	if filterKey != "" && !s.authorizeFilterChange(w, r, filterKey) {
+		return
+	}
+
+	var response models.APIResponse
+	w.Header().Set("Content-Type", "application/json")
+	if filterKey == "" {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter key required",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	} else if closedConnections, exists := s.subscriptions.DeleteFilter(filterKey); exists {
+		response = models.APIResponse{
+			Success: true,
+			Message: "Filter subscription deleted successfully",
+			Data: map[string]interface{}{
+				"filterKey":         filterKey,
+				"closedConnections": closedConnections,
+			},
+		}
+	} else {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminDeleteFilter force-deletes a filter subscription, kicking all of its connections
+// @Summary Force-Delete Filter Subscription (admin)
+// @Description Delete a filter subscription and close every WebSocket connection subscribed to it, including connections also subscribed to other filters, with a policy-violation (1008) close frame. Only available when API key auth is enabled.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Success 200 {object} models.APIResponse "Filter subscription force-deleted"
+// @Failure 400 {object} models.APIResponse "Filter key required"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key"
+// @Failure 403 {object} models.APIResponse "API key auth is not enabled"
+// @Failure 404 {object} models.APIResponse "Filter subscription not found"
+// @Security BearerAuth
+// @Router /api/admin/filters/{filterKey} [delete]
+func (s *Server) handleAdminDeleteFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filterKey := strings.TrimPrefix(r.URL.Path, "/api/admin/filters/")
+
+	var response models.APIResponse
+	w.Header().Set("Content-Type", "application/json")
+	if filterKey == "" {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter key required",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	} else if closedConnections, exists := s.subscriptions.ForceDeleteFilter(filterKey); exists {
+		log.Printf("🛑 Admin force-deleted filter %s, closed %d connection(s) (requested by %s)", filterKey, closedConnections, r.RemoteAddr)
+		response = models.APIResponse{
+			Success: true,
+			Message: "Filter subscription force-deleted",
+			Data: map[string]interface{}{
+				"filterKey":         filterKey,
+				"closedConnections": closedConnections,
+			},
+		}
+	} else {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminCloseConnections kicks the connections matching the query criteria
+// @Summary Close Connections (admin)
+// @Description Close every WebSocket connection matching all given criteria with a policy-violation (1008) close frame, removing it from all of its filters. At least one criterion is required. Only available when API key auth is enabled.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param remoteIp query string false "Close connections from this client IP address"
+// @Param filterKey query string false "Close connections subscribed to this filter"
+// @Success 200 {object} models.APIResponse "Connections closed"
+// @Failure 400 {object} models.APIResponse "Missing or invalid criteria"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key"
+// @Failure 403 {object} models.APIResponse "API key auth is not enabled"
+// @Security BearerAuth
+// @Router /api/admin/connections [delete]
+func (s *Server) handleAdminCloseConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	criteria := subscription.ConnectionCriteria{
+		FilterKey: strings.TrimSpace(query.Get("filterKey")),
+		RemoteIP:  strings.TrimSpace(query.Get("remoteIp")),
+	}
+
+	var response models.APIResponse
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case criteria.FilterKey == "" && criteria.RemoteIP == "":
+		response = models.APIResponse{
+			Success: false,
+			Message: "At least one of remoteIp or filterKey is required",
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	case criteria.RemoteIP != "" && net.ParseIP(criteria.RemoteIP) == nil:
+		response = models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Invalid remoteIp: %s", criteria.RemoteIP),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		closedConnections := s.subscriptions.CloseConnections(criteria)
+		log.Printf("🛑 Admin closed %d connection(s) matching remoteIp=%q filterKey=%q (requested by %s)", closedConnections, criteria.RemoteIP, criteria.FilterKey, r.RemoteAddr)
+		response = models.APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Closed %d connection(s)", closedConnections),
+			Data: map[string]interface{}{
+				"remoteIp":          criteria.RemoteIP,
+				"filterKey":         criteria.FilterKey,
+				"closedConnections": closedConnections,
+			},
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Page sizes for the subscription list, when paging is asked for
+const (
+	defaultSubscriptionsLimit = 100
+	maxSubscriptionsLimit     = 1000
+)
+
+// handleGetSubscriptions returns the filter subscriptions, or a page of them when limit or offset is given
+// @Summary Get All Subscriptions
+// @Description Retrieve active filter subscriptions, oldest first. Without limit or offset the response data is the array of all matching subscriptions; with either, it is a page object holding the page and the total number of matching subscriptions. Filters created with requireToken are only listed when the request carries a valid API key.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param limit query int false "Maximum subscriptions returned (default 100, max 1000)"
+// @Param offset query int false "Matching subscriptions to skip"
+// @Param keyword query string false "Only subscriptions whose keyword option contains this text (case-insensitive)"
+// @Success 200 {object} models.APIResponse{data=[]models.FilterSubscription} "Subscriptions retrieved successfully (data is a models.SubscriptionPage when paging)"
+// @Failure 400 {object} models.APIResponse "Invalid limit or offset"
+// @Router /api/subscriptions [get]
+func (s *Server) handleGetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	// Paging is opt-in, so clients written against the plain array keep working
+	paged := query.Has("limit") || query.Has("offset")
+	limit, err := queryInt(query, "limit", defaultSubscriptionsLimit)
+	if err == nil && (limit < 1 || limit > maxSubscriptionsLimit) {
+		err = fmt.Errorf("limit must be between 1 and %d", maxSubscriptionsLimit)
+	}
+	var offset int
+	if err == nil {
+		offset, err = queryInt(query, "offset", 0)
+	}
+	if err == nil && offset < 0 {
+		err = errors.New("offset must not be negative")
+	}
+
+	var response models.APIResponse
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		response = models.APIResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		listQuery := subscription.SubscriptionQuery{
+			Keyword: strings.TrimSpace(query.Get("keyword")),
+			// Filters created with requireToken are only listed to API key holders
+			HideTokenFilters: !s.authEnabled() || !s.validAPIKey(bearerToken(r)),
+		}
+		if paged {
+			listQuery.Offset, listQuery.Limit = offset, limit
+		}
+		subscriptions, total := s.subscriptions.ListSubscriptions(listQuery)
+		response = models.APIResponse{
+			Success: true,
+			Message: "Filter subscriptions retrieved successfully",
+			Data:    subscriptions,
+		}
+		if paged {
+			response.Data = models.SubscriptionPage{
+				Subscriptions: subscriptions,
+				Total:         total,
+				Offset:        offset,
+				Limit:         limit,
+			}
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// queryInt parses an integer query parameter, returning fallback when it is absent
+func queryInt(query url.Values, name string, fallback int) (int, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	return value, nil
+}
+
+// handleGetSubscription returns a specific filter subscription
+// @Summary Get Subscription Details
+// @Description Get detailed information about a specific filter subscription. Filters created with requireToken also need a connect token, as ?token= or X-Connect-Token, or a valid API key.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse "Subscription details retrieved successfully"
+// @Failure 401 {object} models.APIResponse "Invalid or missing connect token"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey} [get]
+func (s *Server) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract filter key from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/api/subscriptions/")
+	if path == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	subscription, exists := s.subscriptions.GetSubscription(path)
+
+	var response models.APIResponse
+	if exists {
+		response = models.APIResponse{
+			Success: true,
+			Message: "Filter subscription retrieved successfully",
+			Data:    subscription,
+		}
+	} else {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleSubscription routes requests for a single filter subscription by method
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	// A filter that requires a connect token to connect requires it, or an API key, to read its
+	// details and recent events too
+	filterKey, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/")
+	if r.Method == http.MethodGet && !strings.HasSuffix(r.URL.Path, "/token") {
+		if !s.authorizeFilterRead(w, r, filterKey) {
+			return
+		}
+	}
+	// ...and to change or pause it
+	if r.Method == http.MethodPut || (r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/pause")) {
+		if !s.authorizeFilterChange(w, r, filterKey) {
+			return
+		}
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/connections") {
+		s.handleSubscriptionConnections(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/stats") {
+		s.handleSubscriptionStats(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/pause") {
+		s.handlePauseSubscription(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/token") {
+		s.handleConnectToken(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/recent") {
+		s.handleRecentEvents(w, r)
+		return
+	}
+	if r.Method == http.MethodPut {
+		s.handleUpdateSubscription(w, r)
+		return
+	}
+	s.handleGetSubscription(w, r)
+}
+
+// handleSubscriptionConnections lists the clients connected to a filter subscription
+// @Summary List Subscription Connections
+// @Description List each client connected to a filter subscription with its remote address and connection time, oldest first. When API key auth is enabled a valid key is required; otherwise remote addresses are omitted, and filters created with requireToken need a connect token, as ?token= or X-Connect-Token.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse "Connections retrieved successfully"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled), or connect token"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey}/connections [get]
+func (s *Server) handleSubscriptionConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Client addresses are personal data, so they need a key whenever auth is configured
+	if s.authEnabled() && !s.validAPIKey(bearerToken(r)) {
+		writeUnauthorized(w)
+		return
+	}
+
+	filterKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/connections")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	connections, exists := s.subscriptions.GetConnections(filterKey)
+
+	var response models.APIResponse
+	if exists {
+		message := "Connections retrieved successfully"
+		if !s.authEnabled() {
+			// Without auth anyone can call this endpoint, so don't expose client addresses
+			for i := range connections {
+				connections[i].RemoteAddr = ""
+			}
+			message += " (remote addresses are only shown when API key auth is enabled)"
+		}
+		response = models.APIResponse{
+			Success: true,
+			Message: message,
+			Data:    connections,
+		}
+	} else {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleSubscriptionStats returns a filter subscription's throughput
+// @Summary Subscription Statistics
+// @Description Get one filter's throughput: the total messages delivered to its connections and webhook, the messages forwarded per second averaged over the last 1, 5 and 15 minutes, when a message was last forwarded and how many clients are connected. Filters created with requireToken also need a connect token, as ?token= or X-Connect-Token, or a valid API key.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse{data=models.SubscriptionStats} "Subscription statistics retrieved successfully"
+// @Failure 401 {object} models.APIResponse "Invalid or missing connect token"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey}/stats [get]
+func (s *Server) handleSubscriptionStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filterKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/stats")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	stats, exists := s.subscriptions.GetSubscriptionStats(filterKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	var response models.APIResponse
+	if exists {
+		response = models.APIResponse{
+			Success: true,
+			Message: "Subscription statistics retrieved successfully",
+			Data:    stats,
+		}
+	} else {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Limits on the events returned by the recent events endpoint
+const (
+	defaultRecentEventsLimit = 50
+	maxRecentEventsLimit     = 1000
+)
+
+// handleRecentEvents returns the events a filter matched most recently
+// @Summary Recent Subscription Events
+// @Description Get the events a filter matched most recently, oldest first, for clients that poll instead of holding a WebSocket open. Events come from the filter's replay buffer (server.replay_buffer_size, default 100), so at most that many are available and none when replay is disabled; events are buffered while nobody is connected too. Polling counts as activity, so a filter without connections isn't cleaned up while it is polled at least every 10 minutes. Filters created with requireToken also need a connect token, as ?token= or X-Connect-Token, or a valid API key.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param limit query int false "Maximum number of events to return (1-1000, default 50)"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse{data=models.RecentEvents} "Recent events retrieved successfully"
+// @Failure 400 {object} models.APIResponse "Invalid limit"
+// @Failure 401 {object} models.APIResponse "Invalid or missing connect token"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey}/recent [get]
+func (s *Server) handleRecentEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filterKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/recent")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(r.URL.Query(), "limit", defaultRecentEventsLimit)
+	if err == nil && (limit < 1 || limit > maxRecentEventsLimit) {
+		err = fmt.Errorf("limit must be between 1 and %d", maxRecentEventsLimit)
+	}
+
+	var response models.APIResponse
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		response = models.APIResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	} else if events, err := s.subscriptions.RecentEvents(filterKey, limit); err != nil {
+		response = models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		if events == nil {
+			events = []models.WSMessage{} // Replay disabled; still an empty list rather than null
+		}
+		response = models.APIResponse{
+			Success: true,
+			Message: "Recent events retrieved successfully",
+			Data:    models.RecentEvents{FilterKey: filterKey, Count: len(events), Events: events},
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handlePauseSubscription pauses or resumes event delivery to a filter subscription
+// @Summary Pause or Resume Subscription
+// @Description Temporarily stop (paused=true) or restart (paused=false) event delivery to a filter subscription without dropping the filter or its connections. Connected clients receive a paused or resumed message when the state changes. Events matched while paused are not delivered, buffered for replay or sent to the webhook. A paused filter is kept while it still has connections. When API key auth is disabled, filters created with requireToken also need a connect token, as ?token= or X-Connect-Token.
+// @Tags Subscriptions
+// @Accept json
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param request body models.PauseSubscriptionRequest true "Whether to pause or resume delivery"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse{data=models.FilterSubscription} "Subscription paused or resumed"
+// @Failure 400 {object} models.APIResponse "Invalid JSON in request body"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled), or connect token"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey}/pause [post]
+func (s *Server) handlePauseSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filterKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/pause")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	var req models.PauseSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response := models.APIResponse{
+			Success: false,
+			Message: "Invalid JSON in request body: " + err.Error(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	updated, err := s.subscriptions.SetSubscriptionPaused(filterKey, req.Paused)
+	if err != nil {
+		response := models.APIResponse{
+			Success: false,
+			Message: "Filter subscription not found",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	message := "Filter subscription resumed"
+	if req.Paused {
+		message = "Filter subscription paused"
+	}
+	response := models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    updated,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleConnectToken issues a new connect token for a filter subscription
+// @Summary Issue Connect Token
+// @Description Issue a new connect token for a filter created with requireToken, valid for server.connect_token_ttl (default 5m), e.g. for reconnecting after the one returned at creation expired. Other filters are refused with 403. When API key auth is enabled a valid key is required; otherwise the request must carry a current connect token as ?token= or X-Connect-Token, so the filter key alone can't mint one.
+// @Tags Subscriptions
+// @Produce json
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param token query string false "A current connect token, when API key auth is disabled"
+// @Param X-Connect-Token header string false "A current connect token, when API key auth is disabled"
+// @Success 200 {object} models.APIResponse{data=models.ConnectTokenResponse} "Connect token issued"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key or connect token"
+// @Failure 403 {object} models.APIResponse "Filter wasn't created with requireToken"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey}/token [post]
+func (s *Server) handleConnectToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req models.FilterUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	filterKey := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/subscriptions/"), "/token")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	// Only filters created with requireToken get new tokens, so the filter key alone can't lock
+	// others out of an open filter
+	if existing, exists := s.subscriptions.GetSubscription(filterKey); exists && !existing.RequiresToken {
 		response := models.APIResponse{
 			Success: false,
-			Message: "Invalid JSON in request body: " + err.Error(),
+			Message: "Filter subscription wasn't created with requireToken",
 		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusForbidden)
 		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
 			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	// Get current filters
-	currentFilters := s.firehoseClient.GetFilters()
-
-	// Update only the provided fields
-	if req.Repository != nil {
-		currentFilters.Repository = *req.Repository
-	}
-	if req.PathPrefix != nil {
-		currentFilters.PathPrefix = *req.PathPrefix
-	}
-	if req.Keyword != nil {
-		currentFilters.Keyword = *req.Keyword
+	// authMiddleware has already checked the API key; without one, only a holder of a current
+	// token may extend access
+	if !s.authEnabled() {
+		token := r.Header.Get("X-Connect-Token")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if err := s.subscriptions.ValidateConnectToken(filterKey, token); err != nil {
+			response := models.APIResponse{
+				Success: false,
+				Message: "Invalid or expired connect token",
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+				http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+			}
+			return
+		}
 	}
 
-	// Apply the updated filters
-	s.firehoseClient.UpdateFilters(currentFilters)
-
-	fmt.Printf("Filters updated via API: Repository=%s, PathPrefix=%s, Keyword=%s\n",
-		getFilterString(currentFilters.Repository),
-		getFilterString(currentFilters.PathPrefix),
-		getFilterString(currentFilters.Keyword))
+	token, expiresAt, err := s.subscriptions.IssueConnectToken(filterKey)
+	if err != nil {
+		status, message := http.StatusInternalServerError, "Failed to issue connect token"
+		if errors.Is(err, subscription.ErrSubscriptionNotFound) {
+			status, message = http.StatusNotFound, "Filter subscription not found"
+		}
+		response := models.APIResponse{
+			Success: false,
+			Message: message,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
+			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
+		}
+		return
+	}
 
 	response := models.APIResponse{
 		Success: true,
-		Message: "Filters updated successfully",
-		Data:    currentFilters,
+		Message: "Connect token issued",
+		Data: models.ConnectTokenResponse{
+			FilterKey: filterKey,
+			Token:     token,
+			ExpiresAt: expiresAt,
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -224,49 +1631,41 @@ func (s *Server) handleUpdateFilters(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getFilterString returns "ALL" if filter is empty, otherwise returns the filter value
-func getFilterString(filter string) string {
-	if filter == "" {
-		return "ALL"
-	}
-	return filter
-}
-
-// handleCreateFilter creates a new filter subscription and returns a filter key
-// @Summary Create Filter Subscription
-// @Description Create a new filter subscription for receiving real-time events. Keyword filter is required and must contain at least 3 letters to prevent forwarding the entire firehose.
+// handleUpdateSubscription replaces the filter options of an existing subscription
+// @Summary Update Subscription Filter
+// @Description Replace the filter options of an existing subscription without dropping its connections. Connected clients receive a filter_updated message. The same validation as filter creation applies. When API key auth is disabled, filters created with requireToken also need a connect token, as ?token= or X-Connect-Token.
 // @Tags Subscriptions
 // @Accept json
 // @Produce json
-// @Param request body models.CreateFilterRequest true "Filter creation request"
-// @Success 200 {object} models.CreateFilterResponse "Filter subscription created successfully"
-// @Failure 400 {object} models.APIResponse "Invalid request - keyword filter required or insufficient letters"
-// @Router /api/filters/create [post]
-func (s *Server) handleCreateFilter(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// @Param filterKey path string true "The unique filter key for the subscription"
+// @Param request body models.UpdateSubscriptionRequest true "New filter options"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Param X-Connect-Token header string false "Connect token, when the filter was created with requireToken"
+// @Success 200 {object} models.APIResponse "Subscription updated successfully"
+// @Failure 400 {object} models.APIResponse "Invalid request - keyword filter required or invalid options"
+// @Failure 404 {object} models.APIResponse "Subscription not found"
+// @Failure 410 {object} models.APIResponse "Filter has passed its expiresAt"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth is enabled), or connect token"
+// @Security BearerAuth
+// @Router /api/subscriptions/{filterKey} [put]
+func (s *Server) handleUpdateSubscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req models.CreateFilterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response := models.APIResponse{
-			Success: false,
-			Message: "Invalid JSON in request body: " + err.Error(),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
-			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
-		}
+	// Extract filter key from URL path
+	filterKey := strings.TrimPrefix(r.URL.Path, "/api/subscriptions/")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
 		return
 	}
 
-	// Validate that keyword filter is always provided
-	if req.Options.Keyword == "" {
+	var req models.UpdateSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response := models.APIResponse{
 			Success: false,
-			Message: "Keyword filter is required. Filters must include keywords to prevent forwarding the entire firehose.",
+			Message: "Invalid JSON in request body: " + err.Error(),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -276,11 +1675,11 @@ func (s *Server) handleCreateFilter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate filter content - each non-empty field must contain at least 3 letters
-	if validationErr := validateFilterContent(req.Options); validationErr != "" {
+	options, resolveErr := s.resolveRepositoryHandles(r.Context(), req.Options)
+	if resolveErr != "" {
 		response := models.APIResponse{
 			Success: false,
-			Message: validationErr,
+			Message: resolveErr,
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -290,24 +1689,31 @@ func (s *Server) handleCreateFilter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filterKey := s.subscriptions.CreateFilter(req.Options)
-	if filterKey == "" {
+	updated, err := s.subscriptions.UpdateSubscriptionOptions(filterKey, options)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, subscription.ErrSubscriptionNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, subscription.ErrFilterExpired):
+			status = http.StatusGone
+		}
 		response := models.APIResponse{
 			Success: false,
-			Message: "Failed to create filter - no criteria provided",
+			Message: err.Error(),
 		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(status)
 		if encErr := json.NewEncoder(w).Encode(response); encErr != nil {
 			http.Error(w, "Failed to encode error response", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	response := models.CreateFilterResponse{
-		FilterKey: filterKey,
-		Options:   req.Options,
-		CreatedAt: time.Now(),
+	response := models.APIResponse{
+		Success: true,
+		Message: "Filter subscription updated successfully",
+		Data:    updated,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -317,26 +1723,26 @@ func (s *Server) handleCreateFilter(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleGetSubscriptions returns all filter subscriptions
-// @Summary Get All Subscriptions
-// @Description Retrieve all active filter subscriptions
+// handleStats returns subscription manager statistics
+// @Summary Get Statistics
+// @Description Get subscription manager statistics and metrics
 // @Tags Subscriptions
 // @Accept json
 // @Produce json
-// @Success 200 {object} models.APIResponse "Subscriptions retrieved successfully"
-// @Router /api/subscriptions [get]
-func (s *Server) handleGetSubscriptions(w http.ResponseWriter, r *http.Request) {
+// @Success 200 {object} models.APIResponse "Statistics retrieved successfully"
+// @Router /api/stats [get]
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	subscriptions := s.subscriptions.GetSubscriptions()
+	stats := s.subscriptions.GetStats()
 
 	response := models.APIResponse{
 		Success: true,
-		Message: "Filter subscriptions retrieved successfully",
-		Data:    subscriptions,
+		Message: "Statistics retrieved successfully",
+		Data:    stats,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -346,44 +1752,28 @@ func (s *Server) handleGetSubscriptions(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// handleGetSubscription returns a specific filter subscription
-// @Summary Get Subscription Details
-// @Description Get detailed information about a specific filter subscription
+// handleDetailedStats returns the statistics snapshot with per-keyword throughput
+// @Summary Get Detailed Statistics
+// @Description Get subscription manager statistics plus the messages sent per keyword over the last minute and the resulting rate, busiest keywords first. Meant for dashboards that can't query Prometheus.
 // @Tags Subscriptions
-// @Accept json
 // @Produce json
-// @Param filterKey path string true "The unique filter key for the subscription"
-// @Success 200 {object} models.APIResponse "Subscription details retrieved successfully"
-// @Failure 404 {object} models.APIResponse "Subscription not found"
-// @Router /api/subscriptions/{filterKey} [get]
-func (s *Server) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
+// @Success 200 {object} models.APIResponse "Detailed statistics retrieved successfully"
+// @Router /api/stats/detailed [get]
+func (s *Server) handleDetailedStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Extract filter key from URL path
-	path := strings.TrimPrefix(r.URL.Path, "/api/subscriptions/")
-	if path == "" {
-		http.Error(w, "Filter key required", http.StatusBadRequest)
-		return
-	}
-
-	subscription, exists := s.subscriptions.GetSubscription(path)
-
-	var response models.APIResponse
-	if exists {
-		response = models.APIResponse{
-			Success: true,
-			Message: "Filter subscription retrieved successfully",
-			Data:    subscription,
-		}
-	} else {
-		response = models.APIResponse{
-			Success: false,
-			Message: "Filter subscription not found",
-		}
-		w.WriteHeader(http.StatusNotFound)
+	response := models.APIResponse{
+		Success: true,
+		Message: "Detailed statistics retrieved successfully",
+		Data: models.DetailedStats{
+			Stats:         s.subscriptions.GetStats(),
+			WindowSeconds: subscription.KeywordRateWindowSeconds,
+			Keywords:      s.subscriptions.GetKeywordThroughput(),
+			GeneratedAt:   time.Now().UTC(),
+		},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -393,26 +1783,23 @@ func (s *Server) handleGetSubscription(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleStats returns subscription manager statistics
-// @Summary Get Statistics
-// @Description Get subscription manager statistics and metrics
+// handleKeywords returns the keyword terms used across all filter subscriptions
+// @Summary List Active Keywords
+// @Description Get every keyword term configured across filter subscriptions with the number of filters using it, sorted by popularity. Plain keywords are lowercased; regex patterns are listed as written.
 // @Tags Subscriptions
-// @Accept json
 // @Produce json
-// @Success 200 {object} models.APIResponse "Statistics retrieved successfully"
-// @Router /api/stats [get]
-func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+// @Success 200 {object} models.APIResponse "Keywords retrieved successfully"
+// @Router /api/keywords [get]
+func (s *Server) handleKeywords(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	stats := s.subscriptions.GetStats()
-
 	response := models.APIResponse{
 		Success: true,
-		Message: "Statistics retrieved successfully",
-		Data:    stats,
+		Message: "Keywords retrieved successfully",
+		Data:    s.subscriptions.GetKeywordUsage(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -422,13 +1809,92 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// wsConnection is a client WebSocket and the encoding it asked for. Events are written in that
+// encoding by the subscription manager; replies to client messages are always JSON.
+// Both write from different goroutines, so data frames and write deadlines are serialized here
+type wsConnection struct {
+	*websocket.Conn
+	msgpack atomic.Bool
+	writeMu sync.Mutex
+}
+
+// newWSConnection wraps conn, starting with the given encoding
+func newWSConnection(conn *websocket.Conn, encoding string) *wsConnection {
+	client := &wsConnection{Conn: conn}
+	client.setEncoding(encoding)
+	return client
+}
+
+// MessageEncoding reports the encoding events should be sent in
+func (c *wsConnection) MessageEncoding() string {
+	if c.msgpack.Load() {
+		return subscription.EncodingMsgpack
+	}
+	return subscription.EncodingJSON
+}
+
+// WriteJSON writes a JSON text frame
+func (c *wsConnection) WriteJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+// WriteMessage writes a single frame of the given type
+func (c *wsConnection) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// SetWriteDeadline sets the deadline for the next write. The manager's writer and the replies to
+// client messages both set it before writing, so it is serialized with the writes.
+func (c *wsConnection) SetWriteDeadline(t time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// writeJSONWithDeadline writes a JSON text frame with a fresh write deadline, holding the write
+// lock across both so another goroutine can't move the deadline in between
+func (c *wsConnection) writeJSONWithDeadline(v interface{}, writeWait time.Duration) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return c.Conn.WriteJSON(v)
+}
+
+// setEncoding switches the encoding used for subsequent events
+func (c *wsConnection) setEncoding(encoding string) {
+	c.msgpack.Store(encoding == subscription.EncodingMsgpack)
+}
+
+// parseMessageEncoding maps a format parameter to an encoding; empty means JSON
+func parseMessageEncoding(format string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", subscription.EncodingJSON:
+		return subscription.EncodingJSON, true
+	case subscription.EncodingMsgpack:
+		return subscription.EncodingMsgpack, true
+	}
+	return "", false
+}
+
 // handleWebSocket handles WebSocket upgrade and message routing
 // @Summary WebSocket Connection
 // @Description Establish a WebSocket connection to receive real-time filtered events. Connect to /ws/{filterKey} with the filter key obtained from creating a subscription.
+// @Description Events are JSON text frames by default; with format=msgpack they are MessagePack binary frames with the same fields.
+// @Description Filters created with requireToken also need a connect token, as ?token= or a "token.<token>" subprotocol (Sec-WebSocket-Protocol), which the server then selects.
 // @Tags WebSocket
 // @Param filterKey path string true "The unique filter key obtained from creating a subscription"
+// @Param format query string false "Event encoding: json (default) or msgpack"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
 // @Success 101 "WebSocket connection established"
-// @Failure 400 "Filter key required or invalid"
+// @Failure 400 "Filter key required or invalid, or unsupported format"
+// @Param api_key query string false "API key, when auth.require_for_streams is enabled"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth.require_for_streams is enabled), or invalid or expired connect token"
 // @Failure 404 "Invalid filter key"
 // @Router /ws/{filterKey} [get]
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -439,20 +1905,49 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.authorizeStream(r) {
+		writeUnauthorized(w)
+		return
+	}
+
+	encoding, ok := parseMessageEncoding(r.URL.Query().Get("format"))
+	if !ok {
+		http.Error(w, "Unsupported format, must be json or msgpack", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorizeConnectToken(w, r, path) {
+		return
+	}
+
+	// A token sent as a subprotocol must be selected, or browsers fail the handshake
+	var responseHeader http.Header
+	if _, subprotocol := connectToken(r); subprotocol != "" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {subprotocol}}
+	}
+
 	// Upgrade the HTTP connection to WebSocket
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	conn, err := s.upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
+	client := newWSConnection(conn, encoding)
+
+	// Compress outgoing frames when permessage-deflate was negotiated; this is
+	// a no-op for clients that didn't offer the extension
+	if s.upgrader.EnableCompression {
+		conn.EnableWriteCompression(true)
+		if cfg := s.currentConfig(); cfg != nil && cfg.Server.WebSocketCompressionLevel != 0 {
+			if err := conn.SetCompressionLevel(cfg.Server.WebSocketCompressionLevel); err != nil {
+				log.Printf("Invalid WebSocket compression level %d: %v", cfg.Server.WebSocketCompressionLevel, err)
+			}
+		}
+	}
 
 	// Set connection timeouts and limits
-	const (
-		writeWait      = 30 * time.Second    // Time allowed to write a message (increased for better reliability)
-		pongWait       = 60 * time.Second    // Time allowed to read the next pong message
-		pingPeriod     = (pongWait * 9) / 10 // Send pings to peer with this period (must be less than pongWait)
-		maxMessageSize = 512                 // Maximum message size allowed
-	)
+	const maxMessageSize = 4096 // Maximum message size allowed, enough for set_filter options
+	writeWait, pongWait, pingPeriod := s.webSocketTimeouts()
 
 	// Configure connection
 	conn.SetReadLimit(maxMessageSize)
@@ -467,7 +1962,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Add connection to the subscription
-	result := s.subscriptions.AddConnectionWithResult(path, conn)
+	result := s.subscriptions.AddConnectionWithResult(path, client)
 	if !result.Success {
 		errorData := map[string]string{
 			"error":     result.ErrorMessage,
@@ -480,10 +1975,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			Timestamp: time.Now(),
 			Data:      errorData,
 		}
-		if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-			log.Printf("Failed to set write deadline for error message: %v", err)
-		}
-		if err := conn.WriteJSON(errorMsg); err != nil {
+		if err := client.writeJSONWithDeadline(errorMsg, writeWait); err != nil {
 			log.Printf("Failed to write error message: %v", err)
 		}
 		if err := conn.Close(); err != nil {
@@ -502,10 +1994,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			"message":   "Successfully connected to filter subscription",
 		},
 	}
-	if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-		log.Printf("Failed to set write deadline for welcome message: %v", err)
-	}
-	if err := conn.WriteJSON(welcomeMsg); err != nil {
+	if err := client.writeJSONWithDeadline(welcomeMsg, writeWait); err != nil {
 		log.Printf("Failed to send welcome message: %v", err)
 	}
 
@@ -513,7 +2002,8 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Handle connection lifecycle with proper cleanup
 	defer func() {
-		s.subscriptions.RemoveConnection(path, conn)
+		// The connection may have subscribed to further filters over the socket
+		s.subscriptions.DropConnection(client)
 		if err := conn.Close(); err != nil && !websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
 			log.Printf("Error closing connection: %v", err)
 		}
@@ -537,6 +2027,9 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			}
 		}()
 
+		// The filter named in the URL until set_filter moves the connection to another one
+		filterKey := path
+
 		for {
 			var msg map[string]interface{}
 			if err := conn.ReadJSON(&msg); err != nil {
@@ -555,30 +2048,46 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 						Timestamp: time.Now(),
 						Data:      map[string]string{"status": "alive"},
 					}
-					if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-						log.Printf("Failed to set write deadline for pong: %v", err)
-					}
-					if err := conn.WriteJSON(pongMsg); err != nil {
+					if err := client.writeJSONWithDeadline(pongMsg, writeWait); err != nil {
 						log.Printf("Failed to send pong: %v", err)
 						return
 					}
 				case "get_filter":
 					// Send current filter configuration
-					subscription, exists := s.subscriptions.GetSubscription(path)
+					subscription, exists := s.subscriptions.GetSubscription(filterKey)
 					if exists {
 						filterMsg := models.WSMessage{
 							Type:      "filter_info",
 							Timestamp: time.Now(),
 							Data:      subscription,
 						}
-						if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-							log.Printf("Failed to set write deadline for filter info: %v", err)
-						}
-						if err := conn.WriteJSON(filterMsg); err != nil {
+						if err := client.writeJSONWithDeadline(filterMsg, writeWait); err != nil {
 							log.Printf("Failed to send filter info: %v", err)
 							return
 						}
 					}
+				case "subscribe", "unsubscribe":
+					if err := s.handleSubscriptionMessage(client, msgType, msg, writeWait); err != nil {
+						log.Printf("Failed to send %s reply: %v", msgType, err)
+						return
+					}
+				case "set_format":
+					if err := handleFormatMessage(client, msg, writeWait); err != nil {
+						log.Printf("Failed to send format reply: %v", err)
+						return
+					}
+				case "replay":
+					if err := s.handleReplayMessage(client, filterKey, msg, writeWait); err != nil {
+						log.Printf("Failed to send replay reply: %v", err)
+						return
+					}
+				case "set_filter":
+					newKey, err := s.handleSetFilterMessage(r.Context(), client, filterKey, streamAPIKey(r), msg, writeWait)
+					if err != nil {
+						log.Printf("Failed to send set_filter reply: %v", err)
+						return
+					}
+					filterKey = newKey
 				default:
 					// Echo unknown messages back
 					echoMsg := models.WSMessage{
@@ -586,10 +2095,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 						Timestamp: time.Now(),
 						Data:      msg,
 					}
-					if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-						log.Printf("Failed to set write deadline for echo message: %v", err)
-					}
-					if err := conn.WriteJSON(echoMsg); err != nil {
+					if err := client.writeJSONWithDeadline(echoMsg, writeWait); err != nil {
 						log.Printf("Failed to echo message: %v", err)
 						return
 					}
@@ -606,10 +2112,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			return
 		case <-ticker.C:
 			// Send ping to client
-			if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
-				log.Printf("Failed to set write deadline for ping: %v", err)
-			}
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := client.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
 				log.Printf("Failed to send ping: %v", err)
 				return
 			}
@@ -617,40 +2120,205 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// validateFilterContent validates that non-empty filter fields contain at least 3 letters
-func validateFilterContent(options models.FilterOptions) string {
-	letterRegex := regexp.MustCompile(`[a-zA-Z]`)
+// Defaults for WebSocket keepalive timing when the server config doesn't set it
+const (
+	defaultWebSocketWriteWait = 30 * time.Second // Time allowed to write a message
+	defaultWebSocketPongWait  = 60 * time.Second // Time allowed to read the next pong message
+)
+
+// webSocketTimeouts returns the configured write wait, pong wait and ping period, using the
+// defaults for unset values. The ping period defaults to 90% of the pong wait.
+func (s *Server) webSocketTimeouts() (writeWait, pongWait, pingPeriod time.Duration) {
+	writeWait, pongWait = defaultWebSocketWriteWait, defaultWebSocketPongWait
+	if cfg := s.currentConfig(); cfg != nil {
+		if cfg.Server.WebSocketWriteWait > 0 {
+			writeWait = cfg.Server.WebSocketWriteWait
+		}
+		if cfg.Server.WebSocketPongWait > 0 {
+			pongWait = cfg.Server.WebSocketPongWait
+		}
+		pingPeriod = cfg.Server.WebSocketPingInterval
+	}
+	if pingPeriod <= 0 || pingPeriod >= pongWait {
+		pingPeriod = pongWait * 9 / 10
+	}
+	return writeWait, pongWait, pingPeriod
+}
+
+// handleSubscriptionMessage adds the connection to, or removes it from, the filter named in a
+// {"type":"subscribe"|"unsubscribe","filterKey":"...","token":"..."} message and replies with the
+// outcome. The token is only needed to subscribe to filters that require a connect token.
+func (s *Server) handleSubscriptionMessage(conn *wsConnection, msgType string, msg map[string]interface{}, writeWait time.Duration) error {
+	filterKey, _ := msg["filterKey"].(string)
+	token, _ := msg["token"].(string)
+
+	status := "subscribed"
+	if msgType == "unsubscribe" {
+		status = "unsubscribed"
+	}
+	reply := models.WSMessage{
+		Type:      status,
+		Timestamp: time.Now(),
+		Data: map[string]string{
+			"filterKey": filterKey,
+			"status":    status,
+		},
+	}
+
+	replyError := func(message, code string) {
+		reply.Type = "error"
+		reply.Data = map[string]string{
+			"error":     message,
+			"errorCode": code,
+			"filterKey": filterKey,
+		}
+	}
+
+	switch {
+	case filterKey == "":
+		replyError("filterKey is required", "MISSING_FILTER_KEY")
+	case msgType == "subscribe" && s.subscriptions.ValidateConnectToken(filterKey, token) != nil:
+		replyError("Invalid or expired connect token", "INVALID_CONNECT_TOKEN")
+	case msgType == "subscribe":
+		if result := s.subscriptions.AddConnectionWithResult(filterKey, conn); !result.Success {
+			replyError(result.ErrorMessage, result.ErrorCode)
+		}
+	default:
+		if !s.subscriptions.UnsubscribeConnection(filterKey, conn) {
+			replyError("Not subscribed to filter", "NOT_SUBSCRIBED")
+		}
+	}
+
+	return conn.writeJSONWithDeadline(reply, writeWait)
+}
+
+// handleFormatMessage switches the encoding of subsequent events on a
+// {"type":"set_format","format":"json"|"msgpack"} message and replies with the result
+func handleFormatMessage(conn *wsConnection, msg map[string]interface{}, writeWait time.Duration) error {
+	format, _ := msg["format"].(string)
 
-	// Validate repository field
-	if options.Repository != "" {
-		if countLetters(options.Repository, letterRegex) < 3 {
-			return "Repository filter must contain at least 3 letters"
+	reply := models.WSMessage{
+		Type:      "format",
+		Timestamp: time.Now(),
+	}
+	if encoding, ok := parseMessageEncoding(format); ok {
+		conn.setEncoding(encoding)
+		reply.Data = map[string]string{"format": encoding}
+	} else {
+		reply.Type = "error"
+		reply.Data = map[string]string{
+			"error":     "Unsupported format, must be json or msgpack",
+			"errorCode": "UNSUPPORTED_FORMAT",
 		}
 	}
 
-	// Validate pathPrefix field
-	if options.PathPrefix != "" {
-		if countLetters(options.PathPrefix, letterRegex) < 3 {
-			return "Path prefix filter must contain at least 3 letters"
+	return conn.writeJSONWithDeadline(reply, writeWait)
+}
+
+// handleReplayMessage queues the buffered events a reconnecting client missed on a
+// {"type":"replay","since":"<forwarded timestamp>","filterKey":"..."} message and replies with
+// how many were queued. filterKey defaults to the filter in the connection's URL.
+func (s *Server) handleReplayMessage(conn *wsConnection, path string, msg map[string]interface{}, writeWait time.Duration) error {
+	filterKey, _ := msg["filterKey"].(string)
+	if filterKey == "" {
+		filterKey = path
+	}
+	sinceValue, _ := msg["since"].(string)
+
+	reply := models.WSMessage{
+		Type:      "replay",
+		Timestamp: time.Now(),
+	}
+	replyError := func(message, code string) {
+		reply.Type = "error"
+		reply.Data = map[string]string{
+			"error":     message,
+			"errorCode": code,
+			"filterKey": filterKey,
 		}
 	}
 
-	// Validate keyword field - check each keyword individually
-	if options.Keyword != "" {
-		keywords := strings.Split(options.Keyword, ",")
-		for _, keyword := range keywords {
-			keyword = strings.TrimSpace(keyword)
-			if keyword != "" && countLetters(keyword, letterRegex) < 3 {
-				return fmt.Sprintf("Keyword '%s' must contain at least 3 letters", keyword)
+	since, err := time.Parse(time.RFC3339Nano, sinceValue)
+	if err != nil {
+		replyError("since must be an RFC3339 timestamp", "INVALID_SINCE")
+	} else {
+		result, err := s.subscriptions.Replay(filterKey, conn, since)
+		switch {
+		case errors.Is(err, subscription.ErrSubscriptionNotFound):
+			replyError("Filter key not found", "INVALID_FILTER_KEY")
+		case errors.Is(err, subscription.ErrNotSubscribed):
+			replyError("Not subscribed to filter", "NOT_SUBSCRIBED")
+		default:
+			reply.Data = map[string]interface{}{
+				"filterKey": filterKey,
+				"since":     since,
+				"events":    result.Events,
+				"truncated": result.Truncated,
 			}
 		}
 	}
 
-	return "" // No validation errors
+	return conn.writeJSONWithDeadline(reply, writeWait)
 }
 
-// countLetters counts the number of letters in a string
-func countLetters(s string, letterRegex *regexp.Regexp) int {
-	matches := letterRegex.FindAllString(s, -1)
-	return len(matches)
+// handleSetFilterMessage replaces the connection's filter options on a
+// {"type":"set_filter","options":{...},"filterKey":"..."} message and replies with a
+// filter_updated message carrying the resulting filter. filterKey defaults to the connection's
+// current filter. When that filter is shared the connection moves to a new one, so the returned
+// key, which is the current filter's key if filterKey named another one, may change.
+// Changing filters creates them like /api/filters/create does, so with auth enabled it needs a
+// valid API key, from the message's apiKey or else the one the connection was opened with.
+func (s *Server) handleSetFilterMessage(ctx context.Context, conn *wsConnection, current, apiKey string, msg map[string]interface{}, writeWait time.Duration) (string, error) {
+	filterKey, _ := msg["filterKey"].(string)
+	if filterKey == "" {
+		filterKey = current
+	}
+
+	reply := models.WSMessage{
+		Type:      "filter_updated",
+		Timestamp: time.Now(),
+	}
+	replyError := func(message, code string) {
+		reply.Type = "error"
+		reply.Data = map[string]string{
+			"error":     message,
+			"errorCode": code,
+			"filterKey": filterKey,
+		}
+	}
+
+	if key, _ := msg["apiKey"].(string); key != "" {
+		apiKey = key
+	}
+
+	var options models.FilterOptions
+	rawOptions, hasOptions := msg["options"].(map[string]interface{})
+	encoded, _ := json.Marshal(rawOptions)
+	if s.authEnabled() && !s.validAPIKey(apiKey) {
+		replyError("A valid API key is required to change filters", "UNAUTHORIZED")
+	} else if err := json.Unmarshal(encoded, &options); !hasOptions || err != nil {
+		replyError("options must be a filter options object", "INVALID_OPTIONS")
+	} else if options, resolveErr := s.resolveRepositoryHandles(ctx, options); resolveErr != "" {
+		replyError(resolveErr, "INVALID_OPTIONS")
+	} else {
+		// The manager validates the options like it does for /api/filters/create
+		updated, err := s.subscriptions.SetConnectionFilter(filterKey, conn, options)
+		switch {
+		case errors.Is(err, subscription.ErrSubscriptionNotFound):
+			replyError("Filter key not found", "INVALID_FILTER_KEY")
+		case errors.Is(err, subscription.ErrNotSubscribed):
+			replyError("Not subscribed to filter", "NOT_SUBSCRIBED")
+		case errors.Is(err, subscription.ErrFilterExpired):
+			replyError("Filter has expired", "FILTER_EXPIRED")
+		case err != nil:
+			replyError(err.Error(), "INVALID_OPTIONS")
+		default:
+			reply.Data = updated
+			if filterKey == current {
+				current = updated.FilterKey
+			}
+		}
+	}
+
+	return current, conn.writeJSONWithDeadline(reply, writeWait)
 }
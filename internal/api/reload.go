@@ -0,0 +1,63 @@
+package api
+
+import (
+	"slices"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+)
+
+// currentConfig returns the server configuration. ReloadConfig swaps in a changed copy instead
+// of modifying it, so callers may keep reading the returned config without holding configMu.
+func (s *Server) currentConfig() *config.Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+// ReloadConfig applies the settings of cfg that can change without a restart: server.cors,
+// server.max_connections and the WebSocket ping interval, pong wait and write wait. New requests
+// and connections use them right away, while open connections keep the timeouts they started
+// with. Every other setting is left as it was. It returns the keys of the settings that changed.
+func (s *Server) ReloadConfig(cfg *config.Config) []string {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	next := config.Config{}
+	if s.config != nil {
+		next = *s.config
+	}
+
+	var changed []string
+	if !corsEqual(next.Server.CORS, cfg.Server.CORS) {
+		next.Server.CORS = cfg.Server.CORS
+		changed = append(changed, "server.cors")
+	}
+	if next.Server.MaxConnections != cfg.Server.MaxConnections {
+		next.Server.MaxConnections = cfg.Server.MaxConnections
+		s.subscriptions.SetMaxConnections(cfg.Server.MaxConnections)
+		changed = append(changed, "server.max_connections")
+	}
+	if next.Server.WebSocketPingInterval != cfg.Server.WebSocketPingInterval {
+		next.Server.WebSocketPingInterval = cfg.Server.WebSocketPingInterval
+		changed = append(changed, "server.websocket_ping_interval")
+	}
+	if next.Server.WebSocketPongWait != cfg.Server.WebSocketPongWait {
+		next.Server.WebSocketPongWait = cfg.Server.WebSocketPongWait
+		changed = append(changed, "server.websocket_pong_wait")
+	}
+	if next.Server.WebSocketWriteWait != cfg.Server.WebSocketWriteWait {
+		next.Server.WebSocketWriteWait = cfg.Server.WebSocketWriteWait
+		changed = append(changed, "server.websocket_write_wait")
+	}
+
+	s.config = &next
+	return changed
+}
+
+// corsEqual reports whether two CORS configurations allow the same origins, methods and headers
+func corsEqual(a, b config.CORSConfig) bool {
+	return a.AllowAllOrigins == b.AllowAllOrigins &&
+		slices.Equal(a.AllowedOrigins, b.AllowedOrigins) &&
+		slices.Equal(a.AllowedMethods, b.AllowedMethods) &&
+		slices.Equal(a.AllowedHeaders, b.AllowedHeaders)
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/subscription"
+)
+
+// handleResolveTimeout bounds each handle lookup made while creating or updating a filter
+const handleResolveTimeout = 5 * time.Second
+
+// maxCachedHandles bounds the resolution cache; expired entries are evicted first when it fills
+const maxCachedHandles = 10000
+
+// HandleResolver resolves an atproto handle to the DID it currently points at
+type HandleResolver interface {
+	ResolveHandle(ctx context.Context, handle string) (string, error)
+}
+
+// newHandleResolver builds the server's resolver: the configured identity service, then DNS and
+// HTTPS directly, with successful lookups cached for the configured TTL
+func newHandleResolver(cfg config.IdentityConfig) HandleResolver {
+	var resolver HandleResolver = newDNSHandleResolver()
+	if cfg.ResolverURL != "" {
+		resolver = fallbackHandleResolver{newXRPCHandleResolver(cfg.ResolverURL), resolver}
+	}
+	if cfg.CacheTTL > 0 {
+		resolver = newCachingHandleResolver(resolver, cfg.CacheTTL)
+	}
+	return resolver
+}
+
+// xrpcHandleResolver asks an XRPC service (normally the AppView) via com.atproto.identity.resolveHandle
+type xrpcHandleResolver struct {
+	baseURL string
+	client  *http.Client
+}
+
+// newXRPCHandleResolver creates a resolver for the service at baseURL
+func newXRPCHandleResolver(baseURL string) *xrpcHandleResolver {
+	return &xrpcHandleResolver{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: handleResolveTimeout},
+	}
+}
+
+// ResolveHandle calls com.atproto.identity.resolveHandle and returns the DID from the response
+func (r *xrpcHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	endpoint := r.baseURL + "/xrpc/com.atproto.identity.resolveHandle?handle=" + url.QueryEscape(handle)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Did     string `json:"did"`
+		Message string `json:"message"`
+	}
+	decodeErr := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+
+	if resp.StatusCode != http.StatusOK {
+		if body.Message != "" {
+			return "", fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body.Message)
+		}
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("invalid resolveHandle response: %w", decodeErr)
+	}
+
+	did, err := syntax.ParseDID(body.Did)
+	if err != nil {
+		return "", fmt.Errorf("invalid DID in resolveHandle response: %w", err)
+	}
+	return did.String(), nil
+}
+
+// fallbackHandleResolver tries primary and, if it fails, secondary
+type fallbackHandleResolver struct {
+	primary   HandleResolver
+	secondary HandleResolver
+}
+
+// ResolveHandle returns the first successful resolution, or both errors
+func (r fallbackHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	did, primaryErr := r.primary.ResolveHandle(ctx, handle)
+	if primaryErr == nil {
+		return did, nil
+	}
+
+	did, secondaryErr := r.secondary.ResolveHandle(ctx, handle)
+	if secondaryErr != nil {
+		return "", fmt.Errorf("%v; %v", primaryErr, secondaryErr)
+	}
+	return did, nil
+}
+
+// cachedDID is a resolved handle and when it stops being reused
+type cachedDID struct {
+	did       string
+	expiresAt time.Time
+}
+
+// cachingHandleResolver remembers successful resolutions for ttl. Failures aren't cached, so a
+// handle that was just set up can be retried immediately
+type cachingHandleResolver struct {
+	next HandleResolver
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedDID
+}
+
+// newCachingHandleResolver wraps next with a resolution cache
+func newCachingHandleResolver(next HandleResolver, ttl time.Duration) *cachingHandleResolver {
+	return &cachingHandleResolver{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedDID),
+	}
+}
+
+// ResolveHandle returns a cached DID if it hasn't expired, otherwise resolves and caches it
+func (r *cachingHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	r.mu.Lock()
+	entry, found := r.entries[handle]
+	r.mu.Unlock()
+	if found && r.now().Before(entry.expiresAt) {
+		return entry.did, nil
+	}
+
+	did, err := r.next.ResolveHandle(ctx, handle)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) >= maxCachedHandles {
+		r.evictLocked()
+	}
+	r.entries[handle] = cachedDID{did: did, expiresAt: r.now().Add(r.ttl)}
+	return did, nil
+}
+
+// evictLocked drops expired entries, or an arbitrary one if none have expired. Caller holds r.mu
+func (r *cachingHandleResolver) evictLocked() {
+	now := r.now()
+	for handle, entry := range r.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(r.entries, handle)
+		}
+	}
+	if len(r.entries) < maxCachedHandles {
+		return
+	}
+	for handle := range r.entries {
+		delete(r.entries, handle)
+		return
+	}
+}
+
+// dnsHandleResolver resolves handles as described in the atproto spec: a DNS TXT record
+// at _atproto.<handle>, falling back to https://<handle>/.well-known/atproto-did
+type dnsHandleResolver struct {
+	lookupTXT    func(ctx context.Context, name string) ([]string, error)
+	wellKnownURL func(handle string) string
+	client       *http.Client
+}
+
+// newDNSHandleResolver creates a resolver backed by the system DNS resolver and HTTPS
+func newDNSHandleResolver() *dnsHandleResolver {
+	return &dnsHandleResolver{
+		lookupTXT: net.DefaultResolver.LookupTXT,
+		wellKnownURL: func(handle string) string {
+			return "https://" + handle + "/.well-known/atproto-did"
+		},
+		client: &http.Client{Timeout: handleResolveTimeout},
+	}
+}
+
+// ResolveHandle tries DNS first and HTTPS second, returning the first DID found
+func (r *dnsHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	did, dnsErr := r.resolveDNS(ctx, handle)
+	if dnsErr == nil {
+		return did, nil
+	}
+
+	did, httpErr := r.resolveWellKnown(ctx, handle)
+	if httpErr != nil {
+		return "", fmt.Errorf("dns: %v; https: %v", dnsErr, httpErr)
+	}
+	return did, nil
+}
+
+// resolveDNS looks for a "did=<did>" TXT record at _atproto.<handle>
+func (r *dnsHandleResolver) resolveDNS(ctx context.Context, handle string) (string, error) {
+	records, err := r.lookupTXT(ctx, "_atproto."+handle)
+	if err != nil {
+		return "", err
+	}
+
+	for _, record := range records {
+		if value, found := strings.CutPrefix(record, "did="); found {
+			did, err := syntax.ParseDID(strings.TrimSpace(value))
+			if err != nil {
+				return "", fmt.Errorf("invalid DID in TXT record: %w", err)
+			}
+			return did.String(), nil
+		}
+	}
+	return "", errors.New("no did= TXT record found")
+}
+
+// resolveWellKnown fetches the DID from the handle's /.well-known/atproto-did document
+func (r *dnsHandleResolver) resolveWellKnown(ctx context.Context, handle string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.wellKnownURL(handle), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// A DID document reference is a single short line; don't read arbitrary bodies
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if err != nil {
+		return "", err
+	}
+
+	did, err := syntax.ParseDID(strings.TrimSpace(string(body)))
+	if err != nil {
+		return "", fmt.Errorf("invalid DID in well-known document: %w", err)
+	}
+	return did.String(), nil
+}
+
+// resolveRepositoryHandles replaces handles in the Repository filter with the DIDs they resolve
+// to, since events only carry DIDs. Entries that aren't valid handles are left for validation
+// to reject. It returns an error message, or "" if every handle resolved.
+func (s *Server) resolveRepositoryHandles(ctx context.Context, options models.FilterOptions) (models.FilterOptions, string) {
+	resolver := s.handleResolver
+	if resolver == nil {
+		resolver = newDNSHandleResolver()
+	}
+
+	repos := options.RepositoryList()
+	resolved := false
+	for i, repo := range repos {
+		if strings.HasPrefix(repo, "did:") {
+			continue
+		}
+		handle, err := syntax.ParseHandle(repo)
+		if err != nil {
+			continue
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, handleResolveTimeout)
+		did, err := resolver.ResolveHandle(lookupCtx, handle.Normalize().String())
+		cancel()
+		if err != nil {
+			return options, fmt.Sprintf("Could not resolve handle '%s': %v", repo, err)
+		}
+		if validationErr := subscription.ValidateRepository(did); validationErr != "" {
+			return options, fmt.Sprintf("Handle '%s' resolved to an unusable DID: %s", repo, validationErr)
+		}
+
+		repos[i] = did
+		resolved = true
+	}
+
+	if resolved {
+		options.Repository = strings.Join(repos, ",")
+	}
+	return options, ""
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/subscription"
+)
+
+// staticHandleResolver resolves handles from a fixed map
+type staticHandleResolver map[string]string
+
+func (r staticHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	did, ok := r[handle]
+	if !ok {
+		return "", errors.New("handle not found")
+	}
+	return did, nil
+}
+
+func TestDNSHandleResolver(t *testing.T) {
+	wellKnown := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/web.example/.well-known/atproto-did":
+			w.Write([]byte("did:plc:fromwellknown\n"))
+		case "/garbage.example/.well-known/atproto-did":
+			w.Write([]byte("<html>not a did</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer wellKnown.Close()
+
+	resolver := &dnsHandleResolver{
+		lookupTXT: func(ctx context.Context, name string) ([]string, error) {
+			if name == "_atproto.dns.example" {
+				return []string{"v=spf1 -all", "did=did:plc:fromdns"}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+		wellKnownURL: func(handle string) string {
+			return wellKnown.URL + "/" + handle + "/.well-known/atproto-did"
+		},
+		client: wellKnown.Client(),
+	}
+
+	tests := []struct {
+		handle      string
+		expectedDID string
+		expectError bool
+	}{
+		{handle: "dns.example", expectedDID: "did:plc:fromdns"},
+		{handle: "web.example", expectedDID: "did:plc:fromwellknown"},
+		{handle: "garbage.example", expectError: true},
+		{handle: "missing.example", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.handle, func(t *testing.T) {
+			did, err := resolver.ResolveHandle(context.Background(), tt.handle)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got DID %q", did)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if did != tt.expectedDID {
+				t.Errorf("Expected %q, got %q", tt.expectedDID, did)
+			}
+		})
+	}
+}
+
+// countingHandleResolver counts lookups and resolves every handle to the same DID
+type countingHandleResolver struct {
+	calls int
+	err   error
+}
+
+func (r *countingHandleResolver) ResolveHandle(ctx context.Context, handle string) (string, error) {
+	r.calls++
+	if r.err != nil {
+		return "", r.err
+	}
+	return "did:plc:counted123", nil
+}
+
+func TestXRPCHandleResolver(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/com.atproto.identity.resolveHandle" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("handle") {
+		case "alice.bsky.social":
+			w.Write([]byte(`{"did":"did:plc:alice123"}`))
+		case "broken.example":
+			w.Write([]byte(`{"did":"not-a-did"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"InvalidRequest","message":"Unable to resolve handle"}`))
+		}
+	}))
+	defer service.Close()
+
+	resolver := newXRPCHandleResolver(service.URL + "/")
+
+	did, err := resolver.ResolveHandle(context.Background(), "alice.bsky.social")
+	if err != nil || did != "did:plc:alice123" {
+		t.Errorf("Expected did:plc:alice123, got %q (err %v)", did, err)
+	}
+	if _, err := resolver.ResolveHandle(context.Background(), "broken.example"); err == nil {
+		t.Error("Expected an error for an invalid DID in the response")
+	}
+	_, err = resolver.ResolveHandle(context.Background(), "nobody.example")
+	if err == nil || !strings.Contains(err.Error(), "Unable to resolve handle") {
+		t.Errorf("Expected the service error message to be surfaced, got %v", err)
+	}
+
+	// The direct resolver is only consulted when the service fails
+	fallback := &countingHandleResolver{}
+	chain := fallbackHandleResolver{resolver, fallback}
+	if did, _ := chain.ResolveHandle(context.Background(), "alice.bsky.social"); did != "did:plc:alice123" || fallback.calls != 0 {
+		t.Errorf("Expected the service answer without fallback, got %q after %d fallback calls", did, fallback.calls)
+	}
+	if did, _ := chain.ResolveHandle(context.Background(), "nobody.example"); did != "did:plc:counted123" || fallback.calls != 1 {
+		t.Errorf("Expected the fallback answer, got %q after %d fallback calls", did, fallback.calls)
+	}
+}
+
+func TestCachingHandleResolver(t *testing.T) {
+	next := &countingHandleResolver{}
+	resolver := newCachingHandleResolver(next, time.Minute)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if did, err := resolver.ResolveHandle(context.Background(), "alice.bsky.social"); err != nil || did != "did:plc:counted123" {
+			t.Fatalf("Unexpected resolution %q (err %v)", did, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Errorf("Expected repeated lookups to be cached, got %d calls", next.calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	resolver.ResolveHandle(context.Background(), "alice.bsky.social")
+	if next.calls != 2 {
+		t.Errorf("Expected an expired entry to be resolved again, got %d calls", next.calls)
+	}
+
+	// Failures aren't cached
+	failing := &countingHandleResolver{err: errors.New("no such host")}
+	resolver = newCachingHandleResolver(failing, time.Minute)
+	resolver.ResolveHandle(context.Background(), "nobody.example")
+	resolver.ResolveHandle(context.Background(), "nobody.example")
+	if failing.calls != 2 {
+		t.Errorf("Expected failed lookups to be retried, got %d calls", failing.calls)
+	}
+}
+
+func TestResolveRepositoryHandles(t *testing.T) {
+	server := &Server{
+		subscriptions: subscription.NewManager(),
+		handleResolver: staticHandleResolver{
+			"alice.bsky.social": "did:plc:alice123",
+			"key.example":       "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK",
+		},
+	}
+
+	tests := []struct {
+		name               string
+		repository         string
+		expectedRepository string
+		expectedStatus     int
+	}{
+		{"Handle resolved to DID", "alice.bsky.social", "did:plc:alice123", http.StatusOK},
+		{"Handle case is normalized", "Alice.Bsky.Social", "did:plc:alice123", http.StatusOK},
+		{"Mixed DIDs and handles", "did:plc:bob456, alice.bsky.social", "did:plc:bob456,did:plc:alice123", http.StatusOK},
+		{"DIDs left untouched", "did:plc:bob456, did:web:example.com", "did:plc:bob456, did:web:example.com", http.StatusOK},
+		{"Unresolvable handle", "nobody.example", "", http.StatusBadRequest},
+		{"Handle resolving to unsupported DID", "key.example", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(models.CreateFilterRequest{
+				Options: models.FilterOptions{Repository: tt.repository, Keyword: "hello"},
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/filters/create", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			server.handleCreateFilter(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.CreateFilterResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Options.Repository != tt.expectedRepository {
+				t.Errorf("Expected repository %q, got %q", tt.expectedRepository, response.Options.Repository)
+			}
+
+			sub, exists := server.subscriptions.GetSubscription(response.FilterKey)
+			if !exists {
+				t.Fatal("Filter should exist after creation")
+			}
+			if sub.Options.Repository != tt.expectedRepository {
+				t.Errorf("Expected stored repository %q, got %q", tt.expectedRepository, sub.Options.Repository)
+			}
+		})
+	}
+}
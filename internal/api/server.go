@@ -1,17 +1,29 @@
 package api
 
 import (
+	"bufio"
 	"context"
-	"fmt"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	httpSwagger "github.com/swaggo/http-swagger"
 
+	"github.com/JWhist/AT_Proto_PubSub/internal/bus"
 	"github.com/JWhist/AT_Proto_PubSub/internal/config"
 	"github.com/JWhist/AT_Proto_PubSub/internal/firehose"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
 	"github.com/JWhist/AT_Proto_PubSub/internal/subscription"
 
 	_ "github.com/JWhist/AT_Proto_PubSub/docs" // Import generated docs
@@ -23,19 +35,121 @@ type Server struct {
 	subscriptions  *subscription.Manager
 	server         *http.Server
 	upgrader       websocket.Upgrader
-	config         *config.Config
+	config         *config.Config // Replaced, never modified, by ReloadConfig; read it with currentConfig
+	configMu       sync.RWMutex
+	handleResolver HandleResolver
+}
+
+// statusRecorder captures the status code a handler writes. It passes Flush and Hijack through,
+// so SSE streams and WebSocket upgrades work behind it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols // The upgrade response is written to the hijacked connection
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// filterKeyRoutes are the mux patterns whose path continues with a filter key
+var filterKeyRoutes = map[string]bool{
+	"/ws/":                 true,
+	"/sse/":                true,
+	"/api/subscriptions/":  true,
+	"/api/filters/delete/": true,
+	"/api/admin/filters/":  true,
+}
+
+// logPath returns a request path for the logs with the filter key shortened to its first 8
+// characters, as everywhere else in the logs, since the full key is enough to read the stream
+func logPath(route, path string) string {
+	if !filterKeyRoutes[route] {
+		return path
+	}
+	filterKey, rest, hasRest := strings.Cut(strings.TrimPrefix(path, route), "/")
+	if len(filterKey) <= 8 {
+		return path
+	}
+	if hasRest {
+		rest = "/" + rest
+	}
+	return route + filterKey[:8] + "..." + rest
+}
+
+// loggingMiddleware logs every request's method, path (with filter keys shortened), status and
+// duration and records the duration in http_request_duration_seconds, labeled by the mux pattern
+// that served it (not the raw path, so filter keys don't create a series each). WebSocket and
+// SSE requests are logged when their stream closes.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		duration := time.Since(start)
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK // Nothing written, which net/http answers with 200
+		}
+		route := r.Pattern // Set on the request by the mux once it picked a handler
+		path := logPath(route, r.URL.Path)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metriks.HTTPRequestDuration.WithLabelValues(route, strconv.Itoa(status)).Observe(duration.Seconds())
+		slog.Info("HTTP request",
+			"method", r.Method,
+			"path", path,
+			"status", status,
+			"duration", duration)
+	})
 }
 
 // corsMiddleware adds CORS headers to HTTP responses
 func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
+		cors := s.currentConfig().Server.CORS
 
 		// Check if origin is allowed
-		if s.config.Server.CORS.AllowAllOrigins {
+		if cors.AllowAllOrigins {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 		} else if origin != "" {
-			for _, allowedOrigin := range s.config.Server.CORS.AllowedOrigins {
+			for _, allowedOrigin := range cors.AllowedOrigins {
 				if origin == allowedOrigin {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 					break
@@ -44,11 +158,11 @@ func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// Set other CORS headers only if configured
-		if len(s.config.Server.CORS.AllowedMethods) > 0 {
-			w.Header().Set("Access-Control-Allow-Methods", strings.Join(s.config.Server.CORS.AllowedMethods, ", "))
+		if len(cors.AllowedMethods) > 0 {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
 		}
-		if len(s.config.Server.CORS.AllowedHeaders) > 0 {
-			w.Header().Set("Access-Control-Allow-Headers", strings.Join(s.config.Server.CORS.AllowedHeaders, ", "))
+		if len(cors.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
 		}
 
 		// Handle preflight requests
@@ -61,68 +175,303 @@ func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// authMiddleware rejects mutating requests (POST, PUT, PATCH, DELETE) that don't carry a
+// valid API key when auth is enabled. Wrap it inside corsMiddleware so preflights still pass
+func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if s.authEnabled() && !s.validAPIKey(bearerToken(r)) {
+				writeUnauthorized(w)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// adminMiddleware guards operator endpoints: they are only served when API key auth is enabled,
+// and every request, whatever its method, needs a valid key
+func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authEnabled() {
+			writeAdminDisabled(w)
+			return
+		}
+		if !s.validAPIKey(bearerToken(r)) {
+			writeUnauthorized(w)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeAdminDisabled writes the 403 API response for admin endpoints while auth is disabled
+func writeAdminDisabled(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(models.APIResponse{
+		Success: false,
+		Message: "Admin endpoints require API key auth to be enabled",
+	}); err != nil {
+		log.Printf("Failed to write forbidden response: %v", err)
+	}
+}
+
+// authorizeStream reports whether a /ws or /sse request may connect. Browsers can't set
+// headers on WebSocket or EventSource requests, so the key may also come from ?api_key=
+func (s *Server) authorizeStream(r *http.Request) bool {
+	if !s.authEnabled() || !s.currentConfig().Server.Auth.RequireForStreams {
+		return true
+	}
+	return s.validAPIKey(streamAPIKey(r))
+}
+
+// streamAPIKey returns the API key of a streaming request, from the bearer token or ?api_key=
+func streamAPIKey(r *http.Request) string {
+	if key := bearerToken(r); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// connectTokenSubprotocol prefixes a connect token sent as a WebSocket subprotocol, for
+// browser clients that would rather not put it in the URL
+const connectTokenSubprotocol = "token."
+
+// connectToken returns the connect token of a /ws, /sse or recent events request, from ?token=,
+// an X-Connect-Token header or a "token.<token>" subprotocol, along with that subprotocol so the
+// upgrade can select it
+func connectToken(r *http.Request) (token, subprotocol string) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, ""
+	}
+	if token := r.Header.Get("X-Connect-Token"); token != "" {
+		return token, ""
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if token, ok := strings.CutPrefix(protocol, connectTokenSubprotocol); ok && token != "" {
+			return token, protocol
+		}
+	}
+	return "", ""
+}
+
+// authorizeConnectToken checks the request's connect token against a filter that requires one,
+// writing a 401 response when it's missing or invalid
+func (s *Server) authorizeConnectToken(w http.ResponseWriter, r *http.Request, filterKey string) bool {
+	token, _ := connectToken(r)
+	if err := s.subscriptions.ValidateConnectToken(filterKey, token); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		if encErr := json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: "Invalid or expired connect token",
+			Data:    map[string]string{"errorCode": "INVALID_CONNECT_TOKEN", "filterKey": filterKey},
+		}); encErr != nil {
+			log.Printf("Failed to write unauthorized response: %v", encErr)
+		}
+		return false
+	}
+	return true
+}
+
+// authorizeFilterRead lets a request read a filter's details when the filter doesn't require a
+// connect token, the request carries a valid API key or its connect token is valid, writing a
+// 401 response otherwise
+func (s *Server) authorizeFilterRead(w http.ResponseWriter, r *http.Request, filterKey string) bool {
+	if s.authEnabled() && s.validAPIKey(bearerToken(r)) {
+		return true
+	}
+	return s.authorizeConnectToken(w, r, filterKey)
+}
+
+// authorizeFilterChange lets a request change, pause or delete a filter. With API key auth
+// enabled authMiddleware has already checked the key; otherwise a filter created with
+// requireToken needs a current connect token, so its key alone can't take it over. It writes a
+// 401 response when the token is missing or invalid.
+func (s *Server) authorizeFilterChange(w http.ResponseWriter, r *http.Request, filterKey string) bool {
+	if s.authEnabled() {
+		return true
+	}
+	return s.authorizeConnectToken(w, r, filterKey)
+}
+
+// authEnabled reports whether API key authentication is configured
+func (s *Server) authEnabled() bool {
+	cfg := s.currentConfig()
+	return cfg != nil && cfg.Server.Auth.Enabled
+}
+
+// validAPIKey checks key against the configured keys in constant time
+func (s *Server) validAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	valid := false
+	for _, allowed := range s.currentConfig().Server.Auth.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// writeUnauthorized writes a 401 API response asking for a bearer token
+func writeUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	if err := json.NewEncoder(w).Encode(models.APIResponse{
+		Success: false,
+		Message: "Invalid or missing API key",
+	}); err != nil {
+		log.Printf("Failed to write unauthorized response: %v", err)
+	}
+}
+
 // NewServer creates a new API server instance
 func NewServer(firehoseClient *firehose.Client, port string) *Server {
 	return NewServerWithConfig(firehoseClient, &config.Config{
 		Server: config.ServerConfig{
 			Port: port,
 			// Host left empty to default to binding all interfaces (:port)
+			// Same CORS defaults as a config file, so browser clients can connect
+			CORS: config.CORSConfig{
+				AllowAllOrigins: true,
+				AllowedMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+				AllowedHeaders:  []string{"*"},
+			},
 		},
 	})
 }
 
-// NewServerWithConfig creates a new API server instance with configuration
-func NewServerWithConfig(firehoseClient *firehose.Client, cfg *config.Config) *Server {
-	mux := http.NewServeMux()
+// checkOrigin is the WebSocket upgrader's origin check for the current CORS configuration
+func (s *Server) checkOrigin(r *http.Request) bool {
+	cors := s.currentConfig().Server.CORS
+	if cors.AllowAllOrigins {
+		return true
+	}
 
-	// Configure CORS based on config
-	checkOrigin := func(r *http.Request) bool {
-		if cfg.Server.CORS.AllowAllOrigins {
+	// Check if the origin is in the allowed origins list
+	origin := r.Header.Get("Origin")
+	for _, allowedOrigin := range cors.AllowedOrigins {
+		if origin == allowedOrigin {
 			return true
 		}
+	}
 
-		// Check if the origin is in the allowed origins list
-		origin := r.Header.Get("Origin")
-		for _, allowedOrigin := range cfg.Server.CORS.AllowedOrigins {
-			if origin == allowedOrigin {
-				return true
-			}
-		}
+	// If no origin header or not in allowed list, deny
+	return false
+}
 
-		// If no origin header or not in allowed list, deny
-		return false
+// defaultWebSocketBufferSize is the WebSocket read and write buffer size when the server config
+// doesn't set one
+const defaultWebSocketBufferSize = 1024
+
+// bufferSizeOrDefault returns a configured WebSocket buffer size, or the default if it isn't set
+func bufferSizeOrDefault(size int) int {
+	if size > 0 {
+		return size
 	}
+	return defaultWebSocketBufferSize
+}
+
+// NewServerWithConfig creates a new API server instance with configuration
+func NewServerWithConfig(firehoseClient *firehose.Client, cfg *config.Config) *Server {
+	mux := http.NewServeMux()
 
 	apiServer := &Server{
 		firehoseClient: firehoseClient,
 		subscriptions:  subscription.NewManagerWithConfig(cfg.Server.MaxConnections),
 		server: &http.Server{
-			Addr:    cfg.GetListenAddress(),
-			Handler: mux,
+			Addr: cfg.GetListenAddress(),
 		},
 		upgrader: websocket.Upgrader{
-			CheckOrigin:      checkOrigin,
 			HandshakeTimeout: 45 * time.Second,
-			ReadBufferSize:   1024,
-			WriteBufferSize:  1024,
+			ReadBufferSize:   bufferSizeOrDefault(cfg.Server.WebSocketReadBufferSize),
+			WriteBufferSize:  bufferSizeOrDefault(cfg.Server.WebSocketWriteBufferSize),
+			// Clients that don't offer permessage-deflate still get uncompressed frames
+			EnableCompression: cfg.Server.WebSocketCompression,
 		},
-		config: cfg,
+		config:         cfg,
+		handleResolver: newHandleResolver(cfg.Identity),
+	}
+	apiServer.upgrader.CheckOrigin = apiServer.checkOrigin
+	apiServer.subscriptions.SetTextFields(cfg.Filters.TextFields)
+	apiServer.subscriptions.SetReplayBufferSize(cfg.Server.ReplayBufferSize)
+	apiServer.subscriptions.SetIdempotencyTTL(cfg.Server.IdempotencyTTL)
+	apiServer.subscriptions.SetConnectTokenTTL(cfg.Server.ConnectTokenTTL)
+	apiServer.subscriptions.SetRequireKeyword(cfg.Server.RequireKeyword)
+	apiServer.subscriptions.SetWebhookAllowPrivateAddresses(cfg.Server.WebhookAllowPrivateAddresses)
+	var publishers subscription.MultiPublisher
+	if cfg.Bus.Type == config.BusTypeNATS {
+		publisher, err := bus.NewNATSPublisher(cfg.Bus.URL, cfg.Bus.SubjectPrefix)
+		if err != nil {
+			log.Printf("⚠️  Not publishing events to NATS: %v", err)
+		} else {
+			publishers = append(publishers, publisher)
+		}
+	}
+	if cfg.Kafka.Enabled() {
+		publisher, err := bus.NewKafkaPublisher(cfg.Kafka)
+		if err != nil {
+			log.Printf("⚠️  Not publishing events to Kafka: %v", err)
+		} else {
+			publishers = append(publishers, publisher)
+		}
+	}
+	switch len(publishers) {
+	case 0:
+	case 1:
+		apiServer.subscriptions.SetEventPublisher(publishers[0])
+	default:
+		apiServer.subscriptions.SetEventPublisher(publishers)
 	}
 
 	// Register API routes with CORS middleware
 	mux.HandleFunc("/api/filters", apiServer.corsMiddleware(apiServer.handleFilters))
-	mux.HandleFunc("/api/filters/update", apiServer.corsMiddleware(apiServer.handleUpdateFilters))
-	mux.HandleFunc("/api/filters/create", apiServer.corsMiddleware(apiServer.handleCreateFilter))
+	mux.HandleFunc("/api/filters/update", apiServer.corsMiddleware(apiServer.authMiddleware(apiServer.handleUpdateFilters)))
+	mux.HandleFunc("/api/filters/create", apiServer.corsMiddleware(apiServer.authMiddleware(apiServer.handleCreateFilter)))
+	mux.HandleFunc("/api/filters/batch", apiServer.corsMiddleware(apiServer.authMiddleware(apiServer.handleCreateFilters)))
+	mux.HandleFunc("/api/filters/test", apiServer.corsMiddleware(apiServer.handleTestFilter))
+	mux.HandleFunc("/api/filters/validate", apiServer.corsMiddleware(apiServer.handleValidateFilter))
+	mux.HandleFunc("/api/filters/delete/", apiServer.corsMiddleware(apiServer.authMiddleware(apiServer.handleDeleteFilter)))
+	mux.HandleFunc("/api/admin/filters/", apiServer.corsMiddleware(apiServer.adminMiddleware(apiServer.handleAdminDeleteFilter)))
+	mux.HandleFunc("/api/admin/connections", apiServer.corsMiddleware(apiServer.adminMiddleware(apiServer.handleAdminCloseConnections)))
 	mux.HandleFunc("/api/subscriptions", apiServer.corsMiddleware(apiServer.handleGetSubscriptions))
-	mux.HandleFunc("/api/subscriptions/", apiServer.corsMiddleware(apiServer.handleGetSubscription))
+	mux.HandleFunc("/api/subscriptions/", apiServer.corsMiddleware(apiServer.authMiddleware(apiServer.handleSubscription)))
 	mux.HandleFunc("/api/stats", apiServer.corsMiddleware(apiServer.handleStats))
+	mux.HandleFunc("/api/stats/detailed", apiServer.corsMiddleware(apiServer.handleDetailedStats))
+	mux.HandleFunc("/api/keywords", apiServer.corsMiddleware(apiServer.handleKeywords))
 	mux.HandleFunc("/api/status", apiServer.corsMiddleware(apiServer.handleStatus))
+	mux.HandleFunc("/api/version", apiServer.corsMiddleware(apiServer.handleVersion))
+	mux.HandleFunc("/healthz", apiServer.corsMiddleware(apiServer.handleHealthz))
+	mux.HandleFunc("/readyz", apiServer.corsMiddleware(apiServer.handleReadyz))
+	mux.HandleFunc("/ws/stats", apiServer.handleStatsWebSocket)
+	mux.HandleFunc("/ws/tap", apiServer.handleTapWebSocket)
 	mux.HandleFunc("/ws/", apiServer.handleWebSocket)
+	mux.HandleFunc("/sse/", apiServer.corsMiddleware(apiServer.handleSSE))
 	mux.HandleFunc("/", apiServer.corsMiddleware(apiServer.handleRoot))
 
 	// Register Swagger UI
 	mux.Handle("/swagger/", httpSwagger.WrapHandler)
 
+	// Log every request, whichever route serves it
+	apiServer.server.Handler = apiServer.loggingMiddleware(mux)
+
 	return apiServer
 }
 
@@ -131,10 +480,26 @@ func (s *Server) GetSubscriptionManager() *subscription.Manager {
 	return s.subscriptions
 }
 
-// Start starts the API server
+// Start listens on the configured address and serves the API
 func (s *Server) Start() error {
-	fmt.Printf("Starting API server on %s\n", s.server.Addr)
-	return s.server.ListenAndServe()
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(listener)
+}
+
+// serve accepts API connections on listener until the server is stopped, over TLS when
+// server.tls is configured. HTTP/2 is then offered through ALPN; WebSocket clients still
+// upgrade over HTTP/1.1, so wss:// works the same as ws://
+func (s *Server) serve(listener net.Listener) error {
+	if tlsConfig := s.currentConfig().Server.TLS; tlsConfig.Enabled() {
+		s.server.TLSConfig = &tls.Config{MinVersion: tlsConfig.MinTLSVersion()}
+		slog.Info("Starting API server", "addr", listener.Addr().String(), "tls", true, "minVersion", tlsConfig.MinVersion)
+		return s.server.ServeTLS(listener, tlsConfig.CertFile, tlsConfig.KeyFile)
+	}
+	slog.Info("Starting API server", "addr", listener.Addr().String())
+	return s.server.Serve(listener)
 }
 
 // Stop gracefully stops the API server
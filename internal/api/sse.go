@@ -0,0 +1,229 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// sseKeepAliveInterval is how often a comment line is sent to keep idle SSE streams open through proxies
+const sseKeepAliveInterval = 30 * time.Second
+
+// errSSEClosed is returned when writing to a closed SSE connection
+var errSSEClosed = errors.New("sse connection closed")
+
+// sseConnection adapts a streaming HTTP response to the subscription manager's Connection interface
+type sseConnection struct {
+	mu         sync.Mutex
+	w          http.ResponseWriter
+	flusher    http.Flusher
+	controller *http.ResponseController
+	remoteAddr net.Addr
+	closed     bool
+	done       chan struct{}
+}
+
+// sseAddr is the client address of an SSE stream, taken from the request
+type sseAddr string
+
+func (a sseAddr) Network() string { return "tcp" }
+func (a sseAddr) String() string  { return string(a) }
+
+// newSSEConnection wraps a response writer, failing if it can't stream
+func newSSEConnection(w http.ResponseWriter, r *http.Request) (*sseConnection, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+	return &sseConnection{
+		w:          w,
+		flusher:    flusher,
+		controller: http.NewResponseController(w),
+		remoteAddr: sseAddr(r.RemoteAddr),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// WriteJSON sends v as a single SSE message, using the message type as the event name
+func (c *sseConnection) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errSSEClosed
+	}
+
+	if msg, ok := v.(models.WSMessage); ok && msg.Type != "" {
+		if _, err := fmt.Fprintf(c.w, "event: %s\n", msg.Type); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(c.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+// writeComment sends an SSE comment line, used for keep-alives
+func (c *sseConnection) writeComment(comment string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errSSEClosed
+	}
+	if _, err := fmt.Fprintf(c.w, ": %s\n\n", comment); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline on the underlying connection when the server supports it
+func (c *sseConnection) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errSSEClosed
+	}
+	if err := c.controller.SetWriteDeadline(t); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// RemoteAddr returns the client address of the stream
+func (c *sseConnection) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// Close marks the stream closed and signals the handler to return
+func (c *sseConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+// handleSSE streams filtered events as Server-Sent Events
+// @Summary Server-Sent Events Stream
+// @Description Stream real-time filtered events as text/event-stream, for clients that can't use WebSockets. Messages carry the same JSON as the WebSocket endpoint, with the message type as the SSE event name.
+// @Tags WebSocket
+// @Produce text/event-stream
+// @Param filterKey path string true "The unique filter key obtained from creating a subscription"
+// @Success 200 "Event stream established"
+// @Param api_key query string false "API key, when auth.require_for_streams is enabled"
+// @Param token query string false "Connect token, when the filter was created with requireToken"
+// @Failure 400 "Filter key required"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth.require_for_streams is enabled), or invalid or expired connect token"
+// @Failure 404 "Invalid filter key"
+// @Failure 503 "Maximum connections reached"
+// @Router /sse/{filterKey} [get]
+func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filterKey := strings.TrimPrefix(r.URL.Path, "/sse/")
+	if filterKey == "" {
+		http.Error(w, "Filter key required", http.StatusBadRequest)
+		return
+	}
+
+	if !s.authorizeStream(r) {
+		writeUnauthorized(w)
+		return
+	}
+	if !s.authorizeConnectToken(w, r, filterKey) {
+		return
+	}
+
+	conn, err := newSSEConnection(w, r)
+	if err != nil {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	result := s.subscriptions.AddConnectionWithResult(filterKey, conn)
+	if !result.Success {
+		status := http.StatusNotFound
+		if result.ErrorCode == "MAX_CONNECTIONS_REACHED" {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: result.ErrorMessage,
+			Data:    map[string]string{"errorCode": result.ErrorCode, "filterKey": filterKey},
+		}); err != nil {
+			log.Printf("Failed to write SSE error response: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	// Send welcome message
+	welcomeMsg := models.WSMessage{
+		Type:      "connected",
+		Timestamp: time.Now(),
+		Data: map[string]string{
+			"filterKey": filterKey,
+			"status":    "connected",
+			"message":   "Successfully connected to filter subscription",
+		},
+	}
+	if err := conn.WriteJSON(welcomeMsg); err != nil {
+		log.Printf("Failed to send SSE welcome message: %v", err)
+	}
+
+	log.Printf("🔌 SSE connected for filter %s", filterKey[:8]+"...")
+
+	// Stop writing before the handler returns; the response writer is invalid afterwards
+	defer func() {
+		s.subscriptions.RemoveConnection(filterKey, conn)
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing SSE connection: %v", err)
+		}
+		log.Printf("🔌 SSE disconnected for filter %s", filterKey[:8]+"...")
+	}()
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			// Client disconnected
+			return
+		case <-conn.done:
+			// Closed by the subscription manager (filter deleted, dead connection, shutdown)
+			return
+		case <-ticker.C:
+			if err := conn.writeComment("keep-alive"); err != nil {
+				return
+			}
+		}
+	}
+}
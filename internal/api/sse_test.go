@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/subscription"
+)
+
+// readSSEMessage reads one SSE message, returning its event name and data
+func readSSEMessage(t *testing.T, reader *bufio.Reader) (string, string) {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read SSE stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if data != "" {
+				return event, data
+			}
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestHandleSSE(t *testing.T) {
+	subscriptionManager := subscription.NewManager()
+	server := &Server{
+		subscriptions: subscriptionManager,
+	}
+
+	filterKey := subscriptionManager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	ts := httptest.NewServer(http.HandlerFunc(server.handleSSE))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/sse/" + filterKey)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", contentType)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if event, _ := readSSEMessage(t, reader); event != "connected" {
+		t.Fatalf("Expected connected event, got %s", event)
+	}
+
+	subscriptionManager.BroadcastEvent(&models.ATEvent{
+		Did:  "did:plc:test123",
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{{
+			Action: "create",
+			Path:   "app.bsky.feed.post/abc123",
+			Record: map[string]interface{}{"text": "hello world"},
+		}},
+	})
+
+	event, data := readSSEMessage(t, reader)
+	if event != "event" {
+		t.Fatalf("Expected event message, got %s", event)
+	}
+	var message struct {
+		Type string                 `json:"type"`
+		Data models.EnrichedATEvent `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		t.Fatalf("Failed to decode event data: %v", err)
+	}
+	if message.Data.Did != "did:plc:test123" || message.Data.Timestamps.FilterKey != filterKey {
+		t.Errorf("Unexpected event data: %+v", message.Data)
+	}
+
+	if sub, _ := subscriptionManager.GetSubscription(filterKey); sub.Connections != 1 || sub.MessagesDelivered != 1 {
+		t.Errorf("Expected 1 connection and 1 delivered message, got %d and %d", sub.Connections, sub.MessagesDelivered)
+	}
+
+	// Deleting the filter closes the stream
+	if _, ok := subscriptionManager.DeleteFilter(filterKey); !ok {
+		t.Fatal("Expected filter to be deleted")
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected stream to end cleanly, got %v", err)
+	}
+}
+
+func TestHandleSSEErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConnections int
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "Empty filter key",
+			maxConnections: 10,
+			method:         http.MethodGet,
+			path:           "/sse/",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Unknown filter key",
+			maxConnections: 10,
+			method:         http.MethodGet,
+			path:           "/sse/0123456789abcdef0123456789abcdef",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Max connections reached",
+			maxConnections: 0,
+			method:         http.MethodGet,
+			path:           "/sse/",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Wrong method",
+			maxConnections: 10,
+			method:         http.MethodPost,
+			path:           "/sse/",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscriptionManager := subscription.NewManagerWithConfig(tt.maxConnections)
+			server := &Server{
+				subscriptions: subscriptionManager,
+			}
+
+			path := tt.path
+			if strings.HasSuffix(path, "/sse/") && tt.expectedStatus != http.StatusBadRequest {
+				path += subscriptionManager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+			}
+
+			req := httptest.NewRequest(tt.method, path, nil)
+			rr := httptest.NewRecorder()
+
+			server.handleSSE(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// defaultStatsStreamInterval is how often /ws/stats pushes a snapshot when the server config doesn't set it
+const defaultStatsStreamInterval = 5 * time.Second
+
+// statsStreamInterval returns the configured interval between /ws/stats snapshots
+func (s *Server) statsStreamInterval() time.Duration {
+	if cfg := s.currentConfig(); cfg != nil && cfg.Server.StatsStreamInterval > 0 {
+		return cfg.Server.StatsStreamInterval
+	}
+	return defaultStatsStreamInterval
+}
+
+// handleStatsWebSocket streams the statistics snapshot over WebSocket for live dashboards
+// @Summary Statistics Stream
+// @Description Stream the same statistics as /api/stats over WebSocket as {"type":"stats"} messages: one on connect and then one every server.stats_stream_interval (default 5s). Stats connections aren't attached to a filter, so they don't count against the connection limits. Messages sent by the client are ignored.
+// @Tags WebSocket
+// @Param api_key query string false "API key, when auth.require_for_streams is enabled"
+// @Success 101 "WebSocket connection established"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key (when auth.require_for_streams is enabled)"
+// @Router /ws/stats [get]
+func (s *Server) handleStatsWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeStream(r) {
+		writeUnauthorized(w)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing stats connection: %v", err)
+		}
+		log.Printf("📊 Stats stream disconnected")
+	}()
+
+	const maxMessageSize = 512 // Clients have nothing to send but control frames
+	writeWait, pongWait, pingPeriod := s.webSocketTimeouts()
+
+	conn.SetReadLimit(maxMessageSize)
+	if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+		log.Printf("Failed to set read deadline: %v", err)
+	}
+	conn.SetPongHandler(func(string) error {
+		if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+			log.Printf("Failed to set read deadline in pong handler: %v", err)
+		}
+		return nil
+	})
+
+	// Read (and discard) client messages so pongs and close frames are processed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+					log.Printf("Stats stream unexpected close: %v", err)
+				}
+				return
+			}
+		}
+	}()
+
+	sendStats := func() error {
+		if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(models.WSMessage{
+			Type:      "stats",
+			Timestamp: time.Now(),
+			Data:      s.subscriptions.GetStats(),
+		})
+	}
+
+	log.Printf("📊 Stats stream connected")
+	if err := sendStats(); err != nil {
+		log.Printf("Failed to send stats: %v", err)
+		return
+	}
+
+	statsTicker := time.NewTicker(s.statsStreamInterval())
+	defer statsTicker.Stop()
+	pingTicker := time.NewTicker(pingPeriod)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-statsTicker.C:
+			if err := sendStats(); err != nil {
+				log.Printf("Failed to send stats: %v", err)
+				return
+			}
+		case <-pingTicker.C:
+			if err := conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+				log.Printf("Failed to set write deadline for ping: %v", err)
+			}
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("Failed to send ping: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/subscription"
+)
+
+// handleTapWebSocket streams a random sample of every event, whatever the filters, for operators
+// checking what the firehose looks like
+// @Summary Firehose Tap
+// @Description Stream a deterministic sample of every event the server receives over WebSocket, bypassing filters and the requirement that they have criteria. The sample rate is capped at 0.01 and at most 5 taps may be open at once; taps don't count against the connection limits. Admin-only: API key auth must be enabled and the key is sent as a bearer token or ?api_key=. Messages sent by the client are ignored.
+// @Tags Admin
+// @Param rate query number false "Share of events to receive, greater than 0 and at most 0.01" default(0.001)
+// @Param api_key query string false "API key, if not sent as a bearer token"
+// @Success 101 "WebSocket connection established"
+// @Failure 400 {object} models.APIResponse "Invalid rate"
+// @Failure 401 {object} models.APIResponse "Invalid or missing API key"
+// @Failure 403 {object} models.APIResponse "API key auth is disabled"
+// @Failure 503 {object} models.APIResponse "Too many taps are open"
+// @Router /ws/tap [get]
+func (s *Server) handleTapWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled() {
+		writeAdminDisabled(w)
+		return
+	}
+	if !s.validAPIKey(streamAPIKey(r)) {
+		writeUnauthorized(w)
+		return
+	}
+
+	rate := subscription.DefaultTapRate
+	if raw := r.URL.Query().Get("rate"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 || parsed > subscription.MaxTapRate {
+			writeTapError(w, http.StatusBadRequest, fmt.Sprintf("rate must be a number greater than 0 and at most %g", subscription.MaxTapRate))
+			return
+		}
+		rate = parsed
+	}
+	if s.subscriptions.TapCount() >= subscription.MaxTaps {
+		writeTapError(w, http.StatusServiceUnavailable, "Too many tap connections")
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer func() {
+		s.subscriptions.RemoveTap(conn)
+		if err := conn.Close(); err != nil {
+			log.Printf("Error closing tap connection: %v", err)
+		}
+		log.Printf("🚰 Tap disconnected: %s", r.RemoteAddr)
+	}()
+
+	// Another tap may have taken the last slot since the check above
+	if err := s.subscriptions.AddTap(conn, rate); err != nil {
+		reason := "Failed to open tap"
+		if errors.Is(err, subscription.ErrTooManyTaps) {
+			reason = "Too many tap connections"
+		}
+		if writeErr := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason)); writeErr != nil {
+			log.Printf("Failed to send close message: %v", writeErr)
+		}
+		return
+	}
+	log.Printf("🚰 Tap connected: %s (rate %g)", r.RemoteAddr, rate)
+
+	const maxMessageSize = 512 // Clients have nothing to send but control frames
+	writeWait, pongWait, pingPeriod := s.webSocketTimeouts()
+
+	conn.SetReadLimit(maxMessageSize)
+	if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+		log.Printf("Failed to set read deadline: %v", err)
+	}
+	conn.SetPongHandler(func(string) error {
+		if err := conn.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
+			log.Printf("Failed to set read deadline in pong handler: %v", err)
+		}
+		return nil
+	})
+
+	// Read (and discard) client messages so pongs and close frames are processed
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+					log.Printf("Tap unexpected close: %v", err)
+				}
+				return
+			}
+		}
+	}()
+
+	pingTicker := time.NewTicker(pingPeriod)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-pingTicker.C:
+			// Control frames may be written concurrently with the tap's writer
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				log.Printf("Failed to send ping: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// writeTapError writes an error API response for a tap request that can't be upgraded
+func writeTapError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.APIResponse{
+		Success: false,
+		Message: message,
+	}); err != nil {
+		log.Printf("Failed to encode error response: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// Build information, injected at compile time, e.g.
+//
+//	go build -ldflags "-X github.com/JWhist/AT_Proto_PubSub/internal/api.Version=v1.2.0 \
+//	  -X github.com/JWhist/AT_Proto_PubSub/internal/api.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/JWhist/AT_Proto_PubSub/internal/api.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// buildCommit returns Commit, falling back to the VCS revision the Go toolchain stamps into
+// builds from a git checkout
+func buildCommit() string {
+	if Commit != "unknown" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && setting.Value != "" {
+				return setting.Value
+			}
+		}
+	}
+	return Commit
+}
+
+// credentialParams are substrings of query parameter names whose values are treated as credentials
+var credentialParams = []string{"token", "key", "pass", "secret", "auth", "sig", "credential"}
+
+// redactURL hides the user info of a URL and the values of credential-looking query
+// parameters (token, api_key, password and so on), which may hold credentials
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[invalid URL]"
+	}
+	if u.User != nil {
+		u.User = url.User("redacted")
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			lower := strings.ToLower(name)
+			for _, credential := range credentialParams {
+				if strings.Contains(lower, credential) {
+					query[name] = []string{"redacted"}
+					break
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// upstreamStatuses returns the firehose upstream statuses with their URLs redacted
+func (s *Server) upstreamStatuses() []models.FirehoseUpstreamStatus {
+	statuses := s.firehoseClient.UpstreamStatuses()
+	for i := range statuses {
+		statuses[i].URL = redactURL(statuses[i].URL)
+	}
+	return statuses
+}
+
+// firehoseURLs returns the firehose upstream URLs in use, redacted
+func (s *Server) firehoseURLs() []string {
+	var urls []string
+	if s.firehoseClient != nil {
+		for _, upstream := range s.firehoseClient.UpstreamStatuses() {
+			urls = append(urls, upstream.URL)
+		}
+	} else if cfg := s.currentConfig(); cfg != nil {
+		urls = cfg.Firehose.UpstreamURLs()
+	}
+
+	redacted := make([]string, len(urls))
+	for i, u := range urls {
+		redacted[i] = redactURL(u)
+	}
+	return redacted
+}
+
+// handleVersion returns the build information of the running server
+// @Summary Version
+// @Description Get the build version, git commit and build date injected at compile time, the Go runtime version and the firehose URLs in use, with any credentials redacted. Useful to verify what a deployment is running.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} models.APIResponse{data=models.VersionResponse} "Version information"
+// @Router /api/version [get]
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := models.APIResponse{
+		Success: true,
+		Message: "Version information retrieved successfully",
+		Data: models.VersionResponse{
+			Version:      Version,
+			Commit:       buildCommit(),
+			BuildDate:    BuildDate,
+			GoVersion:    runtime.Version(),
+			FirehoseURLs: s.firehoseURLs(),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
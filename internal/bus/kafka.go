@@ -0,0 +1,253 @@
+package bus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// Kafka producer defaults
+const (
+	kafkaQueueSize      = 8192             // Records buffered before new ones are dropped
+	kafkaMaxBatchBytes  = 512 * 1024       // Payload bytes per batch, well below the brokers' default 1MB message limit
+	kafkaDialTimeout    = 5 * time.Second  // Timeout for connecting to a broker
+	kafkaRequestTimeout = 10 * time.Second // How long the leader waits for replicas to acknowledge a produce request
+	kafkaCloseTimeout   = 5 * time.Second  // How long Close waits for buffered records to be delivered
+	kafkaMaxTopicLength = 249              // Longest topic name Kafka accepts
+	kafkaClientID       = "atprotopubsub"
+
+	defaultKafkaMetadataMaxAge = 5 * time.Minute // How long partition leaders are cached when the config doesn't say
+)
+
+// KafkaPublisher produces event messages as JSON records to a Kafka topic per filter key or per
+// record collection, keyed by the event's DID so each repository's events stay in one partition.
+// Producing is left to a franz-go client, which batches records per partition, picks partitions
+// with the murmur2 hash of the Java client's default partitioner, produces idempotently with
+// acks=all and retries retriable broker errors up to MaxRetries times. Records that still fail
+// are counted as failed. Brokers can be reached over TLS and authenticated to with SASL PLAIN or
+// SCRAM.
+type KafkaPublisher struct {
+	config    config.KafkaConfig
+	client    *kgo.Client
+	queueSize int64 // Buffered records at which Publish starts dropping messages
+}
+
+// NewKafkaPublisher starts producing to the configured brokers in the background
+func NewKafkaPublisher(cfg config.KafkaConfig) (*KafkaPublisher, error) {
+	return newKafkaPublisher(cfg, kafkaQueueSize)
+}
+
+// newKafkaPublisher is NewKafkaPublisher with the number of records buffered before messages are
+// dropped
+func newKafkaPublisher(cfg config.KafkaConfig, queueSize int) (*KafkaPublisher, error) {
+	if !cfg.Enabled() {
+		return nil, errors.New("no Kafka brokers configured")
+	}
+	if cfg.TopicBy != config.KafkaTopicByFilter && cfg.TopicBy != config.KafkaTopicByCollection {
+		return nil, fmt.Errorf("invalid Kafka topic_by: %s", cfg.TopicBy)
+	}
+	cfg.TopicPrefix = strings.TrimSuffix(cfg.TopicPrefix, ".")
+	compression := kgo.NoCompression()
+	switch cfg.Compression {
+	case "", config.KafkaCompressionNone:
+	case config.KafkaCompressionGzip:
+		compression = kgo.GzipCompression()
+	default:
+		return nil, fmt.Errorf("invalid Kafka compression: %s", cfg.Compression)
+	}
+	cfg.MaxRetries = max(cfg.MaxRetries, 0)
+	if cfg.MetadataMaxAge <= 0 {
+		cfg.MetadataMaxAge = defaultKafkaMetadataMaxAge
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ClientID(kafkaClientID),
+		kgo.WithLogger(kafkaLogger{}),
+		kgo.DialTimeout(kafkaDialTimeout),
+		kgo.MetadataMaxAge(cfg.MetadataMaxAge),
+		kgo.AllowAutoTopicCreation(),
+		kgo.MaxBufferedRecords(queueSize),
+		kgo.ProducerLinger(cfg.Linger),
+		kgo.ProducerBatchMaxBytes(kafkaMaxBatchBytes),
+		kgo.ProducerBatchCompression(compression),
+		kgo.ProduceRequestTimeout(kafkaRequestTimeout),
+		kgo.RecordRetries(cfg.MaxRetries + 1), // Counts the first try as well
+	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := kafkaTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	switch cfg.SASL.Mechanism {
+	case "":
+	case config.KafkaSASLPlain:
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.SASL.Username, Pass: cfg.SASL.Password}.AsMechanism()))
+	case config.KafkaSASLScramSHA256:
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASL.Username, Pass: cfg.SASL.Password}.AsSha256Mechanism()))
+	case config.KafkaSASLScramSHA512:
+		opts = append(opts, kgo.SASL(scram.Auth{User: cfg.SASL.Username, Pass: cfg.SASL.Password}.AsSha512Mechanism()))
+	default:
+		return nil, fmt.Errorf("invalid Kafka SASL mechanism: %s", cfg.SASL.Mechanism)
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	return &KafkaPublisher{config: cfg, client: client, queueSize: int64(queueSize)}, nil
+}
+
+// kafkaTLSConfig returns the client TLS settings for the brokers, trusting the CAs in CAFile
+// instead of the system roots when it is set
+func kafkaTLSConfig(cfg config.KafkaTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka CA file: %w", err)
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in Kafka CA file %s", cfg.CAFile)
+	}
+	return tlsConfig, nil
+}
+
+// Topic returns the topic a filter's message is produced to
+func (p *KafkaPublisher) Topic(filterKey string, message models.WSMessage) string {
+	name := filterKey
+	if p.config.TopicBy == config.KafkaTopicByCollection {
+		name, _ = messageRouting(message)
+	}
+	if p.config.TopicPrefix != "" {
+		name = p.config.TopicPrefix + "." + name
+	}
+	return kafkaTopicName(name)
+}
+
+// messageRouting returns the collection (or, for identity and account events, the event kind)
+// and the DID of a forwarded message
+func messageRouting(message models.WSMessage) (collection, did string) {
+	switch data := message.Data.(type) {
+	case models.EnrichedATEvent:
+		for _, op := range data.Ops {
+			if op.Collection != "" {
+				return op.Collection, data.Did
+			}
+			if collection, _, _ := strings.Cut(op.Path, "/"); collection != "" {
+				return collection, data.Did
+			}
+		}
+		if data.Kind != "" && data.Kind != models.EventKindCommit {
+			return data.Kind, data.Did
+		}
+		return "unknown", data.Did
+	case models.DeleteNotification:
+		return data.Collection, data.Did
+	}
+	return "unknown", ""
+}
+
+// kafkaTopicName replaces the characters Kafka doesn't allow in topic names with '_' and cuts
+// the name to the longest length Kafka accepts
+func kafkaTopicName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > kafkaMaxTopicLength {
+		name = name[:kafkaMaxTopicLength]
+	}
+	return name
+}
+
+// Publish hands a message for the filter's topic to the client without blocking
+func (p *KafkaPublisher) Publish(filterKey string, message models.WSMessage) error {
+	value, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	if p.client.BufferedProduceRecords() >= p.queueSize {
+		metriks.KafkaMessagesFailed.WithLabelValues("queue_full").Inc()
+		return ErrQueueFull
+	}
+
+	// Records without a DID have no key and are spread over the partitions
+	record := &kgo.Record{Topic: p.Topic(filterKey, message), Value: value, Timestamp: message.Timestamp}
+	if _, did := messageRouting(message); did != "" {
+		record.Key = []byte(did)
+	}
+	p.client.TryProduce(context.Background(), record, p.delivered)
+	return nil
+}
+
+// delivered counts the outcome of producing a record
+func (p *KafkaPublisher) delivered(record *kgo.Record, err error) {
+	var brokerErr *kerr.Error
+	switch {
+	case err == nil:
+		metriks.KafkaMessagesDelivered.Inc()
+	case errors.Is(err, kgo.ErrClientClosed):
+		// Discarded by Close
+	case errors.Is(err, kgo.ErrMaxBuffered):
+		// Another Publish filled the buffer after the check in Publish
+		metriks.KafkaMessagesFailed.WithLabelValues("queue_full").Inc()
+	case errors.As(err, &brokerErr) && !brokerErr.Retriable:
+		slog.Warn("Kafka rejected message", "topic", record.Topic, "partition", record.Partition, "error", err)
+		metriks.KafkaMessagesFailed.WithLabelValues("rejected").Inc()
+	default:
+		slog.Warn("Giving up on Kafka message", "topic", record.Topic, "error", err)
+		metriks.KafkaMessagesFailed.WithLabelValues("retries_exhausted").Inc()
+	}
+}
+
+// Close waits up to kafkaCloseTimeout for buffered records to be delivered and closes the broker
+// connections; records still buffered after that are discarded
+func (p *KafkaPublisher) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaCloseTimeout)
+	defer cancel()
+	if err := p.client.Flush(ctx); err != nil {
+		slog.Warn("Closing Kafka publisher with undelivered messages", "messages", p.client.BufferedProduceRecords())
+	}
+	p.client.Close()
+	return nil
+}
+
+// kafkaLogger passes the client's warnings and errors on to slog
+type kafkaLogger struct{}
+
+// Level returns the most verbose level the client logs at
+func (kafkaLogger) Level() kgo.LogLevel { return kgo.LogLevelWarn }
+
+// Log logs a client message with its key-value pairs
+func (kafkaLogger) Log(level kgo.LogLevel, msg string, keyvals ...any) {
+	if level == kgo.LogLevelError {
+		slog.Error("Kafka client: "+msg, keyvals...)
+		return
+	}
+	slog.Warn("Kafka client: "+msg, keyvals...)
+}
@@ -0,0 +1,212 @@
+package bus
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// unreachableBroker returns the address of a port nothing listens on
+func unreachableBroker(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func testEvent(did string) models.WSMessage {
+	return models.WSMessage{
+		Type:      "event",
+		Timestamp: time.Now(),
+		Data: models.EnrichedATEvent{
+			Did:  did,
+			Kind: models.EventKindCommit,
+			Ops:  []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc", Collection: "app.bsky.feed.post"}},
+		},
+	}
+}
+
+func TestNewKafkaPublisherValidation(t *testing.T) {
+	valid := config.KafkaConfig{Brokers: []string{"127.0.0.1:9092"}, TopicBy: config.KafkaTopicByFilter}
+	tests := []struct {
+		name   string
+		modify func(*config.KafkaConfig)
+	}{
+		{"no brokers", func(c *config.KafkaConfig) { c.Brokers = nil }},
+		{"topic_by", func(c *config.KafkaConfig) { c.TopicBy = "nsid" }},
+		{"compression", func(c *config.KafkaConfig) { c.Compression = "zstd" }},
+		{"sasl mechanism", func(c *config.KafkaConfig) { c.SASL.Mechanism = "GSSAPI" }},
+		{"missing CA file", func(c *config.KafkaConfig) {
+			c.TLS = config.KafkaTLSConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			if publisher, err := NewKafkaPublisher(cfg); err == nil {
+				publisher.Close()
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	caFile := selfSignedCA(t)
+	valid.TLS = config.KafkaTLSConfig{Enabled: true, CAFile: caFile}
+	valid.SASL = config.KafkaSASLConfig{Mechanism: config.KafkaSASLScramSHA512, Username: "user", Password: "secret"}
+	valid.Compression = config.KafkaCompressionGzip
+	publisher, err := NewKafkaPublisher(valid)
+	if err != nil {
+		t.Fatalf("Expected a valid config to be accepted, got %v", err)
+	}
+	publisher.client.Close()
+}
+
+func TestKafkaPublisherQueueFull(t *testing.T) {
+	publisher, err := newKafkaPublisher(config.KafkaConfig{
+		Brokers: []string{unreachableBroker(t)},
+		TopicBy: config.KafkaTopicByFilter,
+		Linger:  time.Millisecond,
+	}, 1)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	// Close would wait for the undeliverable record
+	defer publisher.client.Close()
+
+	queueFull := testutil.ToFloat64(metriks.KafkaMessagesFailed.WithLabelValues("queue_full"))
+	if err := publisher.Publish("abc", testEvent("did:plc:one")); err != nil {
+		t.Fatalf("Expected the first message to be buffered, got %v", err)
+	}
+	if err := publisher.Publish("abc", testEvent("did:plc:two")); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Expected ErrQueueFull, got %v", err)
+	}
+	if count := testutil.ToFloat64(metriks.KafkaMessagesFailed.WithLabelValues("queue_full")) - queueFull; count != 1 {
+		t.Errorf("Expected 1 queue_full failure, got %v", count)
+	}
+}
+
+func TestKafkaPublisherCountsOutcomes(t *testing.T) {
+	publisher := &KafkaPublisher{}
+	counts := func() [4]float64 {
+		return [4]float64{
+			testutil.ToFloat64(metriks.KafkaMessagesDelivered),
+			testutil.ToFloat64(metriks.KafkaMessagesFailed.WithLabelValues("queue_full")),
+			testutil.ToFloat64(metriks.KafkaMessagesFailed.WithLabelValues("rejected")),
+			testutil.ToFloat64(metriks.KafkaMessagesFailed.WithLabelValues("retries_exhausted")),
+		}
+	}
+	tests := []struct {
+		name     string
+		err      error
+		expected [4]float64 // delivered, queue_full, rejected, retries_exhausted
+	}{
+		{"delivered", nil, [4]float64{1, 0, 0, 0}},
+		{"buffer full", kgo.ErrMaxBuffered, [4]float64{0, 1, 0, 0}},
+		{"refused by the broker", kerr.MessageTooLarge, [4]float64{0, 0, 1, 0}},
+		{"retriable broker error", kerr.NotLeaderForPartition, [4]float64{0, 0, 0, 1}},
+		{"out of retries", kgo.ErrRecordRetries, [4]float64{0, 0, 0, 1}},
+		{"client closed", kgo.ErrClientClosed, [4]float64{0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := counts()
+			publisher.delivered(&kgo.Record{Topic: "atproto.abc"}, tt.err)
+			after := counts()
+			for i := range after {
+				if after[i]-before[i] != tt.expected[i] {
+					t.Errorf("Expected counts to change by %v, got %v -> %v", tt.expected, before, after)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestKafkaTLSConfig(t *testing.T) {
+	caFile := selfSignedCA(t)
+	tlsConfig, err := kafkaTLSConfig(config.KafkaTLSConfig{Enabled: true, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("Failed to load CA file: %v", err)
+	}
+	if tlsConfig.RootCAs == nil {
+		t.Error("Expected the CA file to replace the system roots")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	if _, err := kafkaTLSConfig(config.KafkaTLSConfig{Enabled: true, CAFile: empty}); err == nil {
+		t.Error("Expected an error for a CA file without certificates")
+	}
+}
+
+// selfSignedCA writes a self-signed CA certificate to a PEM file and returns its path
+func selfSignedCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	return caFile
+}
+
+func TestKafkaTopic(t *testing.T) {
+	publisher := &KafkaPublisher{config: config.KafkaConfig{TopicBy: config.KafkaTopicByCollection, TopicPrefix: "atproto"}}
+	deleted := models.WSMessage{Data: models.DeleteNotification{Collection: "com.example/odd name"}}
+	if topic := publisher.Topic("abc", deleted); topic != "atproto.com.example_odd_name" {
+		t.Errorf("Expected invalid characters to be replaced, got %s", topic)
+	}
+	account := models.WSMessage{Data: models.EnrichedATEvent{Kind: models.EventKindAccount}}
+	if topic := publisher.Topic("abc", account); topic != "atproto.account" {
+		t.Errorf("Expected account events to go to atproto.account, got %s", topic)
+	}
+
+	publisher.config.TopicBy = config.KafkaTopicByFilter
+	publisher.config.TopicPrefix = ""
+	if topic := publisher.Topic("abc", account); topic != "abc" {
+		t.Errorf("Expected the filter key as topic, got %s", topic)
+	}
+}
@@ -0,0 +1,116 @@
+// Package bus publishes forwarded events to NATS and Kafka for downstream consumers.
+package bus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/nats-io/nats.go"
+)
+
+// NATS publisher defaults
+const (
+	natsReconnectBufSize  = 8 * 1024 * 1024  // Bytes buffered while disconnected before new messages are dropped
+	natsDialTimeout       = 5 * time.Second  // Timeout for each connection attempt
+	natsReconnectDelay    = 1 * time.Second  // Initial delay between connection attempts, doubled per failure
+	natsMaxReconnectDelay = 30 * time.Second // Upper bound for the reconnect delay
+)
+
+// ErrQueueFull is returned by Publish when the outbound queue is full and the message was dropped
+var ErrQueueFull = errors.New("publish queue full")
+
+// NATSPublisher publishes event messages as JSON to a NATS subject per filter key
+// (<prefix>.<filterKey>). It only publishes: nothing in this process subscribes, so relaying
+// the events to clients elsewhere is up to the consumers of those subjects. The client buffers
+// messages and reconnects with backoff; while the server is unreachable the reconnect buffer
+// fills up and further messages are dropped.
+type NATSPublisher struct {
+	conn          *nats.Conn
+	subjectPrefix string
+}
+
+// NewNATSPublisher validates a nats:// or tls:// URL (user:password@ is sent as credentials) and
+// connects in the background
+func NewNATSPublisher(rawURL, subjectPrefix string) (*NATSPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL: %s", rawURL)
+	}
+
+	conn, err := nats.Connect(rawURL,
+		nats.Name("atprotopubsub"),
+		nats.Timeout(natsDialTimeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectBufSize(natsReconnectBufSize),
+		nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			delay := natsReconnectDelay
+			for ; attempts > 1 && delay < natsMaxReconnectDelay; attempts-- {
+				delay *= 2
+			}
+			return min(delay, natsMaxReconnectDelay)
+		}),
+		nats.ConnectHandler(func(c *nats.Conn) {
+			slog.Info("Connected to NATS", "server", c.ConnectedUrlRedacted())
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			slog.Info("Reconnected to NATS", "server", c.ConnectedUrlRedacted())
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				slog.Warn("NATS connection lost", "server", u.Redacted(), "error", err)
+			}
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			slog.Warn("NATS error", "server", u.Redacted(), "error", err)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	return &NATSPublisher{
+		conn:          conn,
+		subjectPrefix: strings.TrimSuffix(subjectPrefix, "."),
+	}, nil
+}
+
+// Subject returns the subject a filter's events are published to
+func (p *NATSPublisher) Subject(filterKey string) string {
+	if p.subjectPrefix == "" {
+		return filterKey
+	}
+	return p.subjectPrefix + "." + filterKey
+}
+
+// Publish hands a message for the filter's subject to the client, which writes it in the
+// background
+func (p *NATSPublisher) Publish(filterKey string, message models.WSMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	if err := p.conn.Publish(p.Subject(filterKey), payload); err != nil {
+		metriks.BusMessagesDropped.Inc()
+		if errors.Is(err, nats.ErrReconnectBufExceeded) {
+			return ErrQueueFull
+		}
+		return err
+	}
+	return nil
+}
+
+// Close flushes buffered messages if connected and closes the connection; messages buffered
+// while disconnected are discarded
+func (p *NATSPublisher) Close() error {
+	p.conn.Close()
+	return nil
+}
@@ -0,0 +1,170 @@
+package bus
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// natsClient is a client connection accepted by fakeNATSServer
+type natsClient struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	connect string // The options JSON the client sent with CONNECT
+}
+
+// fakeNATSServer accepts one client, greets it with INFO, answers the PING that completes the
+// handshake and returns the connection
+func fakeNATSServer(t *testing.T) (string, <-chan natsClient) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	accepted := make(chan natsClient, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			conn.Close()
+			return
+		}
+		if _, err := io.WriteString(conn, `INFO {"server_id":"test","max_payload":1048576}`+"\r\n"); err != nil {
+			conn.Close()
+			return
+		}
+		reader := bufio.NewReader(conn)
+		connect, err := reader.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return
+		}
+		if ping, err := reader.ReadString('\n'); err != nil || ping != "PING\r\n" {
+			conn.Close()
+			return
+		}
+		if _, err := io.WriteString(conn, "PONG\r\n"); err != nil {
+			conn.Close()
+			return
+		}
+		accepted <- natsClient{conn: conn, reader: reader, connect: strings.TrimSuffix(connect, "\r\n")}
+	}()
+	return listener.Addr().String(), accepted
+}
+
+// readLine reads one CRLF-terminated protocol line
+func readLine(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read from client: %v", err)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+func TestNATSPublisher(t *testing.T) {
+	addr, accepted := fakeNATSServer(t)
+	publisher, err := NewNATSPublisher("nats://alice:secret@"+addr, "atproto.filters.")
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	defer publisher.Close()
+
+	var client natsClient
+	select {
+	case client = <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publisher didn't connect")
+	}
+	defer client.conn.Close()
+	reader := client.reader
+
+	connectJSON, ok := strings.CutPrefix(client.connect, "CONNECT ")
+	if !ok {
+		t.Fatalf("Expected CONNECT, got %q", connectJSON)
+	}
+	var options map[string]interface{}
+	if err := json.Unmarshal([]byte(connectJSON), &options); err != nil {
+		t.Fatalf("Invalid CONNECT options: %v", err)
+	}
+	if options["user"] != "alice" || options["pass"] != "secret" || options["verbose"] != false {
+		t.Errorf("Unexpected CONNECT options: %v", options)
+	}
+
+	message := models.WSMessage{Type: "event", Data: map[string]string{"did": "did:plc:test123"}}
+	if err := publisher.Publish("8a3ce5f31b47d4788df91aeb38a565fe", message); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	fields := strings.Fields(readLine(t, reader))
+	if len(fields) != 3 || fields[0] != "PUB" || fields[1] != "atproto.filters.8a3ce5f31b47d4788df91aeb38a565fe" {
+		t.Fatalf("Expected PUB to the filter's subject, got %q", fields)
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		t.Fatalf("Invalid payload size %q", fields[2])
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read payload: %v", err)
+	}
+	var published struct {
+		Type string            `json:"type"`
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(payload[:size], &published); err != nil {
+		t.Fatalf("Payload isn't JSON: %v", err)
+	}
+	if published.Type != "event" || published.Data["did"] != "did:plc:test123" {
+		t.Errorf("Unexpected payload: %s", payload[:size])
+	}
+}
+
+func TestNATSPublisherQueueFull(t *testing.T) {
+	// Nothing listens here, so messages stay in the reconnect buffer
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	publisher, err := NewNATSPublisher("nats://"+addr, "")
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	defer publisher.Close()
+
+	if subject := publisher.Subject("abc"); subject != "abc" {
+		t.Errorf("Expected the bare filter key without a prefix, got %q", subject)
+	}
+
+	message := models.WSMessage{Type: "event", Data: strings.Repeat("x", 1024*1024)}
+	var lastErr error
+	for i := 0; i <= natsReconnectBufSize/(1024*1024) && lastErr == nil; i++ {
+		lastErr = publisher.Publish("abc", message)
+	}
+	if lastErr != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull once the reconnect buffer is full, got %v", lastErr)
+	}
+}
+
+func TestNewNATSPublisherInvalidURL(t *testing.T) {
+	for _, rawURL := range []string{"", "localhost:4222", "http://localhost:4222", "nats://", "tls://"} {
+		if publisher, err := NewNATSPublisher(rawURL, "atproto"); err == nil {
+			publisher.Close()
+			t.Errorf("Expected %q to be rejected", rawURL)
+		}
+	}
+}
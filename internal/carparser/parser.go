@@ -2,14 +2,23 @@ package carparser
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"log/slog"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-car/v2"
 )
 
+// Bounds for ParseCARMessageSimple's scan, so arbitrary input costs at most a fixed number of
+// decodes, each linear in the message size
+const (
+	maxSimpleScanLength     = 64 * 1024 // Leading bytes searched for the start of the commit object
+	maxSimpleDecodeAttempts = 256       // Candidate map headers decoded before giving up
+)
+
 // ATProtoEvent represents a parsed AT Protocol event from the firehose
 type ATProtoEvent struct {
 	Repo string      `json:"repo"`
@@ -65,7 +74,7 @@ func ParseCARMessage(data []byte) (*ATProtoEvent, error) {
 			if rev, ok := cborData["rev"].(string); ok {
 				event.Rev = rev
 			}
-			if seq, ok := cborData["seq"].(int64); ok {
+			if seq, ok := parseSeq(cborData["seq"]); ok {
 				event.Seq = seq
 			}
 			if time, ok := cborData["time"].(string); ok {
@@ -74,18 +83,18 @@ func ParseCARMessage(data []byte) (*ATProtoEvent, error) {
 
 			// Parse operations - with detailed debugging
 			if ops, ok := cborData["ops"].([]interface{}); ok {
-				fmt.Printf("🔍 Found ops field with %d operations\n", len(ops))
+				slog.Debug("Found ops field", "operations", len(ops))
 				for i, op := range ops {
 					if opMap, ok := op.(map[string]interface{}); ok {
 						operation := Operation{}
 
 						if action, ok := opMap["action"].(string); ok {
 							operation.Action = action
-							fmt.Printf("🔍 Operation %d action: %s\n", i, action)
+							slog.Debug("Parsed operation action", "index", i, "action", action)
 						}
 						if path, ok := opMap["path"].(string); ok {
 							operation.Path = path
-							fmt.Printf("🔍 Operation %d path: %s\n", i, path)
+							slog.Debug("Parsed operation path", "index", i, "path", path)
 						}
 						if cidStr, ok := opMap["cid"].(string); ok {
 							operation.CID = &cidStr
@@ -98,7 +107,7 @@ func ParseCARMessage(data []byte) (*ATProtoEvent, error) {
 					}
 				}
 			} else {
-				fmt.Printf("🔍 No 'ops' field found or not an array\n")
+				slog.Debug("No ops field found or not an array")
 			}
 			break
 		}
@@ -111,6 +120,20 @@ func ParseCARMessage(data []byte) (*ATProtoEvent, error) {
 	return event, nil
 }
 
+// parseSeq converts a decoded seq value to int64. CBOR decodes non-negative integers as
+// uint64 and negative ones as int64, and JSON-derived values arrive as float64
+func parseSeq(value interface{}) (int64, bool) {
+	switch seq := value.(type) {
+	case int64:
+		return seq, true
+	case uint64:
+		return int64(seq), true
+	case float64:
+		return int64(seq), true
+	}
+	return 0, false
+}
+
 // ParseCARMessageSimple provides a simpler approach that looks for the main commit object
 func ParseCARMessageSimple(data []byte) (*ATProtoEvent, error) {
 	// Try to find CBOR data that looks like a commit
@@ -120,14 +143,20 @@ func ParseCARMessageSimple(data []byte) (*ATProtoEvent, error) {
 	// AT Protocol commits usually start with specific CBOR patterns
 
 	// For now, let's try a more direct approach - scan for CBOR maps
-	var offset int
-	for offset < len(data) {
-		// Try to decode CBOR from this position
-		decoder := cbor.NewDecoder(bytes.NewReader(data[offset:]))
+	scanLength := min(len(data), maxSimpleScanLength)
+	attempts := 0
+	for offset := 0; offset < scanLength; offset++ {
+		// Only offsets holding a map header that fits in the remaining bytes can start the commit
+		if !couldStartCBORMap(data[offset:]) {
+			continue
+		}
+		if attempts == maxSimpleDecodeAttempts {
+			break
+		}
+		attempts++
 
 		var obj map[string]interface{}
-		if err := decoder.Decode(&obj); err != nil {
-			offset++
+		if _, err := cbor.UnmarshalFirst(data[offset:], &obj); err != nil {
 			continue
 		}
 
@@ -141,68 +170,125 @@ func ParseCARMessageSimple(data []byte) (*ATProtoEvent, error) {
 			if rev, ok := obj["rev"].(string); ok {
 				event.Rev = rev
 			}
-			if seq, ok := obj["seq"].(int64); ok {
+			if seq, ok := parseSeq(obj["seq"]); ok {
 				event.Seq = seq
-			} else if seq, ok := obj["seq"].(uint64); ok {
-				event.Seq = int64(seq)
-			} else if seq, ok := obj["seq"].(float64); ok {
-				event.Seq = int64(seq)
 			}
 			if time, ok := obj["time"].(string); ok {
 				event.Time = time
 			}
 
 			// Parse operations
-			if ops, ok := obj["ops"].([]interface{}); ok {
-				for _, op := range ops {
-					var operation Operation
-					var opMap map[string]interface{}
-
-					// Handle both map[string]interface{} and map[interface{}]interface{}
-					if stringMap, ok := op.(map[string]interface{}); ok {
-						opMap = stringMap
-					} else if interfaceMap, ok := op.(map[interface{}]interface{}); ok {
-						// Convert map[interface{}]interface{} to map[string]interface{}
-						opMap = make(map[string]interface{})
-						for k, v := range interfaceMap {
-							if keyStr, ok := k.(string); ok {
-								opMap[keyStr] = v
-							}
-						}
-					}
+			event.Ops = parseOps(repo, obj["ops"])
 
-					if opMap != nil {
-						if action, ok := opMap["action"].(string); ok {
-							operation.Action = action
-						}
-						if path, ok := opMap["path"].(string); ok {
-							operation.Path = path
-						}
-						if cidBytes, ok := opMap["cid"].([]byte); ok {
-							// CID is often encoded as bytes, try to decode
-							if c, err := cid.Cast(cidBytes); err == nil {
-								cidStr := c.String()
-								operation.CID = &cidStr
-							}
-						} else if cidStr, ok := opMap["cid"].(string); ok {
-							// CID might also come as a string
-							operation.CID = &cidStr
-						}
-						if record, ok := opMap["record"]; ok {
-							operation.Record = record
-						}
+			return event, nil
+		}
+	}
 
-						event.Ops = append(event.Ops, operation)
-					}
-				}
+	return nil, fmt.Errorf("no AT Protocol commit found in message")
+}
+
+// parseOps extracts the operations of a commit's ops value. Besides the usual array of op maps
+// it accepts a single op map and arrays mixing op maps with nested arrays of them; anything
+// else is logged and skipped, so a shape change shows up in the logs instead of as empty commits
+func parseOps(repo string, value interface{}) []Operation {
+	if value == nil {
+		return nil
+	}
+
+	var ops []Operation
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		if items, ok := value.([]interface{}); ok {
+			for _, item := range items {
+				collect(item)
 			}
+			return
+		}
 
-			return event, nil
+		opMap, ok := stringKeyedMap(value)
+		if !ok || !looksLikeOperation(opMap) {
+			slog.Warn("Skipping commit op that can't be interpreted", "repo", repo, "type", fmt.Sprintf("%T", value))
+			return
+		}
+		ops = append(ops, parseOperation(opMap))
+	}
+	collect(value)
+	return ops
+}
+
+// stringKeyedMap returns a decoded CBOR map with its string keys; other keys are dropped.
+// Nested maps decode as map[interface{}]interface{}
+func stringKeyedMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		opMap := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if keyStr, ok := k.(string); ok {
+				opMap[keyStr] = item
+			}
 		}
+		return opMap, true
+	}
+	return nil, false
+}
+
+// looksLikeOperation reports whether a map has the string action or path every op carries
+func looksLikeOperation(opMap map[string]interface{}) bool {
+	_, hasAction := opMap["action"].(string)
+	_, hasPath := opMap["path"].(string)
+	return hasAction || hasPath
+}
 
-		// Move to next byte and try again
-		offset++
+// parseOperation converts an op map to an Operation
+func parseOperation(opMap map[string]interface{}) Operation {
+	var operation Operation
+	if action, ok := opMap["action"].(string); ok {
+		operation.Action = action
+	}
+	if path, ok := opMap["path"].(string); ok {
+		operation.Path = path
+	}
+	if cidBytes, ok := opMap["cid"].([]byte); ok {
+		// CID is often encoded as bytes, try to decode
+		if c, err := cid.Cast(cidBytes); err == nil {
+			cidStr := c.String()
+			operation.CID = &cidStr
+		}
+	} else if cidStr, ok := opMap["cid"].(string); ok {
+		// CID might also come as a string
+		operation.CID = &cidStr
 	}
+	if record, ok := opMap["record"]; ok {
+		operation.Record = record
+	}
+	return operation
+}
 
-	return nil, fmt.Errorf("no AT Protocol commit found in message")
+// couldStartCBORMap reports whether data begins with a CBOR map header (major type 5) whose
+// declared pairs could fit in data, at least one byte for each key and value
+func couldStartCBORMap(data []byte) bool {
+	if len(data) == 0 || data[0]>>5 != 5 {
+		return false
+	}
+
+	var pairs uint64
+	switch info := data[0] & 0x1f; {
+	case info < 24:
+		pairs = uint64(info)
+	case info == 24 && len(data) >= 2:
+		pairs = uint64(data[1])
+	case info == 25 && len(data) >= 3:
+		pairs = uint64(binary.BigEndian.Uint16(data[1:3]))
+	case info == 26 && len(data) >= 5:
+		pairs = uint64(binary.BigEndian.Uint32(data[1:5]))
+	case info == 27 && len(data) >= 9:
+		pairs = binary.BigEndian.Uint64(data[1:9])
+	case info == 31:
+		return len(data) >= 2 // Indefinite length, terminated by a break byte
+	default:
+		return false
+	}
+	return pairs <= uint64(len(data)-1)/2
 }
@@ -1,10 +1,16 @@
 package carparser
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/ipfs/go-cid"
 )
 
 func TestATProtoEvent_Fields(t *testing.T) {
@@ -85,6 +91,28 @@ func TestParseCARMessage_InvalidData(t *testing.T) {
 	}
 }
 
+func TestParseCARMessage_UintSeq(t *testing.T) {
+	// CBOR decodes non-negative integers into interface{} as uint64
+	data := createCARData(t, map[string]interface{}{
+		"repo": "did:plc:test123",
+		"rev":  "3k2abc",
+		"seq":  uint64(4815162342),
+		"time": "2024-01-01T00:00:00Z",
+		"ops":  []interface{}{},
+	})
+
+	event, err := ParseCARMessage(data)
+	if err != nil {
+		t.Fatalf("ParseCARMessage() error = %v", err)
+	}
+	if event.Seq != 4815162342 {
+		t.Errorf("Seq = %d, want 4815162342", event.Seq)
+	}
+	if event.Repo != "did:plc:test123" || event.Rev != "3k2abc" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
 func TestParseCARMessageSimple_InvalidData(t *testing.T) {
 	tests := []struct {
 		name string
@@ -393,6 +421,96 @@ func TestParseCARMessageSimple_OpsNotArray(t *testing.T) {
 	}
 }
 
+func TestParseCARMessageSimple_OpsShapes(t *testing.T) {
+	post := map[string]interface{}{"action": "create", "path": "app.bsky.feed.post/1"}
+	like := map[interface{}]interface{}{"action": "create", "path": "app.bsky.feed.like/2"}
+
+	tests := []struct {
+		name          string
+		ops           interface{}
+		expectedPaths []string
+		expectedSkips int
+	}{
+		{
+			name:          "array of op maps",
+			ops:           []interface{}{post, like},
+			expectedPaths: []string{"app.bsky.feed.post/1", "app.bsky.feed.like/2"},
+		},
+		{
+			name:          "single op map",
+			ops:           post,
+			expectedPaths: []string{"app.bsky.feed.post/1"},
+		},
+		{
+			name:          "single op map with interface keys",
+			ops:           like,
+			expectedPaths: []string{"app.bsky.feed.like/2"},
+		},
+		{
+			name:          "nested arrays of op maps",
+			ops:           []interface{}{[]interface{}{post}, like},
+			expectedPaths: []string{"app.bsky.feed.post/1", "app.bsky.feed.like/2"},
+		},
+		{
+			name:          "mixed shapes",
+			ops:           []interface{}{"garbage", post, 42, nil, []interface{}{like, true}},
+			expectedPaths: []string{"app.bsky.feed.post/1", "app.bsky.feed.like/2"},
+			expectedSkips: 4,
+		},
+		{
+			name:          "map without action or path",
+			ops:           map[string]interface{}{"record": map[string]interface{}{"text": "hi"}},
+			expectedSkips: 1,
+		},
+		{
+			name:          "string",
+			ops:           "not an array",
+			expectedSkips: 1,
+		},
+		{
+			name:          "number",
+			ops:           uint64(7),
+			expectedSkips: 1,
+		},
+		{
+			name: "null",
+			ops:  nil,
+		},
+		{
+			name: "empty array",
+			ops:  []interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defaultLogger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			defer slog.SetDefault(defaultLogger)
+
+			event, err := ParseCARMessageSimple(createCBORData(map[string]interface{}{
+				"repo": "did:plc:test123",
+				"ops":  tt.ops,
+			}))
+			if err != nil {
+				t.Fatalf("ParseCARMessageSimple() error = %v", err)
+			}
+
+			var paths []string
+			for _, op := range event.Ops {
+				paths = append(paths, op.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.expectedPaths) {
+				t.Errorf("Op paths = %v, want %v", paths, tt.expectedPaths)
+			}
+			if skips := strings.Count(logs.String(), "Skipping commit op"); skips != tt.expectedSkips {
+				t.Errorf("Logged %d skipped ops, want %d:\n%s", skips, tt.expectedSkips, logs.String())
+			}
+		})
+	}
+}
+
 func TestParseCARMessageSimple_MultipleOffsets(t *testing.T) {
 	// Create data with garbage at the beginning
 	invalidData := []byte("garbage data")
@@ -414,6 +532,77 @@ func TestParseCARMessageSimple_MultipleOffsets(t *testing.T) {
 	}
 }
 
+func TestParseCARMessageSimple_ScanBounds(t *testing.T) {
+	commit := createCBORData(map[string]interface{}{"repo": "did:plc:test123"})
+
+	// Bytes that can't start a map are skipped without counting as decode attempts
+	padded := append(bytes.Repeat([]byte{0x00}, maxSimpleScanLength-len(commit)), commit...)
+	if _, err := ParseCARMessageSimple(padded); err != nil {
+		t.Errorf("Expected the commit within the scan length to be found, got error: %v", err)
+	}
+
+	// A commit starting past the scan length isn't searched for
+	tooFar := append(bytes.Repeat([]byte{0x00}, maxSimpleScanLength), commit...)
+	if _, err := ParseCARMessageSimple(tooFar); err == nil {
+		t.Error("Expected an error for a commit past the scan length")
+	}
+
+	// Map headers that decode without a repo use up the attempts
+	emptyMaps := append(bytes.Repeat([]byte{0xa0}, maxSimpleDecodeAttempts), commit...)
+	if _, err := ParseCARMessageSimple(emptyMaps); err == nil {
+		t.Error("Expected an error once the decode attempts are used up")
+	}
+}
+
+func TestCouldStartCBORMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{name: "empty", data: nil, expected: false},
+		{name: "not a map", data: []byte{0x61, 'a'}, expected: false},
+		{name: "empty map", data: []byte{0xa0}, expected: true},
+		{name: "small map that fits", data: []byte{0xa1, 0x61, 'a', 0x01}, expected: true},
+		{name: "small map that doesn't fit", data: []byte{0xa5, 0x00, 0x00}, expected: false},
+		{name: "one byte length", data: append([]byte{0xb8, 0x02}, make([]byte, 4)...), expected: true},
+		{name: "truncated length", data: []byte{0xb9, 0x01}, expected: false},
+		{name: "huge length", data: []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}, expected: false},
+		{name: "indefinite length", data: []byte{0xbf, 0xff}, expected: true},
+		{name: "reserved additional info", data: []byte{0xbc, 0x00}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := couldStartCBORMap(tt.data); got != tt.expected {
+				t.Errorf("couldStartCBORMap(%x) = %v, want %v", tt.data, got, tt.expected)
+			}
+		})
+	}
+}
+
+func FuzzParseCARMessageSimple(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("not cbor data"))
+	f.Add(createCBORData(map[string]interface{}{"notrepo": "test"}))
+	f.Add(createCBORData(map[string]interface{}{
+		"repo": "did:plc:test123",
+		"seq":  uint64(12345),
+		"ops": []interface{}{
+			map[string]interface{}{"action": "create", "path": "app.bsky.feed.post/12345", "cid": []byte{1, 85, 18, 32}},
+		},
+	}))
+	f.Add(append([]byte("garbage data"), createCBORData(map[string]interface{}{"repo": "did:plc:test123"})...))
+	f.Add(bytes.Repeat([]byte{0xbf, 0x61, 'a', 0x00}, 64))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		event, err := ParseCARMessageSimple(data)
+		if err == nil && event == nil {
+			t.Fatal("ParseCARMessageSimple() returned neither an event nor an error")
+		}
+	})
+}
+
 func TestOperation_AllFields(t *testing.T) {
 	cidStr := "bafyreiabc123"
 	record := map[string]interface{}{
@@ -490,3 +679,25 @@ func createCBORData(obj interface{}) []byte {
 	}
 	return data
 }
+
+// createCARData wraps a CBOR-encoded object as the single block of a CARv1 archive
+func createCARData(t *testing.T, obj interface{}) []byte {
+	t.Helper()
+	block := createCBORData(obj)
+	blockCid, err := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: 0x12, MhLength: -1}.Sum(block)
+	if err != nil {
+		t.Fatalf("Failed to compute CID: %v", err)
+	}
+
+	// CIDs are CBOR tag 42 over the binary CID with a leading multibase identity byte
+	header := createCBORData(map[string]interface{}{
+		"roots":   []cbor.Tag{{Number: 42, Content: append([]byte{0}, blockCid.Bytes()...)}},
+		"version": 1,
+	})
+
+	car := binary.AppendUvarint(nil, uint64(len(header)))
+	car = append(car, header...)
+	car = binary.AppendUvarint(car, uint64(len(blockCid.Bytes())+len(block)))
+	car = append(car, blockCid.Bytes()...)
+	return append(car, block...)
+}
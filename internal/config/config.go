@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/JWhist/jwconfig"
@@ -13,6 +16,10 @@ import (
 type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Firehose FirehoseConfig `yaml:"firehose"`
+	Filters  FilterConfig   `yaml:"filters"`
+	Identity IdentityConfig `yaml:"identity"`
+	Bus      BusConfig      `yaml:"bus"`
+	Kafka    KafkaConfig    `yaml:"kafka"`
 	Logging  LoggingConfig  `yaml:"logging"`
 }
 
@@ -24,7 +31,76 @@ type ServerConfig struct {
 	MetricsHost     string        `yaml:"metrics_host" default:"localhost"`
 	MaxConnections  int           `yaml:"max_connections" default:"1000"`
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" default:"10s"`
-	CORS            CORSConfig    `yaml:"cors"`
+	// DrainTimeout bounds flushing queued deliveries and waiting for WebSocket clients to close after the going-away frame (capped at ShutdownTimeout)
+	DrainTimeout time.Duration `yaml:"drain_timeout" default:"5s"`
+	// WebSocketCompression negotiates permessage-deflate with clients that support it
+	WebSocketCompression bool `yaml:"websocket_compression" default:"false"`
+	// WebSocketCompressionLevel is the deflate level for compressed frames: 1 (fastest) to 9
+	// (smallest), or -2 for Huffman-only; 0 uses the default of 1
+	WebSocketCompressionLevel int `yaml:"websocket_compression_level" default:"1"`
+	// WebSocketReadBufferSize and WebSocketWriteBufferSize are the per-connection I/O buffer
+	// sizes in bytes; a write buffer that fits a whole event frame saves a syscall per fragment
+	WebSocketReadBufferSize  int `yaml:"websocket_read_buffer_size" default:"1024"`
+	WebSocketWriteBufferSize int `yaml:"websocket_write_buffer_size" default:"1024"`
+	// WebSocketPingInterval is how often clients are pinged; it must be shorter than WebSocketPongWait,
+	// and is 90% of it when unset so shortening the pong wait alone keeps the two consistent
+	WebSocketPingInterval time.Duration `yaml:"websocket_ping_interval"`
+	// WebSocketPongWait is how long a client may stay silent (no pong or message) before it's disconnected
+	WebSocketPongWait time.Duration `yaml:"websocket_pong_wait" default:"60s"`
+	// WebSocketWriteWait is the deadline for writing each ping or reply to a client
+	WebSocketWriteWait time.Duration `yaml:"websocket_write_wait" default:"30s"`
+	// ReplayBufferSize is how many recent events each filter keeps for clients that reconnect (0 disables replay)
+	ReplayBufferSize int `yaml:"replay_buffer_size" default:"100"`
+	// StatsStreamInterval is how often /ws/stats pushes a statistics snapshot
+	StatsStreamInterval time.Duration `yaml:"stats_stream_interval" default:"5s"`
+	// IdempotencyTTL is how long a filter creation's idempotency key returns the same filter
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl" default:"24h"`
+	// ConnectTokenTTL is how long a connect token of a requireToken filter can be used to connect
+	ConnectTokenTTL time.Duration `yaml:"connect_token_ttl" default:"5m"`
+	// RequireKeyword rejects filters without a keyword; when false, repositories or collections alone will do
+	RequireKeyword bool `yaml:"require_keyword" default:"true"`
+	// WebhookAllowPrivateAddresses lets webhooks post to loopback, private and other non-public addresses
+	WebhookAllowPrivateAddresses bool       `yaml:"webhook_allow_private_addresses" default:"false"`
+	CORS                         CORSConfig `yaml:"cors"`
+	Auth                         AuthConfig `yaml:"auth"`
+	TLS                          TLSConfig  `yaml:"tls"`
+}
+
+// TLSConfig serves the API over HTTPS, with HTTP/2 negotiated for clients that support it,
+// once both a certificate and a key are set
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"` // PEM certificate chain
+	KeyFile  string `yaml:"key_file"`  // PEM private key for the certificate
+	// MinVersion is the oldest TLS version accepted: "1.2" or "1.3"
+	MinVersion string `yaml:"min_version" default:"1.2"`
+}
+
+// Enabled reports whether a certificate and key are configured
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// tlsVersions maps the accepted min_version values to crypto/tls versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// MinTLSVersion returns MinVersion as a crypto/tls version, TLS 1.2 if it isn't set or known
+func (t TLSConfig) MinTLSVersion() uint16 {
+	if version, ok := tlsVersions[t.MinVersion]; ok {
+		return version
+	}
+	return tls.VersionTLS12
+}
+
+// AuthConfig contains API key authentication configuration. Enabling auth without any
+// keys rejects every protected request rather than falling back to open access
+type AuthConfig struct {
+	Enabled bool     `yaml:"enabled" default:"false"`
+	APIKeys []string `yaml:"api_keys"`
+	// RequireForStreams also requires a key to open /ws and /sse connections
+	RequireForStreams bool `yaml:"require_for_streams" default:"false"`
 }
 
 // CORSConfig contains CORS configuration
@@ -35,14 +111,167 @@ type CORSConfig struct {
 	AllowedHeaders  []string `yaml:"allowed_headers" default:"[\"*\"]"`
 }
 
+// Firehose sources
+const (
+	FirehoseSourceRepo      = "repo"      // com.atproto.sync.subscribeRepos (CBOR/CAR)
+	FirehoseSourceJetstream = "jetstream" // Bluesky Jetstream (JSON)
+)
+
+// Default firehose endpoints for each source
+const (
+	DefaultRepoURL      = "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"
+	DefaultJetstreamURL = "wss://jetstream2.us-east.bsky.network/subscribe"
+)
+
 // FirehoseConfig contains AT Protocol firehose configuration
 type FirehoseConfig struct {
-	URL            string        `yaml:"url" default:"wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"`
-	ReconnectDelay time.Duration `yaml:"reconnect_delay" default:"5s"`
-	MaxReconnects  int           `yaml:"max_reconnects" default:"10"`
-	ReadTimeout    time.Duration `yaml:"read_timeout" default:"60s"`
-	WriteTimeout   time.Duration `yaml:"write_timeout" default:"10s"`
-	PingInterval   time.Duration `yaml:"ping_interval" default:"30s"`
+	Source string `yaml:"source" default:"repo"`
+	URL    string `yaml:"url" default:"wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"`
+	// URLs connects to several upstreams of the same source at once, e.g. the main relay and a
+	// private PDS, instead of URL. Commits delivered by more than one are forwarded once.
+	URLs              []string      `yaml:"urls"`
+	ReconnectDelay    time.Duration `yaml:"reconnect_delay" default:"5s"`
+	MaxReconnectDelay time.Duration `yaml:"max_reconnect_delay" default:"2m"`
+	MaxReconnects     int           `yaml:"max_reconnects" default:"10"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" default:"60s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" default:"10s"`
+	PingInterval      time.Duration `yaml:"ping_interval" default:"30s"`
+	// HandshakeTimeout bounds connecting to the firehose, including DNS, TLS and the WebSocket upgrade
+	HandshakeTimeout time.Duration `yaml:"handshake_timeout" default:"10s"`
+	// Cursor resume: start from StartCursor (0 = live / saved cursor) and persist the last seen sequence to CursorFile
+	StartCursor        int64         `yaml:"start_cursor" default:"0"`
+	CursorFile         string        `yaml:"cursor_file"`
+	CursorSaveInterval time.Duration `yaml:"cursor_save_interval" default:"10s"`
+	// ReadinessWindow is how recently a firehose message must have arrived for /readyz to pass
+	ReadinessWindow time.Duration `yaml:"readiness_window" default:"30s"`
+	// ObserveOnly ingests and counts events without forwarding them to subscribers, for benchmarking ingest
+	ObserveOnly bool `yaml:"observe_only" default:"false"`
+	// CollectionAllowlist limits record decoding to commits with an op in one of these collection
+	// NSIDs (empty decodes every commit); other commits are forwarded without their records
+	CollectionAllowlist []string `yaml:"collection_allowlist"`
+	// MaxRecordBytes is the largest record block that is decoded (0 means no limit); bigger records
+	// are forwarded without their content and marked recordTruncated
+	MaxRecordBytes int `yaml:"max_record_bytes" default:"0"`
+	// CollectionMetrics counts every commit op in records_by_collection_total, labeled by its
+	// collection NSID; off by default since each collection adds a time series
+	CollectionMetrics bool `yaml:"collection_metrics" default:"false"`
+	// CollectionMetricsMaxLabels caps the distinct collection labels; ops in collections seen
+	// after the cap is reached are counted under "other"
+	CollectionMetricsMaxLabels int `yaml:"collection_metrics_max_labels" default:"100"`
+	// EventBufferSize is how many events are queued between firehose ingest and the broadcast, so
+	// slow fan-out doesn't stall the read loop; when it is full the oldest event is dropped
+	EventBufferSize int `yaml:"event_buffer_size" default:"4096"`
+	// EventWorkers is how many goroutines broadcast buffered events. With one, every connection
+	// receives events in upstream seq order; above 1 events may be delivered out of order
+	EventWorkers int `yaml:"event_workers" default:"1"`
+}
+
+// UpstreamURLs returns the firehose URLs to connect to: URLs when set, otherwise URL or the
+// source's default
+func (f FirehoseConfig) UpstreamURLs() []string {
+	switch {
+	case len(f.URLs) > 0:
+		return f.URLs
+	case f.URL != "":
+		return []string{f.URL}
+	case f.Source == FirehoseSourceJetstream:
+		return []string{DefaultJetstreamURL}
+	}
+	return []string{DefaultRepoURL}
+}
+
+// FilterConfig contains server-wide defaults for filter matching
+type FilterConfig struct {
+	// TextFields are the record fields searched for keywords when a filter doesn't list its own
+	// (empty means text, message, content)
+	TextFields []string `yaml:"text_fields"`
+}
+
+// DefaultIdentityResolverURL is the public AppView, which answers com.atproto.identity.resolveHandle
+const DefaultIdentityResolverURL = "https://public.api.bsky.app"
+
+// IdentityConfig controls how handles in repository filters are resolved to DIDs
+type IdentityConfig struct {
+	// ResolverURL is the XRPC service asked first; DNS and /.well-known/atproto-did are the fallback
+	ResolverURL string `yaml:"resolver_url" default:"https://public.api.bsky.app"`
+	// CacheTTL is how long a resolved handle is reused before asking again
+	CacheTTL time.Duration `yaml:"cache_ttl" default:"10m"`
+}
+
+// Message bus types
+const (
+	BusTypeNone = "none" // Events only go to this node's clients
+	BusTypeNATS = "nats" // Events are also published to NATS
+)
+
+// BusConfig controls publishing forwarded events to a message bus
+type BusConfig struct {
+	Type string `yaml:"type" default:"none"`
+	URL  string `yaml:"url" default:"nats://localhost:4222"`
+	// SubjectPrefix is prepended to the filter key to form each filter's subject (<prefix>.<filterKey>)
+	SubjectPrefix string `yaml:"subject_prefix" default:"atproto.filters"`
+}
+
+// Kafka topic naming
+const (
+	KafkaTopicByFilter     = "filter"     // One topic per filter: <topic_prefix>.<filterKey>
+	KafkaTopicByCollection = "collection" // One topic per record collection: <topic_prefix>.<collection>
+)
+
+// Kafka record batch compression codecs
+const (
+	KafkaCompressionNone = "none"
+	KafkaCompressionGzip = "gzip"
+)
+
+// Kafka SASL mechanisms
+const (
+	KafkaSASLPlain       = "PLAIN"
+	KafkaSASLScramSHA256 = "SCRAM-SHA-256"
+	KafkaSASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// KafkaConfig controls the Kafka sink, which publishes every event a filter forwards to a Kafka
+// topic. The sink is off while Brokers is empty.
+type KafkaConfig struct {
+	// Brokers are the bootstrap brokers (host:port) the cluster's partition leaders are looked up from
+	Brokers []string `yaml:"brokers"`
+	// TopicBy is "filter" or "collection"; identity and account events go to <topic_prefix>.identity
+	// and <topic_prefix>.account in collection mode
+	TopicBy     string `yaml:"topic_by" default:"filter"`
+	TopicPrefix string `yaml:"topic_prefix" default:"atproto"`
+	// Linger is how long a batch waits to fill up before it is sent
+	Linger time.Duration `yaml:"linger" default:"100ms"`
+	// MaxRetries is how often a batch is retried after broker errors before its messages count as failed
+	MaxRetries int `yaml:"max_retries" default:"5"`
+	// MetadataMaxAge is how long partition leaders are cached before they are looked up again, so
+	// added partitions and moved leaders are picked up even while produce requests succeed
+	MetadataMaxAge time.Duration `yaml:"metadata_max_age" default:"5m"`
+	// Compression is the record batch codec: "none" or "gzip"
+	Compression string          `yaml:"compression" default:"none"`
+	TLS         KafkaTLSConfig  `yaml:"tls"`
+	SASL        KafkaSASLConfig `yaml:"sasl"`
+}
+
+// KafkaTLSConfig connects to the brokers over TLS
+type KafkaTLSConfig struct {
+	Enabled bool `yaml:"enabled" default:"false"`
+	// CAFile is a PEM bundle of the CAs broker certificates are checked against instead of the system's
+	CAFile string `yaml:"ca_file"`
+}
+
+// KafkaSASLConfig authenticates to the brokers; no authentication while Mechanism is empty
+type KafkaSASLConfig struct {
+	// Mechanism is "PLAIN", "SCRAM-SHA-256" or "SCRAM-SHA-512". PLAIN sends the password as is,
+	// so it should only be used with TLS.
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// Enabled reports whether events are published to Kafka
+func (k KafkaConfig) Enabled() bool {
+	return len(k.Brokers) > 0
 }
 
 // LoggingConfig contains logging configuration
@@ -64,9 +293,13 @@ func LoadConfig(filename string) (*Config, error) {
 	return &cfg, nil
 }
 
-// LoadConfigWithDefaults loads configuration with defaults applied
+// LoadConfigWithDefaults loads configuration with defaults applied. A missing or malformed file
+// is reported as an error rather than a panic, so a failed reload leaves the server running.
 func LoadConfigWithDefaults(filename string) (*Config, error) {
-	cfg := jwconfig.LoadFile[Config](filename)
+	var cfg Config
+	if err := jwconfig.Load(filename, &cfg); err != nil {
+		return nil, err
+	}
 
 	// Validate and apply defaults
 	if err := cfg.Validate(); err != nil {
@@ -78,7 +311,7 @@ func LoadConfigWithDefaults(filename string) (*Config, error) {
 
 // GetDefaultConfig returns a configuration with all default values
 func GetDefaultConfig() *Config {
-	cfg := &Config{}
+	cfg := &Config{Server: ServerConfig{RequireKeyword: true}}
 	err := cfg.Validate() // This will apply defaults
 	if err != nil {
 		// Handle error if needed, for now just print
@@ -112,9 +345,91 @@ func (c *Config) Validate() error {
 		c.Server.ShutdownTimeout = 10 * time.Second
 	}
 
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		return fmt.Errorf("server tls needs both cert_file and key_file")
+	}
+	if c.Server.TLS.MinVersion == "" {
+		c.Server.TLS.MinVersion = "1.2"
+	}
+	if _, ok := tlsVersions[c.Server.TLS.MinVersion]; !ok {
+		return fmt.Errorf("invalid server tls min_version: %s (must be 1.2 or 1.3)", c.Server.TLS.MinVersion)
+	}
+
+	// Draining happens within the shutdown timeout, so it can't take longer
+	if c.Server.DrainTimeout <= 0 {
+		c.Server.DrainTimeout = 5 * time.Second
+	}
+	if c.Server.DrainTimeout > c.Server.ShutdownTimeout {
+		c.Server.DrainTimeout = c.Server.ShutdownTimeout
+	}
+
+	if c.Server.WebSocketPongWait <= 0 {
+		c.Server.WebSocketPongWait = 60 * time.Second
+	}
+
+	if c.Server.WebSocketPingInterval <= 0 {
+		c.Server.WebSocketPingInterval = c.Server.WebSocketPongWait * 9 / 10
+	}
+
+	// A ping has to go out before the pong wait runs out, or idle clients get disconnected
+	if c.Server.WebSocketPingInterval >= c.Server.WebSocketPongWait {
+		return fmt.Errorf("invalid websocket ping interval: %s, must be less than websocket_pong_wait (%s)",
+			c.Server.WebSocketPingInterval, c.Server.WebSocketPongWait)
+	}
+
+	if c.Server.WebSocketWriteWait <= 0 {
+		c.Server.WebSocketWriteWait = 30 * time.Second
+	}
+
+	// Levels match compress/flate: -2 is Huffman-only, 1 through 9 trade speed for size
+	if c.Server.WebSocketCompressionLevel == 0 {
+		c.Server.WebSocketCompressionLevel = 1
+	}
+	if c.Server.WebSocketCompressionLevel < -2 || c.Server.WebSocketCompressionLevel > 9 || c.Server.WebSocketCompressionLevel == -1 {
+		return fmt.Errorf("invalid websocket compression level: %d, must be -2 or between 1 and 9", c.Server.WebSocketCompressionLevel)
+	}
+
+	if c.Server.WebSocketReadBufferSize < 0 || c.Server.WebSocketWriteBufferSize < 0 {
+		return fmt.Errorf("invalid websocket buffer sizes: read %d, write %d", c.Server.WebSocketReadBufferSize, c.Server.WebSocketWriteBufferSize)
+	}
+	if c.Server.WebSocketReadBufferSize == 0 {
+		c.Server.WebSocketReadBufferSize = 1024
+	}
+	if c.Server.WebSocketWriteBufferSize == 0 {
+		c.Server.WebSocketWriteBufferSize = 1024
+	}
+
+	if c.Server.ReplayBufferSize < 0 {
+		return fmt.Errorf("invalid replay buffer size: %d", c.Server.ReplayBufferSize)
+	}
+
+	if c.Server.StatsStreamInterval <= 0 {
+		c.Server.StatsStreamInterval = 5 * time.Second
+	}
+
+	if c.Server.IdempotencyTTL <= 0 {
+		c.Server.IdempotencyTTL = 24 * time.Hour
+	}
+
+	if c.Server.ConnectTokenTTL <= 0 {
+		c.Server.ConnectTokenTTL = 5 * time.Minute
+	}
+
 	// Firehose validation
+	switch c.Firehose.Source {
+	case "":
+		c.Firehose.Source = FirehoseSourceRepo
+	case FirehoseSourceRepo, FirehoseSourceJetstream:
+	default:
+		return fmt.Errorf("invalid firehose source: %s, must be one of: repo, jetstream", c.Firehose.Source)
+	}
+
 	if c.Firehose.URL == "" {
-		c.Firehose.URL = "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"
+		if c.Firehose.Source == FirehoseSourceJetstream {
+			c.Firehose.URL = DefaultJetstreamURL
+		} else {
+			c.Firehose.URL = DefaultRepoURL
+		}
 	}
 
 	// Validate firehose URL
@@ -122,14 +437,164 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid firehose URL: %s", c.Firehose.URL)
 	}
 
+	seenURLs := make(map[string]bool)
+	for _, firehoseURL := range c.Firehose.URLs {
+		if _, err := url.Parse(firehoseURL); err != nil || firehoseURL == "" {
+			return fmt.Errorf("invalid firehose URL in firehose.urls: %q", firehoseURL)
+		}
+		if seenURLs[firehoseURL] {
+			return fmt.Errorf("firehose.urls lists %s more than once", firehoseURL)
+		}
+		seenURLs[firehoseURL] = true
+	}
+
 	if c.Firehose.ReconnectDelay <= 0 {
 		c.Firehose.ReconnectDelay = 5 * time.Second
 	}
 
+	if c.Firehose.MaxReconnectDelay <= 0 {
+		c.Firehose.MaxReconnectDelay = 2 * time.Minute
+	}
+
+	if c.Firehose.StartCursor < 0 {
+		return fmt.Errorf("invalid firehose start cursor: %d", c.Firehose.StartCursor)
+	}
+
+	if c.Firehose.CursorSaveInterval <= 0 {
+		c.Firehose.CursorSaveInterval = 10 * time.Second
+	}
+
+	if c.Firehose.ReadinessWindow <= 0 {
+		c.Firehose.ReadinessWindow = 30 * time.Second
+	}
+
+	if c.Firehose.HandshakeTimeout <= 0 {
+		c.Firehose.HandshakeTimeout = 10 * time.Second
+	}
+
 	if c.Firehose.MaxReconnects <= 0 {
 		c.Firehose.MaxReconnects = 10
 	}
 
+	if c.Firehose.MaxRecordBytes < 0 {
+		return fmt.Errorf("invalid firehose max record bytes: %d", c.Firehose.MaxRecordBytes)
+	}
+
+	if c.Firehose.CollectionMetricsMaxLabels < 0 {
+		return fmt.Errorf("invalid firehose collection metrics max labels: %d", c.Firehose.CollectionMetricsMaxLabels)
+	}
+	if c.Firehose.CollectionMetricsMaxLabels == 0 {
+		c.Firehose.CollectionMetricsMaxLabels = 100
+	}
+
+	if c.Firehose.EventBufferSize < 0 {
+		return fmt.Errorf("invalid firehose event buffer size: %d", c.Firehose.EventBufferSize)
+	}
+	if c.Firehose.EventBufferSize == 0 {
+		c.Firehose.EventBufferSize = 4096
+	}
+	if c.Firehose.EventWorkers < 0 {
+		return fmt.Errorf("invalid firehose event workers: %d", c.Firehose.EventWorkers)
+	}
+	if c.Firehose.EventWorkers == 0 {
+		c.Firehose.EventWorkers = 1
+	}
+
+	for _, collection := range c.Firehose.CollectionAllowlist {
+		if strings.TrimSpace(collection) == "" {
+			return fmt.Errorf("firehose.collection_allowlist must not contain empty collections")
+		}
+	}
+
+	// Filter defaults validation
+	for _, field := range c.Filters.TextFields {
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("filters.text_fields must not contain empty field names")
+		}
+	}
+
+	// Identity validation
+	if c.Identity.ResolverURL == "" {
+		c.Identity.ResolverURL = DefaultIdentityResolverURL
+	}
+	if u, err := url.Parse(c.Identity.ResolverURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid identity resolver URL: %s", c.Identity.ResolverURL)
+	}
+
+	if c.Identity.CacheTTL <= 0 {
+		c.Identity.CacheTTL = 10 * time.Minute
+	}
+
+	// Message bus validation
+	switch c.Bus.Type {
+	case "":
+		c.Bus.Type = BusTypeNone
+	case BusTypeNone:
+	case BusTypeNATS:
+		if c.Bus.URL == "" {
+			c.Bus.URL = "nats://localhost:4222"
+		}
+		if u, err := url.Parse(c.Bus.URL); err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+			return fmt.Errorf("invalid bus URL: %s, must be nats://host:port or tls://host:port", c.Bus.URL)
+		}
+		if c.Bus.SubjectPrefix == "" {
+			c.Bus.SubjectPrefix = "atproto.filters"
+		}
+		if strings.ContainsAny(c.Bus.SubjectPrefix, " \t\r\n*>") {
+			return fmt.Errorf("invalid bus subject prefix: %q, must not contain whitespace or wildcards", c.Bus.SubjectPrefix)
+		}
+	default:
+		return fmt.Errorf("invalid bus type: %s, must be one of: none, nats", c.Bus.Type)
+	}
+
+	// Kafka validation
+	for _, broker := range c.Kafka.Brokers {
+		if _, port, err := net.SplitHostPort(broker); err != nil || port == "" {
+			return fmt.Errorf("invalid kafka broker: %q, must be host:port", broker)
+		}
+	}
+	switch c.Kafka.TopicBy {
+	case "":
+		c.Kafka.TopicBy = KafkaTopicByFilter
+	case KafkaTopicByFilter, KafkaTopicByCollection:
+	default:
+		return fmt.Errorf("invalid kafka topic_by: %s, must be one of: filter, collection", c.Kafka.TopicBy)
+	}
+	if c.Kafka.TopicPrefix == "" {
+		c.Kafka.TopicPrefix = "atproto"
+	}
+	if strings.Trim(c.Kafka.TopicPrefix, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-") != "" {
+		return fmt.Errorf("invalid kafka topic prefix: %q, may only contain letters, digits, '.', '_' and '-'", c.Kafka.TopicPrefix)
+	}
+	if c.Kafka.Linger <= 0 {
+		c.Kafka.Linger = 100 * time.Millisecond
+	}
+	if c.Kafka.MaxRetries < 0 {
+		return fmt.Errorf("invalid kafka max retries: %d", c.Kafka.MaxRetries)
+	}
+	if c.Kafka.MaxRetries == 0 {
+		c.Kafka.MaxRetries = 5
+	}
+	if c.Kafka.MetadataMaxAge <= 0 {
+		c.Kafka.MetadataMaxAge = 5 * time.Minute
+	}
+	switch c.Kafka.Compression {
+	case "":
+		c.Kafka.Compression = KafkaCompressionNone
+	case KafkaCompressionNone, KafkaCompressionGzip:
+	default:
+		return fmt.Errorf("invalid kafka compression: %s, must be one of: none, gzip", c.Kafka.Compression)
+	}
+	switch c.Kafka.SASL.Mechanism {
+	case "":
+	case KafkaSASLPlain, KafkaSASLScramSHA256, KafkaSASLScramSHA512:
+		if c.Kafka.SASL.Username == "" {
+			return fmt.Errorf("kafka sasl username is required with mechanism %s", c.Kafka.SASL.Mechanism)
+		}
+	default:
+		return fmt.Errorf("invalid kafka sasl mechanism: %s, must be one of: PLAIN, SCRAM-SHA-256, SCRAM-SHA-512", c.Kafka.SASL.Mechanism)
+	}
+
 	// Logging validation
 	validLogLevels := map[string]bool{
 		"debug": true, "info": true, "warn": true, "error": true,
@@ -161,10 +626,19 @@ func (c *Config) GetListenAddress() string {
 	return c.Server.Host + ":" + c.Server.Port
 }
 
-// GetBaseURL returns the base URL for the server
+// GetBaseURL returns the base URL for the server, https:// when TLS is enabled
 func (c *Config) GetBaseURL() string {
+	scheme := "http://"
+	if c.Server.TLS.Enabled() {
+		scheme = "https://"
+	}
 	if c.Server.Host == "0.0.0.0" {
-		return "http://localhost:" + c.Server.Port
+		return scheme + "localhost:" + c.Server.Port
 	}
-	return "http://" + c.Server.Host + ":" + c.Server.Port
+	return scheme + c.Server.Host + ":" + c.Server.Port
+}
+
+// GetWebSocketBaseURL returns the base URL for WebSocket connections, wss:// when TLS is enabled
+func (c *Config) GetWebSocketBaseURL() string {
+	return "ws" + strings.TrimPrefix(c.GetBaseURL(), "http")
 }
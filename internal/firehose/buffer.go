@@ -0,0 +1,45 @@
+package firehose
+
+import (
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// eventBuffer sits between firehose ingest and the event callback: ingest queues events without
+// blocking and a pool of workers hands them to the callback. A slow broadcast would otherwise
+// stall the read loop until the relay drops the connection; instead, once the buffer is full
+// the oldest queued event is dropped and counted in firehose_backpressure_drops_total.
+type eventBuffer struct {
+	queue chan *models.ATEvent
+}
+
+// newEventBuffer creates a buffer of size events and starts workers goroutines calling deliver
+// with each queued event. Workers run for the life of the process.
+func newEventBuffer(size, workers int, deliver func(*models.ATEvent)) *eventBuffer {
+	b := &eventBuffer{queue: make(chan *models.ATEvent, size)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for event := range b.queue {
+				deliver(event)
+			}
+		}()
+	}
+	return b
+}
+
+// push queues an event, dropping the oldest queued events until it fits
+func (b *eventBuffer) push(event *models.ATEvent) {
+	for {
+		select {
+		case b.queue <- event:
+			return
+		default:
+		}
+
+		select {
+		case <-b.queue:
+			metriks.FirehoseBackpressureDrops.Inc()
+		default:
+		}
+	}
+}
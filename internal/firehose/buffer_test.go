@@ -0,0 +1,110 @@
+package firehose
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestEventBufferDropsOldest(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var delivered []string
+	buffer := newEventBuffer(2, 1, func(event *models.ATEvent) {
+		if event.Did == "did:plc:1" {
+			close(started)
+			<-release
+		}
+		mu.Lock()
+		delivered = append(delivered, event.Did)
+		mu.Unlock()
+	})
+	dropsBefore := testutil.ToFloat64(metriks.FirehoseBackpressureDrops)
+
+	// The worker holds the first event while the next ones pile up in the buffer
+	buffer.push(&models.ATEvent{Did: "did:plc:1"})
+	<-started
+	for i := 2; i <= 5; i++ {
+		buffer.push(&models.ATEvent{Did: "did:plc:" + strconv.Itoa(i)})
+	}
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		count := len(delivered)
+		mu.Unlock()
+		if count == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for deliveries, got %d", count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"did:plc:1", "did:plc:4", "did:plc:5"}
+	for i, did := range expected {
+		if delivered[i] != did {
+			t.Errorf("Expected deliveries %v, got %v", expected, delivered)
+			break
+		}
+	}
+	if drops := testutil.ToFloat64(metriks.FirehoseBackpressureDrops) - dropsBefore; drops != 2 {
+		t.Errorf("Expected firehose_backpressure_drops_total to increase by 2, got %v", drops)
+	}
+}
+
+func TestEventBufferDoesNotBlockIngest(t *testing.T) {
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{EventBufferSize: 16, EventWorkers: 1}})
+	release := make(chan struct{})
+	mock := &MockEventCallback{}
+	client.SetEventCallback(func(event *models.ATEvent) {
+		<-release
+		mock.Call(event)
+	})
+
+	// A stuck callback doesn't hold up the read loop
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 3; i++ {
+			if err := client.handleRepoIdentity(client.upstreams[0], &atproto.SyncSubscribeRepos_Identity{
+				Did: "did:plc:" + strconv.Itoa(i),
+				Seq: int64(i),
+			}); err != nil {
+				t.Errorf("handleRepoIdentity returned error: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected ingest to continue while the callback is blocked")
+	}
+	if cursor := client.GetCursor(); cursor != 3 {
+		t.Errorf("Expected the cursor to advance to 3, got %d", cursor)
+	}
+
+	close(release)
+	events := mock.WaitForEvents(t, 3)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 buffered events delivered, got %d", len(events))
+	}
+	for i, event := range events {
+		if want := "did:plc:" + strconv.Itoa(i+1); event.Did != want {
+			t.Errorf("Expected event %d from %s, got %s", i, want, event.Did)
+		}
+	}
+}
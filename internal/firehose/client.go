@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluesky-social/indigo/api/atproto"
@@ -15,35 +23,63 @@ import (
 	"github.com/bluesky-social/indigo/events/schedulers/sequential"
 	"github.com/fxamacker/cbor/v2"
 	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
 	carv2 "github.com/ipld/go-car/v2"
 
 	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
 	"github.com/JWhist/AT_Proto_PubSub/internal/models"
 )
 
+// stableConnectionDuration is how long a connection must stay up before the reconnect backoff is reset
+const stableConnectionDuration = 1 * time.Minute
+
+// lagSmoothing is the weight of each new sample in the rolling firehose lag
+const lagSmoothing = 0.1
+
 // Client handles the AT Protocol firehose connection and filtering
 type Client struct {
 	filters       models.FilterOptions
 	mutex         sync.RWMutex
-	conn          *websocket.Conn
+	upstreams     []*upstream // One connection per firehose URL, all feeding the same callback; guarded by upstreamsMu
+	upstreamsMu   sync.RWMutex
+	switched      chan struct{} // Signals Start that SwitchUpstreams replaced the upstreams
 	eventCallback func(*models.ATEvent)
 	callbackMu    sync.RWMutex
+	deliverMu     sync.Mutex     // Serializes synchronous deliveries, so the callback never runs concurrently
+	events        *eventBuffer   // Queues events for the callback off the read loop (nil delivers synchronously)
+	dedup         *commitDeduper // Drops commits already delivered by another upstream (nil with one upstream)
 	config        *config.Config
+	lag           atomic.Int64      // Rolling firehose lag in nanoseconds (commit time vs wall clock)
+	eventsSeen    atomic.Uint64     // Commit events processed since startup
+	eventsMatched atomic.Uint64     // Commit events with an operation matching the client's filters
+	carDecoders   sync.Pool         // Reusable *carDecoder scratch state for commit blocks
+	collections   *collectionLabels // Label set for records_by_collection_total, nil unless collection metrics are enabled
 }
 
 // NewClient creates a new firehose client instance
 func NewClient() *Client {
-	return &Client{
-		filters: models.FilterOptions{},
-	}
+	return NewClientWithConfig(nil)
 }
 
 // NewClientWithConfig creates a new firehose client instance with configuration
 func NewClientWithConfig(cfg *config.Config) *Client {
-	return &Client{
-		filters: models.FilterOptions{},
-		config:  cfg,
+	c := &Client{
+		filters:   models.FilterOptions{},
+		config:    cfg,
+		upstreams: newUpstreams(cfg),
+		switched:  make(chan struct{}, 1),
+	}
+	if len(c.upstreams) > 1 {
+		c.dedup = newCommitDeduper(commitDedupWindow)
 	}
+	if cfg != nil && cfg.Firehose.CollectionMetrics {
+		c.collections = newCollectionLabels(cfg.Firehose.CollectionMetricsMaxLabels)
+	}
+	if cfg != nil && cfg.Firehose.EventBufferSize > 0 {
+		c.events = newEventBuffer(cfg.Firehose.EventBufferSize, max(cfg.Firehose.EventWorkers, 1), c.deliverEvent)
+	}
+	return c
 }
 
 // UpdateFilters updates the filter options in a thread-safe manner
@@ -60,59 +96,206 @@ func (c *Client) GetFilters() models.FilterOptions {
 	return c.filters
 }
 
-// SetEventCallback sets a callback function to be called for each received event
+// SetEventCallback sets a callback function to be called for each received event, replacing
+// any previous one. It waits for an event being delivered to the previous callback, so once it
+// returns the old callback won't be called again and can be torn down. The callback must not
+// call SetEventCallback or ClearEventCallback itself. With firehose.event_workers above 1 it is
+// called concurrently and events may arrive out of order.
 func (c *Client) SetEventCallback(callback func(*models.ATEvent)) {
 	c.callbackMu.Lock()
 	defer c.callbackMu.Unlock()
 	c.eventCallback = callback
 }
 
-// getEventCallback safely gets the current event callback
+// ClearEventCallback removes the event callback, waiting for an event being delivered to it
+// like SetEventCallback. Events received afterwards are only processed by the client itself.
+func (c *Client) ClearEventCallback() {
+	c.SetEventCallback(nil)
+}
+
+// getEventCallback safely gets the current event callback, or nil in observe-only mode
 func (c *Client) getEventCallback() func(*models.ATEvent) {
+	if c.observeOnly() {
+		return nil
+	}
 	c.callbackMu.RLock()
 	defer c.callbackMu.RUnlock()
 	return c.eventCallback
 }
 
-// Start begins the firehose connection and event processing with auto-reconnection
+// dispatchEvent hands an event to the callback, through the event buffer when one is configured
+// and otherwise synchronously, one upstream at a time
+func (c *Client) dispatchEvent(event *models.ATEvent) {
+	if c.observeOnly() {
+		return
+	}
+	if c.events != nil {
+		c.events.push(event)
+		return
+	}
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+	c.deliverEvent(event)
+}
+
+// deliverEvent calls the current callback with an event, if any. The callback is looked up per
+// event, so swapping it takes effect on the next event, and it is held for the duration of the
+// call so that SetEventCallback can wait for in-flight deliveries to finish.
+func (c *Client) deliverEvent(event *models.ATEvent) {
+	c.callbackMu.RLock()
+	defer c.callbackMu.RUnlock()
+	if c.eventCallback != nil {
+		c.eventCallback(event)
+	}
+}
+
+// observeOnly reports whether events are processed without being forwarded to the callback
+func (c *Client) observeOnly() bool {
+	return c.config != nil && c.config.Firehose.ObserveOnly
+}
+
+// Start begins the firehose connection and event processing with auto-reconnection. Each
+// upstream is connected and reconnected on its own; Start returns once every upstream gave up
+// or the context is cancelled.
 func (c *Client) Start(ctx context.Context) error {
 	filters := c.GetFilters()
-	fmt.Println("Starting AT Protocol Firehose Filter Server...")
-	fmt.Println("Initial Filters:")
-	fmt.Printf("  Repository: %s\n", getFilterString(filters.Repository))
-	fmt.Printf("  Path Prefix: %s\n", getFilterString(filters.PathPrefix))
-	fmt.Printf("  Keyword: %s\n", getFilterString(filters.Keyword))
+	slog.Info("Starting AT Protocol firehose client",
+		"repository", getFilterString(filters.Repository),
+		"pathPrefix", getFilterString(filters.PathPrefix),
+		"keyword", getFilterString(filters.Keyword),
+		"upstreams", len(c.currentUpstreams()))
+	if c.observeOnly() {
+		slog.Warn("Firehose observe-only mode enabled, events will not be forwarded to subscribers")
+	}
 
+	// Run the upstreams until they give up or the context ends, starting over with the new
+	// upstreams whenever SwitchUpstreams replaces them. A switch made before starting is
+	// already reflected in the upstreams.
+	select {
+	case <-c.switched:
+	default:
+	}
+	resume := true
+	for {
+		switched, err := c.runUpstreams(ctx, c.currentUpstreams(), resume)
+		if !switched {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		resume = false
+	}
+}
+
+// runUpstreams connects the given upstreams until they all stop, the context ends or
+// SwitchUpstreams replaces them, in which case their connections are closed and it reports
+// switched. With resume set, each upstream starts from its persisted cursor.
+func (c *Client) runUpstreams(ctx context.Context, upstreams []*upstream, resume bool) (switched bool, err error) {
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	if len(upstreams) > 1 && c.dedup == nil {
+		c.dedup = newCommitDeduper(commitDedupWindow)
+	}
+
+	// Resume each upstream from its persisted cursor; the configured start cursor applies to the
+	// first. Cursors are specific to a relay, so upstreams switched to at runtime start live.
+	var persisting sync.WaitGroup
+	if c.config != nil {
+		for i, u := range upstreams {
+			if resume {
+				if i == 0 && c.config.Firehose.StartCursor > 0 {
+					u.cursor.Store(c.config.Firehose.StartCursor)
+				} else if u.cursorFile != "" {
+					if saved, err := loadCursor(u.cursorFile); err != nil {
+						slog.Warn("Failed to load saved cursor", "file", u.cursorFile, "error", err)
+					} else if saved > 0 {
+						u.cursor.Store(saved)
+					}
+				}
+			}
+
+			if u.cursorFile != "" {
+				persisting.Add(1)
+				go func() {
+					defer persisting.Done()
+					u.persistCursor(runCtx, u.cursorFile, c.config.Firehose.CursorSaveInterval)
+				}()
+			}
+		}
+	}
+
+	// Handle graceful shutdown
+	go func() {
+		<-runCtx.Done()
+		slog.Info("Shutting down firehose connection")
+		for _, u := range upstreams {
+			if u.conn != nil {
+				if err := u.conn.Close(); err != nil {
+					slog.Warn("Error closing firehose connection", "url", u.url, "error", err)
+				}
+			}
+		}
+	}()
+
+	errs := make([]error, len(upstreams))
+	var wg sync.WaitGroup
+	for i, u := range upstreams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.runUpstream(runCtx, u)
+		}()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-c.switched:
+		switched = true
+		stop()
+		<-stopped
+	}
+	// Wait for the final cursor saves, so a switched upstream can't overwrite its successor's
+	stop()
+	persisting.Wait()
+
+	return switched, errors.Join(errs...)
+}
+
+// runUpstream keeps one upstream connected, reconnecting with exponential backoff until the
+// context is cancelled or the reconnect limit is reached
+func (c *Client) runUpstream(ctx context.Context, u *upstream) error {
 	// Get configuration values with defaults
-	firehoseURL := "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"
+	source := config.FirehoseSourceRepo
 	reconnectDelay := 5 * time.Second
+	maxReconnectDelay := 2 * time.Minute
 	maxReconnects := 10
 
 	if c.config != nil {
-		if c.config.Firehose.URL != "" {
-			firehoseURL = c.config.Firehose.URL
+		if c.config.Firehose.Source == config.FirehoseSourceJetstream {
+			source = config.FirehoseSourceJetstream
 		}
 		if c.config.Firehose.ReconnectDelay > 0 {
 			reconnectDelay = c.config.Firehose.ReconnectDelay
 		}
+		if c.config.Firehose.MaxReconnectDelay > 0 {
+			maxReconnectDelay = c.config.Firehose.MaxReconnectDelay
+		}
 		if c.config.Firehose.MaxReconnects > 0 {
 			maxReconnects = c.config.Firehose.MaxReconnects
 		}
 	}
+	if maxReconnectDelay < reconnectDelay {
+		maxReconnectDelay = reconnectDelay
+	}
 
-	// Handle graceful shutdown
-	go func() {
-		<-ctx.Done()
-		fmt.Println("\nShutting down firehose connection...")
-		if c.conn != nil {
-			if err := c.conn.Close(); err != nil {
-				fmt.Printf("Error closing connection: %v\n", err)
-			}
-		}
-	}()
-
-	// Connection loop with auto-reconnection
-	reconnectCount := 0
+	// Connection loop with auto-reconnection and exponential backoff
 	for {
 		select {
 		case <-ctx.Done():
@@ -121,49 +304,244 @@ func (c *Client) Start(ctx context.Context) error {
 		}
 
 		// Attempt to connect
-		fmt.Println("Connecting to firehose...")
-		if err := c.connectAndListen(ctx, firehoseURL); err != nil {
-			reconnectCount++
-			fmt.Printf("❌ Firehose connection failed (attempt %d/%d): %v\n", reconnectCount, maxReconnects, err)
+		connectURL := u.url
+		if cursor := u.cursor.Load(); cursor > 0 {
+			connectURL = withCursor(u.url, cursor)
+			slog.Info("Connecting to firehose", "url", u.url, "cursor", cursor)
+		} else {
+			slog.Info("Connecting to firehose", "url", u.url)
+		}
+		connectedAt := time.Now()
+		var err error
+		if source == config.FirehoseSourceJetstream {
+			err = c.connectAndListenJetstream(ctx, u, connectURL)
+		} else {
+			err = c.connectAndListen(ctx, u, connectURL)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-			if reconnectCount >= maxReconnects {
-				return fmt.Errorf("max reconnection attempts (%d) reached, giving up", maxReconnects)
-			}
+		// A connection that stayed up long enough counts as healthy, so start the backoff over
+		if time.Since(connectedAt) >= stableConnectionDuration {
+			u.reconnects.Store(0)
+		}
+		reconnectCount := int(u.reconnects.Add(1))
 
-			fmt.Printf("⏳ Retrying connection in %v...\n", reconnectDelay)
+		if err != nil {
+			slog.Error("Firehose connection failed", "url", u.url, "attempt", reconnectCount, "maxAttempts", maxReconnects, "error", err)
+		} else {
+			slog.Warn("Firehose connection lost", "url", u.url, "attempt", reconnectCount, "maxAttempts", maxReconnects)
+		}
 
-			// Wait for reconnect delay or context cancellation
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(reconnectDelay):
-				continue
-			}
+		if reconnectCount >= maxReconnects {
+			return fmt.Errorf("%s: max reconnection attempts (%d) reached, giving up", u.url, maxReconnects)
+		}
+
+		delay := reconnectBackoff(reconnectDelay, maxReconnectDelay, reconnectCount)
+		slog.Info("Retrying firehose connection", "url", u.url, "delay", delay)
+
+		// Wait for reconnect delay or context cancellation
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
 		}
+	}
+}
 
-		// If we get here, the connection was successful but then disconnected
-		// Reset reconnect count on successful connection
-		reconnectCount = 0
-		fmt.Println("🔄 Connection lost, attempting to reconnect...")
+// GetCursor returns the last seen firehose sequence number of the first upstream (0 if none
+// yet). For the Jetstream source this is the event time in unix microseconds.
+func (c *Client) GetCursor() int64 {
+	return c.currentUpstreams()[0].cursor.Load()
+}
+
+// GetEventsSeen returns the number of commit events processed since startup
+func (c *Client) GetEventsSeen() uint64 {
+	return c.eventsSeen.Load()
+}
+
+// GetEventsMatched returns the number of commit events that matched the client's filters since startup
+func (c *Client) GetEventsMatched() uint64 {
+	return c.eventsMatched.Load()
+}
+
+// GetLag returns the rolling difference between commit event times and the wall clock
+func (c *Client) GetLag() time.Duration {
+	return time.Duration(c.lag.Load())
+}
+
+// recordLag folds the lag of an event timestamp into the rolling lag.
+// Unparseable timestamps are ignored.
+func (c *Client) recordLag(eventTime string) {
+	parsed, err := time.Parse(time.RFC3339Nano, eventTime)
+	if err != nil {
+		return
+	}
+
+	sample := time.Since(parsed)
+	lag := sample
+	if previous := time.Duration(c.lag.Load()); previous != 0 {
+		lag = previous + time.Duration(float64(sample-previous)*lagSmoothing)
+	}
+	c.lag.Store(int64(lag))
+	metriks.FirehoseLag.Set(lag.Seconds())
+}
+
+// withCursor returns the firehose URL with the cursor query parameter set
+func withCursor(firehoseURL string, cursor int64) string {
+	parsed, err := url.Parse(firehoseURL)
+	if err != nil {
+		return firehoseURL
+	}
+	query := parsed.Query()
+	query.Set("cursor", strconv.FormatInt(cursor, 10))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// loadCursor reads a persisted cursor from disk, returning 0 if the file doesn't exist
+func loadCursor(filename string) (int64, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
 	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
 }
 
-// connectAndListen establishes a connection and listens for events
-func (c *Client) connectAndListen(ctx context.Context, firehoseURL string) error {
+// saveCursor atomically writes the cursor to disk
+func saveCursor(filename string, cursor int64) error {
+	tmpFile := filename + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(strconv.FormatInt(cursor, 10)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+// persistCursor periodically saves the upstream's cursor until the context is cancelled
+func (u *upstream) persistCursor(ctx context.Context, filename string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastSaved := int64(0)
+	save := func() {
+		cursor := u.cursor.Load()
+		if cursor == 0 || cursor == lastSaved {
+			return
+		}
+		if err := saveCursor(filename, cursor); err != nil {
+			slog.Warn("Failed to save cursor", "file", filename, "error", err)
+			return
+		}
+		lastSaved = cursor
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			save() // Save the final position on shutdown
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
+
+// reconnectBackoff returns the delay before the given reconnect attempt (1-based),
+// doubling from base on each attempt and capped at maxDelay
+func reconnectBackoff(base, maxDelay time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// IsConnected reports whether a connection to any firehose upstream is currently established
+func (c *Client) IsConnected() bool {
+	for _, u := range c.currentUpstreams() {
+		if u.connected.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// LastMessageAt returns when the last message from any firehose upstream was received (zero if
+// none yet)
+func (c *Client) LastMessageAt() time.Time {
+	var latest time.Time
+	for _, u := range c.currentUpstreams() {
+		if lastMessageAt := u.lastMessageAt(); lastMessageAt.After(latest) {
+			latest = lastMessageAt
+		}
+	}
+	return latest
+}
+
+// CheckReady returns nil if the client is connected and received a message within window,
+// or an error describing why it isn't ready
+func (c *Client) CheckReady(window time.Duration) error {
+	if !c.IsConnected() {
+		return errors.New("firehose is not connected")
+	}
+	lastMessageAt := c.LastMessageAt()
+	if lastMessageAt.IsZero() {
+		return errors.New("no firehose messages received yet")
+	}
+	if idle := time.Since(lastMessageAt); idle > window {
+		return fmt.Errorf("no firehose messages for %v", idle.Round(time.Second))
+	}
+	return nil
+}
+
+// countEvent records that a commit event is being processed
+func (c *Client) countEvent() {
+	c.eventsSeen.Add(1)
+	metriks.MessagesReceived.Inc()
+}
+
+// defaultHandshakeTimeout bounds a firehose connection attempt when no timeout is configured
+const defaultHandshakeTimeout = 10 * time.Second
+
+// dialer returns a WebSocket dialer whose handshake (including DNS and TLS) times out after
+// the configured firehose handshake timeout
+func (c *Client) dialer() *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = defaultHandshakeTimeout
+	if c.config != nil && c.config.Firehose.HandshakeTimeout > 0 {
+		dialer.HandshakeTimeout = c.config.Firehose.HandshakeTimeout
+	}
+	return &dialer
+}
+
+// connectAndListen establishes a connection to an upstream and listens for events
+func (c *Client) connectAndListen(ctx context.Context, u *upstream, firehoseURL string) error {
 	// Connect to the AT Protocol firehose
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.Dial(firehoseURL, nil)
+	conn, _, err := c.dialer().DialContext(ctx, firehoseURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to dial firehose: %w", err)
 	}
-	c.conn = conn
-	fmt.Println("✅ Successfully connected to firehose!")
-	fmt.Println("📡 Listening for firehose messages...")
+	u.conn = conn
+	u.connected.Store(true)
+	slog.Info("Connected to firehose, listening for messages", "url", u.url)
 
 	// Set up AT Protocol event callbacks
 	rsc := &events.RepoStreamCallbacks{
 		RepoCommit: func(evt *atproto.SyncSubscribeRepos_Commit) error {
-			return c.handleRepoCommit(evt)
+			return c.handleRepoCommit(u, evt)
+		},
+		RepoIdentity: func(evt *atproto.SyncSubscribeRepos_Identity) error {
+			return c.handleRepoIdentity(u, evt)
+		},
+		RepoAccount: func(evt *atproto.SyncSubscribeRepos_Account) error {
+			return c.handleRepoAccount(u, evt)
 		},
 	}
 
@@ -175,95 +553,218 @@ func (c *Client) connectAndListen(ctx context.Context, firehoseURL string) error
 	err = events.HandleRepoStream(ctx, conn, sched, logger)
 
 	// Clean up connection
-	if c.conn != nil {
-		if closeErr := c.conn.Close(); closeErr != nil {
-			fmt.Printf("Error closing firehose connection: %v\n", closeErr)
+	u.connected.Store(false)
+	if u.conn != nil {
+		if closeErr := u.conn.Close(); closeErr != nil {
+			slog.Warn("Error closing firehose connection", "url", u.url, "error", closeErr)
 		}
-		c.conn = nil
+		u.conn = nil
 	}
 
 	return err
 }
 
-// handleRepoCommit processes repo commit events from the firehose
-func (c *Client) handleRepoCommit(evt *atproto.SyncSubscribeRepos_Commit) error {
+// handleRepoCommit processes repo commit events from a firehose upstream
+func (c *Client) handleRepoCommit(u *upstream, evt *atproto.SyncSubscribeRepos_Commit) error {
+	// Track the sequence number so reconnects can resume from here
+	u.cursor.Store(evt.Seq)
+	u.markMessageReceived()
+
+	// A repo revision is the same commit whichever relay it came through
+	if c.isDuplicateCommit(evt.Repo, evt.Rev, "") {
+		return nil
+	}
+	c.recordLag(evt.Time)
+	c.countEvent()
+
 	// Convert to our internal event format
 	atEvent := models.ATEvent{
 		Did:  evt.Repo,
 		Time: evt.Time,
-		Kind: "commit",
+		Kind: models.EventKindCommit,
+		Seq:  evt.Seq,
 	}
 
-	// Process CAR blocks to extract records
+	// Decode CAR blocks to extract records; on decode errors, or when no op is in an allowed
+	// collection, records stays nil and operations are forwarded without them
+	var records map[string]interface{}
+	var rawBlocks map[string][]byte
+	var oversized map[string]struct{}
 	if len(evt.Blocks) > 0 {
-		// Decode CAR blocks to extract records
-		records, err := c.decodeCarBlocks(evt.Blocks)
-		if err != nil {
-			// Silently continue on CAR decode errors
-			records = make(map[string]interface{})
-		}
-
-		// Convert operations with decoded records
-		for _, op := range evt.Ops {
-			atOp := models.ATOperation{
-				Action: op.Action,
-				Path:   op.Path,
+		if !c.decodesRecords(evt.Ops) {
+			metriks.SkippedCommitDecodes.Inc()
+		} else if dec, err := c.decodeCarBlocks(evt.Blocks); err != nil {
+			slog.Debug("Failed to decode commit blocks", "repo", evt.Repo, "seq", evt.Seq, "error", err)
+		} else {
+			if dec.readErr != nil || dec.invalidBlocks > 0 {
+				slog.Debug("Commit blocks partially decoded", "repo", evt.Repo, "seq", evt.Seq,
+					"invalidBlocks", dec.invalidBlocks, "error", dec.readErr)
 			}
-			if op.Cid != nil {
-				atOp.Cid = op.Cid.String()
+			records = dec.records
+			rawBlocks = dec.rawBlocks
+			oversized = dec.oversized
+			defer c.releaseCarDecoder(dec)
+		}
+	}
 
-				// Try to find the corresponding record for this CID
-				if record, exists := records[op.Cid.String()]; exists {
-					atOp.Record = record
-				}
+	// Convert operations with decoded records
+	for _, op := range evt.Ops {
+		atOp := models.ATOperation{
+			Action: op.Action,
+			Path:   op.Path,
+		}
+		if op.Cid != nil {
+			atOp.Cid = op.Cid.String()
+
+			// Try to find the corresponding record for this CID
+			key := cid.Cid(*op.Cid).KeyString()
+			if record, exists := records[key]; exists {
+				atOp.Record = record
+				atOp.RawRecord = rawBlocks[key]
+			} else if _, skipped := oversized[key]; skipped {
+				atOp.RecordTruncated = true
 			}
+		}
 
-			// Extract collection from path (e.g., "app.bsky.feed.post/abc123" -> "app.bsky.feed.post")
-			pathParts := strings.Split(op.Path, "/")
-			if len(pathParts) > 0 {
-				atOp.Collection = pathParts[0]
-				if len(pathParts) > 1 {
-					atOp.Rkey = pathParts[1]
-				}
+		// Extract collection from path (e.g., "app.bsky.feed.post/abc123" -> "app.bsky.feed.post")
+		pathParts := strings.Split(op.Path, "/")
+		if len(pathParts) > 0 {
+			atOp.Collection = pathParts[0]
+			if len(pathParts) > 1 {
+				atOp.Rkey = pathParts[1]
 			}
-
-			atEvent.Ops = append(atEvent.Ops, atOp)
 		}
-	} else {
-		// Fallback for operations without blocks
-		for _, op := range evt.Ops {
-			atOp := models.ATOperation{
-				Action: op.Action,
-				Path:   op.Path,
-			}
-			if op.Cid != nil {
-				atOp.Cid = op.Cid.String()
-			}
 
-			atEvent.Ops = append(atEvent.Ops, atOp)
-		}
+		atEvent.Ops = append(atEvent.Ops, atOp)
 	}
+	c.countCollections(atEvent.Ops)
 
 	// Send event to callback (subscription manager) if set
-	if callback := c.getEventCallback(); callback != nil {
-		callback(&atEvent)
-	}
+	c.dispatchEvent(&atEvent)
 
 	// Process the event with legacy filtering (for backward compatibility)
 	c.handleEvent(atEvent)
 	return nil
 }
 
-// decodeCarBlocks decodes CAR (Content Addressable Archive) blocks and extracts records
-func (c *Client) decodeCarBlocks(carData []byte) (map[string]interface{}, error) {
-	records := make(map[string]interface{})
+// maxRecordBytes returns the size above which record blocks aren't decoded (0 means no limit)
+func (c *Client) maxRecordBytes() int {
+	if c.config == nil {
+		return 0
+	}
+	return c.config.Firehose.MaxRecordBytes
+}
+
+// decodesRecords reports whether a commit's records are worth decoding: always without a
+// collection allowlist, otherwise only when one of its ops is in an allowed collection
+func (c *Client) decodesRecords(ops []*atproto.SyncSubscribeRepos_RepoOp) bool {
+	if c.config == nil || len(c.config.Firehose.CollectionAllowlist) == 0 {
+		return true
+	}
+	for _, op := range ops {
+		collection, _, _ := strings.Cut(op.Path, "/")
+		if slices.Contains(c.config.Firehose.CollectionAllowlist, collection) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRepoIdentity processes identity events (handle and DID document changes) from a firehose upstream
+func (c *Client) handleRepoIdentity(u *upstream, evt *atproto.SyncSubscribeRepos_Identity) error {
+	u.cursor.Store(evt.Seq)
+	u.markMessageReceived()
+
+	atEvent := models.ATEvent{
+		Did:      evt.Did,
+		Time:     evt.Time,
+		Kind:     models.EventKindIdentity,
+		Seq:      evt.Seq,
+		Identity: &models.IdentityInfo{},
+	}
+	if evt.Handle != nil {
+		atEvent.Identity.Handle = *evt.Handle
+	}
+
+	c.dispatchEvent(&atEvent)
+	return nil
+}
+
+// handleRepoAccount processes account status events (activation, deactivation, takedown) from a firehose upstream
+func (c *Client) handleRepoAccount(u *upstream, evt *atproto.SyncSubscribeRepos_Account) error {
+	u.cursor.Store(evt.Seq)
+	u.markMessageReceived()
+
+	atEvent := models.ATEvent{
+		Did:     evt.Did,
+		Time:    evt.Time,
+		Kind:    models.EventKindAccount,
+		Seq:     evt.Seq,
+		Account: &models.AccountInfo{Active: evt.Active},
+	}
+	if evt.Status != nil {
+		atEvent.Account.Status = *evt.Status
+	}
+
+	c.dispatchEvent(&atEvent)
+	return nil
+}
+
+// carDecoder holds the scratch state for decoding one commit's CAR blocks, pooled across commits
+type carDecoder struct {
+	reader        bytes.Reader
+	records       map[string]interface{} // Decoded records keyed by binary CID (cid.Cid.KeyString)
+	rawBlocks     map[string][]byte      // Original bytes of the decoded records, keyed like records
+	oversized     map[string]struct{}    // Binary CIDs of blocks left undecoded for exceeding firehose.max_record_bytes
+	invalidBlocks int                    // Blocks skipped because they weren't valid CBOR
+	readErr       error                  // Error that cut reading the archive short, if any
+}
+
+// stringMapDecMode decodes CBOR maps straight into string-keyed maps. Records are DAG-CBOR,
+// which only allows string keys, so this skips the convertCBORToStringMap copy in the common case
+var stringMapDecMode = func() cbor.DecMode {
+	mode, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	if err != nil {
+		panic(fmt.Sprintf("invalid CBOR decode options: %v", err))
+	}
+	return mode
+}()
 
-	// Create a reader from the CAR data
-	carReader := bytes.NewReader(carData)
+// acquireCarDecoder takes a decoder from the pool, allocating one if the pool is empty
+func (c *Client) acquireCarDecoder() *carDecoder {
+	if dec, ok := c.carDecoders.Get().(*carDecoder); ok {
+		return dec
+	}
+	return &carDecoder{records: make(map[string]interface{}), rawBlocks: make(map[string][]byte), oversized: make(map[string]struct{})}
+}
+
+// releaseCarDecoder returns a decoder to the pool. Decoded records and raw blocks may still be
+// referenced by events, so only the maps are cleared; the values themselves are never reused
+func (c *Client) releaseCarDecoder(dec *carDecoder) {
+	clear(dec.records)
+	clear(dec.rawBlocks)
+	clear(dec.oversized)
+	dec.reader.Reset(nil)
+	dec.invalidBlocks = 0
+	dec.readErr = nil
+	c.carDecoders.Put(dec)
+}
+
+// decodeCarBlocks decodes CAR (Content Addressable Archive) blocks and extracts records.
+// The returned decoder must be handed back with releaseCarDecoder once its records are consumed.
+// Failures are counted in car_decode_errors_total; blocks that aren't valid CBOR are skipped
+// and a read error partway through keeps the records decoded so far (see invalidBlocks and readErr).
+// Blocks larger than firehose.max_record_bytes aren't decoded at all (see oversized).
+func (c *Client) decodeCarBlocks(carData []byte) (*carDecoder, error) {
+	dec := c.acquireCarDecoder()
+	maxRecordBytes := c.maxRecordBytes()
 
 	// Read the CAR file
-	blockReader, err := carv2.NewBlockReader(carReader)
+	dec.reader.Reset(carData)
+	blockReader, err := carv2.NewBlockReader(&dec.reader)
 	if err != nil {
+		c.releaseCarDecoder(dec)
+		metriks.CarDecodeErrors.WithLabelValues("archive").Inc()
 		return nil, fmt.Errorf("failed to create CAR block reader: %w", err)
 	}
 
@@ -271,26 +772,43 @@ func (c *Client) decodeCarBlocks(carData []byte) (map[string]interface{}, error)
 	for {
 		block, err := blockReader.Next()
 		if err != nil {
-			// End of blocks
+			// io.EOF is the normal end of blocks; anything else is a truncated or corrupt archive
+			if !errors.Is(err, io.EOF) {
+				metriks.CarDecodeErrors.WithLabelValues("archive").Inc()
+				dec.readErr = err
+			}
 			break
 		}
 
-		// Try to decode the block data as CBOR
-		var record interface{}
-		if err := cbor.Unmarshal(block.RawData(), &record); err != nil {
-			// Skip blocks that aren't valid CBOR records
+		// Leave giant records undecoded, so they can't slow down matching for everyone
+		if maxRecordBytes > 0 && len(block.RawData()) > maxRecordBytes {
+			metriks.OversizedRecords.Inc()
+			dec.oversized[block.Cid().KeyString()] = struct{}{}
 			continue
 		}
 
-		// Convert CBOR map to string-keyed map for easier handling
-		convertedRecord := c.convertCBORToStringMap(record)
+		// Try to decode the block data as CBOR
+		var record interface{}
+		if err := stringMapDecMode.Unmarshal(block.RawData(), &record); err != nil {
+			// Fall back to generic maps for blocks with non-string keys
+			if err := cbor.Unmarshal(block.RawData(), &record); err != nil {
+				// Skip blocks that aren't valid CBOR records
+				metriks.CarDecodeErrors.WithLabelValues("block").Inc()
+				dec.invalidBlocks++
+				continue
+			}
+			record = c.convertCBORToStringMap(record)
+		}
 
-		// Store the record using the CID as the key
-		cidStr := block.Cid().String()
-		records[cidStr] = convertedRecord
+		// Store the record under its binary CID, which avoids a base32 encode per block. The
+		// block reader allocates each block's bytes, so keeping them for includeRawRecord
+		// filters costs no copy.
+		key := block.Cid().KeyString()
+		dec.records[key] = record
+		dec.rawBlocks[key] = block.RawData()
 	}
 
-	return records, nil
+	return dec, nil
 }
 
 // convertCBORToStringMap converts CBOR interface{} maps to string-keyed maps
@@ -319,14 +837,15 @@ func (c *Client) convertCBORToStringMap(data interface{}) interface{} {
 func (c *Client) handleEvent(event models.ATEvent) {
 	currentFilters := c.GetFilters()
 
-	// Filter by repository if specified (repository filter should match DID)
-	if currentFilters.Repository != "" && event.Did != currentFilters.Repository {
+	// Filter by repository if specified (repository filter should match one of the DIDs)
+	if !currentFilters.MatchesRepository(event.Did) {
 		return
 	}
 
-	// Process operations in the event
+	// Process operations in the event (create/update by default, or the configured actions)
+	matched := false
 	for _, op := range event.Ops {
-		if op.Action == "create" || op.Action == "update" {
+		if actionSelected(op.Action, currentFilters) {
 			// Extract collection from path (e.g., "app.bsky.feed.post/abc123" -> "app.bsky.feed.post")
 			pathParts := strings.Split(op.Path, "/")
 			if len(pathParts) > 0 {
@@ -341,10 +860,29 @@ func (c *Client) handleEvent(event models.ATEvent) {
 				continue
 			}
 
+			// Filter by exact collection if specified
+			if !currentFilters.MatchesCollection(op.Collection) {
+				continue
+			}
+
 			// Check if matches filter (for legacy compatibility)
-			c.matchesFilter(op, currentFilters)
+			if c.matchesFilter(op, currentFilters) {
+				matched = true
+			}
 		}
 	}
+
+	if matched {
+		c.eventsMatched.Add(1)
+	}
+}
+
+// actionSelected reports whether an operation action should be processed for the given filters
+func actionSelected(action string, filters models.FilterOptions) bool {
+	if len(filters.Actions) == 0 {
+		return action == models.ActionCreate || action == models.ActionUpdate
+	}
+	return filters.AllowsAction(action)
 }
 
 // matchesFilter checks if an operation matches the filter criteria
@@ -378,18 +916,30 @@ func (c *Client) matchesFilter(op models.ATOperation, filters models.FilterOptio
 		return text != ""
 	}
 
-	// Check if text contains any of the keywords (comma-separated, case-insensitive)
+	// Check if text contains the keywords (comma-separated, case-insensitive)
 	if text != "" {
-		// Split keywords by comma and check for any match
+		// Split keywords by comma and check according to the match mode
 		keywordList := strings.Split(filters.Keyword, ",")
-		textLower := strings.ToLower(text)
+		requireAll := filters.KeywordMatchMode == models.KeywordMatchAll
+		matched := false
 
 		for _, keyword := range keywordList {
 			keyword = strings.TrimSpace(keyword) // Remove any surrounding whitespace
-			if keyword != "" && strings.Contains(textLower, strings.ToLower(keyword)) {
+			if keyword == "" {
+				continue
+			}
+
+			contains := filters.ContainsKeyword(text, keyword)
+			if contains && !requireAll {
 				return true // Return true if any keyword matches
 			}
+			if !contains && requireAll {
+				return false // Every keyword must match in "all" mode
+			}
+			matched = matched || contains
 		}
+
+		return matched
 	}
 
 	return false
@@ -1,9 +1,26 @@
 package firehose
 
 import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/ipfs/go-cid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
 	"github.com/JWhist/AT_Proto_PubSub/internal/models"
 )
 
@@ -28,6 +45,20 @@ func (m *MockEventCallback) GetEvents() []models.ATEvent {
 	return eventsCopy
 }
 
+// WaitForEvents returns the received events once there are at least n of them, for clients that
+// deliver through the event buffer
+func (m *MockEventCallback) WaitForEvents(t *testing.T, n int) []models.ATEvent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events := m.GetEvents()
+		if len(events) >= n || time.Now().After(deadline) {
+			return events
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 func (m *MockEventCallback) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -180,6 +211,75 @@ func TestNilCallback(t *testing.T) {
 	client.SetEventCallback(nil)
 }
 
+func TestSwapEventCallbackWhileEventsFlow(t *testing.T) {
+	client := NewClient()
+	first, second, third := &MockEventCallback{}, &MockEventCallback{}, &MockEventCallback{}
+	client.SetEventCallback(first.Call)
+
+	// Keep commits flowing from several goroutines until the callbacks have been swapped
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for seq := int64(1); ; seq++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+					Repo: "did:plc:test" + strconv.Itoa(id),
+					Seq:  seq,
+					Time: time.Now().Format(time.RFC3339),
+					Ops:  []*atproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/abc"}},
+				}); err != nil {
+					t.Errorf("handleRepoCommit returned error: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	waitForEvents := func(mock *MockEventCallback) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for len(mock.GetEvents()) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for the callback to receive events")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Once a swap returns, the replaced callback must never be called again
+	waitForEvents(first)
+	client.SetEventCallback(second.Call)
+	firstCount := len(first.GetEvents())
+
+	waitForEvents(second)
+	client.ClearEventCallback()
+	secondCount := len(second.GetEvents())
+
+	// Events keep being processed without a callback, and a new one picks up where they left off
+	client.SetEventCallback(third.Call)
+	waitForEvents(third)
+
+	close(stop)
+	wg.Wait()
+
+	if got := len(first.GetEvents()); got != firstCount {
+		t.Errorf("Expected the first callback to stay at %d events after being replaced, got %d", firstCount, got)
+	}
+	if got := len(second.GetEvents()); got != secondCount {
+		t.Errorf("Expected the second callback to stay at %d events after being cleared, got %d", secondCount, got)
+	}
+	if client.getEventCallback() == nil {
+		t.Error("Expected the last callback to still be set")
+	}
+}
+
 func TestNewClient(t *testing.T) {
 	client := NewClient()
 
@@ -504,6 +604,97 @@ func TestMatchesFilter(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name: "All mode matches when every keyword present",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "Hello world, this is a test",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:          "hello,test",
+				KeywordMatchMode: models.KeywordMatchAll,
+			},
+			expected: true,
+		},
+		{
+			name: "All mode rejects when a keyword is missing",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "Hello world",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:          "hello,test",
+				KeywordMatchMode: models.KeywordMatchAll,
+			},
+			expected: false,
+		},
+		{
+			name: "Whole word rejects substring",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "Browse by category",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:   "cat",
+				WholeWord: true,
+			},
+			expected: false,
+		},
+		{
+			name: "Whole word matches next to punctuation",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "My cat, Felix!",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:   "cat",
+				WholeWord: true,
+			},
+			expected: true,
+		},
+		{
+			name: "Whole word matches next to emoji",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "🐱cat🐱",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:   "cat",
+				WholeWord: true,
+			},
+			expected: true,
+		},
+		{
+			name: "Case-sensitive keyword rejects different case",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "Watching $aapl",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:       "$AAPL",
+				CaseSensitive: true,
+			},
+			expected: false,
+		},
+		{
+			name: "Case-sensitive keyword matches exact case",
+			op: models.ATOperation{
+				Record: map[string]interface{}{
+					"text": "Watching $AAPL",
+				},
+			},
+			filters: models.FilterOptions{
+				Keyword:       "$AAPL",
+				CaseSensitive: true,
+			},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -868,3 +1059,709 @@ func TestPathParsing(t *testing.T) {
 	})
 	client.handleEvent(event)
 }
+
+func TestActionSelected(t *testing.T) {
+	// Without an action filter only create/update are processed
+	if !actionSelected("create", models.FilterOptions{}) || !actionSelected("update", models.FilterOptions{}) {
+		t.Error("Expected create and update to be selected by default")
+	}
+	if actionSelected("delete", models.FilterOptions{}) {
+		t.Error("Expected delete to be skipped by default")
+	}
+
+	// An explicit action filter replaces the default
+	deletesOnly := models.FilterOptions{Actions: []string{"delete"}}
+	if !actionSelected("delete", deletesOnly) {
+		t.Error("Expected delete to be selected when configured")
+	}
+	if actionSelected("create", deletesOnly) {
+		t.Error("Expected create to be skipped when only delete is configured")
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	base := 5 * time.Second
+	maxDelay := 1 * time.Minute
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 1, expected: 5 * time.Second},
+		{attempt: 2, expected: 10 * time.Second},
+		{attempt: 3, expected: 20 * time.Second},
+		{attempt: 4, expected: 40 * time.Second},
+		{attempt: 5, expected: 1 * time.Minute},
+		{attempt: 50, expected: 1 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if delay := reconnectBackoff(base, maxDelay, tt.attempt); delay != tt.expected {
+			t.Errorf("reconnectBackoff(attempt %d) = %v, want %v", tt.attempt, delay, tt.expected)
+		}
+	}
+}
+
+func TestWithCursor(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		cursor   int64
+		expected string
+	}{
+		{
+			name:     "adds cursor parameter",
+			url:      "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos",
+			cursor:   12345,
+			expected: "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos?cursor=12345",
+		},
+		{
+			name:     "replaces existing cursor parameter",
+			url:      "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos?cursor=1",
+			cursor:   99,
+			expected: "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos?cursor=99",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := withCursor(tt.url, tt.cursor); result != tt.expected {
+				t.Errorf("withCursor() = %s, want %s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCursorPersistence(t *testing.T) {
+	cursorFile := filepath.Join(t.TempDir(), "cursor")
+
+	// Missing file means no saved cursor
+	cursor, err := loadCursor(cursorFile)
+	if err != nil || cursor != 0 {
+		t.Fatalf("Expected 0 cursor and no error for missing file, got %d, %v", cursor, err)
+	}
+
+	if err := saveCursor(cursorFile, 424242); err != nil {
+		t.Fatalf("Failed to save cursor: %v", err)
+	}
+
+	cursor, err = loadCursor(cursorFile)
+	if err != nil {
+		t.Fatalf("Failed to load cursor: %v", err)
+	}
+	if cursor != 424242 {
+		t.Errorf("Expected cursor 424242, got %d", cursor)
+	}
+}
+
+func TestGetCursor(t *testing.T) {
+	client := NewClient()
+	if client.GetCursor() != 0 {
+		t.Errorf("Expected initial cursor 0, got %d", client.GetCursor())
+	}
+
+	client.upstreams[0].cursor.Store(7)
+	if client.GetCursor() != 7 {
+		t.Errorf("Expected cursor 7, got %d", client.GetCursor())
+	}
+}
+
+func TestHandleNonCommitEvents(t *testing.T) {
+	client := NewClient()
+	mockCallback := &MockEventCallback{}
+	client.SetEventCallback(mockCallback.Call)
+
+	handle := "alice.bsky.social"
+	if err := client.handleRepoIdentity(client.upstreams[0], &atproto.SyncSubscribeRepos_Identity{
+		Did:    "did:plc:alice",
+		Handle: &handle,
+		Seq:    100,
+		Time:   "2024-01-01T00:00:00Z",
+	}); err != nil {
+		t.Fatalf("handleRepoIdentity returned error: %v", err)
+	}
+
+	status := "deactivated"
+	if err := client.handleRepoAccount(client.upstreams[0], &atproto.SyncSubscribeRepos_Account{
+		Did:    "did:plc:alice",
+		Active: false,
+		Status: &status,
+		Seq:    101,
+		Time:   "2024-01-01T00:00:01Z",
+	}); err != nil {
+		t.Fatalf("handleRepoAccount returned error: %v", err)
+	}
+
+	events := mockCallback.GetEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	if events[0].Kind != models.EventKindIdentity || events[0].Identity == nil || events[0].Identity.Handle != handle {
+		t.Errorf("Unexpected identity event: %+v", events[0])
+	}
+	if events[1].Kind != models.EventKindAccount || events[1].Account == nil || events[1].Account.Active || events[1].Account.Status != status {
+		t.Errorf("Unexpected account event: %+v", events[1])
+	}
+	if events[0].Seq != 100 || events[1].Seq != 101 {
+		t.Errorf("Expected events to carry their seq, got %d and %d", events[0].Seq, events[1].Seq)
+	}
+
+	if client.GetCursor() != 101 {
+		t.Errorf("Expected cursor 101 after non-commit events, got %d", client.GetCursor())
+	}
+}
+
+func TestRecordLag(t *testing.T) {
+	client := NewClient()
+
+	// Unparseable timestamps are ignored
+	client.recordLag("not a timestamp")
+	if client.GetLag() != 0 {
+		t.Errorf("Expected no lag for an invalid timestamp, got %v", client.GetLag())
+	}
+
+	// The first sample sets the lag directly
+	client.recordLag(time.Now().Add(-10 * time.Second).Format(time.RFC3339Nano))
+	first := client.GetLag()
+	if first < 10*time.Second || first > 11*time.Second {
+		t.Errorf("Expected lag of about 10s, got %v", first)
+	}
+
+	// Later samples are smoothed rather than replacing the value
+	client.recordLag(time.Now().Format(time.RFC3339Nano))
+	smoothed := client.GetLag()
+	if smoothed >= first || smoothed < first/2 {
+		t.Errorf("Expected smoothed lag between %v and %v, got %v", first/2, first, smoothed)
+	}
+
+	// Commits update the lag while being processed
+	commitClient := NewClient()
+	if err := commitClient.handleRepoCommit(commitClient.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+		Repo: "did:plc:alice",
+		Seq:  1,
+		Time: time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}); err != nil {
+		t.Fatalf("handleRepoCommit returned error: %v", err)
+	}
+	if commitClient.GetLag() < 59*time.Second {
+		t.Errorf("Expected lag of about a minute after commit, got %v", commitClient.GetLag())
+	}
+}
+
+func TestCheckReady(t *testing.T) {
+	client := NewClient()
+
+	if err := client.CheckReady(time.Minute); err == nil {
+		t.Error("Expected not ready before connecting")
+	}
+
+	client.upstreams[0].connected.Store(true)
+	if err := client.CheckReady(time.Minute); err == nil {
+		t.Error("Expected not ready before any message")
+	}
+	if !client.LastMessageAt().IsZero() {
+		t.Errorf("Expected zero LastMessageAt before any message, got %v", client.LastMessageAt())
+	}
+
+	// Any firehose message counts, not just commits
+	if err := client.handleRepoIdentity(client.upstreams[0], &atproto.SyncSubscribeRepos_Identity{Did: "did:plc:alice", Seq: 1}); err != nil {
+		t.Fatalf("handleRepoIdentity returned error: %v", err)
+	}
+	if err := client.CheckReady(time.Minute); err != nil {
+		t.Errorf("Expected ready after a message, got %v", err)
+	}
+
+	// A stale last message fails the window
+	client.upstreams[0].lastMessage.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if err := client.CheckReady(time.Minute); err == nil {
+		t.Error("Expected not ready when the last message is outside the window")
+	}
+
+	if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{Repo: "did:plc:alice", Seq: 2}); err != nil {
+		t.Fatalf("handleRepoCommit returned error: %v", err)
+	}
+	if err := client.CheckReady(time.Minute); err != nil {
+		t.Errorf("Expected ready after a commit, got %v", err)
+	}
+
+	client.upstreams[0].connected.Store(false)
+	if err := client.CheckReady(time.Minute); err == nil {
+		t.Error("Expected not ready after disconnecting")
+	}
+}
+
+func TestHandleRepoCommitCountsEvents(t *testing.T) {
+	client := NewClient()
+	client.UpdateFilters(models.FilterOptions{Keyword: "hello"})
+	receivedBefore := testutil.ToFloat64(metriks.MessagesReceived)
+
+	carData, cids := buildTestCar(t, testPostRecord("hello world"), testPostRecord("goodbye"))
+	for i, c := range cids {
+		link := lexutil.LexLink(c)
+		if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:alice",
+			Seq:    int64(i + 1),
+			Blocks: carData,
+			Ops:    []*atproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/" + strconv.Itoa(i), Cid: &link}},
+		}); err != nil {
+			t.Fatalf("handleRepoCommit returned error: %v", err)
+		}
+	}
+
+	if received := testutil.ToFloat64(metriks.MessagesReceived) - receivedBefore; received != 2 {
+		t.Errorf("Expected messages_received_total to increase by 2, got %v", received)
+	}
+	if seen := client.GetEventsSeen(); seen != 2 {
+		t.Errorf("Expected 2 events seen, got %d", seen)
+	}
+	if matched := client.GetEventsMatched(); matched != 1 {
+		t.Errorf("Expected 1 event matched, got %d", matched)
+	}
+}
+
+func TestObserveOnlySkipsCallback(t *testing.T) {
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{ObserveOnly: true}})
+	mock := &MockEventCallback{}
+	client.SetEventCallback(mock.Call)
+	receivedBefore := testutil.ToFloat64(metriks.MessagesReceived)
+
+	carData, cids := buildTestCar(t, testPostRecord("hello world"))
+	link := lexutil.LexLink(cids[0])
+	if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:alice",
+		Seq:    7,
+		Time:   time.Now().Format(time.RFC3339),
+		Blocks: carData,
+		Ops:    []*atproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: "app.bsky.feed.post/abc123", Cid: &link}},
+	}); err != nil {
+		t.Fatalf("handleRepoCommit returned error: %v", err)
+	}
+
+	if len(mock.GetEvents()) != 0 {
+		t.Errorf("Expected no events forwarded in observe-only mode, got %d", len(mock.GetEvents()))
+	}
+	// Ingest bookkeeping still happens
+	if client.GetEventsSeen() != 1 || client.GetCursor() != 7 {
+		t.Errorf("Expected the event counted and the cursor advanced, got %d seen at cursor %d", client.GetEventsSeen(), client.GetCursor())
+	}
+	if received := testutil.ToFloat64(metriks.MessagesReceived) - receivedBefore; received != 1 {
+		t.Errorf("Expected messages_received_total to increase by 1, got %v", received)
+	}
+}
+
+func TestConnectHandshakeTimeout(t *testing.T) {
+	// A listener that accepts connections but never answers the upgrade request
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Swallow the request until the client gives up, then release the connection
+			io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"non-routable address", "ws://10.255.255.1/xrpc/com.atproto.sync.subscribeRepos"},
+		{"unresponsive server", "ws://" + listener.Addr().String() + "/xrpc/com.atproto.sync.subscribeRepos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{HandshakeTimeout: 200 * time.Millisecond}})
+
+			start := time.Now()
+			err := client.connectAndListen(context.Background(), client.upstreams[0], tt.url)
+			if err == nil {
+				t.Fatal("Expected the dial to fail")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected the dial to give up after the handshake timeout, took %v", elapsed)
+			}
+		})
+	}
+
+	t.Run("context cancelled", func(t *testing.T) {
+		client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{HandshakeTimeout: time.Minute}})
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := client.connectAndListen(ctx, client.upstreams[0], "ws://"+listener.Addr().String()+"/"); err == nil {
+			t.Fatal("Expected the dial to fail")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected the dial to stop when the context is done, took %v", elapsed)
+		}
+	})
+}
+
+// buildTestCar encodes records as DAG-CBOR blocks in a CARv1 archive, returning the archive and block CIDs
+func buildTestCar(t testing.TB, records ...interface{}) ([]byte, []cid.Cid) {
+	t.Helper()
+	prefix := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: 0x12, MhLength: -1} // sha2-256
+
+	var cids []cid.Cid
+	var blocks [][]byte
+	for _, record := range records {
+		data, err := cbor.Marshal(record)
+		if err != nil {
+			t.Fatalf("Failed to encode record: %v", err)
+		}
+		blockCid, err := prefix.Sum(data)
+		if err != nil {
+			t.Fatalf("Failed to compute CID: %v", err)
+		}
+		cids = append(cids, blockCid)
+		blocks = append(blocks, data)
+	}
+
+	// CIDs are CBOR tag 42 over the binary CID with a leading multibase identity byte
+	header, err := cbor.Marshal(map[string]interface{}{
+		"roots":   []cbor.Tag{{Number: 42, Content: append([]byte{0}, cids[0].Bytes()...)}},
+		"version": 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode CAR header: %v", err)
+	}
+
+	car := binary.AppendUvarint(nil, uint64(len(header)))
+	car = append(car, header...)
+	for i, data := range blocks {
+		cidBytes := cids[i].Bytes()
+		car = binary.AppendUvarint(car, uint64(len(cidBytes)+len(data)))
+		car = append(car, cidBytes...)
+		car = append(car, data...)
+	}
+	return car, cids
+}
+
+// testPostRecord is a representative app.bsky.feed.post record with nested maps and arrays
+func testPostRecord(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"$type":     "app.bsky.feed.post",
+		"text":      text,
+		"createdAt": "2024-01-01T00:00:00Z",
+		"langs":     []interface{}{"en"},
+		"facets": []interface{}{
+			map[string]interface{}{
+				"index":    map[string]interface{}{"byteStart": 0, "byteEnd": 5},
+				"features": []interface{}{map[string]interface{}{"$type": "app.bsky.richtext.facet#tag", "tag": "golang"}},
+			},
+		},
+		"embed": map[string]interface{}{
+			"$type": "app.bsky.embed.external",
+			"external": map[string]interface{}{
+				"uri":         "https://example.com",
+				"title":       "Example",
+				"description": "An example link",
+			},
+		},
+	}
+}
+
+func TestDecodeCarBlocks(t *testing.T) {
+	client := NewClient()
+	records := []interface{}{
+		testPostRecord("hello world"),
+		map[string]interface{}{"$type": "app.bsky.feed.like", "createdAt": "2024-01-01T00:00:00Z"},
+		// Non-string keys aren't valid DAG-CBOR but must still decode, dropping those keys
+		map[interface{}]interface{}{"text": "mixed keys", 1: "dropped"},
+	}
+	carData, cids := buildTestCar(t, records...)
+
+	// Run twice so the second pass exercises a decoder taken back from the pool
+	for pass := 0; pass < 2; pass++ {
+		dec, err := client.decodeCarBlocks(carData)
+		if err != nil {
+			t.Fatalf("decodeCarBlocks returned error: %v", err)
+		}
+		if len(dec.records) != len(records) {
+			t.Fatalf("Expected %d records, got %d", len(records), len(dec.records))
+		}
+
+		for i, blockCid := range cids {
+			// The result must match the generic decode + convertCBORToStringMap path
+			data, _ := cbor.Marshal(records[i])
+			var generic interface{}
+			if err := cbor.Unmarshal(data, &generic); err != nil {
+				t.Fatalf("Failed to decode record %d: %v", i, err)
+			}
+			expected := client.convertCBORToStringMap(generic)
+
+			if got := dec.records[blockCid.KeyString()]; !reflect.DeepEqual(got, expected) {
+				t.Errorf("Pass %d record %d: expected %#v, got %#v", pass, i, expected, got)
+			}
+		}
+		client.releaseCarDecoder(dec)
+	}
+
+	if _, err := client.decodeCarBlocks([]byte("not a car file")); err == nil {
+		t.Error("Expected error for invalid CAR data")
+	}
+}
+
+func TestDecodeCarBlocksCountsFailures(t *testing.T) {
+	client := NewClient()
+	archiveErrors := func() float64 { return testutil.ToFloat64(metriks.CarDecodeErrors.WithLabelValues("archive")) }
+	blockErrors := func() float64 { return testutil.ToFloat64(metriks.CarDecodeErrors.WithLabelValues("block")) }
+
+	before := archiveErrors()
+	if _, err := client.decodeCarBlocks([]byte("not a car file")); err == nil {
+		t.Error("Expected error for invalid CAR data")
+	}
+	if delta := archiveErrors() - before; delta != 1 {
+		t.Errorf("Expected one archive error counted, got %v", delta)
+	}
+
+	// Append a block that isn't CBOR after a valid record
+	carData, _ := buildTestCar(t, testPostRecord("hello world"))
+	garbage := []byte{0xff, 0xff}
+	garbageCid, err := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: 0x12, MhLength: -1}.Sum(garbage)
+	if err != nil {
+		t.Fatalf("Failed to compute CID: %v", err)
+	}
+	carData = binary.AppendUvarint(carData, uint64(len(garbageCid.Bytes())+len(garbage)))
+	carData = append(carData, garbageCid.Bytes()...)
+	carData = append(carData, garbage...)
+
+	before = blockErrors()
+	dec, err := client.decodeCarBlocks(carData)
+	if err != nil {
+		t.Fatalf("decodeCarBlocks returned error: %v", err)
+	}
+	if len(dec.records) != 1 || dec.invalidBlocks != 1 || dec.readErr != nil {
+		t.Errorf("Expected 1 record and 1 invalid block, got %d records, %d invalid, error %v", len(dec.records), dec.invalidBlocks, dec.readErr)
+	}
+	client.releaseCarDecoder(dec)
+	if delta := blockErrors() - before; delta != 1 {
+		t.Errorf("Expected one block error counted, got %v", delta)
+	}
+
+	// A truncated archive keeps the records read before the cut
+	truncated, _ := buildTestCar(t, testPostRecord("first"), testPostRecord("second"))
+	before = archiveErrors()
+	dec, err = client.decodeCarBlocks(truncated[:len(truncated)-5])
+	if err != nil {
+		t.Fatalf("decodeCarBlocks returned error: %v", err)
+	}
+	if len(dec.records) != 1 || dec.readErr == nil {
+		t.Errorf("Expected 1 record and a read error, got %d records, error %v", len(dec.records), dec.readErr)
+	}
+	client.releaseCarDecoder(dec)
+	if delta := archiveErrors() - before; delta != 1 {
+		t.Errorf("Expected one archive error counted, got %v", delta)
+	}
+}
+
+func TestHandleRepoCommitAttachesRecords(t *testing.T) {
+	client := NewClient()
+	mock := &MockEventCallback{}
+	client.SetEventCallback(mock.Call)
+
+	carData, cids := buildTestCar(t, testPostRecord("hello world"))
+	link := lexutil.LexLink(cids[0])
+	if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:alice",
+		Seq:    1,
+		Time:   time.Now().Format(time.RFC3339),
+		Blocks: carData,
+		Ops: []*atproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/abc123", Cid: &link},
+		},
+	}); err != nil {
+		t.Fatalf("handleRepoCommit returned error: %v", err)
+	}
+
+	events := mock.GetEvents()
+	if len(events) != 1 || len(events[0].Ops) != 1 {
+		t.Fatalf("Expected 1 event with 1 op, got %+v", events)
+	}
+	op := events[0].Ops[0]
+	if op.Cid != cids[0].String() {
+		t.Errorf("Expected CID %s, got %s", cids[0].String(), op.Cid)
+	}
+	record, ok := op.Record.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected record map, got %T", op.Record)
+	}
+	if record["text"] != "hello world" {
+		t.Errorf("Expected record text 'hello world', got %v", record["text"])
+	}
+
+	// The original block is kept alongside the decoded record and still hashes to its CID
+	if len(op.RawRecord) == 0 {
+		t.Fatal("Expected the raw record block to be attached")
+	}
+	if hashed, err := cids[0].Prefix().Sum(op.RawRecord); err != nil || !hashed.Equals(cids[0]) {
+		t.Errorf("Expected the raw record to hash to %s, got %v (error %v)", cids[0], hashed, err)
+	}
+}
+
+func TestHandleRepoCommitCollectionAllowlist(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Firehose.CollectionAllowlist = []string{"app.bsky.feed.post"}
+	client := NewClientWithConfig(cfg)
+	mock := &MockEventCallback{}
+	client.SetEventCallback(mock.Call)
+
+	carData, cids := buildTestCar(t, testPostRecord("hello world"))
+	link := lexutil.LexLink(cids[0])
+	commit := func(path string) {
+		if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+			Repo:   "did:plc:alice",
+			Seq:    1,
+			Time:   time.Now().Format(time.RFC3339),
+			Blocks: carData,
+			Ops:    []*atproto.SyncSubscribeRepos_RepoOp{{Action: "create", Path: path, Cid: &link}},
+		}); err != nil {
+			t.Fatalf("handleRepoCommit returned error: %v", err)
+		}
+	}
+
+	skippedBefore := testutil.ToFloat64(metriks.SkippedCommitDecodes)
+	commit("app.bsky.feed.post/abc123")
+	commit("app.bsky.feed.like/def456")
+
+	events := mock.WaitForEvents(t, 2)
+	if len(events) != 2 {
+		t.Fatalf("Expected both commits to be forwarded, got %d", len(events))
+	}
+	if events[0].Ops[0].Record == nil {
+		t.Error("Expected the record of an allowed collection to be decoded")
+	}
+	skipped := events[1].Ops[0]
+	if skipped.Record != nil {
+		t.Errorf("Expected no record outside the allowlist, got %v", skipped.Record)
+	}
+	if skipped.Collection != "app.bsky.feed.like" || skipped.Rkey != "def456" || skipped.Cid != cids[0].String() {
+		t.Errorf("Expected the op to keep its collection, rkey and CID, got %+v", skipped)
+	}
+	if delta := testutil.ToFloat64(metriks.SkippedCommitDecodes) - skippedBefore; delta != 1 {
+		t.Errorf("Expected one skipped decode counted, got %v", delta)
+	}
+}
+
+func TestHandleRepoCommitMaxRecordBytes(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Firehose.MaxRecordBytes = 1024
+	client := NewClientWithConfig(cfg)
+	mock := &MockEventCallback{}
+	client.SetEventCallback(mock.Call)
+
+	carData, cids := buildTestCar(t, testPostRecord("short post"), testPostRecord(strings.Repeat("giant ", 500)))
+	small, giant := lexutil.LexLink(cids[0]), lexutil.LexLink(cids[1])
+
+	oversizedBefore := testutil.ToFloat64(metriks.OversizedRecords)
+	if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:alice",
+		Seq:    1,
+		Time:   time.Now().Format(time.RFC3339),
+		Blocks: carData,
+		Ops: []*atproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/small", Cid: &small},
+			{Action: "create", Path: "app.bsky.feed.post/giant", Cid: &giant},
+		},
+	}); err != nil {
+		t.Fatalf("handleRepoCommit returned error: %v", err)
+	}
+
+	events := mock.WaitForEvents(t, 1)
+	if len(events) != 1 || len(events[0].Ops) != 2 {
+		t.Fatalf("Expected 1 event with 2 ops, got %+v", events)
+	}
+	if op := events[0].Ops[0]; op.Record == nil || op.RecordTruncated {
+		t.Errorf("Expected the small record to be decoded, got %+v", op)
+	}
+	if op := events[0].Ops[1]; op.Record != nil || !op.RecordTruncated {
+		t.Errorf("Expected the giant record to be left out and marked truncated, got %+v", op)
+	}
+	if delta := testutil.ToFloat64(metriks.OversizedRecords) - oversizedBefore; delta != 1 {
+		t.Errorf("Expected one oversized record counted, got %v", delta)
+	}
+}
+
+func TestHandleRepoCommitCollectionMetrics(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Firehose.CollectionMetrics = true
+	cfg.Firehose.CollectionMetricsMaxLabels = 2
+	client := NewClientWithConfig(cfg)
+
+	commit := func(paths ...string) {
+		var ops []*atproto.SyncSubscribeRepos_RepoOp
+		for _, path := range paths {
+			ops = append(ops, &atproto.SyncSubscribeRepos_RepoOp{Action: "delete", Path: path})
+		}
+		if err := client.handleRepoCommit(client.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+			Repo: "did:plc:alice",
+			Seq:  1,
+			Time: time.Now().Format(time.RFC3339),
+			Ops:  ops,
+		}); err != nil {
+			t.Fatalf("handleRepoCommit returned error: %v", err)
+		}
+	}
+	count := func(label string) float64 {
+		return testutil.ToFloat64(metriks.RecordsByCollection.WithLabelValues(label))
+	}
+
+	postsBefore, likesBefore, otherBefore := count("app.bsky.feed.post"), count("app.bsky.feed.like"), count("other")
+	commit("app.bsky.feed.post/a", "app.bsky.feed.post/b", "app.bsky.feed.like/c")
+	commit("app.bsky.graph.follow/d", "app.bsky.feed.post/e")
+
+	if delta := count("app.bsky.feed.post") - postsBefore; delta != 3 {
+		t.Errorf("Expected 3 posts counted, got %v", delta)
+	}
+	if delta := count("app.bsky.feed.like") - likesBefore; delta != 1 {
+		t.Errorf("Expected 1 like counted, got %v", delta)
+	}
+	// The label cap is reached, so follows share the "other" label
+	if delta := count("other") - otherBefore; delta != 1 {
+		t.Errorf("Expected 1 op counted as other, got %v", delta)
+	}
+
+	// Without the flag nothing is counted
+	disabled := NewClientWithConfig(config.GetDefaultConfig())
+	postsBefore = count("app.bsky.feed.post")
+	if err := disabled.handleRepoCommit(disabled.upstreams[0], &atproto.SyncSubscribeRepos_Commit{
+		Repo: "did:plc:alice",
+		Seq:  2,
+		Time: time.Now().Format(time.RFC3339),
+		Ops:  []*atproto.SyncSubscribeRepos_RepoOp{{Action: "delete", Path: "app.bsky.feed.post/f"}},
+	}); err != nil {
+		t.Fatalf("handleRepoCommit returned error: %v", err)
+	}
+	if delta := count("app.bsky.feed.post") - postsBefore; delta != 0 {
+		t.Errorf("Expected no collection counts without collection_metrics, got %v", delta)
+	}
+}
+
+func BenchmarkDecodeCarBlocks(b *testing.B) {
+	client := NewClient()
+	carData, _ := buildTestCar(b,
+		testPostRecord("hello world"),
+		testPostRecord("second post"),
+		map[string]interface{}{"$type": "app.bsky.feed.like", "createdAt": "2024-01-01T00:00:00Z"},
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec, err := client.decodeCarBlocks(carData)
+		if err != nil {
+			b.Fatalf("decodeCarBlocks returned error: %v", err)
+		}
+		client.releaseCarDecoder(dec)
+	}
+}
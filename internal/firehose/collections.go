@@ -0,0 +1,68 @@
+package firehose
+
+import (
+	"sync"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+const (
+	otherCollectionLabel       = "other" // records_by_collection_total label for collections past the cap
+	defaultCollectionMaxLabels = 100     // Cap when the config doesn't set one
+)
+
+// collectionLabels hands out records_by_collection_total labels. Anyone can publish records in
+// a new collection, so only the first limit distinct collections get their own label and the
+// rest share "other", keeping the metric's cardinality bounded.
+type collectionLabels struct {
+	mu     sync.RWMutex
+	limit  int
+	labels map[string]struct{}
+}
+
+// newCollectionLabels returns a label set that admits up to limit distinct collections
+func newCollectionLabels(limit int) *collectionLabels {
+	if limit <= 0 {
+		limit = defaultCollectionMaxLabels
+	}
+	return &collectionLabels{
+		limit:  limit,
+		labels: make(map[string]struct{}),
+	}
+}
+
+// label returns the label to count a collection under, admitting it if there's room
+func (l *collectionLabels) label(collection string) string {
+	l.mu.RLock()
+	_, known := l.labels[collection]
+	l.mu.RUnlock()
+	if known {
+		return collection
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, known := l.labels[collection]; known {
+		return collection
+	}
+	if len(l.labels) >= l.limit {
+		return otherCollectionLabel
+	}
+	l.labels[collection] = struct{}{}
+	return collection
+}
+
+// countCollections counts a commit's ops in records_by_collection_total when collection
+// metrics are enabled
+func (c *Client) countCollections(ops []models.ATOperation) {
+	if c.collections == nil {
+		return
+	}
+	for _, op := range ops {
+		if op.Collection == "" {
+			continue
+		}
+		metriks.RecordsByCollection.WithLabelValues(c.collections.label(op.Collection)).Inc()
+	}
+}
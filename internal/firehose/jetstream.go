@@ -0,0 +1,165 @@
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// jetstreamEvent is a single JSON message from a Jetstream endpoint
+type jetstreamEvent struct {
+	Did      string             `json:"did"`
+	TimeUS   int64              `json:"time_us"`
+	Kind     string             `json:"kind"`
+	Commit   *jetstreamCommit   `json:"commit,omitempty"`
+	Identity *jetstreamIdentity `json:"identity,omitempty"`
+	Account  *jetstreamAccount  `json:"account,omitempty"`
+}
+
+// jetstreamCommit is the commit payload of a Jetstream event (one operation per message)
+type jetstreamCommit struct {
+	Rev        string                 `json:"rev"`
+	Operation  string                 `json:"operation"`
+	Collection string                 `json:"collection"`
+	Rkey       string                 `json:"rkey"`
+	Record     map[string]interface{} `json:"record,omitempty"`
+	Cid        string                 `json:"cid,omitempty"`
+}
+
+// jetstreamIdentity is the identity payload of a Jetstream event
+type jetstreamIdentity struct {
+	Did    string `json:"did"`
+	Handle string `json:"handle,omitempty"`
+	Seq    int64  `json:"seq"`
+	Time   string `json:"time"`
+}
+
+// jetstreamAccount is the account payload of a Jetstream event
+type jetstreamAccount struct {
+	Did    string `json:"did"`
+	Active bool   `json:"active"`
+	Status string `json:"status,omitempty"`
+	Seq    int64  `json:"seq"`
+	Time   string `json:"time"`
+}
+
+// connectAndListenJetstream establishes a Jetstream connection to an upstream and listens for JSON events
+func (c *Client) connectAndListenJetstream(ctx context.Context, u *upstream, jetstreamURL string) error {
+	conn, _, err := c.dialer().DialContext(ctx, jetstreamURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial jetstream: %w", err)
+	}
+	u.conn = conn
+	u.connected.Store(true)
+	slog.Info("Connected to jetstream, listening for messages", "url", u.url)
+
+	defer func() {
+		u.connected.Store(false)
+		if u.conn != nil {
+			if closeErr := u.conn.Close(); closeErr != nil {
+				slog.Warn("Error closing jetstream connection", "url", u.url, "error", closeErr)
+			}
+			u.conn = nil
+		}
+	}()
+
+	// This will block until the connection is lost or context is cancelled
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("jetstream read failed: %w", err)
+		}
+
+		if err := c.handleJetstreamMessage(u, data); err != nil {
+			// Skip malformed messages rather than dropping the connection
+			continue
+		}
+	}
+}
+
+// handleJetstreamMessage decodes a Jetstream JSON message from an upstream and dispatches it
+// like a firehose event
+func (c *Client) handleJetstreamMessage(u *upstream, data []byte) error {
+	var evt jetstreamEvent
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return fmt.Errorf("failed to decode jetstream message: %w", err)
+	}
+	u.markMessageReceived()
+
+	atEvent, ok := jetstreamToATEvent(&evt)
+	if !ok {
+		return nil
+	}
+
+	// Jetstream cursors are event times in unix microseconds
+	u.cursor.Store(evt.TimeUS)
+	if atEvent.Kind == models.EventKindCommit {
+		// Jetstream sends one message per op, so the op path tells messages of a commit apart
+		if c.isDuplicateCommit(evt.Did, evt.Commit.Rev, atEvent.Ops[0].Path) {
+			return nil
+		}
+		c.recordLag(atEvent.Time)
+		c.countEvent()
+		c.countCollections(atEvent.Ops)
+	}
+
+	c.dispatchEvent(atEvent)
+
+	// Commits also go through legacy filtering (for backward compatibility)
+	if atEvent.Kind == models.EventKindCommit {
+		c.handleEvent(*atEvent)
+	}
+	return nil
+}
+
+// jetstreamToATEvent converts a Jetstream event into the internal event format,
+// returning false for kinds that aren't supported
+func jetstreamToATEvent(evt *jetstreamEvent) (*models.ATEvent, bool) {
+	atEvent := &models.ATEvent{
+		Did:  evt.Did,
+		Time: time.UnixMicro(evt.TimeUS).UTC().Format(time.RFC3339Nano),
+		Seq:  evt.TimeUS, // Jetstream's cursor, increasing like a relay seq
+	}
+
+	switch evt.Kind {
+	case models.EventKindCommit:
+		if evt.Commit == nil {
+			return nil, false
+		}
+		atEvent.Kind = models.EventKindCommit
+		atEvent.Ops = []models.ATOperation{{
+			Action:     evt.Commit.Operation,
+			Path:       evt.Commit.Collection + "/" + evt.Commit.Rkey,
+			Collection: evt.Commit.Collection,
+			Rkey:       evt.Commit.Rkey,
+			Cid:        evt.Commit.Cid,
+		}}
+		// Only attach a record when present so deletes keep a nil Record like the repo source
+		if evt.Commit.Record != nil {
+			atEvent.Ops[0].Record = evt.Commit.Record
+		}
+	case models.EventKindIdentity:
+		atEvent.Kind = models.EventKindIdentity
+		atEvent.Identity = &models.IdentityInfo{}
+		if evt.Identity != nil {
+			atEvent.Identity.Handle = evt.Identity.Handle
+		}
+	case models.EventKindAccount:
+		if evt.Account == nil {
+			return nil, false
+		}
+		atEvent.Kind = models.EventKindAccount
+		atEvent.Account = &models.AccountInfo{Active: evt.Account.Active, Status: evt.Account.Status}
+	default:
+		return nil, false
+	}
+
+	return atEvent, true
+}
@@ -0,0 +1,119 @@
+package firehose
+
+import (
+	"testing"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestHandleJetstreamMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		message    string
+		expectErr  bool
+		expectKind string // empty means no event is delivered
+		validate   func(t *testing.T, event models.ATEvent)
+	}{
+		{
+			name:       "Commit create",
+			message:    `{"did":"did:plc:alice","time_us":1725911162329308,"kind":"commit","commit":{"rev":"3l3","operation":"create","collection":"app.bsky.feed.post","rkey":"abc123","record":{"$type":"app.bsky.feed.post","text":"hello world"},"cid":"bafyrei"}}`,
+			expectKind: models.EventKindCommit,
+			validate: func(t *testing.T, event models.ATEvent) {
+				if len(event.Ops) != 1 {
+					t.Fatalf("Expected 1 op, got %d", len(event.Ops))
+				}
+				op := event.Ops[0]
+				if op.Action != "create" || op.Path != "app.bsky.feed.post/abc123" || op.Collection != "app.bsky.feed.post" || op.Rkey != "abc123" || op.Cid != "bafyrei" {
+					t.Errorf("Unexpected op: %+v", op)
+				}
+				record, ok := op.Record.(map[string]interface{})
+				if !ok || record["text"] != "hello world" {
+					t.Errorf("Unexpected record: %+v", op.Record)
+				}
+				if event.Time != "2024-09-09T19:46:02.329308Z" {
+					t.Errorf("Unexpected time: %s", event.Time)
+				}
+			},
+		},
+		{
+			name:       "Commit delete has no record",
+			message:    `{"did":"did:plc:alice","time_us":1725911162329309,"kind":"commit","commit":{"rev":"3l3","operation":"delete","collection":"app.bsky.feed.post","rkey":"abc123"}}`,
+			expectKind: models.EventKindCommit,
+			validate: func(t *testing.T, event models.ATEvent) {
+				if event.Ops[0].Record != nil {
+					t.Errorf("Expected nil record for delete, got %+v", event.Ops[0].Record)
+				}
+			},
+		},
+		{
+			name:       "Identity",
+			message:    `{"did":"did:plc:alice","time_us":1725911162329310,"kind":"identity","identity":{"did":"did:plc:alice","handle":"alice.bsky.social","seq":1,"time":"2024-09-09T19:46:02.102Z"}}`,
+			expectKind: models.EventKindIdentity,
+			validate: func(t *testing.T, event models.ATEvent) {
+				if event.Identity == nil || event.Identity.Handle != "alice.bsky.social" {
+					t.Errorf("Unexpected identity: %+v", event.Identity)
+				}
+			},
+		},
+		{
+			name:       "Account",
+			message:    `{"did":"did:plc:alice","time_us":1725911162329311,"kind":"account","account":{"active":false,"did":"did:plc:alice","seq":2,"status":"takendown","time":"2024-09-09T19:46:02.102Z"}}`,
+			expectKind: models.EventKindAccount,
+			validate: func(t *testing.T, event models.ATEvent) {
+				if event.Account == nil || event.Account.Active || event.Account.Status != "takendown" {
+					t.Errorf("Unexpected account: %+v", event.Account)
+				}
+			},
+		},
+		{
+			name:    "Unknown kind is ignored",
+			message: `{"did":"did:plc:alice","time_us":1725911162329312,"kind":"unknown"}`,
+		},
+		{
+			name:    "Commit without payload is ignored",
+			message: `{"did":"did:plc:alice","time_us":1725911162329313,"kind":"commit"}`,
+		},
+		{
+			name:      "Invalid JSON",
+			message:   `{"did":`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient()
+			mockCallback := &MockEventCallback{}
+			client.SetEventCallback(mockCallback.Call)
+
+			err := client.handleJetstreamMessage(client.upstreams[0], []byte(tt.message))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error %v, got %v", tt.expectErr, err)
+			}
+
+			events := mockCallback.GetEvents()
+			if tt.expectKind == "" {
+				if len(events) != 0 {
+					t.Errorf("Expected no events, got %d", len(events))
+				}
+				return
+			}
+
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(events))
+			}
+			if events[0].Kind != tt.expectKind {
+				t.Errorf("Expected kind %s, got %s", tt.expectKind, events[0].Kind)
+			}
+			if events[0].Did != "did:plc:alice" {
+				t.Errorf("Expected DID did:plc:alice, got %s", events[0].Did)
+			}
+			if client.GetCursor() == 0 {
+				t.Error("Expected cursor to be updated from time_us")
+			}
+			if tt.validate != nil {
+				tt.validate(t, events[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package firehose
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// commitDedupWindow is how many recent commits are remembered to recognise copies delivered by
+// another upstream
+const commitDedupWindow = 100000
+
+// upstream is the connection state of one firehose URL. Upstreams reconnect independently and
+// keep their own cursors, since sequence numbers are specific to a relay.
+type upstream struct {
+	url         string
+	cursorFile  string // Where the cursor is persisted ("" to not persist it)
+	conn        *websocket.Conn
+	cursor      atomic.Int64 // Last seen sequence number
+	connected   atomic.Bool  // Whether a connection is currently established
+	lastMessage atomic.Int64 // Unix nanoseconds of the last received message (0 if none)
+	reconnects  atomic.Int64 // Connection attempts since the last stable connection
+}
+
+// newUpstreams returns an upstream per configured firehose URL: firehose.urls when set,
+// otherwise firehose.url or the source's default
+func newUpstreams(cfg *config.Config) []*upstream {
+	if cfg == nil {
+		return upstreamsFor([]string{config.DefaultRepoURL}, "")
+	}
+	return upstreamsFor(cfg.Firehose.UpstreamURLs(), cfg.Firehose.CursorFile)
+}
+
+// upstreamsFor returns an upstream per URL. The first upstream persists its cursor to
+// cursorFile and the others to cursorFile.1, cursorFile.2 and so on ("" to not persist them).
+func upstreamsFor(urls []string, cursorFile string) []*upstream {
+	upstreams := make([]*upstream, len(urls))
+	for i, url := range urls {
+		upstreams[i] = &upstream{url: url}
+		if cursorFile != "" {
+			upstreams[i].cursorFile = cursorFile
+			if i > 0 {
+				upstreams[i].cursorFile += "." + strconv.Itoa(i)
+			}
+		}
+	}
+	return upstreams
+}
+
+// currentUpstreams returns the upstreams the client connects to. SwitchUpstreams replaces the
+// slice rather than modifying it, so callers may range over it without holding upstreamsMu.
+func (c *Client) currentUpstreams() []*upstream {
+	c.upstreamsMu.RLock()
+	defer c.upstreamsMu.RUnlock()
+	return c.upstreams
+}
+
+// SwitchUpstreams replaces the firehose URLs the client connects to. If they differ from the
+// current ones, the running client closes its connections and connects to the new URLs,
+// starting from the live stream since cursors are specific to a relay; subscriptions and
+// counters are unaffected. It reports whether the URLs changed.
+func (c *Client) SwitchUpstreams(urls []string) bool {
+	c.upstreamsMu.Lock()
+	defer c.upstreamsMu.Unlock()
+
+	current := make([]string, len(c.upstreams))
+	for i, u := range c.upstreams {
+		current[i] = u.url
+	}
+	if len(urls) == 0 || slices.Equal(current, urls) {
+		return false
+	}
+
+	cursorFile := ""
+	if c.config != nil {
+		cursorFile = c.config.Firehose.CursorFile
+	}
+	c.upstreams = upstreamsFor(urls, cursorFile)
+
+	// Wake Start up, unless a switch it hasn't handled yet is already pending
+	select {
+	case c.switched <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// markMessageReceived records that a message from the upstream just arrived
+func (u *upstream) markMessageReceived() {
+	u.lastMessage.Store(time.Now().UnixNano())
+}
+
+// lastMessageAt returns when the last message from the upstream was received (zero if none yet)
+func (u *upstream) lastMessageAt() time.Time {
+	nanos := u.lastMessage.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// UpstreamStatuses returns the connection status of each firehose upstream, in configured order
+func (c *Client) UpstreamStatuses() []models.FirehoseUpstreamStatus {
+	upstreams := c.currentUpstreams()
+	statuses := make([]models.FirehoseUpstreamStatus, len(upstreams))
+	for i, u := range upstreams {
+		statuses[i] = models.FirehoseUpstreamStatus{
+			URL:        u.url,
+			Connected:  u.connected.Load(),
+			Cursor:     u.cursor.Load(),
+			Reconnects: int(u.reconnects.Load()),
+		}
+		if lastMessageAt := u.lastMessageAt(); !lastMessageAt.IsZero() {
+			statuses[i].LastMessageAt = &lastMessageAt
+		}
+	}
+	return statuses
+}
+
+// isDuplicateCommit reports whether a commit was already delivered by another upstream,
+// remembering it otherwise. Path tells apart the per-op messages of a Jetstream commit ("" for
+// whole commits). Commits without a revision can't be recognised and are never duplicates.
+func (c *Client) isDuplicateCommit(did, rev, path string) bool {
+	if c.dedup == nil || rev == "" {
+		return false
+	}
+	if c.dedup.seenBefore(did + " " + rev + " " + path) {
+		metriks.DuplicateCommits.Inc()
+		return true
+	}
+	return false
+}
+
+// commitDeduper remembers a bounded number of recent commit keys, forgetting the oldest first
+type commitDeduper struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	keys []string // Ring buffer of remembered keys in arrival order
+	next int      // Index in keys of the oldest key, overwritten by the next new one
+}
+
+// newCommitDeduper returns a deduper remembering up to size keys
+func newCommitDeduper(size int) *commitDeduper {
+	return &commitDeduper{
+		seen: make(map[string]struct{}, size),
+		keys: make([]string, size),
+	}
+}
+
+// seenBefore reports whether key was already seen, remembering it otherwise
+func (d *commitDeduper) seenBefore(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, seen := d.seen[key]; seen {
+		return true
+	}
+	if oldest := d.keys[d.next]; oldest != "" {
+		delete(d.seen, oldest)
+	}
+	d.keys[d.next] = key
+	d.next = (d.next + 1) % len(d.keys)
+	d.seen[key] = struct{}{}
+	return false
+}
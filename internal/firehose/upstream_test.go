@@ -0,0 +1,241 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/atproto"
+	"github.com/gorilla/websocket"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestNewUpstreams(t *testing.T) {
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{
+		URL:        "wss://ignored.example/xrpc/com.atproto.sync.subscribeRepos",
+		URLs:       []string{"wss://relay.example", "wss://pds.example"},
+		CursorFile: "cursor",
+	}})
+
+	if len(client.upstreams) != 2 {
+		t.Fatalf("Expected 2 upstreams, got %d", len(client.upstreams))
+	}
+	if client.upstreams[0].url != "wss://relay.example" || client.upstreams[1].url != "wss://pds.example" {
+		t.Errorf("Expected upstreams in configured order, got %s and %s", client.upstreams[0].url, client.upstreams[1].url)
+	}
+	if client.upstreams[0].cursorFile != "cursor" || client.upstreams[1].cursorFile != "cursor.1" {
+		t.Errorf("Expected cursor files cursor and cursor.1, got %q and %q", client.upstreams[0].cursorFile, client.upstreams[1].cursorFile)
+	}
+
+	if single := NewClient(); len(single.upstreams) != 1 || single.upstreams[0].url != config.DefaultRepoURL || single.dedup != nil {
+		t.Errorf("Expected a single default upstream without deduplication, got %+v", single.upstreams)
+	}
+}
+
+func TestMultipleUpstreamsDeduplicateCommits(t *testing.T) {
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{URLs: []string{"wss://relay.example", "wss://pds.example"}}})
+	mockCallback := &MockEventCallback{}
+	client.SetEventCallback(mockCallback.Call)
+	relay, pds := client.upstreams[0], client.upstreams[1]
+
+	commit := func(u *upstream, seq int64, repo, rev string) {
+		t.Helper()
+		if err := client.handleRepoCommit(u, &atproto.SyncSubscribeRepos_Commit{Repo: repo, Rev: rev, Seq: seq, Time: time.Now().Format(time.RFC3339)}); err != nil {
+			t.Fatalf("handleRepoCommit returned error: %v", err)
+		}
+	}
+
+	commit(relay, 100, "did:plc:alice", "3l3aaa")
+	commit(pds, 7, "did:plc:alice", "3l3aaa")   // Same commit through the PDS
+	commit(pds, 8, "did:plc:alice", "3l3aab")   // Next revision
+	commit(relay, 101, "did:plc:bob", "3l3aaa") // Same revision, different repo
+	commit(relay, 102, "did:plc:carol", "")     // Without a revision it can't be recognised
+	commit(pds, 9, "did:plc:carol", "")
+
+	events := mockCallback.GetEvents()
+	if len(events) != 5 {
+		t.Fatalf("Expected 5 events after deduplication, got %d", len(events))
+	}
+	if client.GetEventsSeen() != 5 {
+		t.Errorf("Expected duplicates not to be counted as seen, got %d", client.GetEventsSeen())
+	}
+
+	// Each upstream still advances its own cursor, duplicates included
+	statuses := client.UpstreamStatuses()
+	if statuses[0].Cursor != 102 || statuses[1].Cursor != 9 {
+		t.Errorf("Expected cursors 102 and 9, got %d and %d", statuses[0].Cursor, statuses[1].Cursor)
+	}
+	if statuses[0].LastMessageAt == nil || statuses[1].LastMessageAt == nil {
+		t.Error("Expected both upstreams to report their last message")
+	}
+	if client.GetCursor() != 102 {
+		t.Errorf("Expected GetCursor to report the first upstream, got %d", client.GetCursor())
+	}
+}
+
+// Identity events carry no revision, so every upstream's copy is delivered
+func TestMultipleUpstreamsForwardIdentityEvents(t *testing.T) {
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{URLs: []string{"wss://relay.example", "wss://pds.example"}}})
+	mockCallback := &MockEventCallback{}
+	client.SetEventCallback(mockCallback.Call)
+
+	for _, u := range client.upstreams {
+		if err := client.handleRepoIdentity(u, &atproto.SyncSubscribeRepos_Identity{Did: "did:plc:alice", Seq: 1}); err != nil {
+			t.Fatalf("handleRepoIdentity returned error: %v", err)
+		}
+	}
+	if events := mockCallback.GetEvents(); len(events) != 2 || events[0].Kind != models.EventKindIdentity {
+		t.Errorf("Expected both identity events to be delivered, got %+v", events)
+	}
+}
+
+func TestMultipleJetstreamUpstreamsMerge(t *testing.T) {
+	shared := `{"did":"did:plc:alice","time_us":1725911162329308,"kind":"commit","commit":{"rev":"3l3","operation":"create","collection":"app.bsky.feed.post","rkey":"abc123","record":{"text":"hello"}}}`
+	sharedLike := `{"did":"did:plc:alice","time_us":1725911162329309,"kind":"commit","commit":{"rev":"3l3","operation":"create","collection":"app.bsky.feed.like","rkey":"def456","record":{}}}`
+	relayOnly := `{"did":"did:plc:bob","time_us":1725911162329310,"kind":"commit","commit":{"rev":"3l4","operation":"create","collection":"app.bsky.feed.post","rkey":"ghi789","record":{"text":"relay"}}}`
+	pdsOnly := `{"did":"did:plc:carol","time_us":1725911162329311,"kind":"commit","commit":{"rev":"3l5","operation":"create","collection":"app.bsky.feed.post","rkey":"jkl012","record":{"text":"pds"}}}`
+
+	relay := newJetstreamServer(t, shared, sharedLike, relayOnly)
+	pds := newJetstreamServer(t, shared, pdsOnly)
+
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{
+		Source: config.FirehoseSourceJetstream,
+		URLs:   []string{relay, pds},
+	}})
+	mockCallback := &MockEventCallback{}
+	client.SetEventCallback(mockCallback.Call)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Start(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mockCallback.GetEvents()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // Give a duplicate time to slip through
+
+	paths := make(map[string]int)
+	for _, event := range mockCallback.GetEvents() {
+		paths[event.Did+" "+event.Ops[0].Path]++
+	}
+	expected := []string{
+		"did:plc:alice app.bsky.feed.post/abc123",
+		"did:plc:alice app.bsky.feed.like/def456",
+		"did:plc:bob app.bsky.feed.post/ghi789",
+		"did:plc:carol app.bsky.feed.post/jkl012",
+	}
+	if len(paths) != len(expected) {
+		t.Errorf("Expected %d distinct events, got %v", len(expected), paths)
+	}
+	for _, key := range expected {
+		if paths[key] != 1 {
+			t.Errorf("Expected %s to be delivered once, got %d", key, paths[key])
+		}
+	}
+
+	for _, status := range client.UpstreamStatuses() {
+		if !status.Connected {
+			t.Errorf("Expected upstream %s to be connected", status.URL)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected Start to return context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Start to return after cancellation")
+	}
+}
+
+func TestSwitchUpstreams(t *testing.T) {
+	oldRelay := newJetstreamServer(t, `{"did":"did:plc:alice","time_us":1725911162329308,"kind":"commit","commit":{"rev":"3l3","operation":"create","collection":"app.bsky.feed.post","rkey":"abc123","record":{"text":"old"}}}`)
+	newRelay := newJetstreamServer(t, `{"did":"did:plc:bob","time_us":1725911162329309,"kind":"commit","commit":{"rev":"3l4","operation":"create","collection":"app.bsky.feed.post","rkey":"def456","record":{"text":"new"}}}`)
+
+	client := NewClientWithConfig(&config.Config{Firehose: config.FirehoseConfig{
+		Source: config.FirehoseSourceJetstream,
+		URL:    oldRelay,
+	}})
+	mockCallback := &MockEventCallback{}
+	client.SetEventCallback(mockCallback.Call)
+
+	if client.SwitchUpstreams([]string{oldRelay}) {
+		t.Error("Expected switching to the same URL to be a no-op")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Start(ctx) }()
+
+	waitForEvents := func(count int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); len(mockCallback.GetEvents()) < count; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d events, got %d", count, len(mockCallback.GetEvents()))
+			}
+		}
+	}
+	waitForEvents(1)
+
+	if !client.SwitchUpstreams([]string{newRelay}) {
+		t.Fatal("Expected switching to a new URL to report a change")
+	}
+	waitForEvents(2)
+	if events := mockCallback.GetEvents(); events[1].Did != "did:plc:bob" {
+		t.Errorf("Expected the second event to come from the new relay, got %+v", events[1])
+	}
+
+	statuses := client.UpstreamStatuses()
+	if len(statuses) != 1 || statuses[0].URL != newRelay {
+		t.Errorf("Expected only the new relay to be reported, got %+v", statuses)
+	}
+	if client.GetEventsSeen() != 2 {
+		t.Errorf("Expected counters to survive the switch, got %d events seen", client.GetEventsSeen())
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected Start to return context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Start to return after cancellation")
+	}
+}
+
+// newJetstreamServer serves the messages to each WebSocket client and then keeps the connection
+// open, returning the ws:// URL
+func newJetstreamServer(t *testing.T, messages ...string) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, message := range messages {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+				return
+			}
+		}
+		// Hold the connection until the client goes away
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+)
+
+// defaultLevel is the level of the logger installed by Setup, which SetLevel changes at runtime
+var defaultLevel slog.LevelVar
+
+// New builds a slog logger from the logging configuration. JSON output is used when
+// Format is "json" or Structured is set; Output is "stdout", "stderr" or a file path
+// that is appended to. The returned closer releases the output file, if any.
+func New(cfg config.LoggingConfig) (*slog.Logger, io.Closer, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newLogger(cfg, level)
+}
+
+// newLogger builds a slog logger for the configured format and output that logs at level
+func newLogger(cfg config.LoggingConfig, level slog.Leveler) (*slog.Logger, io.Closer, error) {
+	var (
+		out    io.Writer
+		closer io.Closer = nopCloser{}
+	)
+	switch cfg.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		file, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file %s: %w", cfg.Output, err)
+		}
+		out, closer = file, file
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.Format == "json" || cfg.Structured {
+		handler = slog.NewJSONHandler(out, options)
+	} else {
+		handler = slog.NewTextHandler(out, options)
+	}
+
+	return slog.New(handler), closer, nil
+}
+
+// Setup installs the configured logger as the slog default. Output from the standard
+// log package is routed through it as well, at info level.
+func Setup(cfg config.LoggingConfig) (io.Closer, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger, closer, err := newLogger(cfg, &defaultLevel)
+	if err != nil {
+		return nil, err
+	}
+	defaultLevel.Set(level)
+	slog.SetDefault(logger)
+	return closer, nil
+}
+
+// SetLevel changes the level of the logger installed by Setup without reopening its output
+func SetLevel(level string) error {
+	parsed, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	defaultLevel.Set(parsed)
+	return nil
+}
+
+// Level returns the current level of the logger installed by Setup
+func Level() slog.Level {
+	return defaultLevel.Level()
+}
+
+// parseLevel parses a configured level name; empty means info
+func parseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if name != "" {
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return level, fmt.Errorf("invalid log level %q: %w", name, err)
+		}
+	}
+	return level, nil
+}
+
+// nopCloser is returned for the standard streams, which must stay open
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
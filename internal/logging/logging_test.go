@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.LoggingConfig
+		expectJSON  bool
+		expectDebug bool
+	}{
+		{"text info", config.LoggingConfig{Level: "info", Format: "text"}, false, false},
+		{"json format", config.LoggingConfig{Level: "info", Format: "json"}, true, false},
+		{"structured flag", config.LoggingConfig{Level: "info", Format: "text", Structured: true}, true, false},
+		{"debug level", config.LoggingConfig{Level: "debug", Format: "json"}, true, true},
+		{"defaults", config.LoggingConfig{}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Output = filepath.Join(t.TempDir(), "server.log")
+			logger, closer, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+
+			if enabled := logger.Enabled(context.Background(), slog.LevelDebug); enabled != tt.expectDebug {
+				t.Errorf("Expected debug enabled=%v, got %v", tt.expectDebug, enabled)
+			}
+
+			logger.Info("filter created", "filter", "8a3ce5f3...")
+			if err := closer.Close(); err != nil {
+				t.Fatalf("Failed to close log file: %v", err)
+			}
+
+			data, err := os.ReadFile(tt.cfg.Output)
+			if err != nil {
+				t.Fatalf("Failed to read log file: %v", err)
+			}
+			line := strings.TrimSpace(string(data))
+
+			var entry map[string]interface{}
+			isJSON := json.Unmarshal([]byte(line), &entry) == nil
+			if isJSON != tt.expectJSON {
+				t.Errorf("Expected JSON output=%v, got line %q", tt.expectJSON, line)
+			}
+			if !strings.Contains(line, "filter created") || !strings.Contains(line, "8a3ce5f3...") {
+				t.Errorf("Expected message and attribute in output, got %q", line)
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, _, err := New(config.LoggingConfig{Level: "verbose"}); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if _, _, err := New(config.LoggingConfig{Output: filepath.Join(t.TempDir(), "missing", "server.log")}); err == nil {
+		t.Error("Expected an error for an unwritable output path")
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	output := filepath.Join(t.TempDir(), "server.log")
+	closer, err := Setup(config.LoggingConfig{Level: "info", Output: output})
+	if err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+	t.Cleanup(func() { closer.Close() })
+
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("Expected debug logging to start disabled")
+	}
+	if err := SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel returned error: %v", err)
+	}
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) || Level() != slog.LevelDebug {
+		t.Error("Expected debug logging to be enabled after SetLevel")
+	}
+
+	if err := SetLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if Level() != slog.LevelDebug {
+		t.Errorf("Expected an invalid level to leave the level unchanged, got %v", Level())
+	}
+}
@@ -9,6 +9,11 @@ var (
 		Name: "websocket_connections",
 		Help: "Current number of active WebSocket connections",
 	})
+	// Gauge of /ws/tap connections, which aren't counted in websocket_connections
+	TapConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tap_connections",
+		Help: "Current number of firehose tap connections",
+	})
 	MessagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "messages_sent_total",
 		Help: "Total number of messages sent to clients",
@@ -16,7 +21,7 @@ var (
 	// Gauge to track current keyword activity - shows "right now" activity
 	KeywordActivity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "keyword_messages_current",
-		Help: "Current count of messages containing each keyword (resets periodically)",
+		Help: "Messages sent for each keyword during the last completed 30 second window",
 	}, []string{"keyword"})
 	MessagesReceived = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "messages_received_total",
@@ -30,15 +35,117 @@ var (
 		Name: "filters_deleted_total",
 		Help: "Total number of filters deleted",
 	})
+	FiltersRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filters_rejected_total",
+		Help: "Total number of filter creation attempts rejected by validation",
+	}, []string{"reason"})
+	WebhookFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_failures_total",
+		Help: "Total number of events that could not be delivered to a filter's webhook after retries",
+	}, []string{"filter_key"})
+	SampledOutEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_sampled_out_total",
+		Help: "Total number of matching events not forwarded because of a filter's sample rate",
+	}, []string{"filter_key"})
+	DroppedMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "dropped_messages_total",
+		Help: "Total number of messages dropped because a client connection's outbound queue was full",
+	})
+	// Counter of queued messages and webhook events still undelivered when the shutdown flush timed out
+	ShutdownDroppedMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "shutdown_dropped_messages_total",
+		Help: "Total number of queued messages and webhook events dropped because they weren't delivered within the shutdown drain timeout",
+	})
+	BusMessagesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "bus_messages_dropped_total",
+		Help: "Total number of events not published to the message bus because its queue was full or the connection failed",
+	})
+	KafkaMessagesDelivered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_messages_delivered_total",
+		Help: "Total number of events acknowledged by Kafka",
+	})
+	// Counter of events the Kafka sink gave up on; reason is "queue_full" when the outbound queue
+	// was full, "rejected" when a broker refused them and "retries_exhausted" when brokers kept failing
+	KafkaMessagesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_failed_total",
+		Help: "Total number of events that could not be delivered to Kafka",
+	}, []string{"reason"})
+	// Counter of commit CAR data that couldn't be decoded; stage is "archive" for the CAR itself
+	// and "block" for individual blocks that aren't valid CBOR
+	CarDecodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "car_decode_errors_total",
+		Help: "Total number of firehose commit CAR archives and blocks that failed to decode",
+	}, []string{"stage"})
+	// Counter of commits whose record blocks weren't decoded because none of their ops is in
+	// firehose.collection_allowlist
+	SkippedCommitDecodes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "firehose_commit_decodes_skipped_total",
+		Help: "Total number of firehose commits forwarded without decoding their records because no op is in an allowed collection",
+	})
+	// Counter of record blocks left undecoded because they exceed firehose.max_record_bytes
+	OversizedRecords = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "firehose_records_oversized_total",
+		Help: "Total number of firehose record blocks forwarded without their content because they exceed the maximum record size",
+	})
+	// Counter of events dropped from the full buffer between firehose ingest and broadcast
+	FirehoseBackpressureDrops = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "firehose_backpressure_drops_total",
+		Help: "Total number of firehose events dropped, oldest first, because the buffer in front of the broadcast was full",
+	})
+	// Counter of commits dropped because another firehose upstream already delivered them
+	DuplicateCommits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "firehose_duplicate_commits_total",
+		Help: "Total number of firehose commits dropped because another upstream already delivered the same repo revision",
+	})
+	FirehoseLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "firehose_lag_seconds",
+		Help: "Rolling difference between firehose commit event times and the wall clock",
+	})
+	// Counter of commit ops by collection NSID, only collected with firehose.collection_metrics;
+	// collections beyond firehose.collection_metrics_max_labels share the "other" label
+	RecordsByCollection = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "records_by_collection_total",
+		Help: "Total number of firehose commit operations by record collection",
+	}, []string{"collection"})
+	// Histogram of the time between receiving an event from the firehose and forwarding it to a filter's clients
+	DeliveryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_delivery_latency_seconds",
+		Help:    "Latency from receiving a firehose event to forwarding it to clients",
+		Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"filter_key"})
+	// Histogram of HTTP API request durations; WebSocket and SSE requests last as long as the stream
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route pattern and status code",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "status"})
 )
 
 func init() {
 	prometheus.MustRegister(
 		WebsocketConnections,
+		TapConnections,
 		MessagesSent,
 		KeywordActivity,
 		MessagesReceived,
 		FiltersCreated,
 		FiltersDeleted,
+		FiltersRejected,
+		DeliveryLatency,
+		HTTPRequestDuration,
+		FirehoseLag,
+		CarDecodeErrors,
+		SkippedCommitDecodes,
+		OversizedRecords,
+		DuplicateCommits,
+		FirehoseBackpressureDrops,
+		RecordsByCollection,
+		WebhookFailures,
+		SampledOutEvents,
+		BusMessagesDropped,
+		KafkaMessagesDelivered,
+		KafkaMessagesFailed,
+		DroppedMessages,
+		ShutdownDroppedMessages,
 	)
 }
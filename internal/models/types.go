@@ -1,14 +1,379 @@
 package models
 
-import "time"
+import (
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
 
 // FilterOptions represents the filter options that can be set via API
 type FilterOptions struct {
-	Repository string `json:"repository" example:"did:plc:example123" description:"Filter by repository DID (empty string means all repositories)"`
-	PathPrefix string `json:"pathPrefix" example:"app.bsky.feed.post" description:"Filter by operation path prefix (empty string means all paths)"`
-	Keyword    string `json:"keyword" example:"hello,world,test" description:"Filter by keywords in text content (comma-separated, empty string means all content)"` // Comma-separated list of keywords (e.g., "hello,world,test")
+	Repository string `json:"repository" example:"did:plc:example123,did:plc:example456" description:"Filter by repository DIDs or handles (comma-separated, empty string means all repositories). Handles are resolved to DIDs when the filter is created"` // Comma-separated list of DIDs
+	// RepositoryPrefix matches every repository whose DID starts with it, e.g. all accounts on one did:web domain
+	RepositoryPrefix string `json:"repositoryPrefix,omitempty" example:"did:web:example.com" description:"Filter by DID prefix, e.g. 'did:web:example.com' for every account on that domain; applies in addition to repository (empty means all repositories)"`
+	PathPrefix       string `json:"pathPrefix" example:"app.bsky.feed.post" description:"Filter by operation path prefix, or a glob on the collection when it contains '*' (empty string means all paths)"`
+	// Collections restricts matching to operations in exactly these collections (empty means all collections)
+	Collections []string `json:"collections,omitempty" example:"app.bsky.feed.like,app.bsky.feed.repost" description:"Filter by exact collection NSID, so 'app.bsky.feed.like' doesn't match 'app.bsky.feed.likeX' (empty means all collections)"`
+	Keyword     string   `json:"keyword" example:"hello,world,test" description:"Filter by keywords in text content (comma-separated, empty string means all content)"` // Comma-separated list of keywords (e.g., "hello,world,test")
+	// KeywordMatchMode controls how multiple keywords are combined: "any" (default) or "all"
+	KeywordMatchMode string `json:"keywordMatchMode,omitempty" example:"any" description:"How multiple keywords are combined: 'any' (default) matches if any keyword is present, 'all' requires every keyword"`
+	// KeywordRegex treats each comma-separated keyword as a regular expression
+	KeywordRegex bool `json:"keywordRegex,omitempty" example:"false" description:"Treat each comma-separated keyword as a case-insensitive Go regular expression"`
+	// Actions restricts matching to operations with these actions (empty means all actions)
+	Actions []string `json:"actions,omitempty" example:"create,delete" description:"Filter by operation action: create, update, delete (empty means all actions)"`
+	// StripNonMatchingOps forwards only the ops of a matched commit that match the filter on their own
+	StripNonMatchingOps bool `json:"stripNonMatchingOps,omitempty" example:"false" description:"Forward only the operations that match the filter on their own instead of every op in a matched commit"`
+	// EventKinds opts in to firehose event kinds beyond commits (empty means commits only)
+	EventKinds []string `json:"eventKinds,omitempty" example:"commit,account" description:"Firehose event kinds to receive: commit, identity, account (empty means commits only)"`
+	// DeepTextSearch also matches keywords against link cards, quoted records and facets
+	DeepTextSearch bool `json:"deepTextSearch,omitempty" example:"false" description:"Also match keywords in embedded link titles/descriptions, quoted record text, facet links and hashtags"`
+	// Langs restricts matching to records tagged with one of these languages (empty means all languages)
+	Langs []string `json:"langs,omitempty" example:"en,ja" description:"Filter by record languages (BCP-47, e.g. 'en' also matches 'en-US'; records without langs never match)"`
+	// EmbedTypes restricts matching to records with one of these embed types (empty means any record)
+	EmbedTypes []string `json:"embedTypes,omitempty" example:"app.bsky.embed.images,app.bsky.embed.video" description:"Filter by embed type NSID, including the media of a recordWithMedia embed (records without embeds never match)"`
+	// ReplyRootURI restricts matching to one thread: the post with this AT URI and the replies whose reply.root.uri is it
+	ReplyRootURI string `json:"replyRootUri,omitempty" example:"at://did:plc:example123/app.bsky.feed.post/3k2a4b5c6d7e8" description:"Follow a thread: only match the post with this AT URI and replies whose reply.root.uri equals it (records that aren't replies never match)"`
+	// PostType restricts matching to posts of one kind: "top", "reply" or "quote" (empty means any record)
+	PostType string `json:"postType,omitempty" example:"top" description:"Only match posts of this kind: 'top' (neither a reply nor a quote), 'reply' or 'quote'; records outside app.bsky.feed.post never match"`
+	// WholeWord only matches keywords that aren't part of a longer word ("cat" won't match "category")
+	WholeWord bool `json:"wholeWord,omitempty" example:"false" description:"Only match whole words, so 'cat' doesn't match 'category' (plain keywords only); shorthand for matchType 'word'"`
+	// MatchType is how a plain keyword must appear in the text: "substring" (default), "word" or "exact-text"
+	MatchType string `json:"matchType,omitempty" example:"word" description:"How a plain keyword must appear: 'substring' (default) anywhere, so 'test' matches 'testing'; 'word' as a whole word; 'exact-text' as the entire text of a field, ignoring surrounding whitespace"`
+	// CaseSensitive matches keywords (and regex keywords) with exact case instead of ignoring it
+	CaseSensitive bool `json:"caseSensitive,omitempty" example:"false" description:"Match keywords with exact case, so '$AAPL' doesn't match '$aapl'; applies to regex keywords too"`
+	// NormalizeUnicode folds compatibility forms and diacritics before matching ("cafe" matches "café")
+	NormalizeUnicode bool `json:"normalizeUnicode,omitempty" example:"false" description:"Apply NFKC normalization and strip diacritics from text and keywords before matching, so 'cafe' matches 'café' and full-width 'ｃａｆｅ' (plain keywords only)"`
+	// MinTextLength and MaxTextLength bound the record text length in characters (0 means no bound)
+	MinTextLength int `json:"minTextLength,omitempty" example:"10" description:"Only match records whose text has at least this many characters (0 means no minimum)"`
+	MaxTextLength int `json:"maxTextLength,omitempty" example:"300" description:"Only match records whose text has at most this many characters (0 means no maximum)"`
+	// MinLinks and MinMentions require at least this many link or mention facets in the record (0 means no minimum)
+	MinLinks    int `json:"minLinks,omitempty" example:"1" description:"Only match records with at least this many link facets (app.bsky.richtext.facet#link); records without facets have none"`
+	MinMentions int `json:"minMentions,omitempty" example:"5" description:"Only match records with at least this many mention facets (app.bsky.richtext.facet#mention), e.g. to catch mass-mention spam; records without facets have none"`
+	// Since and Until bound the record's createdAt as RFC3339 timestamps (empty means no bound)
+	Since string `json:"since,omitempty" example:"2024-01-01T00:00:00Z" description:"Only match records created at or after this RFC3339 time; records without a valid createdAt never match"`
+	Until string `json:"until,omitempty" example:"2025-01-01T00:00:00Z" description:"Only match records created before this RFC3339 time; records without a valid createdAt never match"`
+	// TextFields lists the record fields searched for keywords, overriding the server's default field list
+	TextFields []string `json:"textFields,omitempty" example:"text,body" description:"Record fields whose text is searched for keywords, in order; nested fields use dots, e.g. 'embed.external.title' (empty means the server default: text, message, content)"`
+	// IncludeRawRecord attaches each op's original DAG-CBOR record block to forwarded events
+	IncludeRawRecord bool `json:"includeRawRecord,omitempty" example:"false" description:"Attach each op's original DAG-CBOR record block as base64 'rawRecord', so consumers can verify CIDs and signatures themselves (relay firehose only; off by default to keep payloads small)"`
+	// SampleRate forwards only this fraction of matching events, chosen deterministically per event (0 means all)
+	SampleRate float64 `json:"sampleRate,omitempty" example:"0.1" description:"Forward only this fraction (0-1) of matching events, e.g. 0.1 for about one in ten; 0 or 1 forwards every event"`
+	// MaxMessagesPerConnection closes each WebSocket connection after it was sent this many events (0 means no limit)
+	MaxMessagesPerConnection int `json:"maxMessagesPerConnection,omitempty" example:"1" description:"Close each WebSocket connection with a normal close frame once it has been sent this many event messages, e.g. 1 for 'give me the next matching event' clients (0 means no limit)"`
+	// WebhookURL receives matching enriched events as JSON POSTs, in addition to any WebSocket connections
+	WebhookURL string `json:"webhookUrl,omitempty" example:"https://example.com/hooks/bluesky" description:"POST matching events as JSON to this http(s) URL; webhook filters aren't cleaned up for lacking connections; the URL must resolve to a public address"`
+}
+
+// DefaultTextFields are the record fields searched for keywords when neither the filter
+// nor the server configuration lists any
+var DefaultTextFields = []string{"text", "message", "content"}
+
+// RepositoryList returns the individual DIDs configured in the comma-separated Repository field
+func (o FilterOptions) RepositoryList() []string {
+	var repos []string
+	for _, repo := range strings.Split(o.Repository, ",") {
+		repo = strings.TrimSpace(repo)
+		if repo != "" {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// MatchesRepository reports whether a DID passes the Repository filter (empty means all repositories)
+func (o FilterOptions) MatchesRepository(did string) bool {
+	repos := o.RepositoryList()
+	if len(repos) == 0 {
+		return true
+	}
+	for _, repo := range repos {
+		if repo == did {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesRepositoryPrefix reports whether a DID passes the RepositoryPrefix filter (empty means all repositories)
+func (o FilterOptions) MatchesRepositoryPrefix(did string) bool {
+	return strings.HasPrefix(did, o.RepositoryPrefix)
+}
+
+// MatchesPath reports whether an operation path passes the PathPrefix filter (empty means all paths).
+// A PathPrefix containing '*' is treated as a path.Match glob against the collection segment
+// (e.g. "app.bsky.feed.*"); otherwise it is a literal prefix of the full path.
+func (o FilterOptions) MatchesPath(opPath string) bool {
+	if o.PathPrefix == "" {
+		return true
+	}
+	if !strings.Contains(o.PathPrefix, "*") {
+		return strings.HasPrefix(opPath, o.PathPrefix)
+	}
+
+	collection, _, _ := strings.Cut(opPath, "/")
+	matched, err := path.Match(o.PathPrefix, collection)
+	return err == nil && matched
+}
+
+// MatchesCollection reports whether an operation's collection passes the Collections filter
+// (empty means all collections). Unlike PathPrefix this is an exact match on the NSID.
+func (o FilterOptions) MatchesCollection(collection string) bool {
+	if len(o.Collections) == 0 {
+		return true
+	}
+	for _, allowed := range o.Collections {
+		if allowed == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsEventKind reports whether a firehose event kind passes the EventKinds filter.
+// Events without a kind are treated as commits, and an empty EventKinds only allows commits.
+func (o FilterOptions) AllowsEventKind(kind string) bool {
+	if kind == "" {
+		kind = EventKindCommit
+	}
+	if len(o.EventKinds) == 0 {
+		return kind == EventKindCommit
+	}
+	for _, allowed := range o.EventKinds {
+		if allowed == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesLangs reports whether a record's langs pass the Langs filter.
+// A filter language without a region (e.g. "en") also matches regional variants ("en-US").
+// Records without langs never match an active language filter.
+func (o FilterOptions) MatchesLangs(recordLangs []string) bool {
+	if len(o.Langs) == 0 {
+		return true
+	}
+	for _, recordLang := range recordLangs {
+		recordLang = strings.ToLower(strings.TrimSpace(recordLang))
+		for _, lang := range o.Langs {
+			lang = strings.ToLower(strings.TrimSpace(lang))
+			if lang != "" && (recordLang == lang || strings.HasPrefix(recordLang, lang+"-")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchesEmbedTypes reports whether any of a record's embed types pass the EmbedTypes filter.
+// Records without embeds never match an active embed type filter.
+func (o FilterOptions) MatchesEmbedTypes(recordEmbedTypes []string) bool {
+	if len(o.EmbedTypes) == 0 {
+		return true
+	}
+	for _, recordType := range recordEmbedTypes {
+		for _, embedType := range o.EmbedTypes {
+			if recordType == embedType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasFacetCountBounds reports whether MinLinks or MinMentions is set
+func (o FilterOptions) HasFacetCountBounds() bool {
+	return o.MinLinks > 0 || o.MinMentions > 0
+}
+
+// MatchesFacetCounts reports whether a record's link and mention facet counts reach the
+// MinLinks/MinMentions thresholds
+func (o FilterOptions) MatchesFacetCounts(links, mentions int) bool {
+	return links >= o.MinLinks && mentions >= o.MinMentions
+}
+
+// HasTextLengthBounds reports whether MinTextLength or MaxTextLength is set
+func (o FilterOptions) HasTextLengthBounds() bool {
+	return o.MinTextLength > 0 || o.MaxTextLength > 0
+}
+
+// MatchesTextLength reports whether text passes the MinTextLength/MaxTextLength bounds.
+// Length is counted in characters (runes), not bytes.
+func (o FilterOptions) MatchesTextLength(text string) bool {
+	length := utf8.RuneCountInString(text)
+	if o.MinTextLength > 0 && length < o.MinTextLength {
+		return false
+	}
+	if o.MaxTextLength > 0 && length > o.MaxTextLength {
+		return false
+	}
+	return true
+}
+
+// HasCreatedAtBounds reports whether Since or Until is set
+func (o FilterOptions) HasCreatedAtBounds() bool {
+	return o.Since != "" || o.Until != ""
+}
+
+// MatchesCreatedAt reports whether a record's createdAt passes the Since (inclusive) and Until
+// (exclusive) bounds. Once a bound is set, a missing or unparseable createdAt never matches.
+func (o FilterOptions) MatchesCreatedAt(createdAt string) bool {
+	if !o.HasCreatedAtBounds() {
+		return true
+	}
+	created, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return false
+	}
+	if o.Since != "" {
+		since, err := time.Parse(time.RFC3339, o.Since)
+		if err != nil || created.Before(since) {
+			return false
+		}
+	}
+	if o.Until != "" {
+		until, err := time.Parse(time.RFC3339, o.Until)
+		if err != nil || !created.Before(until) {
+			return false
+		}
+	}
+	return true
+}
+
+// FoldUnicode normalizes text to NFKC with combining marks removed, so accented letters match
+// their base letter ("café" becomes "cafe") and compatibility forms match their plain
+// equivalents (full-width "ｃａｆｅ" becomes "cafe")
+func FoldUnicode(text string) string {
+	// Decompose first so precomposed letters split into base letter and removable marks
+	fold := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFKC)
+	folded, _, err := transform.String(fold, text)
+	if err != nil {
+		return text
+	}
+	return folded
+}
+
+// EffectiveMatchType returns the keyword match type, treating WholeWord as "word"
+func (o FilterOptions) EffectiveMatchType() string {
+	switch {
+	case o.MatchType != "":
+		return o.MatchType
+	case o.WholeWord:
+		return MatchTypeWord
+	}
+	return MatchTypeSubstring
+}
+
+// ContainsKeyword reports whether text contains keyword, ignoring case unless CaseSensitive is set.
+// With the "word" match type the match must not be adjacent to other letters or digits, and with
+// "exact-text" the text, without surrounding whitespace, must be the keyword.
+// With NormalizeUnicode set, both are folded with FoldUnicode first.
+func (o FilterOptions) ContainsKeyword(text, keyword string) bool {
+	if o.NormalizeUnicode {
+		text, keyword = FoldUnicode(text), FoldUnicode(keyword)
+	}
+	compareText, compareKeyword := text, keyword
+	if !o.CaseSensitive {
+		compareText = strings.ToLower(text)
+		compareKeyword = strings.ToLower(keyword)
+	}
+	switch o.EffectiveMatchType() {
+	case MatchTypeExactText:
+		return compareKeyword != "" && strings.TrimSpace(compareText) == strings.TrimSpace(compareKeyword)
+	case MatchTypeWord:
+	default:
+		return strings.Contains(compareText, compareKeyword)
+	}
+	if compareKeyword == "" {
+		return false
+	}
+
+	// Only enforce a boundary on sides where the keyword itself starts or ends with a word character,
+	// so keywords like "#golang" still match after other text
+	first, _ := utf8.DecodeRuneInString(compareKeyword)
+	last, _ := utf8.DecodeLastRuneInString(compareKeyword)
+	checkStart, checkEnd := isWordRune(first), isWordRune(last)
+
+	for offset := 0; offset <= len(compareText)-len(compareKeyword); {
+		index := strings.Index(compareText[offset:], compareKeyword)
+		if index < 0 {
+			return false
+		}
+		start := offset + index
+		end := start + len(compareKeyword)
+
+		before, _ := utf8.DecodeLastRuneInString(compareText[:start])
+		after, _ := utf8.DecodeRuneInString(compareText[end:])
+		if (!checkStart || start == 0 || !isWordRune(before)) && (!checkEnd || end == len(compareText) || !isWordRune(after)) {
+			return true
+		}
+
+		// Continue searching after the first rune of this occurrence
+		_, size := utf8.DecodeRuneInString(compareText[start:])
+		offset = start + size
+	}
+	return false
+}
+
+// isWordRune reports whether r is part of a word (letter, digit or underscore)
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// AllowsAction reports whether an operation action passes the Actions filter
+func (o FilterOptions) AllowsAction(action string) bool {
+	if len(o.Actions) == 0 {
+		return true
+	}
+	for _, allowed := range o.Actions {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
 }
 
+// Firehose event kinds supported by ATEvent.Kind and FilterOptions.EventKinds.
+// Handle changes are delivered as identity events.
+const (
+	EventKindCommit   = "commit"
+	EventKindIdentity = "identity"
+	EventKindAccount  = "account"
+)
+
+// Operation actions supported by FilterOptions.Actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Post kinds supported by FilterOptions.PostType
+const (
+	PostTypeTop   = "top"   // Neither a reply nor a quote
+	PostTypeReply = "reply" // Has a reply reference
+	PostTypeQuote = "quote" // Embeds another record, with or without media, and isn't a reply
+)
+
+// Keyword match types supported by FilterOptions.MatchType
+const (
+	MatchTypeSubstring = "substring"  // The keyword anywhere in the text, "test" matches "testing" (default)
+	MatchTypeWord      = "word"       // The keyword as a whole word, "test" matches "a test" but not "testing"
+	MatchTypeExactText = "exact-text" // The keyword as the entire text of a field, "test" matches only "test"
+)
+
+// Keyword match modes supported by FilterOptions.KeywordMatchMode
+const (
+	KeywordMatchAny = "any" // Match if any keyword is present (default)
+	KeywordMatchAll = "all" // Match only if every keyword is present
+)
+
 // APIResponse represents a standard API response
 type APIResponse struct {
 	Success bool        `json:"success"`
@@ -25,11 +390,25 @@ type FilterUpdateRequest struct {
 
 // ATEvent represents an AT Protocol event from the firehose
 type ATEvent struct {
-	Event string        `json:"event"`
-	Did   string        `json:"did"`
-	Time  string        `json:"time"`
-	Kind  string        `json:"kind"`
-	Ops   []ATOperation `json:"ops"`
+	Event    string        `json:"event"`
+	Did      string        `json:"did"`
+	Time     string        `json:"time"`
+	Kind     string        `json:"kind"`
+	Seq      int64         `json:"seq,omitempty"` // Upstream sequence number: the relay's seq, or Jetstream's time_us cursor
+	Ops      []ATOperation `json:"ops"`
+	Identity *IdentityInfo `json:"identity,omitempty"` // Set for identity events
+	Account  *AccountInfo  `json:"account,omitempty"`  // Set for account events
+}
+
+// IdentityInfo contains the details of an identity (handle/DID document) change
+type IdentityInfo struct {
+	Handle string `json:"handle,omitempty"`
+}
+
+// AccountInfo contains the details of an account status change
+type AccountInfo struct {
+	Active bool   `json:"active"`
+	Status string `json:"status,omitempty"` // Reason the account is inactive (e.g. deactivated, suspended)
 }
 
 // EnrichedATEvent represents an AT Protocol event with additional timestamp metadata
@@ -41,6 +420,10 @@ type EnrichedATEvent struct {
 	Kind  string        `json:"kind"`
 	Ops   []ATOperation `json:"ops"`
 
+	// Identity and account details for non-commit events
+	Identity *IdentityInfo `json:"identity,omitempty"`
+	Account  *AccountInfo  `json:"account,omitempty"`
+
 	// Additional timestamp metadata
 	Timestamps EventTimestamps `json:"timestamps"`
 }
@@ -51,6 +434,11 @@ type EventTimestamps struct {
 	Received  string `json:"received"`  // When we received the event from firehose
 	Forwarded string `json:"forwarded"` // When we forward to WebSocket clients
 	FilterKey string `json:"filterKey"` // Which filter matched this event
+	// Seq is the event's upstream sequence number; each connection receives events in increasing
+	// seq order (see firehose.event_workers)
+	Seq int64 `json:"seq,omitempty"`
+	// Keywords (or regex patterns) of the filter found in the event content
+	MatchedKeywords []string `json:"matchedKeywords,omitempty"`
 }
 
 // ATOperation represents an operation within an AT Protocol event
@@ -61,6 +449,32 @@ type ATOperation struct {
 	Rkey       string      `json:"rkey"`
 	Record     interface{} `json:"record,omitempty"`
 	Cid        string      `json:"cid,omitempty"`
+	// RecordTruncated marks a record left out because it exceeded firehose.max_record_bytes
+	RecordTruncated bool `json:"recordTruncated,omitempty"`
+	// URI is the record's at://{did}/{collection}/{rkey} URI, set on forwarded events
+	URI string `json:"uri,omitempty" example:"at://did:plc:abc123/app.bsky.feed.post/3kabc123"`
+	// RawRecord is the record's original DAG-CBOR block (base64 in JSON), only forwarded to
+	// filters with IncludeRawRecord set
+	RawRecord []byte `json:"rawRecord,omitempty" swaggertype:"string" format:"base64" example:"omRkdGV4dGVoZWxsbw=="`
+}
+
+// RecordURI returns the at:// URI of the record the operation touched in did's repository
+func (op ATOperation) RecordURI(did string) string {
+	if op.Collection == "" {
+		return "at://" + did + "/" + op.Path
+	}
+	return "at://" + did + "/" + op.Collection + "/" + op.Rkey
+}
+
+// DeleteNotification is the data of a "delete" message, sent instead of an event for commits
+// that only delete records, since deleted records have no content to forward
+type DeleteNotification struct {
+	URI        string          `json:"uri" example:"at://did:plc:abc123/app.bsky.feed.post/3kabc123"`
+	Did        string          `json:"did" example:"did:plc:abc123"`
+	Collection string          `json:"collection" example:"app.bsky.feed.post"`
+	Rkey       string          `json:"rkey" example:"3kabc123"`
+	Time       string          `json:"time"` // Original firehose timestamp
+	Timestamps EventTimestamps `json:"timestamps"`
 }
 
 // RecordContent represents the content of an AT Protocol record
@@ -72,28 +486,275 @@ type RecordContent struct {
 	Langs   []string               `json:"langs,omitempty"`
 	Type    string                 `json:"$type"`
 	Created string                 `json:"createdAt"`
+	Embed   *RecordEmbed           `json:"embed,omitempty"`
+	Facets  []RecordFacet          `json:"facets,omitempty"`
+}
+
+// RecordEmbed represents the embed of a post (app.bsky.embed.external, .record, .recordWithMedia)
+type RecordEmbed struct {
+	External *EmbedExternal `json:"external,omitempty"`
+	Record   *EmbedRecord   `json:"record,omitempty"`
+	Media    *RecordEmbed   `json:"media,omitempty"` // recordWithMedia
+}
+
+// EmbedExternal represents a link card
+type EmbedExternal struct {
+	URI         string `json:"uri"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// EmbedRecord represents a quoted record. Firehose records only carry a reference (uri/cid);
+// the quoted record's content is present in Value only when the record was hydrated.
+type EmbedRecord struct {
+	URI    string         `json:"uri,omitempty"`
+	Value  *RecordContent `json:"value,omitempty"`
+	Record *EmbedRecord   `json:"record,omitempty"` // recordWithMedia nests the quote one level deeper
+}
+
+// RecordFacet represents a rich text facet (mention, link or hashtag)
+type RecordFacet struct {
+	Features []FacetFeature `json:"features"`
+}
+
+// FacetFeature represents a single facet feature
+type FacetFeature struct {
+	URI string `json:"uri,omitempty"` // app.bsky.richtext.facet#link
+	Tag string `json:"tag,omitempty"` // app.bsky.richtext.facet#tag
+}
+
+// NestedText returns the text found in the record's embeds (link card title and description,
+// quoted record text) and facets (link URIs and hashtags)
+func (r RecordContent) NestedText() []string {
+	parts := r.Embed.text()
+	for _, facet := range r.Facets {
+		for _, feature := range facet.Features {
+			for _, field := range []string{feature.URI, feature.Tag} {
+				if field != "" {
+					parts = append(parts, field)
+				}
+			}
+		}
+	}
+	return parts
+}
+
+// text returns the non-empty text fields of an embed, walking nested media and quoted records
+func (e *RecordEmbed) text() []string {
+	if e == nil {
+		return nil
+	}
+
+	var parts []string
+	if e.External != nil {
+		for _, field := range []string{e.External.Title, e.External.Description} {
+			if field != "" {
+				parts = append(parts, field)
+			}
+		}
+	}
+	parts = append(parts, e.Record.text()...)
+	parts = append(parts, e.Media.text()...)
+	return parts
+}
+
+// text returns the quoted record's text fields and nested text
+func (e *EmbedRecord) text() []string {
+	if e == nil {
+		return nil
+	}
+
+	var parts []string
+	if e.Value != nil {
+		for _, field := range []string{e.Value.Text, e.Value.Message, e.Value.Content} {
+			if field != "" {
+				parts = append(parts, field)
+			}
+		}
+		parts = append(parts, e.Value.NestedText()...)
+	}
+	parts = append(parts, e.Record.text()...)
+	return parts
 }
 
 // WebSocket subscription models
 
 // FilterSubscription represents a filter subscription with connection info
 type FilterSubscription struct {
-	FilterKey   string        `json:"filterKey"`
-	Options     FilterOptions `json:"options"`
-	CreatedAt   time.Time     `json:"createdAt"`
-	Connections int           `json:"connections"`
+	FilterKey         string        `json:"filterKey"`
+	Options           FilterOptions `json:"options"`
+	Repositories      []string      `json:"repositories,omitempty"` // Individual DIDs from Options.Repository
+	CreatedAt         time.Time     `json:"createdAt"`
+	ExpiresAt         *time.Time    `json:"expiresAt,omitempty"` // When the filter is removed regardless of connections
+	Connections       int           `json:"connections"`
+	MessagesDelivered uint64        `json:"messagesDelivered"`         // Messages sent to this filter's connections and webhook
+	WebhookDisabled   bool          `json:"webhookDisabled,omitempty"` // Webhook paused after too many consecutive failures until its next retry
+	Paused            bool          `json:"paused,omitempty"`          // Event delivery is paused; connections stay open
+	RequiresToken     bool          `json:"requiresToken,omitempty"`   // Connections must present a connect token
+	// Informational label and metadata given when the filter was created
+	Label    string            `json:"label,omitempty" example:"Launch day mentions"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// SubscriptionStats is a filter's throughput: how many messages it delivered in total and how
+// fast it has been forwarding them recently
+type SubscriptionStats struct {
+	FilterKey         string     `json:"filterKey" example:"8a3ce5f31b47d4788df91aeb38a565fe"`
+	MessagesDelivered uint64     `json:"messagesDelivered" example:"1523"` // Messages sent to this filter's connections and webhook
+	Rate1m            float64    `json:"rate1m" example:"2.5"`             // Messages forwarded per second, averaged over the last minute
+	Rate5m            float64    `json:"rate5m" example:"1.8"`             // Messages forwarded per second, averaged over the last 5 minutes
+	Rate15m           float64    `json:"rate15m" example:"1.2"`            // Messages forwarded per second, averaged over the last 15 minutes
+	LastDeliveredAt   *time.Time `json:"lastDeliveredAt,omitempty"`        // When a message was last forwarded, omitted if none was
+	Connections       int        `json:"connections" example:"2"`          // Clients connected to the filter
+}
+
+// RecentEvents is a filter's most recently matched events, as kept for replay
+type RecentEvents struct {
+	FilterKey string      `json:"filterKey" example:"8a3ce5f31b47d4788df91aeb38a565fe"`
+	Count     int         `json:"count" example:"2"` // Number of events returned
+	Events    []WSMessage `json:"events"`            // "event" and "delete" messages, oldest first, as sent over WebSocket
+}
+
+// SubscriptionPage is one page of the subscription list
+type SubscriptionPage struct {
+	Subscriptions []FilterSubscription `json:"subscriptions"`
+	Total         int                  `json:"total" example:"250"` // Subscriptions matching the query across all pages
+	Offset        int                  `json:"offset" example:"0"`  // Subscriptions skipped before this page
+	Limit         int                  `json:"limit" example:"100"` // Maximum page size
+}
+
+// ConnectionDetails describes a client connected to a filter subscription
+type ConnectionDetails struct {
+	RemoteAddr  string    `json:"remoteAddr,omitempty" example:"203.0.113.7:51234"` // Omitted unless API key auth is enabled
+	ConnectedAt time.Time `json:"connectedAt"`
 }
 
 // CreateFilterRequest represents the request body for creating a new filter subscription
 type CreateFilterRequest struct {
 	Options FilterOptions `json:"options"`
+	// ExpiresAt removes the filter and closes its connections at this time (omit to keep it until unused)
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" example:"2025-01-01T13:00:00Z"`
+	// IdempotencyKey makes retries return the filter created by the first request (the Idempotency-Key header takes precedence)
+	IdempotencyKey string `json:"idempotencyKey,omitempty" example:"6f1c0a52-3e4b-4d8f-9a7e-2b5c8d1e0f93"`
+	// RequireToken makes connections to the filter present a short-lived connect token, returned
+	// as connectToken, so the filter key alone doesn't grant access to its events
+	RequireToken bool `json:"requireToken,omitempty" example:"false"`
+	// Label and Metadata describe what the filter is for; they're returned with the filter but
+	// don't affect matching
+	Label    string            `json:"label,omitempty" example:"Launch day mentions"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// BatchFilterError describes why one entry of a batch filter creation was rejected
+type BatchFilterError struct {
+	// Index is the entry's position in the request array
+	Index int    `json:"index" example:"2"`
+	Error string `json:"error" example:"Keyword filter is required. Filters must include keywords to prevent forwarding the entire firehose."`
+	// Reason is no_keyword, too_short, invalid_did or invalid_option
+	Reason string `json:"reason" example:"no_keyword"`
+}
+
+// UpdateSubscriptionRequest represents the request body for replacing a subscription's filter options
+type UpdateSubscriptionRequest struct {
+	Options FilterOptions `json:"options"`
+}
+
+// PauseSubscriptionRequest represents the request body for pausing or resuming a subscription
+type PauseSubscriptionRequest struct {
+	Paused bool `json:"paused" example:"true"` // true pauses event delivery, false resumes it
 }
 
 // CreateFilterResponse represents the response when creating a filter subscription
 type CreateFilterResponse struct {
-	FilterKey string        `json:"filterKey"`
-	Options   FilterOptions `json:"options"`
-	CreatedAt time.Time     `json:"createdAt"`
+	FilterKey string            `json:"filterKey"`
+	Options   FilterOptions     `json:"options"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt *time.Time        `json:"expiresAt,omitempty"`
+	Label     string            `json:"label,omitempty" example:"Launch day mentions"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// ConnectToken must be sent when connecting to a filter created with requireToken
+	ConnectToken          string     `json:"connectToken,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	ConnectTokenExpiresAt *time.Time `json:"connectTokenExpiresAt,omitempty" example:"2025-01-01T12:05:00Z"`
+}
+
+// ConnectTokenResponse is a new connect token for a filter that requires one
+type ConnectTokenResponse struct {
+	FilterKey string    `json:"filterKey" example:"8a3ce5f31b47d4788df91aeb38a565fe"`
+	Token     string    `json:"token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	ExpiresAt time.Time `json:"expiresAt" example:"2025-01-01T12:05:00Z"`
+}
+
+// VersionResponse describes the build of the running server
+type VersionResponse struct {
+	Version      string   `json:"version" example:"v1.2.0"`
+	Commit       string   `json:"commit" example:"735f879"`
+	BuildDate    string   `json:"buildDate" example:"2025-01-01T12:00:00Z"`
+	GoVersion    string   `json:"goVersion" example:"go1.24.4"`
+	FirehoseURLs []string `json:"firehoseUrls" example:"wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"` // User info is replaced with "redacted"
+}
+
+// KeywordUsage reports how many filter subscriptions use a keyword term
+type KeywordUsage struct {
+	Keyword string `json:"keyword" example:"bluesky"`
+	Filters int    `json:"filters" example:"3"`
+}
+
+// KeywordThroughput reports how many messages were sent for a keyword over the recent rate window
+type KeywordThroughput struct {
+	Keyword       string  `json:"keyword" example:"bluesky"`
+	Messages      uint64  `json:"messages" example:"120"`    // Messages sent during the window
+	RatePerSecond float64 `json:"ratePerSecond" example:"2"` // Messages divided by the window length
+}
+
+// DetailedStats is a JSON snapshot of the manager statistics plus per-keyword throughput
+type DetailedStats struct {
+	Stats         map[string]interface{} `json:"stats"`
+	WindowSeconds int                    `json:"windowSeconds" example:"60"`
+	Keywords      []KeywordThroughput    `json:"keywords"` // Busiest keywords first
+	GeneratedAt   time.Time              `json:"generatedAt"`
+}
+
+// TestFilterRequest represents a sample record to evaluate against filter options without creating a subscription
+type TestFilterRequest struct {
+	Options FilterOptions          `json:"options"`
+	Record  map[string]interface{} `json:"record"`
+	Did     string                 `json:"did,omitempty" example:"did:plc:example123"`         // Repository DID of the sample event
+	Path    string                 `json:"path,omitempty" example:"app.bsky.feed.post/abc123"` // Defaults to app.bsky.feed.post/test
+	Action  string                 `json:"action,omitempty" example:"create"`                  // Defaults to create
+}
+
+// TestFilterResponse reports whether a sample record matches filter options
+type TestFilterResponse struct {
+	Matched         bool     `json:"matched"`
+	MatchedKeywords []string `json:"matchedKeywords"` // Keywords (or patterns) found in the record, even if the filter didn't match
+}
+
+// FirehoseUpstreamStatus is the connection status of one firehose upstream
+type FirehoseUpstreamStatus struct {
+	URL           string     `json:"url" example:"wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"`
+	Connected     bool       `json:"connected" example:"true"`
+	Cursor        int64      `json:"cursor" example:"123456789"`                             // Last seen sequence number from this upstream
+	LastMessageAt *time.Time `json:"lastMessageAt,omitempty" example:"2024-10-04T21:15:32Z"` // Omitted until a message arrives
+	Reconnects    int        `json:"reconnects" example:"0"`                                 // Connection attempts since the last stable connection
+}
+
+// ValidateFilterRequest holds filter options to check without creating a subscription
+type ValidateFilterRequest struct {
+	Options FilterOptions `json:"options"`
+}
+
+// FieldValidation is the validation result of a single filter option
+type FieldValidation struct {
+	Field  string `json:"field" example:"keyword"` // JSON name of the option
+	Valid  bool   `json:"valid" example:"false"`
+	Error  string `json:"error,omitempty" example:"Keyword 'hi' must contain at least 3 letters"` // Why the option is invalid
+	Reason string `json:"reason,omitempty" example:"too_short"`                                   // no_keyword, too_short, invalid_did or invalid_option
+}
+
+// FilterValidationResponse reports whether filter options would be accepted, option by option
+type FilterValidationResponse struct {
+	Valid  bool              `json:"valid"`
+	Fields []FieldValidation `json:"fields"`
 }
 
 // WSMessage represents a WebSocket message sent to clients
@@ -2,6 +2,8 @@ package models
 
 import (
 	"encoding/json"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 )
@@ -21,6 +23,14 @@ func TestFilterOptions_JSONMarshaling(t *testing.T) {
 			},
 			expected: `{"repository":"did:plc:test123","pathPrefix":"app.bsky.feed.post","keyword":"golang"}`,
 		},
+		{
+			name: "with actions",
+			filter: FilterOptions{
+				Keyword: "golang",
+				Actions: []string{"create", "delete"},
+			},
+			expected: `{"repository":"","pathPrefix":"","keyword":"golang","actions":["create","delete"]}`,
+		},
 		{
 			name:     "empty filter",
 			filter:   FilterOptions{},
@@ -52,13 +62,374 @@ func TestFilterOptions_JSONMarshaling(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Failed to unmarshal FilterOptions: %v", err)
 			}
-			if filter != tt.filter {
+			if !reflect.DeepEqual(filter, tt.filter) {
 				t.Errorf("Unmarshal result = %+v, want %+v", filter, tt.filter)
 			}
 		})
 	}
 }
 
+func TestFilterOptions_AllowsAction(t *testing.T) {
+	all := FilterOptions{}
+	for _, action := range []string{ActionCreate, ActionUpdate, ActionDelete} {
+		if !all.AllowsAction(action) {
+			t.Errorf("Expected empty Actions to allow %q", action)
+		}
+	}
+
+	deletesOnly := FilterOptions{Actions: []string{ActionDelete}}
+	if !deletesOnly.AllowsAction(ActionDelete) {
+		t.Error("Expected delete to be allowed")
+	}
+	if deletesOnly.AllowsAction(ActionCreate) {
+		t.Error("Expected create to be rejected")
+	}
+}
+
+func TestFilterOptions_MatchesCollection(t *testing.T) {
+	tests := []struct {
+		name        string
+		collections []string
+		collection  string
+		expected    bool
+	}{
+		{name: "empty matches all", collections: nil, collection: "app.bsky.feed.post", expected: true},
+		{name: "exact match", collections: []string{"app.bsky.feed.like"}, collection: "app.bsky.feed.like", expected: true},
+		{name: "one of several", collections: []string{"app.bsky.feed.like", "app.bsky.feed.repost"}, collection: "app.bsky.feed.repost", expected: true},
+		{name: "longer NSID doesn't match", collections: []string{"app.bsky.feed.like"}, collection: "app.bsky.feed.likeX", expected: false},
+		{name: "prefix doesn't match", collections: []string{"app.bsky.feed"}, collection: "app.bsky.feed.like", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{Collections: tt.collections}
+			if result := options.MatchesCollection(tt.collection); result != tt.expected {
+				t.Errorf("MatchesCollection(%q) with %v = %v, want %v", tt.collection, tt.collections, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_MatchesEmbedTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		embedTypes  []string
+		recordTypes []string
+		expected    bool
+	}{
+		{name: "empty matches all", embedTypes: nil, recordTypes: nil, expected: true},
+		{name: "exact match", embedTypes: []string{"app.bsky.embed.images"}, recordTypes: []string{"app.bsky.embed.images"}, expected: true},
+		{name: "media of recordWithMedia", embedTypes: []string{"app.bsky.embed.video"}, recordTypes: []string{"app.bsky.embed.recordWithMedia", "app.bsky.embed.video"}, expected: true},
+		{name: "different embed", embedTypes: []string{"app.bsky.embed.images"}, recordTypes: []string{"app.bsky.embed.external"}, expected: false},
+		{name: "no embed", embedTypes: []string{"app.bsky.embed.images"}, recordTypes: nil, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{EmbedTypes: tt.embedTypes}
+			if result := options.MatchesEmbedTypes(tt.recordTypes); result != tt.expected {
+				t.Errorf("MatchesEmbedTypes(%v) with %v = %v, want %v", tt.recordTypes, tt.embedTypes, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_MatchesLangs(t *testing.T) {
+	tests := []struct {
+		name        string
+		langs       []string
+		recordLangs []string
+		expected    bool
+	}{
+		{name: "No filter", langs: nil, recordLangs: nil, expected: true},
+		{name: "Exact match", langs: []string{"en"}, recordLangs: []string{"en"}, expected: true},
+		{name: "Regional variant", langs: []string{"en"}, recordLangs: []string{"en-US"}, expected: true},
+		{name: "Case insensitive", langs: []string{"pt-br"}, recordLangs: []string{"pt-BR"}, expected: true},
+		{name: "Region does not match base", langs: []string{"en-GB"}, recordLangs: []string{"en"}, expected: false},
+		{name: "Any of several", langs: []string{"en", "ja"}, recordLangs: []string{"ja"}, expected: true},
+		{name: "No intersection", langs: []string{"en"}, recordLangs: []string{"de", "fr"}, expected: false},
+		{name: "Prefix is not a subtag", langs: []string{"en"}, recordLangs: []string{"eng"}, expected: false},
+		{name: "Missing record langs", langs: []string{"en"}, recordLangs: nil, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{Langs: tt.langs}
+			if result := options.MatchesLangs(tt.recordLangs); result != tt.expected {
+				t.Errorf("MatchesLangs(%v) with %v = %v, want %v", tt.recordLangs, tt.langs, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_MatchesTextLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int
+		text     string
+		expected bool
+	}{
+		{name: "No bounds", text: "", expected: true},
+		{name: "Empty text below minimum", min: 1, text: "", expected: false},
+		{name: "Empty text with only maximum", max: 10, text: "", expected: true},
+		{name: "Exactly at minimum", min: 5, text: "hello", expected: true},
+		{name: "One below minimum", min: 5, text: "hell", expected: false},
+		{name: "Exactly at maximum", max: 5, text: "hello", expected: true},
+		{name: "One above maximum", max: 5, text: "hello!", expected: false},
+		{name: "Within range", min: 2, max: 10, text: "hello", expected: true},
+		{name: "CJK counts characters", max: 5, text: "こんにちは", expected: true},         // 15 bytes, 5 runes
+		{name: "Emoji counts characters", min: 3, max: 3, text: "🦋🦋🦋", expected: true}, // 12 bytes, 3 runes
+		{name: "Multibyte above maximum", max: 4, text: "こんにちは", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{MinTextLength: tt.min, MaxTextLength: tt.max}
+			if result := options.MatchesTextLength(tt.text); result != tt.expected {
+				t.Errorf("MatchesTextLength(%q) with [%d, %d] = %v, want %v", tt.text, tt.min, tt.max, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_MatchesCreatedAt(t *testing.T) {
+	tests := []struct {
+		name         string
+		since, until string
+		createdAt    string
+		expected     bool
+	}{
+		{name: "No bounds", createdAt: "", expected: true},
+		{name: "Since only, after", since: "2024-01-01T00:00:00Z", createdAt: "2024-02-01T00:00:00Z", expected: true},
+		{name: "Since only, before", since: "2024-01-01T00:00:00Z", createdAt: "2023-12-01T00:00:00Z", expected: false},
+		{name: "Until only, before", until: "2024-01-01T00:00:00Z", createdAt: "2023-12-01T00:00:00Z", expected: true},
+		{name: "Until is exclusive", until: "2024-01-01T00:00:00Z", createdAt: "2024-01-01T00:00:00Z", expected: false},
+		{name: "Compared as instants", since: "2024-01-01T00:00:00Z", createdAt: "2024-01-01T08:00:00+09:00", expected: false},
+		{name: "Missing timestamp with bound", since: "2024-01-01T00:00:00Z", createdAt: "", expected: false},
+		{name: "Invalid timestamp with bound", until: "2024-01-01T00:00:00Z", createdAt: "not a time", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{Since: tt.since, Until: tt.until}
+			if result := options.MatchesCreatedAt(tt.createdAt); result != tt.expected {
+				t.Errorf("MatchesCreatedAt(%q) with [%q, %q) = %v, want %v", tt.createdAt, tt.since, tt.until, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_ContainsKeyword(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		keyword   string
+		wholeWord bool
+		expected  bool
+	}{
+		{name: "Substring", text: "category", keyword: "cat", wholeWord: false, expected: true},
+		{name: "Case insensitive", text: "CAT", keyword: "cat", wholeWord: false, expected: true},
+		{name: "Whole word rejects prefix", text: "category", keyword: "cat", wholeWord: true, expected: false},
+		{name: "Whole word rejects suffix", text: "communication", keyword: "cat", wholeWord: true, expected: false},
+		{name: "Whole word alone", text: "cat", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Whole word case insensitive", text: "I love my CAT", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Comma after", text: "cat, dog", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Quotes and period", text: `she said "cat".`, keyword: "cat", wholeWord: true, expected: true},
+		{name: "Hyphenated", text: "cat-like", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Apostrophe", text: "the cat's toy", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Digits are word characters", text: "cat9", keyword: "cat", wholeWord: true, expected: false},
+		{name: "Underscore is a word character", text: "cat_food", keyword: "cat", wholeWord: true, expected: false},
+		{name: "Emoji before", text: "🐱cat", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Emoji after", text: "cat🐱 nap", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Non-ASCII letters are word characters", text: "catégorie", keyword: "cat", wholeWord: true, expected: false},
+		{name: "Later occurrence matches", text: "category of cat", keyword: "cat", wholeWord: true, expected: true},
+		{name: "Multi-word keyword", text: "hello world!", keyword: "hello world", wholeWord: true, expected: true},
+		{name: "Hashtag keyword after text", text: "learning#golang", keyword: "#golang", wholeWord: true, expected: true},
+		{name: "Hashtag keyword rejects longer tag", text: "#golangweekly", keyword: "#golang", wholeWord: true, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{WholeWord: tt.wholeWord}
+			if result := options.ContainsKeyword(tt.text, tt.keyword); result != tt.expected {
+				t.Errorf("ContainsKeyword(%q, %q) = %v, want %v", tt.text, tt.keyword, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_ContainsKeywordMatchType(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		matchType string
+		expected  bool
+	}{
+		{name: "Substring inside a word", text: "testing the build", matchType: MatchTypeSubstring, expected: true},
+		{name: "Word inside a word", text: "testing the build", matchType: MatchTypeWord, expected: false},
+		{name: "Exact text inside a word", text: "testing the build", matchType: MatchTypeExactText, expected: false},
+		{name: "Substring as a word", text: "a quick test", matchType: MatchTypeSubstring, expected: true},
+		{name: "Word as a word", text: "a quick test", matchType: MatchTypeWord, expected: true},
+		{name: "Exact text as a word", text: "a quick test", matchType: MatchTypeExactText, expected: false},
+		{name: "Exact text alone", text: "test", matchType: MatchTypeExactText, expected: true},
+		{name: "Exact text ignores case and surrounding whitespace", text: "  TEST\n", matchType: MatchTypeExactText, expected: true},
+		{name: "Exact text with punctuation", text: "test!", matchType: MatchTypeExactText, expected: false},
+		{name: "Empty defaults to substring", text: "testing", matchType: "", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{MatchType: tt.matchType}
+			if result := options.ContainsKeyword(tt.text, "test"); result != tt.expected {
+				t.Errorf("ContainsKeyword(%q, \"test\") with %q = %v, want %v", tt.text, tt.matchType, result, tt.expected)
+			}
+		})
+	}
+
+	// WholeWord is shorthand for the word match type
+	if got := (FilterOptions{WholeWord: true}).EffectiveMatchType(); got != MatchTypeWord {
+		t.Errorf("Expected wholeWord to mean %q, got %q", MatchTypeWord, got)
+	}
+}
+
+func TestFilterOptions_ContainsKeywordCaseSensitive(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		keyword  string
+		options  FilterOptions
+		expected bool
+	}{
+		{name: "Exact case", text: "Buying $AAPL today", keyword: "$AAPL", options: FilterOptions{CaseSensitive: true}, expected: true},
+		{name: "Different case", text: "Buying $aapl today", keyword: "$AAPL", options: FilterOptions{CaseSensitive: true}, expected: false},
+		{name: "Different case, insensitive", text: "Buying $aapl today", keyword: "$AAPL", options: FilterOptions{}, expected: true},
+		{name: "Whole word", text: "NASA launches", keyword: "NASA", options: FilterOptions{CaseSensitive: true, WholeWord: true}, expected: true},
+		{name: "Whole word, different case", text: "Nasa launches", keyword: "NASA", options: FilterOptions{CaseSensitive: true, WholeWord: true}, expected: false},
+		{name: "With normalization", text: "CAFÉ OPEN", keyword: "CAFE", options: FilterOptions{CaseSensitive: true, NormalizeUnicode: true}, expected: true},
+		{name: "With normalization, different case", text: "Café open", keyword: "CAFE", options: FilterOptions{CaseSensitive: true, NormalizeUnicode: true}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.options.ContainsKeyword(tt.text, tt.keyword); result != tt.expected {
+				t.Errorf("ContainsKeyword(%q, %q) = %v, want %v", tt.text, tt.keyword, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_ContainsKeywordNormalizeUnicode(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		keyword   string
+		normalize bool
+		expected  bool
+	}{
+		{name: "Accent in text, off by default", text: "Meet me at the café", keyword: "cafe", normalize: false, expected: false},
+		{name: "Accent in text", text: "Meet me at the café", keyword: "cafe", normalize: true, expected: true},
+		{name: "Accent in keyword", text: "Meet me at the cafe", keyword: "café", normalize: true, expected: true},
+		{name: "Combining accent", text: "Meet me at the cafe\u0301", keyword: "café", normalize: true, expected: true},
+		{name: "Uppercase accents", text: "ÉCOLE NORMALE", keyword: "ecole", normalize: true, expected: true},
+		{name: "Tilde", text: "un ñandú corre", keyword: "nandu", normalize: true, expected: true},
+		{name: "Full-width text", text: "ｃａｆｅ ｌａｔｔｅ", keyword: "cafe", normalize: true, expected: true},
+		{name: "Full-width keyword", text: "cafe latte", keyword: "ＣＡＦＥ", normalize: true, expected: true},
+		{name: "Full-width off by default", text: "ｃａｆｅ", keyword: "cafe", normalize: false, expected: false},
+		{name: "Ligature", text: "ﬁnal answer", keyword: "final", normalize: true, expected: true},
+		{name: "Different base letter", text: "café", keyword: "cafa", normalize: true, expected: false},
+		{name: "Non-Latin script keeps letters", text: "東京タワー", keyword: "タワー", normalize: true, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{NormalizeUnicode: tt.normalize}
+			if result := options.ContainsKeyword(tt.text, tt.keyword); result != tt.expected {
+				t.Errorf("ContainsKeyword(%q, %q) = %v, want %v", tt.text, tt.keyword, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_MatchesRepository(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository string
+		did        string
+		expected   bool
+	}{
+		{name: "empty matches all", repository: "", did: "did:plc:any", expected: true},
+		{name: "single DID match", repository: "did:plc:abc", did: "did:plc:abc", expected: true},
+		{name: "single DID mismatch", repository: "did:plc:abc", did: "did:plc:xyz", expected: false},
+		{name: "list match with spaces", repository: "did:plc:abc, did:plc:xyz", did: "did:plc:xyz", expected: true},
+		{name: "list mismatch", repository: "did:plc:abc,did:plc:xyz", did: "did:plc:def", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{Repository: tt.repository}
+			if result := options.MatchesRepository(tt.did); result != tt.expected {
+				t.Errorf("MatchesRepository(%q) = %v, want %v", tt.did, result, tt.expected)
+			}
+		})
+	}
+
+	repos := FilterOptions{Repository: "did:plc:abc, ,did:plc:xyz"}.RepositoryList()
+	if !reflect.DeepEqual(repos, []string{"did:plc:abc", "did:plc:xyz"}) {
+		t.Errorf("RepositoryList() = %v, want [did:plc:abc did:plc:xyz]", repos)
+	}
+}
+
+func TestFilterOptions_MatchesRepositoryPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		did      string
+		expected bool
+	}{
+		{name: "empty matches all", prefix: "", did: "did:plc:any", expected: true},
+		{name: "did:web domain", prefix: "did:web:example.com", did: "did:web:example.com", expected: true},
+		{name: "did:web path on the domain", prefix: "did:web:example.com", did: "did:web:example.com:user:alice", expected: true},
+		{name: "other domain", prefix: "did:web:example.com", did: "did:web:example.org", expected: false},
+		{name: "other method", prefix: "did:web:", did: "did:plc:example", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{RepositoryPrefix: tt.prefix}
+			if result := options.MatchesRepositoryPrefix(tt.did); result != tt.expected {
+				t.Errorf("MatchesRepositoryPrefix(%q) = %v, want %v", tt.did, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterOptions_MatchesPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		pathPrefix string
+		opPath     string
+		expected   bool
+	}{
+		{name: "empty matches all", pathPrefix: "", opPath: "app.bsky.feed.post/abc", expected: true},
+		{name: "literal prefix match", pathPrefix: "app.bsky.feed", opPath: "app.bsky.feed.post/abc", expected: true},
+		{name: "literal prefix mismatch", pathPrefix: "app.bsky.graph", opPath: "app.bsky.feed.post/abc", expected: false},
+		{name: "trailing glob", pathPrefix: "app.bsky.feed.*", opPath: "app.bsky.feed.like/abc", expected: true},
+		{name: "middle glob", pathPrefix: "app.bsky.*.post", opPath: "app.bsky.feed.post/abc", expected: true},
+		{name: "middle glob mismatch", pathPrefix: "app.bsky.*.post", opPath: "app.bsky.feed.like/abc", expected: false},
+		{name: "glob only matches collection segment", pathPrefix: "app.bsky.feed.post*", opPath: "app.bsky.feed.post/abc", expected: true},
+		{name: "malformed glob never matches", pathPrefix: "app.bsky.[*", opPath: "app.bsky.feed.post/abc", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := FilterOptions{PathPrefix: tt.pathPrefix}
+			if result := options.MatchesPath(tt.opPath); result != tt.expected {
+				t.Errorf("MatchesPath(%q) with prefix %q = %v, want %v", tt.opPath, tt.pathPrefix, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestAPIResponse_JSONMarshaling(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -277,6 +648,25 @@ func TestATOperation_JSONMarshaling(t *testing.T) {
 	}
 }
 
+func TestATOperation_RecordURI(t *testing.T) {
+	tests := []struct {
+		name string
+		op   ATOperation
+		want string
+	}{
+		{"Collection and rkey", ATOperation{Path: "app.bsky.feed.post/3kabc123", Collection: "app.bsky.feed.post", Rkey: "3kabc123"}, "at://did:plc:abc123/app.bsky.feed.post/3kabc123"},
+		{"Falls back to path", ATOperation{Path: "app.bsky.feed.post/3kabc123"}, "at://did:plc:abc123/app.bsky.feed.post/3kabc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.op.RecordURI("did:plc:abc123"); got != tt.want {
+				t.Errorf("URI() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestRecordContent_JSONMarshaling(t *testing.T) {
 	record := RecordContent{
 		Text:    "Hello world",
@@ -339,6 +729,43 @@ func ptrValueOrNil(ptr *string) interface{} {
 	return *ptr
 }
 
+func TestRecordContent_NestedText(t *testing.T) {
+	recordJSON := `{
+		"text": "check this out",
+		"embed": {
+			"$type": "app.bsky.embed.recordWithMedia",
+			"media": {
+				"$type": "app.bsky.embed.external",
+				"external": {"uri": "https://example.com", "title": "Link Title", "description": "Link description"}
+			},
+			"record": {
+				"record": {"uri": "at://did:plc:abc/app.bsky.feed.post/1", "value": {"text": "quoted text"}}
+			}
+		},
+		"facets": [
+			{"features": [{"$type": "app.bsky.richtext.facet#link", "uri": "https://example.org/full"}]},
+			{"features": [{"$type": "app.bsky.richtext.facet#tag", "tag": "golang"}]}
+		]
+	}`
+
+	var record RecordContent
+	if err := json.Unmarshal([]byte(recordJSON), &record); err != nil {
+		t.Fatalf("Failed to unmarshal record: %v", err)
+	}
+
+	expected := []string{"Link Title", "Link description", "quoted text", "https://example.org/full", "golang"}
+	got := record.NestedText()
+	sort.Strings(expected)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	if nested := (RecordContent{Text: "plain"}).NestedText(); len(nested) != 0 {
+		t.Errorf("Expected no nested text for a plain record, got %v", nested)
+	}
+}
+
 func TestEnrichedATEvent_JSONMarshaling(t *testing.T) {
 	now := time.Now()
 
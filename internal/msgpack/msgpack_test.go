@@ -0,0 +1,94 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Depth int `json:"depth"`
+}
+
+type sample struct {
+	inner
+	Name     string            `json:"name"`
+	Skipped  string            `json:"-"`
+	Optional string            `json:"optional,omitempty"`
+	Nested   *inner            `json:"nested,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	When     time.Time         `json:"when"`
+	Expires  *time.Time        `json:"expires,omitempty"`
+	Untagged int
+	private  int
+}
+
+func TestMarshalMatchesJSONLayout(t *testing.T) {
+	expires := time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC)
+	value := sample{
+		inner:    inner{Depth: 2},
+		Name:     "post",
+		Skipped:  "hidden",
+		Labels:   map[string]string{"lang": "en", "kind": "reply"},
+		When:     time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Expires:  &expires,
+		Untagged: 9,
+		private:  1,
+	}
+
+	data, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	// Comparing through JSON normalizes number types between the two decoders
+	fromMsgpack, _ := json.Marshal(decoded)
+	fromJSON, _ := json.Marshal(value)
+	var got, want interface{}
+	json.Unmarshal(fromMsgpack, &got)
+	json.Unmarshal(fromJSON, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the JSON layout\n%s\ngot\n%s", fromJSON, fromMsgpack)
+	}
+}
+
+func TestMarshalIsDeterministic(t *testing.T) {
+	value := map[string]interface{}{"b": 1, "a": 2, "c": map[string]int{"z": 1, "y": 2}}
+	first, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		again, err := Marshal(value)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(first, again) {
+			t.Fatalf("Expected map keys to be sorted, got % x and % x", first, again)
+		}
+	}
+	// Small integers use the one-byte positive fixint format
+	if data, _ := Marshal(int64(5)); !bytes.Equal(data, []byte{0x05}) {
+		t.Errorf("Expected a compact int, got % x", data)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range [][]byte{nil, {0xa5, 'a'}, {0xc1}} {
+		if _, err := Decode(data); err == nil {
+			t.Errorf("Expected an error decoding % x", data)
+		}
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	if _, err := Marshal(map[string]interface{}{"ch": make(chan int)}); err == nil {
+		t.Error("Expected an error for a channel")
+	}
+}
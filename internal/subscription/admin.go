@@ -0,0 +1,113 @@
+package subscription
+
+import (
+	"log/slog"
+	"net"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnectionCriteria selects connections for CloseConnections. Every non-empty field must match;
+// criteria with no fields set match nothing.
+type ConnectionCriteria struct {
+	FilterKey string // Connections subscribed to this filter
+	RemoteIP  string // Connections from this client IP address
+}
+
+// empty reports whether no criteria are set
+func (c ConnectionCriteria) empty() bool {
+	return c.FilterKey == "" && c.RemoteIP == ""
+}
+
+// ForceDeleteFilter removes a filter subscription and closes every connection subscribed to it,
+// including connections also subscribed to other filters, with a policy-violation close frame.
+// It returns the number of closed connections and whether the filter existed.
+func (m *Manager) ForceDeleteFilter(filterKey string) (int, bool) {
+	m.mu.Lock()
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		m.mu.Unlock()
+		return 0, false
+	}
+
+	sub.mu.RLock()
+	closing := make([]Connection, 0, len(sub.Connections))
+	for conn := range sub.Connections {
+		closing = append(closing, conn)
+	}
+	sub.mu.RUnlock()
+
+	for _, conn := range closing {
+		m.dropConnection(conn)
+	}
+	// Dropping the last connection removes the filter unless a webhook keeps it alive
+	if _, exists := m.subscriptions[filterKey]; exists {
+		m.removeSubscription(filterKey)
+	}
+	totalConnections := len(m.connections)
+	m.mu.Unlock()
+
+	// Close frames can take a while to send, so they go out without holding the lock
+	closeWithReason(closing, websocket.ClosePolicyViolation, adminCloseReason)
+
+	slog.Warn("Force-deleted filter",
+		"filter", filterKey[:8]+"...",
+		"closedConnections", len(closing),
+		"totalConnections", totalConnections)
+
+	return len(closing), true
+}
+
+// CloseConnections closes every connection matching criteria with a policy-violation close
+// frame, removing it from all of its filters. It returns the number of closed connections.
+func (m *Manager) CloseConnections(criteria ConnectionCriteria) int {
+	if criteria.empty() {
+		return 0
+	}
+
+	m.mu.Lock()
+	var closing []Connection
+	for conn, filters := range m.connections {
+		if criteria.FilterKey != "" {
+			if _, subscribed := filters[criteria.FilterKey]; !subscribed {
+				continue
+			}
+		}
+		if criteria.RemoteIP != "" && !sameIP(connectionRemoteAddr(conn), criteria.RemoteIP) {
+			continue
+		}
+		closing = append(closing, conn)
+	}
+	for _, conn := range closing {
+		m.dropConnection(conn)
+	}
+	totalConnections := len(m.connections)
+	m.mu.Unlock()
+
+	closeWithReason(closing, websocket.ClosePolicyViolation, adminCloseReason)
+
+	slog.Warn("Closed connections",
+		"filter", criteria.FilterKey,
+		"remoteIP", criteria.RemoteIP,
+		"closedConnections", len(closing),
+		"totalConnections", totalConnections)
+
+	return len(closing)
+}
+
+// sameIP reports whether a host:port client address belongs to ip
+func sameIP(remoteAddr, ip string) bool {
+	if remoteAddr == "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	want := net.ParseIP(ip)
+	got := net.ParseIP(host)
+	if want == nil || got == nil {
+		return host == ip
+	}
+	return got.Equal(want)
+}
@@ -0,0 +1,137 @@
+package subscription
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// closeCode returns the status code of the single close frame a connection received, or 0
+func closeCode(t *testing.T, conn *fakeWebSocketConnection) int {
+	t.Helper()
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.closeFrames) != 1 || len(conn.closeFrames[0]) < 2 {
+		t.Errorf("Expected one close frame, got %q", conn.closeFrames)
+		return 0
+	}
+	return int(conn.closeFrames[0][0])<<8 | int(conn.closeFrames[0][1])
+}
+
+func TestForceDeleteFilter(t *testing.T) {
+	manager := NewManager()
+
+	target := manager.CreateFilter(models.FilterOptions{Keyword: "spam"})
+	other := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	single := &fakeWebSocketConnection{}
+	shared := &fakeWebSocketConnection{}
+	bystander := &fakeConnection{}
+	manager.AddConnection(target, single)
+	manager.AddConnection(target, shared)
+	manager.AddConnection(other, shared)
+	manager.AddConnection(other, bystander)
+
+	if _, exists := manager.ForceDeleteFilter("missing"); exists {
+		t.Error("Expected a missing filter to be reported")
+	}
+
+	closed, exists := manager.ForceDeleteFilter(target)
+	if !exists {
+		t.Fatal("Expected the filter to exist")
+	}
+	if closed != 2 {
+		t.Errorf("Expected 2 closed connections, got %d", closed)
+	}
+	if _, exists := manager.GetSubscription(target); exists {
+		t.Error("Expected the filter to be removed")
+	}
+
+	// Unlike DeleteFilter, connections with other filters are kicked too
+	for name, conn := range map[string]*fakeWebSocketConnection{"single": single, "shared": shared} {
+		if !conn.isClosed() {
+			t.Errorf("Expected the %s connection to be closed", name)
+		}
+		if code := closeCode(t, conn); code != websocket.ClosePolicyViolation {
+			t.Errorf("Expected a policy violation close code for the %s connection, got %d", name, code)
+		}
+	}
+	if bystander.isClosed() {
+		t.Error("Expected connections not on the filter to stay open")
+	}
+
+	sub, exists := manager.GetSubscription(other)
+	if !exists || sub.Connections != 1 {
+		t.Errorf("Expected the other filter to keep only its own connection, got %+v", sub)
+	}
+	if total := manager.GetStats()["total_connections"]; total != 1 {
+		t.Errorf("Expected 1 remaining connection, got %v", total)
+	}
+}
+
+func TestCloseConnections(t *testing.T) {
+	manager := NewManager()
+
+	first := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	second := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	abusive := &fakeAddrConnection{addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}}
+	abusiveAgain := &fakeAddrConnection{addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51235}}
+	neighbour := &fakeAddrConnection{addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.8"), Port: 51234}}
+	manager.AddConnection(first, abusive)
+	manager.AddConnection(second, abusive)
+	manager.AddConnection(second, abusiveAgain)
+	manager.AddConnection(first, neighbour)
+
+	// No criteria must not close everything
+	if closed := manager.CloseConnections(ConnectionCriteria{}); closed != 0 {
+		t.Errorf("Expected empty criteria to close nothing, got %d", closed)
+	}
+
+	// Both criteria have to match
+	if closed := manager.CloseConnections(ConnectionCriteria{FilterKey: first, RemoteIP: "203.0.113.9"}); closed != 0 {
+		t.Errorf("Expected no connections from an unknown IP, got %d", closed)
+	}
+	if closed := manager.CloseConnections(ConnectionCriteria{FilterKey: first, RemoteIP: "203.0.113.7"}); closed != 1 {
+		t.Errorf("Expected 1 closed connection, got %d", closed)
+	}
+	if !abusive.isClosed() || abusiveAgain.isClosed() || neighbour.isClosed() {
+		t.Error("Expected only the connection matching both criteria to be closed")
+	}
+
+	// A closed connection leaves all of its filters
+	if sub, _ := manager.GetSubscription(second); sub.Connections != 1 {
+		t.Errorf("Expected the closed connection to leave its other filter, got %d connections", sub.Connections)
+	}
+
+	if closed := manager.CloseConnections(ConnectionCriteria{RemoteIP: "203.0.113.7"}); closed != 1 {
+		t.Errorf("Expected 1 closed connection, got %d", closed)
+	}
+	if !abusiveAgain.isClosed() {
+		t.Error("Expected the remaining connection from the IP to be closed")
+	}
+	if total := manager.GetStats()["total_connections"]; total != 1 {
+		t.Errorf("Expected 1 remaining connection, got %v", total)
+	}
+}
+
+func TestSameIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		ip         string
+		want       bool
+	}{
+		{"203.0.113.7:51234", "203.0.113.7", true},
+		{"203.0.113.7:51234", "203.0.113.8", false},
+		{"[2001:db8::1]:443", "2001:db8:0::1", true},
+		{"203.0.113.7", "203.0.113.7", true},
+		{"", "203.0.113.7", false},
+	}
+
+	for _, tt := range tests {
+		if got := sameIP(tt.remoteAddr, tt.ip); got != tt.want {
+			t.Errorf("sameIP(%q, %q) = %v, want %v", tt.remoteAddr, tt.ip, got, tt.want)
+		}
+	}
+}
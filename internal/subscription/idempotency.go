@@ -0,0 +1,96 @@
+package subscription
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// DefaultIdempotencyTTL is how long an idempotency key keeps returning the filter created under it
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is reused with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+// scopedIdempotencyKey is an idempotency key within the namespace of the caller that sent it,
+// so callers can't replay or block each other's keys
+type scopedIdempotencyKey struct {
+	scope string
+	key   string
+}
+
+// idempotentCreate records the filter created under an idempotency key
+type idempotentCreate struct {
+	filterKey string
+	request   models.CreateFilterRequest // The request the filter was created for, without its idempotency key
+	expiresAt time.Time                  // When the key may be used for a new filter again
+}
+
+// SetIdempotencyTTL sets how long an idempotency key keeps returning the filter created under
+// it; 0 or less restores DefaultIdempotencyTTL. It must be called before filters are created.
+func (m *Manager) SetIdempotencyTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	m.idempotencyTTL = ttl
+}
+
+// CreateFilterIdempotent creates a filter for request's options like CreateFilterWithResult,
+// unless a filter was created for an identical request under the same idempotency key and scope
+// within the TTL and still exists; then that filter's key is returned with Reused set, so a
+// retried request doesn't create a duplicate. Reusing a key with different options, expiry,
+// requireToken, label or metadata returns ErrIdempotencyKeyReused. The scope identifies the
+// caller; the same key in another scope is unrelated.
+func (m *Manager) CreateFilterIdempotent(scope, idempotencyKey string, request models.CreateFilterRequest) (FilterResult, error) {
+	request.IdempotencyKey = ""
+	request.Metadata = maps.Clone(request.Metadata)
+	keywordPatterns, reason, validationErr := m.prepareFilter(request.Options)
+	if validationErr != "" {
+		return rejectFilter(reason, validationErr), nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	scoped := scopedIdempotencyKey{scope: scope, key: idempotencyKey}
+	if previous, exists := m.idempotencyKeys[scoped]; exists && now.Before(previous.expiresAt) {
+		if _, alive := m.subscriptions[previous.filterKey]; alive {
+			if !sameCreateRequest(previous.request, request) {
+				return FilterResult{}, ErrIdempotencyKeyReused
+			}
+			return FilterResult{FilterKey: previous.filterKey, Success: true, Reused: true}, nil
+		}
+	}
+
+	filterKey := m.addFilter(request.Options, keywordPatterns)
+	m.idempotencyKeys[scoped] = idempotentCreate{
+		filterKey: filterKey,
+		request:   request,
+		expiresAt: now.Add(m.idempotencyTTL),
+	}
+	return FilterResult{FilterKey: filterKey, Success: true}, nil
+}
+
+// sameCreateRequest reports whether two filter creation requests ask for the same filter
+func sameCreateRequest(a, b models.CreateFilterRequest) bool {
+	sameExpiry := a.ExpiresAt == nil && b.ExpiresAt == nil ||
+		a.ExpiresAt != nil && b.ExpiresAt != nil && a.ExpiresAt.Equal(*b.ExpiresAt)
+	return sameExpiry &&
+		a.RequireToken == b.RequireToken &&
+		a.Label == b.Label &&
+		maps.Equal(a.Metadata, b.Metadata) &&
+		reflect.DeepEqual(a.Options, b.Options)
+}
+
+// pruneIdempotencyKeys forgets idempotency keys past their TTL; the caller must hold m.mu for writing
+func (m *Manager) pruneIdempotencyKeys(now time.Time) {
+	for key, previous := range m.idempotencyKeys {
+		if !now.Before(previous.expiresAt) {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+}
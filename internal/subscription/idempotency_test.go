@@ -0,0 +1,126 @@
+package subscription
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestCreateFilterIdempotent(t *testing.T) {
+	manager := NewManager()
+	options := models.FilterOptions{Keyword: "hello"}
+
+	first, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options})
+	if err != nil || !first.Success || first.Reused {
+		t.Fatalf("Expected a new filter, got %+v, %v", first, err)
+	}
+
+	again, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options})
+	if err != nil || !again.Reused || again.FilterKey != first.FilterKey {
+		t.Errorf("Expected the first filter to be reused, got %+v, %v", again, err)
+	}
+
+	if _, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: models.FilterOptions{Keyword: "world"}}); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("Expected ErrIdempotencyKeyReused for different options, got %v", err)
+	}
+
+	// The rest of the request has to match as well
+	expiresAt := time.Now().Add(time.Hour)
+	for name, request := range map[string]models.CreateFilterRequest{
+		"expiresAt":    {Options: options, ExpiresAt: &expiresAt},
+		"requireToken": {Options: options, RequireToken: true},
+		"label":        {Options: options, Label: "demo"},
+		"metadata":     {Options: options, Metadata: map[string]string{"team": "search"}},
+	} {
+		if _, err := manager.CreateFilterIdempotent("client-a", "key-1", request); !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Errorf("Expected ErrIdempotencyKeyReused for a different %s, got %v", name, err)
+		}
+	}
+	if again, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options, IdempotencyKey: "key-1", Metadata: map[string]string{}}); err != nil || !again.Reused {
+		t.Errorf("Expected the idempotency key field and empty metadata not to count as changes, got %+v, %v", again, err)
+	}
+
+	if rejected, err := manager.CreateFilterIdempotent("client-a", "key-2", models.CreateFilterRequest{Options: models.FilterOptions{}}); err != nil || rejected.Success || rejected.Reason != FilterRejectedNoKeyword {
+		t.Errorf("Expected invalid options to be rejected, got %+v, %v", rejected, err)
+	}
+
+	// A key whose filter was deleted creates a new one
+	manager.DeleteFilter(first.FilterKey)
+	recreated, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options})
+	if err != nil || recreated.Reused || recreated.FilterKey == first.FilterKey {
+		t.Errorf("Expected a new filter after the first was deleted, got %+v, %v", recreated, err)
+	}
+
+	// Another caller's identical key neither replays nor conflicts with the first caller's filter
+	other, err := manager.CreateFilterIdempotent("client-b", "key-1", models.CreateFilterRequest{Options: models.FilterOptions{Keyword: "world"}})
+	if err != nil || !other.Success || other.Reused || other.FilterKey == recreated.FilterKey {
+		t.Errorf("Expected a separate filter for another scope, got %+v, %v", other, err)
+	}
+}
+
+func TestCreateFilterIdempotentExpiry(t *testing.T) {
+	manager := NewManager()
+	manager.SetIdempotencyTTL(time.Hour)
+	options := models.FilterOptions{Keyword: "hello"}
+
+	first, _ := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options})
+
+	// Age the key past its TTL; the filter is kept alive by a connection
+	manager.AddConnection(first.FilterKey, &fakeConnection{})
+	manager.mu.Lock()
+	entry := manager.idempotencyKeys[scopedIdempotencyKey{"client-a", "key-1"}]
+	entry.expiresAt = time.Now().Add(-time.Second)
+	manager.idempotencyKeys[scopedIdempotencyKey{"client-a", "key-1"}] = entry
+	manager.mu.Unlock()
+
+	second, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options})
+	if err != nil || second.Reused || second.FilterKey == first.FilterKey {
+		t.Errorf("Expected an expired key to create a new filter, got %+v, %v", second, err)
+	}
+
+	manager.mu.Lock()
+	entry = manager.idempotencyKeys[scopedIdempotencyKey{"client-a", "key-1"}]
+	entry.expiresAt = time.Now().Add(-time.Second)
+	manager.idempotencyKeys[scopedIdempotencyKey{"client-a", "key-1"}] = entry
+	manager.mu.Unlock()
+
+	manager.performPeriodicCleanup()
+	manager.mu.RLock()
+	remaining := len(manager.idempotencyKeys)
+	manager.mu.RUnlock()
+	if remaining != 0 {
+		t.Errorf("Expected cleanup to forget expired keys, %d left", remaining)
+	}
+}
+
+func TestCreateFilterIdempotentConcurrentRetries(t *testing.T) {
+	manager := NewManager()
+	options := models.FilterOptions{Keyword: "hello"}
+
+	var wg sync.WaitGroup
+	keys := make([]string, 10)
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := manager.CreateFilterIdempotent("client-a", "key-1", models.CreateFilterRequest{Options: options})
+			if err != nil {
+				t.Errorf("CreateFilterIdempotent returned error: %v", err)
+			}
+			keys[i] = result.FilterKey
+		}(i)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if key != keys[0] {
+			t.Fatalf("Expected concurrent retries to share one filter, got %v", keys)
+		}
+	}
+	if count := len(manager.GetSubscriptions()); count != 1 {
+		t.Errorf("Expected 1 filter, got %d", count)
+	}
+}
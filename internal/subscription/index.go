@@ -0,0 +1,228 @@
+package subscription
+
+import (
+	"strings"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// keywordAnchorLength is how many leading bytes of a lowercased keyword are used as its index
+// key. Keywords shorter than this can't be indexed.
+const keywordAnchorLength = 3
+
+// subscriptionSet is a set of subscriptions
+type subscriptionSet map[*Subscription]struct{}
+
+// indexPlacement records the index keys a subscription was added under, so it can be removed
+// even after its options changed
+type indexPlacement struct {
+	repositories   []string
+	collections    []string
+	keywords       []string
+	foldedKeywords []string
+}
+
+// filterIndex narrows the subscriptions an event can match before the full filter check, so
+// BroadcastEvent doesn't have to test every filter. Each subscription is indexed under one
+// condition it can't match a commit without: its repositories, else its collections, else the
+// leading bytes of each of its keywords, since every keyword match starts with them. Filters
+// that fit none of these (regex or very short keywords) are checked against every event.
+// The manager's mu guards the index: hold it for writing when changing it.
+type filterIndex struct {
+	byRepository    map[string]subscriptionSet
+	byCollection    map[string]subscriptionSet
+	byKeyword       map[string]subscriptionSet // Lowercased keyword anchors
+	byFoldedKeyword map[string]subscriptionSet // Anchors of normalizeUnicode filters, folded and lowercased
+	unindexed       subscriptionSet            // Checked against every commit
+	anyRepository   subscriptionSet            // Not indexed by repository; identity and account events can match these
+	placements      map[*Subscription]indexPlacement
+}
+
+// add indexes a subscription under its current options
+func (idx *filterIndex) add(sub *Subscription) {
+	if idx.placements == nil {
+		idx.byRepository = make(map[string]subscriptionSet)
+		idx.byCollection = make(map[string]subscriptionSet)
+		idx.byKeyword = make(map[string]subscriptionSet)
+		idx.byFoldedKeyword = make(map[string]subscriptionSet)
+		idx.unindexed = make(subscriptionSet)
+		idx.anyRepository = make(subscriptionSet)
+		idx.placements = make(map[*Subscription]indexPlacement)
+	}
+
+	options := sub.Options
+	var placement indexPlacement
+	if repos := options.RepositoryList(); len(repos) > 0 {
+		placement.repositories = repos
+	} else {
+		idx.anyRepository[sub] = struct{}{}
+		if len(options.Collections) > 0 {
+			placement.collections = options.Collections
+		} else if anchors, ok := keywordAnchors(options); ok {
+			if options.NormalizeUnicode {
+				placement.foldedKeywords = anchors
+			} else {
+				placement.keywords = anchors
+			}
+		} else {
+			idx.unindexed[sub] = struct{}{}
+		}
+	}
+
+	addToSets(idx.byRepository, placement.repositories, sub)
+	addToSets(idx.byCollection, placement.collections, sub)
+	addToSets(idx.byKeyword, placement.keywords, sub)
+	addToSets(idx.byFoldedKeyword, placement.foldedKeywords, sub)
+	idx.placements[sub] = placement
+}
+
+// remove drops a subscription from the index
+func (idx *filterIndex) remove(sub *Subscription) {
+	placement, indexed := idx.placements[sub]
+	if !indexed {
+		return
+	}
+
+	removeFromSets(idx.byRepository, placement.repositories, sub)
+	removeFromSets(idx.byCollection, placement.collections, sub)
+	removeFromSets(idx.byKeyword, placement.keywords, sub)
+	removeFromSets(idx.byFoldedKeyword, placement.foldedKeywords, sub)
+	delete(idx.unindexed, sub)
+	delete(idx.anyRepository, sub)
+	delete(idx.placements, sub)
+}
+
+// candidates returns the subscriptions that may match an event; the rest certainly don't
+func (idx *filterIndex) candidates(event *models.ATEvent) []*Subscription {
+	found := make(subscriptionSet)
+	addAll := func(set subscriptionSet) {
+		for sub := range set {
+			found[sub] = struct{}{}
+		}
+	}
+
+	addAll(idx.byRepository[event.Did])
+
+	// Identity and account events carry no ops, so only the repository filter applies to them
+	if event.Kind != "" && event.Kind != models.EventKindCommit {
+		addAll(idx.anyRepository)
+		return setToSlice(found)
+	}
+
+	addAll(idx.unindexed)
+	for _, op := range event.Ops {
+		addAll(idx.byCollection[operationCollection(op)])
+		if len(idx.byKeyword) == 0 && len(idx.byFoldedKeyword) == 0 {
+			continue
+		}
+		walkRecordStrings(op.Record, func(text string) {
+			if len(idx.byKeyword) > 0 {
+				idx.addKeywordCandidates(found, idx.byKeyword, strings.ToLower(text))
+			}
+			if len(idx.byFoldedKeyword) > 0 {
+				idx.addKeywordCandidates(found, idx.byFoldedKeyword, strings.ToLower(models.FoldUnicode(text)))
+			}
+		})
+	}
+	return setToSlice(found)
+}
+
+// addKeywordCandidates adds the subscriptions whose keyword anchor occurs anywhere in text
+func (idx *filterIndex) addKeywordCandidates(found subscriptionSet, byAnchor map[string]subscriptionSet, text string) {
+	for i := 0; i+keywordAnchorLength <= len(text); i++ {
+		for sub := range byAnchor[text[i:i+keywordAnchorLength]] {
+			found[sub] = struct{}{}
+		}
+	}
+}
+
+// keywordAnchors returns the distinct index keys of a filter's plain keywords, transformed the
+// way ContainsKeyword compares them. It reports false if any keyword can't be indexed.
+func keywordAnchors(options models.FilterOptions) ([]string, bool) {
+	if options.KeywordRegex {
+		return nil, false
+	}
+
+	var anchors []string
+	seen := make(map[string]bool)
+	for _, keyword := range strings.Split(options.Keyword, ",") {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			continue
+		}
+		if options.NormalizeUnicode {
+			keyword = models.FoldUnicode(keyword)
+		}
+		keyword = strings.ToLower(keyword)
+		// Record text fields are joined by newlines, so a keyword spanning one can't be anchored in a single field
+		if len(keyword) < keywordAnchorLength || strings.Contains(keyword, "\n") {
+			return nil, false
+		}
+		if anchor := keyword[:keywordAnchorLength]; !seen[anchor] {
+			seen[anchor] = true
+			anchors = append(anchors, anchor)
+		}
+	}
+	return anchors, len(anchors) > 0
+}
+
+// walkRecordStrings calls fn with every string value in a record, however deeply nested. That
+// covers every text field and nested text any filter may search.
+func walkRecordStrings(record interface{}, fn func(string)) {
+	values, ok := recordMap(record)
+	if !ok {
+		return
+	}
+	walkStrings(values, fn)
+}
+
+// walkStrings calls fn with every string in a decoded value
+func walkStrings(value interface{}, fn func(string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case map[interface{}]interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	}
+}
+
+// addToSets adds sub to the set under each key, creating sets as needed
+func addToSets(sets map[string]subscriptionSet, keys []string, sub *Subscription) {
+	for _, key := range keys {
+		set, exists := sets[key]
+		if !exists {
+			set = make(subscriptionSet)
+			sets[key] = set
+		}
+		set[sub] = struct{}{}
+	}
+}
+
+// removeFromSets removes sub from the set under each key, dropping sets that become empty
+func removeFromSets(sets map[string]subscriptionSet, keys []string, sub *Subscription) {
+	for _, key := range keys {
+		delete(sets[key], sub)
+		if len(sets[key]) == 0 {
+			delete(sets, key)
+		}
+	}
+}
+
+// setToSlice returns the members of a set
+func setToSlice(set subscriptionSet) []*Subscription {
+	subs := make([]*Subscription, 0, len(set))
+	for sub := range set {
+		subs = append(subs, sub)
+	}
+	return subs
+}
@@ -0,0 +1,242 @@
+package subscription
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// postEvent returns a commit creating a post with the given text
+func postEvent(did, text string) *models.ATEvent {
+	return &models.ATEvent{
+		Did:  did,
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{{
+			Action:     "create",
+			Path:       "app.bsky.feed.post/abc123",
+			Collection: "app.bsky.feed.post",
+			Rkey:       "abc123",
+			Record:     map[string]interface{}{"text": text, "langs": []interface{}{"en"}},
+		}},
+	}
+}
+
+// isCandidate reports whether the filter is among the index's candidates for an event
+func isCandidate(m *Manager, filterKey string, event *models.ATEvent) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, sub := range m.index.candidates(event) {
+		if sub.FilterKey == filterKey {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFilterIndexCandidates(t *testing.T) {
+	manager := NewManager()
+
+	byRepo := manager.CreateFilter(models.FilterOptions{Repository: "did:plc:alice,did:plc:bob", Keyword: "hello"})
+	byCollection := manager.CreateFilter(models.FilterOptions{Collections: []string{"app.bsky.feed.like"}, Keyword: "hello"})
+	byKeyword := manager.CreateFilter(models.FilterOptions{Keyword: "Bluesky, golang"})
+	folded := manager.CreateFilter(models.FilterOptions{Keyword: "café", NormalizeUnicode: true})
+	regex := manager.CreateFilter(models.FilterOptions{Keyword: "gol+ang", KeywordRegex: true})
+
+	tests := []struct {
+		name     string
+		event    *models.ATEvent
+		expected map[string]bool
+	}{
+		{
+			name:     "Keyword anywhere in the record, ignoring case",
+			event:    postEvent("did:plc:carol", "I love BLUESKY"),
+			expected: map[string]bool{byRepo: false, byCollection: false, byKeyword: true, folded: false, regex: true},
+		},
+		{
+			name:     "Second keyword",
+			event:    postEvent("did:plc:carol", "learning golang"),
+			expected: map[string]bool{byKeyword: true},
+		},
+		{
+			name:     "Repository",
+			event:    postEvent("did:plc:bob", "nothing relevant"),
+			expected: map[string]bool{byRepo: true, byKeyword: false},
+		},
+		{
+			name:     "Folded keyword",
+			event:    postEvent("did:plc:carol", "meet at the CAFE"),
+			expected: map[string]bool{folded: true, byKeyword: false},
+		},
+		{
+			name: "Collection",
+			event: &models.ATEvent{
+				Did: "did:plc:carol",
+				Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.like/xyz"}},
+			},
+			expected: map[string]bool{byCollection: true, byKeyword: false, byRepo: false},
+		},
+		{
+			name: "Nested text",
+			event: &models.ATEvent{
+				Did: "did:plc:carol",
+				Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{
+					"embed": map[string]interface{}{"external": map[string]interface{}{"title": "Bluesky news"}},
+				}}},
+			},
+			expected: map[string]bool{byKeyword: true},
+		},
+		{
+			name:     "Identity events reach every filter not bound to other repositories",
+			event:    &models.ATEvent{Did: "did:plc:carol", Kind: models.EventKindIdentity},
+			expected: map[string]bool{byRepo: false, byCollection: true, byKeyword: true, folded: true, regex: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for filterKey, expected := range tt.expected {
+				if got := isCandidate(manager, filterKey, tt.event); got != expected {
+					t.Errorf("Expected candidate=%v for filter %s, got %v", expected, filterKey[:8], got)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterIndexAgreesWithFullScan(t *testing.T) {
+	manager := NewManager()
+
+	optionSets := []models.FilterOptions{
+		{Keyword: "hello"},
+		{Keyword: "hello,world", KeywordMatchMode: models.KeywordMatchAll},
+		{Keyword: "world", WholeWord: true},
+		{Keyword: "hi,hello"}, // "hi" is too short to index
+		{Keyword: "h.llo", KeywordRegex: true},
+		{Keyword: "resume", NormalizeUnicode: true},
+		{Keyword: "news", DeepTextSearch: true},
+		{Keyword: "HELLO", CaseSensitive: true},
+		{Keyword: "hello", Repository: "did:plc:alice"},
+		{Keyword: "hello", Collections: []string{"app.bsky.feed.post"}},
+		{Keyword: "hello", PathPrefix: "app.bsky.feed.*"},
+		{Keyword: "hello", EventKinds: []string{models.EventKindCommit, models.EventKindAccount}},
+		{Keyword: "title", TextFields: []string{"embed.external.title"}},
+	}
+	for _, options := range optionSets {
+		manager.CreateFilter(options)
+	}
+
+	events := []*models.ATEvent{
+		postEvent("did:plc:alice", "hello world"),
+		postEvent("did:plc:bob", "HELLO there"),
+		postEvent("did:plc:bob", "my résumé"),
+		postEvent("did:plc:bob", "helloworld"),
+		postEvent("did:plc:bob", "hi"),
+		postEvent("did:plc:bob", "unrelated"),
+		{Did: "did:plc:alice", Ops: []models.ATOperation{{Action: "delete", Path: "app.bsky.feed.post/1"}}},
+		{Did: "did:plc:bob", Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/2", Record: map[string]interface{}{
+			"text":  "see link",
+			"embed": map[string]interface{}{"external": map[string]interface{}{"title": "Big news title"}},
+		}}}},
+		{Did: "did:plc:bob", Kind: models.EventKindAccount, Account: &models.AccountInfo{Active: true}},
+	}
+
+	for i, event := range events {
+		for _, sub := range manager.subscriptions {
+			matches := manager.matchesFilterWithPatterns(event, sub.Options, sub.keywordPatterns)
+			if matches && !isCandidate(manager, sub.FilterKey, event) {
+				t.Errorf("Event %d matches filter %+v but the index skipped it", i, sub.Options)
+			}
+		}
+	}
+}
+
+func TestFilterIndexStaysConsistent(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	manager.AddConnection(filterKey, conn)
+	if !isCandidate(manager, filterKey, postEvent("did:plc:bob", "hello")) {
+		t.Fatal("Expected a new filter to be indexed")
+	}
+
+	// Updating the options moves the filter to its new index keys
+	if _, err := manager.UpdateSubscriptionOptions(filterKey, models.FilterOptions{Keyword: "world"}); err != nil {
+		t.Fatalf("UpdateSubscriptionOptions returned error: %v", err)
+	}
+	if isCandidate(manager, filterKey, postEvent("did:plc:bob", "hello")) {
+		t.Error("Expected the old keyword to be unindexed after an update")
+	}
+	if !isCandidate(manager, filterKey, postEvent("did:plc:bob", "world")) {
+		t.Error("Expected the new keyword to be indexed after an update")
+	}
+
+	// Changing a connection's filter in place reindexes it too
+	if _, err := manager.SetConnectionFilter(filterKey, conn, models.FilterOptions{Keyword: "bluesky"}); err != nil {
+		t.Fatalf("SetConnectionFilter returned error: %v", err)
+	}
+	if !isCandidate(manager, filterKey, postEvent("did:plc:bob", "bluesky")) {
+		t.Error("Expected the filter to be reindexed after SetConnectionFilter")
+	}
+
+	if _, exists := manager.DeleteFilter(filterKey); !exists {
+		t.Fatal("Expected the filter to exist")
+	}
+	manager.mu.RLock()
+	placements := len(manager.index.placements)
+	keywords := len(manager.index.byKeyword)
+	manager.mu.RUnlock()
+	if placements != 0 || keywords != 0 {
+		t.Errorf("Expected an empty index after deleting the only filter, got %d placements and %d keyword anchors", placements, keywords)
+	}
+
+	// Filters removed by cleanup leave the index as well
+	stale := manager.CreateFilter(models.FilterOptions{Keyword: "stale"})
+	manager.mu.Lock()
+	manager.subscriptions[stale].CreatedAt = manager.subscriptions[stale].CreatedAt.Add(-24 * time.Hour)
+	manager.mu.Unlock()
+	manager.performPeriodicCleanup()
+	if isCandidate(manager, stale, postEvent("did:plc:bob", "stale")) {
+		t.Error("Expected a cleaned up filter to leave the index")
+	}
+}
+
+// BenchmarkCandidateMatching compares matching an event against every filter with matching it
+// against the index's candidates only
+func BenchmarkCandidateMatching(b *testing.B) {
+	for _, filters := range []int{1000, 10000} {
+		manager := NewManager()
+		for i := 0; i < filters; i++ {
+			manager.CreateFilter(models.FilterOptions{Keyword: benchmarkKeyword(i)})
+		}
+		event := postEvent("did:plc:bob", "a fairly ordinary post mentioning "+benchmarkKeyword(42)+" among other words")
+
+		b.Run(fmt.Sprintf("scan/%d", filters), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, sub := range manager.subscriptions {
+					manager.matchesFilterWithPatterns(event, sub.Options, sub.keywordPatterns)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("index/%d", filters), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, sub := range manager.index.candidates(event) {
+					manager.matchesFilterWithPatterns(event, sub.Options, sub.keywordPatterns)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkKeyword returns a distinct four letter keyword for i, least significant letter
+// first so that neighbouring keywords have different anchors
+func benchmarkKeyword(i int) string {
+	keyword := make([]byte, 4)
+	for j := range keyword {
+		keyword[j] = byte('a' + i%26)
+		i /= 26
+	}
+	return string(keyword)
+}
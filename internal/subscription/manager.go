@@ -4,25 +4,54 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/gorilla/websocket"
 
 	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
 	"github.com/JWhist/AT_Proto_PubSub/internal/models"
 )
 
+// Connection is a client connection that receives broadcast events.
+// *websocket.Conn satisfies it directly; other transports (e.g. SSE) wrap their writer.
+type Connection interface {
+	WriteJSON(v interface{}) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
 // Manager handles filter subscriptions and WebSocket connections
 type Manager struct {
-	mu               sync.RWMutex
-	subscriptions    map[string]*Subscription
-	maxConnections   int
-	totalConnections int
+	mu             sync.RWMutex
+	subscriptions  map[string]*Subscription
+	index          filterIndex // Narrows the subscriptions BroadcastEvent checks each event against
+	maxConnections int
+	connections    map[Connection]map[string]bool   // Filter keys each client connection is subscribed to
+	writers        map[Connection]*connectionWriter // Outbound queue of each registered connection
+	taps           map[Connection]*tap              // Connections sampling every event regardless of filters, see AddTap
+	textFields     []string                         // Default record fields searched for keywords
+	replayBuffer   int                              // Events each new subscription keeps for replay, 0 disables replay
+	publisher      EventPublisher                   // Message bus forwarded events are also published to
+	requireKeyword bool                             // Reject filters without a keyword, even if they name repositories or collections
+	webhookClient  *http.Client                     // Client webhooks are posted with
+	// Idempotent filter creation
+	idempotencyKeys map[scopedIdempotencyKey]idempotentCreate // Filter created under each client-supplied idempotency key
+	idempotencyTTL  time.Duration                             // How long an idempotency key keeps returning its filter
+	connectTokenTTL time.Duration                             // How long an issued connect token stays valid
 	// Periodic cleanup
 	cleanupTicker  *time.Ticker
 	cleanupStop    chan bool
@@ -30,20 +59,84 @@ type Manager struct {
 	// Keyword activity tracking
 	keywordCounts   map[string]int
 	keywordCountsMu sync.RWMutex
-	allSeenKeywords map[string]bool // Track all keywords we've ever seen
-	activityTicker  *time.Ticker
-	activityStop    chan bool
-	activityRunning bool
+	keywordRates    map[string]*keywordRate // Messages sent per keyword over the last minute
+	// keywordPublished holds the keywords with a gauge series from the last window
+	keywordPublished map[string]bool
+	activityTicker   *time.Ticker
+	activityStop     chan bool
+	activityRunning  bool
 }
 
 // Subscription represents a filter with its associated WebSocket connections
 type Subscription struct {
-	FilterKey        string
-	Options          models.FilterOptions
-	CreatedAt        time.Time
-	LastConnectionAt *time.Time // Track when the last connection was active
-	Connections      map[*websocket.Conn]bool
-	mu               sync.RWMutex
+	FilterKey         string
+	Options           models.FilterOptions
+	CreatedAt         time.Time
+	LastConnectionAt  *time.Time        // Track when the last connection was active
+	ExpiresAt         *time.Time        // When the filter is removed regardless of connections, nil for never
+	Label             string            // Informational name given at creation; guarded by mu
+	Metadata          map[string]string // Informational key/value pairs given at creation, never modified once set; guarded by mu
+	Connections       map[Connection]ConnectionInfo
+	keywordPatterns   []*regexp.Regexp     // Compiled keyword patterns when Options.KeywordRegex is set
+	MessagesDelivered atomic.Uint64        // Monotonic count of messages successfully sent to connections
+	webhook           *webhookSender       // Webhook delivery when Options.WebhookURL is set
+	replay            *replayBuffer        // Recently broadcast events, nil when replay is disabled
+	delivery          deliveryRate         // Messages forwarded over the last 15 minutes, for per-filter stats
+	paused            bool                 // Broadcasts skip the subscription while set; guarded by mu
+	connectTokens     map[string]time.Time // Expiry of each issued connect token by its SHA-256, nil until one is issued; guarded by mu
+	messagesSent      map[Connection]int   // Event messages queued to each connection when Options.MaxMessagesPerConnection is set; guarded by mu
+	lastPolledAt      time.Time            // When RecentEvents last read the filter, zero if never; guarded by mu
+	mu                sync.RWMutex
+}
+
+// ConnectionInfo describes a client connection attached to a subscription
+type ConnectionInfo struct {
+	ConnectedAt time.Time // When the connection subscribed to the filter
+	RemoteAddr  string    // Client address, empty if the transport doesn't expose one
+}
+
+// remoteAddresser is implemented by connections that know their client's address (*websocket.Conn does)
+type remoteAddresser interface {
+	RemoteAddr() net.Addr
+}
+
+// connectionRemoteAddr returns the client address of a connection, or "" if it is unknown
+func connectionRemoteAddr(conn Connection) string {
+	if addresser, ok := conn.(remoteAddresser); ok {
+		if addr := addresser.RemoteAddr(); addr != nil {
+			return addr.String()
+		}
+	}
+	return ""
+}
+
+// snapshot returns the API view of the subscription; the caller must hold sub.mu
+func (sub *Subscription) snapshot() models.FilterSubscription {
+	return models.FilterSubscription{
+		FilterKey:         sub.FilterKey,
+		Options:           sub.Options,
+		Repositories:      sub.Options.RepositoryList(),
+		CreatedAt:         sub.CreatedAt,
+		ExpiresAt:         sub.ExpiresAt,
+		Connections:       len(sub.Connections),
+		MessagesDelivered: sub.MessagesDelivered.Load(),
+		WebhookDisabled:   sub.webhook != nil && sub.webhook.isDisabled(),
+		Paused:            sub.paused,
+		RequiresToken:     sub.connectTokens != nil,
+		Label:             sub.Label,
+		Metadata:          sub.Metadata,
+	}
+}
+
+// expired reports whether the subscription's expiry has passed; the caller must hold sub.mu
+func (sub *Subscription) expired(now time.Time) bool {
+	return sub.ExpiresAt != nil && !now.Before(*sub.ExpiresAt)
+}
+
+// hasWebhook reports whether the subscription delivers to a webhook, including one disabled until
+// its next retry; the caller must hold sub.mu
+func (sub *Subscription) hasWebhook() bool {
+	return sub.webhook != nil
 }
 
 // NewManager creates a new subscription manager
@@ -51,9 +144,19 @@ func NewManager() *Manager {
 	m := &Manager{
 		subscriptions:   make(map[string]*Subscription),
 		maxConnections:  1000, // Default limit
+		connections:     make(map[Connection]map[string]bool),
+		writers:         make(map[Connection]*connectionWriter),
+		taps:            make(map[Connection]*tap),
+		replayBuffer:    DefaultReplayBufferSize,
+		publisher:       NoopPublisher{},
+		idempotencyKeys: make(map[scopedIdempotencyKey]idempotentCreate),
+		idempotencyTTL:  DefaultIdempotencyTTL,
+		connectTokenTTL: DefaultConnectTokenTTL,
+		requireKeyword:  true,
+		webhookClient:   newWebhookClient(false),
 		cleanupStop:     make(chan bool, 1),
 		keywordCounts:   make(map[string]int),
-		allSeenKeywords: make(map[string]bool),
+		keywordRates:    make(map[string]*keywordRate),
 		activityStop:    make(chan bool, 1),
 	}
 	m.startPeriodicCleanup()
@@ -66,9 +169,19 @@ func NewManagerWithConfig(maxConnections int) *Manager {
 	m := &Manager{
 		subscriptions:   make(map[string]*Subscription),
 		maxConnections:  maxConnections,
+		connections:     make(map[Connection]map[string]bool),
+		writers:         make(map[Connection]*connectionWriter),
+		taps:            make(map[Connection]*tap),
+		replayBuffer:    DefaultReplayBufferSize,
+		publisher:       NoopPublisher{},
+		idempotencyKeys: make(map[scopedIdempotencyKey]idempotentCreate),
+		idempotencyTTL:  DefaultIdempotencyTTL,
+		connectTokenTTL: DefaultConnectTokenTTL,
+		requireKeyword:  true,
+		webhookClient:   newWebhookClient(false),
 		cleanupStop:     make(chan bool, 1),
 		keywordCounts:   make(map[string]int),
-		allSeenKeywords: make(map[string]bool),
+		keywordRates:    make(map[string]*keywordRate),
 		activityStop:    make(chan bool, 1),
 	}
 	m.startPeriodicCleanup()
@@ -76,40 +189,234 @@ func NewManagerWithConfig(maxConnections int) *Manager {
 	return m
 }
 
-// CreateFilter creates a new filter subscription and returns a unique key
+// SetTextFields sets the record fields searched for keywords by filters that don't list their own.
+// An empty list restores models.DefaultTextFields. It must be called before events are broadcast.
+func (m *Manager) SetTextFields(fields []string) {
+	m.textFields = fields
+}
+
+// SetRequireKeyword sets whether every filter needs a keyword (the default). When it's off, a
+// filter may instead name repositories or collections, but one of the three is still required
+// so no filter forwards the entire firehose. It must be called before filters are created.
+func (m *Manager) SetRequireKeyword(require bool) {
+	m.requireKeyword = require
+}
+
+// SetWebhookAllowPrivateAddresses sets whether webhooks may post to loopback, private and other
+// non-public addresses, which are refused by default so filters can't reach internal services.
+// It must be called before filters are created.
+func (m *Manager) SetWebhookAllowPrivateAddresses(allow bool) {
+	m.webhookClient = newWebhookClient(allow)
+}
+
+// SetMaxConnections changes the connection limit at runtime. Lowering it below the current count
+// doesn't close anyone; new connections are refused until enough clients have left.
+func (m *Manager) SetMaxConnections(maxConnections int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxConnections = maxConnections
+}
+
+// SetReplayBufferSize sets how many recent events each subscription keeps for clients that
+// reconnect and ask for a replay; 0 disables replay. It must be called before filters are created.
+func (m *Manager) SetReplayBufferSize(size int) {
+	m.replayBuffer = size
+}
+
+// textFieldsFor returns the record fields searched for keywords under the given options
+func (m *Manager) textFieldsFor(options models.FilterOptions) []string {
+	if len(options.TextFields) > 0 {
+		return options.TextFields
+	}
+	if len(m.textFields) > 0 {
+		return m.textFields
+	}
+	return models.DefaultTextFields
+}
+
+// Reasons a filter can be rejected, used as the reason label of filters_rejected_total
+const (
+	FilterRejectedNoKeyword     = "no_keyword"     // No keyword given (or no repository or collection either, when keywords are optional)
+	FilterRejectedTooShort      = "too_short"      // A path prefix or keyword has fewer than 3 letters
+	FilterRejectedInvalidDID    = "invalid_did"    // A repository entry isn't a usable DID or handle
+	FilterRejectedInvalidOption = "invalid_option" // Any other invalid option
+)
+
+// FilterResult represents the result of trying to create a filter
+type FilterResult struct {
+	FilterKey    string
+	Success      bool
+	ErrorMessage string
+	Reason       string // One of the FilterRejected* constants when Success is false
+	Reused       bool   // The filter was created by an earlier request with the same idempotency key
+}
+
+// CreateFilter creates a new filter subscription and returns a unique key, or "" if the
+// options were rejected
 func (m *Manager) CreateFilter(options models.FilterOptions) string {
-	// Validate that keyword filter is always provided
-	if options.Keyword == "" {
-		log.Printf("❌ Rejected filter creation: keyword filter is required")
-		return "" // Return empty string to indicate failure
+	return m.CreateFilterWithResult(options).FilterKey
+}
+
+// CreateFilterWithResult creates a new filter subscription and returns its key, or why the
+// options were rejected. Rejections are logged and counted in filters_rejected_total
+func (m *Manager) CreateFilterWithResult(options models.FilterOptions) FilterResult {
+	keywordPatterns, reason, validationErr := m.prepareFilter(options)
+	if validationErr != "" {
+		return rejectFilter(reason, validationErr)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return FilterResult{FilterKey: m.addFilter(options, keywordPatterns), Success: true}
+}
+
+// CreateFilters creates a filter for each set of options, or none of them if any are invalid.
+// Results are in input order. When ok is false, the invalid entries carry their rejection
+// (logged and counted like CreateFilterWithResult) and nothing was created.
+func (m *Manager) CreateFilters(batch []models.FilterOptions) (results []FilterResult, ok bool) {
+	results = make([]FilterResult, len(batch))
+	patterns := make([][]*regexp.Regexp, len(batch))
+	ok = true
+	for i, options := range batch {
+		keywordPatterns, reason, validationErr := m.prepareFilter(options)
+		if validationErr != "" {
+			results[i] = rejectFilter(reason, validationErr)
+			ok = false
+			continue
+		}
+		patterns[i] = keywordPatterns
+	}
+	if !ok {
+		return results, false
+	}
+
+	// Everything is validated, so the whole batch is added under one lock
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, options := range batch {
+		results[i] = FilterResult{FilterKey: m.addFilter(options, patterns[i]), Success: true}
+	}
+	return results, true
+}
+
+// prepareFilter validates filter options and compiles their keyword patterns, returning the
+// rejection reason and message if the options are invalid
+func (m *Manager) prepareFilter(options models.FilterOptions) (keywordPatterns []*regexp.Regexp, reason, validationErr string) {
+	// Validate that the filter narrows the firehose
+	if reason, validationErr := m.checkRequiredCriteria(options); validationErr != "" {
+		return nil, reason, validationErr
 	}
 
 	// Validate filter content - each non-empty field must contain at least 3 letters
-	if validationErr := validateFilterContent(options); validationErr != "" {
-		log.Printf("❌ Rejected filter creation: %s", validationErr)
-		return "" // Return empty string to indicate failure
+	if reason, validationErr := ValidateFilterContent(options); validationErr != "" {
+		return nil, reason, validationErr
 	}
 
+	// Compile keyword patterns once so they aren't recompiled per event
+	if options.KeywordRegex {
+		patterns, err := CompileKeywordPatterns(options.Keyword, options.CaseSensitive)
+		if err != nil {
+			return nil, FilterRejectedInvalidOption, fmt.Sprintf("Keyword regex is invalid: %v", err)
+		}
+		keywordPatterns = patterns
+	}
+	return keywordPatterns, "", ""
+}
+
+// addFilter registers a subscription for validated options and returns its key.
+// The caller must hold m.mu.
+func (m *Manager) addFilter(options models.FilterOptions, keywordPatterns []*regexp.Regexp) string {
 	filterKey := generateFilterKey()
 	metriks.FiltersCreated.Inc()
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	sub := &Subscription{
+		FilterKey:       filterKey,
+		Options:         options,
+		CreatedAt:       time.Now(),
+		Connections:     make(map[Connection]ConnectionInfo),
+		keywordPatterns: keywordPatterns,
+		replay:          newReplayBuffer(m.replayBuffer),
+	}
+	if options.WebhookURL != "" {
+		sub.webhook = newWebhookSender(filterKey, options.WebhookURL, m.webhookClient, &sub.MessagesDelivered).start()
+	}
+	m.subscriptions[filterKey] = sub
+	m.index.add(sub)
+
+	slog.Info("Created filter",
+		"filter", filterKey[:8]+"...",
+		"repository", getFilterDisplayValue(options.Repository),
+		"pathPrefix", getFilterDisplayValue(options.PathPrefix),
+		"collections", getFilterDisplayValue(strings.Join(options.Collections, ",")),
+		"keyword", previewText(getFilterDisplayValue(options.Keyword), 0, keywordPreviewLength),
+		"keywordMatchMode", getKeywordMatchModeDisplayValue(options.KeywordMatchMode),
+		"actions", getFilterDisplayValue(strings.Join(options.Actions, ",")))
+
+	return filterKey
+}
+
+// rejectFilter logs and counts a rejected filter creation
+func rejectFilter(reason, message string) FilterResult {
+	metriks.FiltersRejected.WithLabelValues(reason).Inc()
+	slog.Warn("Rejected filter creation", "reason", reason, "error", message)
+	return FilterResult{
+		Success:      false,
+		ErrorMessage: message,
+		Reason:       reason,
+	}
+}
 
-	m.subscriptions[filterKey] = &Subscription{
-		FilterKey:   filterKey,
-		Options:     options,
-		CreatedAt:   time.Now(),
-		Connections: make(map[*websocket.Conn]bool),
+// EvaluateFilter reports whether an event would match the given options and which keywords hit,
+// without creating a subscription
+func (m *Manager) EvaluateFilter(options models.FilterOptions, event *models.ATEvent) (bool, []string, error) {
+	sub := &Subscription{Options: options}
+	if options.KeywordRegex {
+		patterns, err := CompileKeywordPatterns(options.Keyword, options.CaseSensitive)
+		if err != nil {
+			return false, nil, err
+		}
+		sub.keywordPatterns = patterns
 	}
 
-	log.Printf("📝 Created filter %s with options: Repository=%s, PathPrefix=%s, Keyword=%s",
-		filterKey[:8]+"...",
-		getFilterDisplayValue(options.Repository),
-		getFilterDisplayValue(options.PathPrefix),
-		getFilterDisplayValue(options.Keyword))
+	matched := m.matchesFilterWithPatterns(event, options, sub.keywordPatterns)
+	return matched, m.getSubscriptionMatchingKeywords(event, sub), nil
+}
+
+// SetFilterExpiry makes a filter expire at expiresAt, after which periodic cleanup removes it and
+// closes its connections whether or not clients are still connected
+func (m *Manager) SetFilterExpiry(filterKey string, expiresAt time.Time) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	return filterKey
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return ErrSubscriptionNotFound
+	}
+
+	sub.mu.Lock()
+	sub.ExpiresAt = &expiresAt
+	sub.mu.Unlock()
+	return nil
+}
+
+// SetFilterLabel attaches an informational label and metadata to a filter. They're returned
+// with the subscription and don't affect matching.
+func (m *Manager) SetFilterLabel(filterKey, label string, metadata map[string]string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return ErrSubscriptionNotFound
+	}
+
+	sub.mu.Lock()
+	sub.Label = label
+	sub.Metadata = maps.Clone(metadata)
+	sub.mu.Unlock()
+	return nil
 }
 
 // GetSubscription returns a specific subscription by filter key
@@ -125,12 +432,8 @@ func (m *Manager) GetSubscription(filterKey string) (*models.FilterSubscription,
 	sub.mu.RLock()
 	defer sub.mu.RUnlock()
 
-	return &models.FilterSubscription{
-		FilterKey:   sub.FilterKey,
-		Options:     sub.Options,
-		CreatedAt:   sub.CreatedAt,
-		Connections: len(sub.Connections),
-	}, true
+	snapshot := sub.snapshot()
+	return &snapshot, true
 }
 
 // GetSubscriptions returns all current filter subscriptions
@@ -141,228 +444,1264 @@ func (m *Manager) GetSubscriptions() []models.FilterSubscription {
 	var subs []models.FilterSubscription
 	for _, sub := range m.subscriptions {
 		sub.mu.RLock()
-		subs = append(subs, models.FilterSubscription{
-			FilterKey:   sub.FilterKey,
-			Options:     sub.Options,
-			CreatedAt:   sub.CreatedAt,
-			Connections: len(sub.Connections),
-		})
+		subs = append(subs, sub.snapshot())
 		sub.mu.RUnlock()
 	}
 	return subs
 }
 
-// ConnectionResult represents the result of trying to add a connection
-type ConnectionResult struct {
-	Success      bool
-	ErrorMessage string
-	ErrorCode    string
+// SubscriptionQuery selects a page of subscriptions for ListSubscriptions
+type SubscriptionQuery struct {
+	Keyword string // Only subscriptions whose keyword option contains this, case-insensitively
+	Offset  int    // Matching subscriptions to skip
+	Limit   int    // Maximum number of subscriptions returned, 0 for no limit
+	// HideTokenFilters leaves out filters that require a connect token, so listing them doesn't
+	// reveal their keys
+	HideTokenFilters bool
 }
 
-// AddConnection adds a WebSocket connection to a filter subscription
-func (m *Manager) AddConnection(filterKey string, conn *websocket.Conn) bool {
-	result := m.AddConnectionWithResult(filterKey, conn)
-	return result.Success
-}
+// ListSubscriptions returns a page of the subscriptions matching query, oldest first, and the
+// number of matching subscriptions across all pages
+func (m *Manager) ListSubscriptions(query SubscriptionQuery) ([]models.FilterSubscription, int) {
+	keyword := strings.ToLower(query.Keyword)
 
-// AddConnectionWithResult adds a WebSocket connection and returns detailed result
-func (m *Manager) AddConnectionWithResult(filterKey string, conn *websocket.Conn) ConnectionResult {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.mu.RLock()
+	subs := make([]models.FilterSubscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		sub.mu.RLock()
+		hidden := query.HideTokenFilters && sub.connectTokens != nil
+		if !hidden && (keyword == "" || strings.Contains(strings.ToLower(sub.Options.Keyword), keyword)) {
+			subs = append(subs, sub.snapshot())
+		}
+		sub.mu.RUnlock()
+	}
+	m.mu.RUnlock()
 
-	// Check if we've reached the maximum connection limit
-	if m.totalConnections >= m.maxConnections {
-		log.Printf("❌ Connection rejected: maximum connections (%d) reached", m.maxConnections)
-		return ConnectionResult{
-			Success:      false,
-			ErrorMessage: fmt.Sprintf("Maximum connections limit reached (%d/%d)", m.totalConnections, m.maxConnections),
-			ErrorCode:    "MAX_CONNECTIONS_REACHED",
+	// Map order is random, so sort to keep pages stable between requests
+	sort.Slice(subs, func(i, j int) bool {
+		if !subs[i].CreatedAt.Equal(subs[j].CreatedAt) {
+			return subs[i].CreatedAt.Before(subs[j].CreatedAt)
 		}
+		return subs[i].FilterKey < subs[j].FilterKey
+	})
+
+	total := len(subs)
+	start := min(max(query.Offset, 0), total)
+	end := total
+	if query.Limit > 0 {
+		end = min(start+query.Limit, total)
 	}
+	return subs[start:end], total
+}
+
+// GetConnections returns the connections attached to a subscription, oldest first
+func (m *Manager) GetConnections(filterKey string) ([]models.ConnectionDetails, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
 	sub, exists := m.subscriptions[filterKey]
 	if !exists {
-		log.Printf("❌ Attempted to connect to non-existent filter: %s", filterKey[:8]+"...")
-		return ConnectionResult{
-			Success:      false,
-			ErrorMessage: "Invalid filter key",
-			ErrorCode:    "INVALID_FILTER_KEY",
-		}
+		return nil, false
+	}
+
+	sub.mu.RLock()
+	connections := make([]models.ConnectionDetails, 0, len(sub.Connections))
+	for _, info := range sub.Connections {
+		connections = append(connections, models.ConnectionDetails{
+			RemoteAddr:  info.RemoteAddr,
+			ConnectedAt: info.ConnectedAt,
+		})
+	}
+	sub.mu.RUnlock()
+
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+	return connections, true
+}
+
+// GetSubscriptionStats returns a filter's delivery totals and its rolling 1, 5 and 15 minute
+// forwarding rates, and whether the filter exists
+func (m *Manager) GetSubscriptionStats(filterKey string) (models.SubscriptionStats, bool) {
+	m.mu.RLock()
+	sub, exists := m.subscriptions[filterKey]
+	m.mu.RUnlock()
+	if !exists {
+		return models.SubscriptionStats{}, false
 	}
 
-	sub.mu.Lock()
-	sub.Connections[conn] = true
 	now := time.Now()
-	sub.LastConnectionAt = &now
-	connectionCount := len(sub.Connections)
-	sub.mu.Unlock()
+	stats := models.SubscriptionStats{
+		FilterKey:         filterKey,
+		MessagesDelivered: sub.MessagesDelivered.Load(),
+		Rate1m:            sub.delivery.perSecond(now, time.Minute),
+		Rate5m:            sub.delivery.perSecond(now, 5*time.Minute),
+		Rate15m:           sub.delivery.perSecond(now, 15*time.Minute),
+	}
+	if last := sub.delivery.lastAt(); !last.IsZero() {
+		stats.LastDeliveredAt = &last
+	}
+	sub.mu.RLock()
+	stats.Connections = len(sub.Connections)
+	sub.mu.RUnlock()
+	return stats, true
+}
 
-	m.totalConnections++
-	metriks.WebsocketConnections.Set(float64(m.totalConnections))
+// GetKeywordUsage returns every keyword term configured across subscriptions with the number
+// of filters using it, most popular first (ties sorted alphabetically). Plain keywords are
+// lowercased since matching ignores case; regex patterns are reported as written.
+func (m *Manager) GetKeywordUsage() []models.KeywordUsage {
+	m.mu.RLock()
+	counts := make(map[string]int)
+	for _, sub := range m.subscriptions {
+		sub.mu.RLock()
+		options := sub.Options
+		sub.mu.RUnlock()
 
-	log.Printf("🔌 Added connection to filter %s (filter connections: %d, total connections: %d/%d)",
-		filterKey[:8]+"...", connectionCount, m.totalConnections, m.maxConnections)
+		// Count each term once per filter, even if it's repeated in the keyword list
+		seen := make(map[string]bool)
+		for _, keyword := range strings.Split(options.Keyword, ",") {
+			keyword = strings.TrimSpace(keyword)
+			if !options.KeywordRegex && !options.CaseSensitive {
+				keyword = strings.ToLower(keyword)
+			}
+			if keyword == "" || seen[keyword] {
+				continue
+			}
+			seen[keyword] = true
+			counts[keyword]++
+		}
+	}
+	m.mu.RUnlock()
 
-	return ConnectionResult{
-		Success: true,
+	usage := make([]models.KeywordUsage, 0, len(counts))
+	for keyword, filters := range counts {
+		usage = append(usage, models.KeywordUsage{Keyword: keyword, Filters: filters})
 	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Filters != usage[j].Filters {
+			return usage[i].Filters > usage[j].Filters
+		}
+		return usage[i].Keyword < usage[j].Keyword
+	})
+	return usage
 }
 
-// RemoveConnection removes a WebSocket connection from a filter subscription
-func (m *Manager) RemoveConnection(filterKey string, conn *websocket.Conn) {
+// ErrSubscriptionNotFound is returned when a filter key doesn't match any subscription
+var ErrSubscriptionNotFound = errors.New("filter subscription not found")
+
+// ErrNotSubscribed is returned when a connection asks to replay or change a filter it isn't subscribed to
+var ErrNotSubscribed = errors.New("connection is not subscribed to the filter")
+
+// ErrFilterExpired is returned when a connection would be attached to, or options set on, a
+// filter past its expiry
+var ErrFilterExpired = errors.New("filter has expired")
+
+// ErrWebhookOverConnection is returned when a connection asks for a webhook. Webhooks make the
+// server send requests on the filter's behalf, so they can only be set through the REST API.
+var ErrWebhookOverConnection = errors.New("webhookUrl can't be set over a connection, use /api/filters/create")
+
+// UpdateSubscriptionOptions validates and swaps the filter options of an existing subscription,
+// keeping its connections, and notifies connected clients with a filter_updated message.
+// Filters past their expiry are refused with ErrFilterExpired.
+func (m *Manager) UpdateSubscriptionOptions(filterKey string, options models.FilterOptions) (*models.FilterSubscription, error) {
+	keywordPatterns, _, validationErr := m.prepareFilter(options)
+	if validationErr != "" {
+		return nil, errors.New(validationErr)
+	}
+
+	// Hold the manager lock so no broadcast sees (or writes alongside) a half-updated subscription
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	sub, exists := m.subscriptions[filterKey]
 	if !exists {
-		return
+		return nil, ErrSubscriptionNotFound
 	}
 
 	sub.mu.Lock()
-	_, wasConnected := sub.Connections[conn]
-	if wasConnected {
-		delete(sub.Connections, conn)
-		m.totalConnections--
-		metriks.WebsocketConnections.Set(float64(m.totalConnections))
+	if sub.expired(time.Now()) {
+		sub.mu.Unlock()
+		return nil, ErrFilterExpired
+	}
+	m.index.remove(sub)
+	sub.setOptions(options, keywordPatterns, m.webhookClient)
+	m.index.add(sub)
+	snapshot := sub.snapshot()
+	updated := &snapshot
+	connections := make([]Connection, 0, len(sub.Connections))
+	for conn := range sub.Connections {
+		connections = append(connections, conn)
 	}
-	connectionCount := len(sub.Connections)
 	sub.mu.Unlock()
 
-	if wasConnected {
-		log.Printf("🔌 Removed connection from filter %s (filter connections: %d, total connections: %d/%d)",
-			filterKey[:8]+"...", connectionCount, m.totalConnections, m.maxConnections)
+	message := models.WSMessage{
+		Type:      "filter_updated",
+		Timestamp: time.Now(),
+		Data:      updated,
+	}
 
-		// Clean up filter subscription if no connections remain
-		if connectionCount == 0 {
-			delete(m.subscriptions, filterKey)
-			metriks.FiltersDeleted.Inc()
-			log.Printf("🗑️  Cleaned up filter %s (no connections remaining)", filterKey[:8]+"...")
+	for _, conn := range connections {
+		if writer := m.writers[conn]; writer != nil && !writer.enqueue(message, nil) {
+			slog.Warn("Outbound queue full, dropped filter update notice", "filter", filterKey[:8]+"...")
 		}
 	}
-}
 
-// BroadcastEvent sends an event to all matching filter subscriptions
-func (m *Manager) BroadcastEvent(event *models.ATEvent) {
-	receivedAt := time.Now() // Track when we received this event
+	slog.Info("Updated filter",
+		"filter", filterKey[:8]+"...",
+		"repository", getFilterDisplayValue(options.Repository),
+		"pathPrefix", getFilterDisplayValue(options.PathPrefix),
+		"keyword", previewText(getFilterDisplayValue(options.Keyword), 0, keywordPreviewLength),
+		"notifiedConnections", len(connections))
 
+	return updated, nil
+}
+
+// SetSubscriptionPaused pauses or resumes event delivery to a subscription. Its connections stay
+// open and get a paused or resumed message when the state changes; while paused, matching events
+// aren't sent to its connections or webhook, nor buffered for replay.
+func (m *Manager) SetSubscriptionPaused(filterKey string, paused bool) (*models.FilterSubscription, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	matchCount := 0
-	for _, sub := range m.subscriptions {
-		if m.matchesFilter(event, sub.Options) {
-			m.broadcastToSubscription(sub, event, receivedAt)
-			matchCount++
-
-			// Track metrics for keywords that actually matched
-			if matchingKeywords := m.getMatchingKeywords(event, sub.Options.Keyword); len(matchingKeywords) > 0 {
-				for _, keyword := range matchingKeywords {
-					// Keep the counter for total tracking
-					metriks.MessagesSent.WithLabelValues(keyword).Inc()
-
-					// Increment current activity count for this keyword
-					m.incrementKeywordActivity(keyword)
-				}
-			}
-		}
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return nil, ErrSubscriptionNotFound
 	}
 
-	if matchCount > 0 {
-		didPreview := event.Did
-		if len(didPreview) > 20 {
-			didPreview = didPreview[:20] + "..."
-		}
-		log.Printf("📡 Broadcasted event to %d matching filter(s) (did: %s)", matchCount, didPreview)
+	sub.mu.Lock()
+	changed := sub.paused != paused
+	sub.paused = paused
+	snapshot := sub.snapshot()
+	connections := make([]Connection, 0, len(sub.Connections))
+	for conn := range sub.Connections {
+		connections = append(connections, conn)
 	}
-}
+	sub.mu.Unlock()
 
-// matchesFilter checks if an event matches the filter criteria
-func (m *Manager) matchesFilter(event *models.ATEvent, options models.FilterOptions) bool {
-	// Safety check: if no filter criteria are set, reject all events
-	// This prevents accidentally forwarding the entire firehose
-	if options.Repository == "" && options.PathPrefix == "" && options.Keyword == "" {
-		log.Printf("⚠️  Blocking event for filter with no criteria (safety check)")
-		return false
+	if !changed {
+		return &snapshot, nil
 	}
 
-	// Repository filter (exact match on DID)
-	if options.Repository != "" && event.Did != options.Repository {
-		return false
+	messageType := "resumed"
+	if paused {
+		messageType = "paused"
 	}
-
-	// Path prefix filter
-	if options.PathPrefix != "" {
-		hasMatchingPath := false
-		for _, op := range event.Ops {
-			if strings.HasPrefix(op.Path, options.PathPrefix) {
-				hasMatchingPath = true
-				break
-			}
-		}
-		if !hasMatchingPath {
-			return false
+	message := models.WSMessage{
+		Type:      messageType,
+		Timestamp: time.Now(),
+		Data:      map[string]interface{}{"filterKey": filterKey},
+	}
+	for _, conn := range connections {
+		if writer := m.writers[conn]; writer != nil && !writer.enqueue(message, nil) {
+			slog.Warn("Outbound queue full, dropped pause notice", "filter", filterKey[:8]+"...", "paused", paused)
 		}
 	}
 
-	// Keyword filter - check in record content
-	if options.Keyword != "" {
-		hasMatchingKeyword := false
-		for _, op := range event.Ops {
-			if m.recordContainsKeywords(op.Record, options.Keyword) {
-				hasMatchingKeyword = true
-				break
-			}
+	slog.Info("Filter pause state changed", "filter", filterKey[:8]+"...", "paused", paused, "notifiedConnections", len(connections))
+	return &snapshot, nil
+}
+
+// setOptions swaps the subscription's options and compiled keyword patterns, restarting webhook
+// delivery with webhookClient when the URL changes. The caller must hold sub.mu.
+func (sub *Subscription) setOptions(options models.FilterOptions, keywordPatterns []*regexp.Regexp, webhookClient *http.Client) {
+	if options.WebhookURL != sub.Options.WebhookURL {
+		if sub.webhook != nil {
+			sub.webhook.stop()
+			sub.webhook = nil
 		}
-		if !hasMatchingKeyword {
-			return false
+		if options.WebhookURL != "" {
+			sub.webhook = newWebhookSender(sub.FilterKey, options.WebhookURL, webhookClient, &sub.MessagesDelivered).start()
 		}
 	}
-
-	return true
+	sub.Options = options
+	sub.keywordPatterns = keywordPatterns
 }
 
-// recordContainsKeywords checks if a record contains any of the specified keywords (comma-separated)
-func (m *Manager) recordContainsKeywords(record interface{}, keywords string) bool {
-	if record == nil || keywords == "" {
-		return false
+// SetConnectionFilter replaces the options a connection receives events for on one of its
+// filters. A filter the connection has to itself is updated in place; a filter shared with
+// other connections or a webhook is left alone and the connection moves to a new filter with
+// the options instead. It returns the connection's filter, whose key may differ from filterKey.
+// Options naming a webhook are refused with ErrWebhookOverConnection.
+func (m *Manager) SetConnectionFilter(filterKey string, conn Connection, options models.FilterOptions) (*models.FilterSubscription, error) {
+	if options.WebhookURL != "" {
+		return nil, ErrWebhookOverConnection
 	}
-
-	// Convert record to JSON and parse text fields
-	recordBytes, err := json.Marshal(record)
-	if err != nil {
-		return false
+	keywordPatterns, _, validationErr := m.prepareFilter(options)
+	if validationErr != "" {
+		return nil, errors.New(validationErr)
 	}
 
-	var recordContent models.RecordContent
-	if err := json.Unmarshal(recordBytes, &recordContent); err != nil {
-		return false
-	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Check various text fields
-	text := recordContent.Text
-	if text == "" {
-		text = recordContent.Message
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	sub.mu.Lock()
+	_, attached := sub.Connections[conn]
+	// A webhook configured through the API stays put even while disabled
+	exclusive := len(sub.Connections) == 1 && sub.Options.WebhookURL == ""
+	if attached && sub.expired(time.Now()) {
+		sub.mu.Unlock()
+		return nil, ErrFilterExpired
+	}
+	if attached && exclusive {
+		m.index.remove(sub)
+		sub.setOptions(options, keywordPatterns, m.webhookClient)
+		m.index.add(sub)
+		snapshot := sub.snapshot()
+		sub.mu.Unlock()
+
+		slog.Info("Updated filter for connection",
+			"filter", filterKey[:8]+"...",
+			"keyword", previewText(getFilterDisplayValue(options.Keyword), 0, keywordPreviewLength))
+		return &snapshot, nil
+	}
+	sub.mu.Unlock()
+	if !attached {
+		return nil, ErrNotSubscribed
+	}
+
+	// The connection is already registered, so moving it doesn't count against the limit
+	newKey := m.addFilter(options, keywordPatterns)
+	moved := m.subscriptions[newKey]
+	moved.mu.Lock()
+	now := time.Now()
+	moved.Connections[conn] = ConnectionInfo{ConnectedAt: now, RemoteAddr: connectionRemoteAddr(conn)}
+	moved.LastConnectionAt = &now
+	snapshot := moved.snapshot()
+	moved.mu.Unlock()
+	m.connections[conn][newKey] = true
+	m.detachConnection(filterKey, conn)
+
+	slog.Info("Moved connection to new filter",
+		"from", filterKey[:8]+"...",
+		"to", newKey[:8]+"...")
+	return &snapshot, nil
+}
+
+// DeleteFilter removes a filter subscription, closing the connections that were subscribed
+// to nothing else; connections still subscribed to other filters stay open.
+// It returns the number of closed connections and whether the filter existed.
+func (m *Manager) DeleteFilter(filterKey string) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return 0, false
+	}
+
+	sub.mu.Lock()
+	closedConnections := 0
+	for conn := range sub.Connections {
+		filters := m.connections[conn]
+		delete(filters, filterKey)
+		if len(filters) > 0 {
+			continue
+		}
+		m.forgetConnection(conn)
+		if err := conn.Close(); err != nil {
+			slog.Warn("Error closing connection", "error", err)
+		}
+		closedConnections++
+	}
+	sub.Connections = make(map[Connection]ConnectionInfo)
+	sub.mu.Unlock()
+
+	m.removeSubscription(filterKey)
+	metriks.WebsocketConnections.Set(float64(len(m.connections)))
+
+	slog.Info("Deleted filter",
+		"filter", filterKey[:8]+"...",
+		"closedConnections", closedConnections,
+		"totalConnections", len(m.connections),
+		"maxConnections", m.maxConnections)
+
+	return closedConnections, true
+}
+
+// removeSubscription deletes a subscription, stops its webhook and drops its per-filter metrics.
+// The caller must hold m.mu.
+func (m *Manager) removeSubscription(filterKey string) {
+	if sub, exists := m.subscriptions[filterKey]; exists {
+		sub.mu.Lock()
+		if sub.webhook != nil {
+			sub.webhook.stop()
+		}
+		sub.mu.Unlock()
+		m.index.remove(sub)
+	}
+
+	delete(m.subscriptions, filterKey)
+	metriks.FiltersDeleted.Inc()
+	metriks.DeliveryLatency.DeleteLabelValues(filterKey)
+	metriks.WebhookFailures.DeleteLabelValues(filterKey)
+	metriks.SampledOutEvents.DeleteLabelValues(filterKey)
+}
+
+// ConnectionResult represents the result of trying to add a connection
+type ConnectionResult struct {
+	Success      bool
+	ErrorMessage string
+	ErrorCode    string
+}
+
+// AddConnection adds a WebSocket connection to a filter subscription
+func (m *Manager) AddConnection(filterKey string, conn Connection) bool {
+	result := m.AddConnectionWithResult(filterKey, conn)
+	return result.Success
+}
+
+// AddConnectionWithResult adds a WebSocket connection and returns detailed result.
+// A connection may be added to several filters; it only counts once against the connection limit.
+func (m *Manager) AddConnectionWithResult(filterKey string, conn Connection) ConnectionResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Check if we've reached the maximum connection limit (new connections only)
+	filters, known := m.connections[conn]
+	if !known && len(m.connections) >= m.maxConnections {
+		slog.Warn("Connection rejected: maximum connections reached", "maxConnections", m.maxConnections)
+		return ConnectionResult{
+			Success:      false,
+			ErrorMessage: fmt.Sprintf("Maximum connections limit reached (%d/%d)", len(m.connections), m.maxConnections),
+			ErrorCode:    "MAX_CONNECTIONS_REACHED",
+		}
+	}
+
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		// The key comes straight from the request path, so it may be shorter than a real one
+		slog.Warn("Attempted to connect to non-existent filter", "filter", previewText(filterKey, 0, 8))
+		return ConnectionResult{
+			Success:      false,
+			ErrorMessage: "Invalid filter key",
+			ErrorCode:    "INVALID_FILTER_KEY",
+		}
+	}
+
+	sub.mu.Lock()
+	now := time.Now()
+	if sub.expired(now) {
+		sub.mu.Unlock()
+		return ConnectionResult{
+			Success:      false,
+			ErrorMessage: "Filter has expired",
+			ErrorCode:    "FILTER_EXPIRED",
+		}
+	}
+	if _, attached := sub.Connections[conn]; !attached {
+		sub.Connections[conn] = ConnectionInfo{ConnectedAt: now, RemoteAddr: connectionRemoteAddr(conn)}
+	}
+	sub.LastConnectionAt = &now
+	connectionCount := len(sub.Connections)
+	sub.mu.Unlock()
+
+	if !known {
+		filters = make(map[string]bool)
+		m.connections[conn] = filters
+		m.writers[conn] = newConnectionWriter(conn, m.handleWriteError).start()
+	}
+	filters[filterKey] = true
+	metriks.WebsocketConnections.Set(float64(len(m.connections)))
+
+	slog.Info("Added connection to filter",
+		"filter", filterKey[:8]+"...",
+		"filterConnections", connectionCount,
+		"totalConnections", len(m.connections),
+		"maxConnections", m.maxConnections)
+
+	return ConnectionResult{
+		Success: true,
+	}
+}
+
+// RemoveConnection removes a connection from a filter subscription. Once the connection
+// is subscribed to no filters it no longer counts against the connection limit.
+func (m *Manager) RemoveConnection(filterKey string, conn Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.detachConnection(filterKey, conn) && len(m.connections[conn]) == 0 {
+		m.forgetConnection(conn)
+		metriks.WebsocketConnections.Set(float64(len(m.connections)))
+	}
+}
+
+// UnsubscribeConnection removes a connection from one filter subscription but keeps it
+// registered (and counted against the connection limit) until DropConnection is called,
+// even when it is left with no filters. It reports whether the connection was subscribed.
+func (m *Manager) UnsubscribeConnection(filterKey string, conn Connection) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.detachConnection(filterKey, conn)
+}
+
+// DropConnection removes a connection from every filter subscription it belongs to,
+// e.g. when the client disconnects
+func (m *Manager) DropConnection(conn Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropConnection(conn)
+}
+
+// dropConnection removes a connection from all of its filters; the caller must hold m.mu
+func (m *Manager) dropConnection(conn Connection) {
+	filters, known := m.connections[conn]
+	if !known {
+		return
+	}
+
+	for filterKey := range filters {
+		m.detachConnection(filterKey, conn)
+	}
+	m.forgetConnection(conn)
+	metriks.WebsocketConnections.Set(float64(len(m.connections)))
+}
+
+// forgetConnection deregisters a connection and stops its writer; the caller must hold m.mu
+func (m *Manager) forgetConnection(conn Connection) {
+	delete(m.connections, conn)
+	if writer, ok := m.writers[conn]; ok {
+		writer.stop()
+		delete(m.writers, conn)
+	}
+}
+
+// handleWriteError is called by a connection's writer when a write fails; the connection is
+// closed and removed from all of its filters
+func (m *Manager) handleWriteError(conn Connection) {
+	m.removeDeadConnections([]Connection{conn})
+}
+
+// detachConnection removes a connection from a single filter subscription, cleaning up the
+// filter when no connections remain. Filters with a webhook, or a replay buffer a reconnecting
+// client may still ask for, are left to the periodic cleanup instead. It reports whether the
+// connection was subscribed. The caller must hold m.mu.
+func (m *Manager) detachConnection(filterKey string, conn Connection) bool {
+	if filters, known := m.connections[conn]; known {
+		delete(filters, filterKey)
+	}
+
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return false
+	}
+
+	sub.mu.Lock()
+	_, wasConnected := sub.Connections[conn]
+	if wasConnected {
+		delete(sub.Connections, conn)
+	}
+	delete(sub.messagesSent, conn)
+	connectionCount := len(sub.Connections)
+	keepForWebhook := sub.hasWebhook()
+	keepForReplay := sub.replay != nil
+	if wasConnected && connectionCount == 0 {
+		// The cleanup grace period runs from when the last connection left
+		now := time.Now()
+		sub.LastConnectionAt = &now
+	}
+	sub.mu.Unlock()
+
+	if wasConnected {
+		slog.Info("Removed connection from filter",
+			"filter", filterKey[:8]+"...",
+			"filterConnections", connectionCount,
+			"totalConnections", len(m.connections),
+			"maxConnections", m.maxConnections)
+
+		// Clean up filter subscription if no connections remain (webhook and replay filters live on)
+		if connectionCount == 0 && !keepForWebhook && !keepForReplay {
+			m.removeSubscription(filterKey)
+			slog.Info("Cleaned up filter with no connections remaining", "filter", filterKey[:8]+"...")
+		}
+	}
+	return wasConnected
+}
+
+// BroadcastEvent sends an event to all matching filter subscriptions
+func (m *Manager) BroadcastEvent(event *models.ATEvent) {
+	receivedAt := time.Now() // Track when we received this event
+
+	m.mu.RLock()
+
+	// A connection subscribed to several matching filters receives the event only once
+	delivered := make(map[Connection]bool)
+
+	matchCount := 0
+	for _, sub := range m.index.candidates(event) {
+		// Expired filters stop forwarding right away instead of at the next cleanup
+		sub.mu.RLock()
+		expired := sub.expired(receivedAt)
+		sub.mu.RUnlock()
+		if expired {
+			continue
+		}
+
+		if m.matchesFilterWithPatterns(event, sub.Options, sub.keywordPatterns) {
+			// Only forward the ops whose action the subscriber asked for
+			forwardEvent := filterEventOpsByAction(event, sub.Options)
+			if sub.Options.StripNonMatchingOps {
+				forwardEvent = m.filterEventOpsByMatch(forwardEvent, sub.Options, sub.keywordPatterns)
+			}
+			matchingKeywords := m.getSubscriptionMatchingKeywords(forwardEvent, sub)
+			m.broadcastToSubscription(sub, forwardEvent, receivedAt, matchingKeywords, delivered)
+			matchCount++
+
+			// Track metrics for keywords that actually matched
+			if len(matchingKeywords) > 0 {
+				for _, keyword := range matchingKeywords {
+					// Keep the counter for total tracking
+					metriks.MessagesSent.WithLabelValues(keyword).Inc()
+
+					// Increment current activity count for this keyword
+					m.incrementKeywordActivity(keyword, receivedAt)
+				}
+			}
+		}
+	}
+
+	m.broadcastToTaps(event, receivedAt)
+	m.mu.RUnlock()
+
+	if matchCount > 0 {
+		slog.Debug("Broadcasted event", "matchingFilters", matchCount, "did", previewText(event.Did, 0, 20))
+	}
+}
+
+// removeDeadConnections closes connections that failed a write and removes them from all of their filters
+func (m *Manager) removeDeadConnections(deadConnections []Connection) {
+	m.mu.Lock()
+	for _, conn := range deadConnections {
+		m.dropConnection(conn)
+		if err := conn.Close(); err != nil {
+			slog.Warn("Failed to close dead connection", "error", err)
+		}
+	}
+	totalConnections := len(m.connections)
+	maxConnections := m.maxConnections
+	m.mu.Unlock()
+
+	slog.Info("Cleaned up dead connections",
+		"deadConnections", len(deadConnections),
+		"totalConnections", totalConnections,
+		"maxConnections", maxConnections)
+}
+
+// matchesFilter checks if an event matches the filter criteria
+func (m *Manager) matchesFilter(event *models.ATEvent, options models.FilterOptions) bool {
+	var patterns []*regexp.Regexp
+	if options.KeywordRegex {
+		compiled, err := CompileKeywordPatterns(options.Keyword, options.CaseSensitive)
+		if err != nil {
+			return false
+		}
+		patterns = compiled
+	}
+	return m.matchesFilterWithPatterns(event, options, patterns)
+}
+
+// matchesFilterWithPatterns checks if an event matches the filter criteria using precompiled keyword patterns
+func (m *Manager) matchesFilterWithPatterns(event *models.ATEvent, options models.FilterOptions, patterns []*regexp.Regexp) bool {
+	// Safety check: if no filter criteria are set, reject all events
+	// This prevents accidentally forwarding the entire firehose
+	if options.Repository == "" && options.RepositoryPrefix == "" && len(options.Collections) == 0 && options.PathPrefix == "" && options.Keyword == "" {
+		slog.Warn("Blocking event for filter with no criteria (safety check)")
+		return false
+	}
+
+	// Repository filter (exact match on any of the configured DIDs)
+	if !options.MatchesRepository(event.Did) {
+		return false
+	}
+
+	// Repository prefix filter (e.g. every did:web account on one domain)
+	if !options.MatchesRepositoryPrefix(event.Did) {
+		return false
+	}
+
+	// Event kind filter (empty means commits only)
+	if !options.AllowsEventKind(event.Kind) {
+		return false
+	}
+
+	// Non-commit events (identity, account) carry no ops, so only the repository filter applies
+	if event.Kind != "" && event.Kind != models.EventKindCommit {
+		return true
+	}
+
+	// Action filter (empty means all actions)
+	if len(options.Actions) > 0 {
+		hasMatchingAction := false
+		for _, op := range event.Ops {
+			if options.AllowsAction(op.Action) {
+				hasMatchingAction = true
+				break
+			}
+		}
+		if !hasMatchingAction {
+			return false
+		}
+	}
+
+	// Path prefix filter
+	if options.PathPrefix != "" {
+		hasMatchingPath := false
+		for _, op := range event.Ops {
+			if options.MatchesPath(op.Path) {
+				hasMatchingPath = true
+				break
+			}
+		}
+		if !hasMatchingPath {
+			return false
+		}
+	}
+
+	// Collection filter (exact match on the collection NSID)
+	if len(options.Collections) > 0 {
+		hasMatchingCollection := false
+		for _, op := range event.Ops {
+			if options.MatchesCollection(operationCollection(op)) {
+				hasMatchingCollection = true
+				break
+			}
+		}
+		if !hasMatchingCollection {
+			return false
+		}
+	}
+
+	// Deleted records have no content to check, so in filters following specific repositories a
+	// commit whose forwarded ops are all deletes matches on repository, action, path and
+	// collection alone. Creates and updates alongside them still need matching content.
+	if options.Repository != "" && forwardsOnlyDeletes(event, options) && hasMatchingDelete(event, options) {
+		return true
+	}
+
+	// Language filter - at least one record must be tagged with a selected language
+	if len(options.Langs) > 0 {
+		hasMatchingLang := false
+		for _, op := range event.Ops {
+			if options.MatchesLangs(recordLangs(op.Record)) {
+				hasMatchingLang = true
+				break
+			}
+		}
+		if !hasMatchingLang {
+			return false
+		}
+	}
+
+	// Embed type filter - at least one record must carry a selected embed (e.g. images)
+	if len(options.EmbedTypes) > 0 {
+		hasMatchingEmbed := false
+		for _, op := range event.Ops {
+			if options.MatchesEmbedTypes(recordEmbedTypes(op.Record)) {
+				hasMatchingEmbed = true
+				break
+			}
+		}
+		if !hasMatchingEmbed {
+			return false
+		}
+	}
+
+	// Thread filter - at least one op must be the thread's root post or a reply in the thread
+	if options.ReplyRootURI != "" {
+		hasMatchingThread := false
+		for _, op := range event.Ops {
+			if op.RecordURI(event.Did) == options.ReplyRootURI || recordReplyRoot(op.Record) == options.ReplyRootURI {
+				hasMatchingThread = true
+				break
+			}
+		}
+		if !hasMatchingThread {
+			return false
+		}
+	}
+
+	// Post type filter - at least one op must be a post of the selected kind
+	if options.PostType != "" {
+		hasMatchingPostType := false
+		for _, op := range event.Ops {
+			if recordPostType(op) == options.PostType {
+				hasMatchingPostType = true
+				break
+			}
+		}
+		if !hasMatchingPostType {
+			return false
+		}
+	}
+
+	// Text length filter - at least one record's text must fall within the bounds
+	if options.HasTextLengthBounds() {
+		hasMatchingLength := false
+		for _, op := range event.Ops {
+			if options.MatchesTextLength(extractRecordText(op.Record, m.textFieldsFor(options))) {
+				hasMatchingLength = true
+				break
+			}
+		}
+		if !hasMatchingLength {
+			return false
+		}
+	}
+
+	// Facet count filter - at least one record must carry enough links and mentions
+	if options.HasFacetCountBounds() {
+		hasMatchingFacets := false
+		for _, op := range event.Ops {
+			if options.MatchesFacetCounts(recordFacetCounts(op.Record)) {
+				hasMatchingFacets = true
+				break
+			}
+		}
+		if !hasMatchingFacets {
+			return false
+		}
+	}
+
+	// Creation time filter - at least one record must have been created within the bounds
+	if options.HasCreatedAtBounds() {
+		hasMatchingTime := false
+		for _, op := range event.Ops {
+			if options.MatchesCreatedAt(recordCreatedAt(op.Record)) {
+				hasMatchingTime = true
+				break
+			}
+		}
+		if !hasMatchingTime {
+			return false
+		}
 	}
-	if text == "" {
-		text = recordContent.Content
+
+	// Keyword filter - check in record content
+	if options.Keyword != "" {
+		hasMatchingKeyword := false
+		for _, op := range event.Ops {
+			if options.KeywordRegex {
+				if recordMatchesPatterns(op.Record, patterns, options.KeywordMatchMode, options.DeepTextSearch, m.textFieldsFor(options)) {
+					hasMatchingKeyword = true
+					break
+				}
+			} else if m.recordMatchesKeywords(op.Record, options.Keyword, options) {
+				hasMatchingKeyword = true
+				break
+			}
+		}
+		if !hasMatchingKeyword {
+			return false
+		}
 	}
 
-	if text == "" {
+	return true
+}
+
+// filterEventOpsByAction returns the event with only the ops whose action passes the filter.
+// The original event is returned unchanged when no action filter is set.
+func filterEventOpsByAction(event *models.ATEvent, options models.FilterOptions) *models.ATEvent {
+	if len(options.Actions) == 0 {
+		return event
+	}
+
+	filtered := *event
+	filtered.Ops = make([]models.ATOperation, 0, len(event.Ops))
+	for _, op := range event.Ops {
+		if options.AllowsAction(op.Action) {
+			filtered.Ops = append(filtered.Ops, op)
+		}
+	}
+	return &filtered
+}
+
+// filterEventOpsByMatch returns the event with only the ops that match the filter on their own,
+// so a commit matched by one op doesn't carry the unrelated ones along
+func (m *Manager) filterEventOpsByMatch(event *models.ATEvent, options models.FilterOptions, patterns []*regexp.Regexp) *models.ATEvent {
+	if len(event.Ops) <= 1 {
+		return event
+	}
+
+	filtered := *event
+	filtered.Ops = make([]models.ATOperation, 0, len(event.Ops))
+	single := *event
+	for _, op := range event.Ops {
+		single.Ops = []models.ATOperation{op}
+		if m.matchesFilterWithPatterns(&single, options, patterns) {
+			filtered.Ops = append(filtered.Ops, op)
+		}
+	}
+	return &filtered
+}
+
+// recordContainsKeywords checks if a record contains any of the specified keywords (comma-separated)
+func (m *Manager) recordContainsKeywords(record interface{}, keywords string) bool {
+	return m.recordMatchesKeywords(record, keywords, models.FilterOptions{})
+}
+
+// recordMatchesKeywords checks a record's text fields against comma-separated keywords using the options' match mode.
+// In "all" mode every keyword must be present; any other mode matches if at least one keyword is present.
+// DeepTextSearch also searches embedded and facet text, and the match type decides whether a keyword
+// may be part of a word, must be a whole word or must be a field's entire text.
+func (m *Manager) recordMatchesKeywords(record interface{}, keywords string, options models.FilterOptions) bool {
+	if record == nil || keywords == "" {
+		return false
+	}
+
+	// Substring and word matches search the fields joined; exact-text compares each field on its own
+	var texts []string
+	if options.EffectiveMatchType() == models.MatchTypeExactText {
+		texts = recordFieldText(record, m.textFieldsFor(options))
+		if options.DeepTextSearch {
+			if recordContent, ok := parseRecordContent(record); ok {
+				texts = append(texts, recordContent.NestedText()...)
+			}
+		}
+	} else {
+		text := concatRecordText(record, m.textFieldsFor(options))
+		if options.DeepTextSearch {
+			text = appendNestedRecordText(text, record)
+		}
+		if text != "" {
+			texts = []string{text}
+		}
+	}
+	if len(texts) == 0 {
 		return false
 	}
 
-	// Split keywords by comma and check for any match
+	// Split keywords by comma and check each against the text
 	keywordList := strings.Split(keywords, ",")
-	textLower := strings.ToLower(text)
+	requireAll := options.KeywordMatchMode == models.KeywordMatchAll
+	matched := false
 
 	for _, keyword := range keywordList {
 		keyword = strings.TrimSpace(keyword) // Remove any surrounding whitespace
-		if keyword != "" && strings.Contains(textLower, strings.ToLower(keyword)) {
-			return true // Return true if any keyword matches
+		if keyword == "" {
+			continue
+		}
+
+		contains := false
+		for _, text := range texts {
+			if options.ContainsKeyword(text, keyword) {
+				contains = true
+				break
+			}
+		}
+		if contains && !requireAll {
+			return true // Any keyword is enough
 		}
+		if !contains && requireAll {
+			return false // Every keyword is required
+		}
+		matched = matched || contains
 	}
 
-	return false
+	return matched
+}
+
+// recordMatchesPatterns checks a record's concatenated text fields against compiled keyword patterns.
+// In "all" mode every pattern must match; any other mode matches if at least one pattern matches.
+func recordMatchesPatterns(record interface{}, patterns []*regexp.Regexp, mode string, deep bool, fields []string) bool {
+	if record == nil || len(patterns) == 0 {
+		return false
+	}
+
+	text := concatRecordText(record, fields)
+	if deep {
+		text = appendNestedRecordText(text, record)
+	}
+	if text == "" {
+		return false
+	}
+
+	requireAll := mode == models.KeywordMatchAll
+	for _, pattern := range patterns {
+		matches := pattern.MatchString(text)
+		if matches && !requireAll {
+			return true
+		}
+		if !matches && requireAll {
+			return false
+		}
+	}
+
+	return requireAll
+}
+
+// CompileKeywordPatterns compiles each comma-separated keyword as a regular expression, case-insensitive
+// unless caseSensitive is set
+func CompileKeywordPatterns(keywords string, caseSensitive bool) ([]*regexp.Regexp, error) {
+	flags := "(?i)"
+	if caseSensitive {
+		flags = ""
+	}
+
+	var patterns []*regexp.Regexp
+	for _, keyword := range strings.Split(keywords, ",") {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			continue
+		}
+
+		pattern, err := regexp.Compile(flags + keyword)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyword pattern '%s': %w", keyword, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no keyword patterns provided")
+	}
+
+	return patterns, nil
+}
+
+// parseRecordContent converts a decoded record into RecordContent
+func parseRecordContent(record interface{}) (models.RecordContent, bool) {
+	var recordContent models.RecordContent
+
+	// Convert record to JSON and parse text fields
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return recordContent, false
+	}
+
+	if err := json.Unmarshal(recordBytes, &recordContent); err != nil {
+		return recordContent, false
+	}
+
+	return recordContent, true
+}
+
+// recordLangs returns the langs declared by a record (nil if none)
+func recordLangs(record interface{}) []string {
+	if record == nil {
+		return nil
+	}
+	recordContent, ok := parseRecordContent(record)
+	if !ok {
+		return nil
+	}
+	return recordContent.Langs
+}
+
+// recordEmbedTypes returns the $type of a record's embed followed by the $type of its media,
+// so a recordWithMedia embed also reports e.g. app.bsky.embed.images (nil if there's no embed)
+func recordEmbedTypes(record interface{}) []string {
+	var values interface{} = record
+	switch record.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+	default:
+		converted, ok := recordMap(record)
+		if !ok {
+			return nil
+		}
+		values = converted
+	}
+
+	var types []string
+	for embed := recordMapValue(values, "embed"); embed != nil; embed = recordMapValue(embed, "media") {
+		if embedType, ok := recordMapValue(embed, "$type").(string); ok && embedType != "" {
+			types = append(types, embedType)
+		}
+	}
+	return types
+}
+
+// recordFacetCounts counts the link and mention features in a record's rich text facets
+// (0 and 0 if the record has no facets)
+func recordFacetCounts(record interface{}) (links, mentions int) {
+	var values interface{} = record
+	switch record.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+	default:
+		converted, ok := recordMap(record)
+		if !ok {
+			return 0, 0
+		}
+		values = converted
+	}
+
+	facets, _ := recordMapValue(values, "facets").([]interface{})
+	for _, facet := range facets {
+		features, _ := recordMapValue(facet, "features").([]interface{})
+		for _, feature := range features {
+			switch recordMapValue(feature, "$type") {
+			case "app.bsky.richtext.facet#link":
+				links++
+			case "app.bsky.richtext.facet#mention":
+				mentions++
+			}
+		}
+	}
+	return links, mentions
+}
+
+// recordReplyRoot returns the reply.root.uri of a reply record, or "" if the record isn't a reply
+func recordReplyRoot(record interface{}) string {
+	var values interface{} = record
+	switch record.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+	default:
+		converted, ok := recordMap(record)
+		if !ok {
+			return ""
+		}
+		values = converted
+	}
+
+	uri, _ := recordMapValue(recordMapValue(recordMapValue(values, "reply"), "root"), "uri").(string)
+	return uri
+}
+
+// recordMapValue returns a key's value from a decoded record map, accepting both the string-keyed
+// maps produced by convertCBORToStringMap and raw CBOR maps with interface{} keys
+func recordMapValue(values interface{}, key string) interface{} {
+	switch v := values.(type) {
+	case map[string]interface{}:
+		return v[key]
+	case map[interface{}]interface{}:
+		return v[key]
+	}
+	return nil
+}
+
+// recordPostType classifies a post as a reply, a quote or a top-level post, or returns "" if
+// the op isn't a post with a record. A reply that quotes another post counts as a reply.
+func recordPostType(op models.ATOperation) string {
+	if operationCollection(op) != "app.bsky.feed.post" {
+		return ""
+	}
+
+	var values interface{} = op.Record
+	switch op.Record.(type) {
+	case map[string]interface{}, map[interface{}]interface{}:
+	default:
+		converted, ok := recordMap(op.Record)
+		if !ok {
+			return ""
+		}
+		values = converted
+	}
+
+	if recordMapValue(values, "reply") != nil {
+		return models.PostTypeReply
+	}
+	embedType, _ := recordMapValue(recordMapValue(values, "embed"), "$type").(string)
+	if embedType == "app.bsky.embed.record" || embedType == "app.bsky.embed.recordWithMedia" {
+		return models.PostTypeQuote
+	}
+	return models.PostTypeTop
+}
+
+// operationCollection returns an operation's collection NSID, taking it from the path when
+// the event source didn't set it
+func operationCollection(op models.ATOperation) string {
+	if op.Collection != "" {
+		return op.Collection
+	}
+	collection, _, _ := strings.Cut(op.Path, "/")
+	return collection
+}
+
+// recordCreatedAt returns a record's createdAt timestamp, or "" if it has none
+func recordCreatedAt(record interface{}) string {
+	if record == nil {
+		return ""
+	}
+	recordContent, ok := parseRecordContent(record)
+	if !ok {
+		return ""
+	}
+	return recordContent.Created
+}
+
+// extractRecordText returns the first non-empty text field of a record, checking fields in order
+func extractRecordText(record interface{}, fields []string) string {
+	if parts := recordFieldText(record, fields); len(parts) > 0 {
+		return parts[0]
+	}
+	return ""
+}
+
+// concatRecordText joins all non-empty text fields of a record, one per line
+func concatRecordText(record interface{}, fields []string) string {
+	return strings.Join(recordFieldText(record, fields), "\n")
+}
+
+// recordFieldText returns the non-empty string values of the given record fields, in field order.
+// A field may name a nested value with dots, e.g. "embed.external.title".
+func recordFieldText(record interface{}, fields []string) []string {
+	values, ok := recordMap(record)
+	if !ok {
+		return nil
+	}
+
+	var parts []string
+	for _, field := range fields {
+		if text, ok := lookupRecordField(values, field).(string); ok && text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return parts
+}
+
+// recordMap returns a record as a generic map; decoded firehose records already are one,
+// anything else is converted through JSON
+func recordMap(record interface{}) (map[string]interface{}, bool) {
+	if record == nil {
+		return nil, false
+	}
+	if values, ok := record.(map[string]interface{}); ok {
+		return values, true
+	}
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return nil, false
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(recordBytes, &values); err != nil {
+		return nil, false
+	}
+	return values, true
+}
+
+// lookupRecordField returns the value at a dotted field path, or nil if any step is missing
+func lookupRecordField(values map[string]interface{}, field string) interface{} {
+	var current interface{} = values
+	for _, key := range strings.Split(strings.TrimSpace(field), ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[key]
+	}
+	return current
+}
+
+// appendNestedRecordText appends a record's embed and facet text to text, one part per line
+func appendNestedRecordText(text string, record interface{}) string {
+	recordContent, ok := parseRecordContent(record)
+	if !ok {
+		return text
+	}
+
+	parts := recordContent.NestedText()
+	if text != "" {
+		parts = append([]string{text}, parts...)
+	}
+	return strings.Join(parts, "\n")
 }
 
 // recordContainsKeyword checks if a record contains the specified keyword (kept for compatibility)
@@ -371,13 +1710,13 @@ func (m *Manager) recordContainsKeyword(record interface{}, keyword string) bool
 }
 
 // getMatchingKeywords returns a list of keywords that actually match the event content
-func (m *Manager) getMatchingKeywords(event *models.ATEvent, keywords string) []string {
-	if keywords == "" {
+func (m *Manager) getMatchingKeywords(event *models.ATEvent, options models.FilterOptions) []string {
+	if options.Keyword == "" {
 		return nil
 	}
 
 	var matchingKeywords []string
-	keywordList := strings.Split(keywords, ",")
+	keywordList := strings.Split(options.Keyword, ",")
 
 	for _, keyword := range keywordList {
 		keyword = strings.TrimSpace(keyword)
@@ -387,119 +1726,287 @@ func (m *Manager) getMatchingKeywords(event *models.ATEvent, keywords string) []
 
 		// Check if this specific keyword matches any operation in the event
 		for _, op := range event.Ops {
-			if m.recordContainsKeywords(op.Record, keyword) {
+			if m.recordMatchesKeywords(op.Record, keyword, options) {
 				matchingKeywords = append(matchingKeywords, keyword)
 				break // Found a match for this keyword, no need to check other operations
 			}
 		}
 	}
-
-	return matchingKeywords
+
+	return matchingKeywords
+}
+
+// getSubscriptionMatchingKeywords returns the keywords (or patterns) of a subscription that match the event content
+func (m *Manager) getSubscriptionMatchingKeywords(event *models.ATEvent, sub *Subscription) []string {
+	if !sub.Options.KeywordRegex {
+		return m.getMatchingKeywords(event, sub.Options)
+	}
+
+	var matchingKeywords []string
+	for _, pattern := range sub.keywordPatterns {
+		for _, op := range event.Ops {
+			if recordMatchesPatterns(op.Record, []*regexp.Regexp{pattern}, models.KeywordMatchAny, sub.Options.DeepTextSearch, m.textFieldsFor(sub.Options)) {
+				// Report the pattern as the user wrote it, without the case-insensitive flag
+				matchingKeywords = append(matchingKeywords, strings.TrimPrefix(pattern.String(), "(?i)"))
+				break
+			}
+		}
+	}
+
+	return matchingKeywords
+}
+
+// withOperationURIs returns a copy of ops with each op's at:// URI set and, unless the filter
+// asked for them, raw record blocks dropped, leaving the event's ops (shared with other
+// subscriptions) untouched
+func withOperationURIs(did string, ops []models.ATOperation, includeRawRecord bool) []models.ATOperation {
+	if ops == nil {
+		return nil
+	}
+	withURIs := make([]models.ATOperation, len(ops))
+	for i, op := range ops {
+		op.URI = op.RecordURI(did)
+		if !includeRawRecord {
+			op.RawRecord = nil
+		}
+		withURIs[i] = op
+	}
+	return withURIs
+}
+
+// broadcastToSubscription queues an event for all connections in a subscription, tagged with the
+// keywords that matched it. Connections already in delivered are skipped and the rest are added.
+// Writes happen on each connection's writer; a full queue drops the event for that connection only.
+// The caller must hold m.mu (read).
+func (m *Manager) broadcastToSubscription(sub *Subscription, event *models.ATEvent, receivedAt time.Time, matchedKeywords []string, delivered map[Connection]bool) {
+	// Paused and sampled-out events aren't marked delivered, so connections on other matching
+	// filters still get them
+	sub.mu.RLock()
+	paused := sub.paused
+	sub.mu.RUnlock()
+	if paused {
+		return
+	}
+	if sampledOut(event, sub.Options.SampleRate) {
+		metriks.SampledOutEvents.WithLabelValues(sub.FilterKey).Inc()
+		return
+	}
+
+	sub.mu.RLock()
+	connections := make([]Connection, 0, len(sub.Connections))
+	for conn := range sub.Connections {
+		if !delivered[conn] {
+			connections = append(connections, conn)
+			delivered[conn] = true
+		}
+	}
+	webhook := sub.webhook
+	sub.mu.RUnlock()
+
+	// Events are still buffered while nobody is connected, so a client that reconnects can replay
+	// them, and published so clients connected to other nodes receive them
+	publish := m.publishing()
+	if len(connections) == 0 && webhook == nil && sub.replay == nil && !publish {
+		return
+	}
+
+	// Create enriched event with timestamp metadata
+	forwardedAt := time.Now()
+	if len(connections) > 0 || webhook != nil {
+		metriks.DeliveryLatency.WithLabelValues(sub.FilterKey).Observe(forwardedAt.Sub(receivedAt).Seconds())
+	}
+
+	enrichedEvent := models.EnrichedATEvent{
+		Event:    event.Event,
+		Did:      event.Did,
+		Time:     event.Time,
+		Kind:     event.Kind,
+		Ops:      withOperationURIs(event.Did, event.Ops, sub.Options.IncludeRawRecord),
+		Identity: event.Identity,
+		Account:  event.Account,
+		Timestamps: models.EventTimestamps{
+			Original:        event.Time,                           // Original firehose timestamp
+			Received:        receivedAt.Format(time.RFC3339Nano),  // When we received from firehose
+			Forwarded:       forwardedAt.Format(time.RFC3339Nano), // When we forward to clients
+			FilterKey:       sub.FilterKey,                        // Which filter matched
+			Seq:             event.Seq,                            // Upstream order, preserved per connection
+			MatchedKeywords: matchedKeywords,                      // Which keywords triggered the match
+		},
+	}
+
+	// Webhook delivery is queued and happens off the broadcast path
+	forwarded := 0
+	if webhook != nil {
+		webhook.enqueue(enrichedEvent)
+		forwarded++
+	}
+
+	messages := []models.WSMessage{{
+		Type:      "event",
+		Timestamp: forwardedAt,
+		Data:      enrichedEvent,
+	}}
+	if onlyDeletes(event) {
+		messages = deleteMessages(enrichedEvent, forwardedAt)
+	}
+
+	for _, message := range messages {
+		sub.replay.add(message)
+		if publish {
+			if err := m.publisher.Publish(sub.FilterKey, message); err != nil {
+				slog.Debug("Failed to publish event", "filter", previewText(sub.FilterKey, 0, 8), "error", err)
+			}
+		}
+	}
+
+	for _, conn := range connections {
+		writer := m.writers[conn]
+		if writer == nil {
+			continue
+		}
+		queued, limited := m.enqueueEvent(sub, conn, writer, messages)
+		forwarded += queued
+		if queued == 0 {
+			if !limited {
+				slog.Debug("Outbound queue full, dropped event", "filter", previewText(sub.FilterKey, 0, 8))
+			}
+			continue
+		}
+
+		// Log queued events with timing info, skipping the "did:plc:" prefix.
+		// Malformed events can carry short DIDs, which previewText leaves whole
+		didPreview := previewText(event.Did, 8, 12)
+		filterPreview := previewText(sub.FilterKey, 0, 8)
+
+		attrs := []any{"repo", didPreview, "filter", filterPreview, "forwarded", forwardedAt.Format("15:04:05.000")}
+		if len(event.Ops) > 0 {
+			op := event.Ops[0] // Log first operation
+			attrs = append(attrs, "action", op.Action, "path", op.Path)
+		}
+		slog.Debug("Queued event for connection", attrs...)
+	}
+
+	if forwarded > 0 {
+		sub.delivery.add(forwardedAt, forwarded)
+	}
+}
+
+// enqueueEvent queues an event's messages to one connection and returns how many were queued.
+// Under the filter's MaxMessagesPerConnection it queues no more than the connection's remaining
+// allowance, reporting limited if that cut the event short, and the connection is closed once
+// the last allowed message has been written.
+func (m *Manager) enqueueEvent(sub *Subscription, conn Connection, writer *connectionWriter, messages []models.WSMessage) (queued int, limited bool) {
+	limit := sub.Options.MaxMessagesPerConnection
+	for _, message := range messages {
+		out := outboundMessage{message: message, delivered: &sub.MessagesDelivered}
+		if limit > 0 {
+			allowed, last := sub.reserveMessage(conn, limit)
+			if !allowed {
+				return queued, true
+			}
+			if last {
+				out.onWritten = m.closeAtMessageLimit
+			}
+		}
+		if writer.enqueueOutbound(out) {
+			queued++
+		} else if limit > 0 {
+			sub.releaseMessage(conn)
+		}
+	}
+	return queued, false
 }
 
-// broadcastToSubscription sends an event to all connections in a subscription
-func (m *Manager) broadcastToSubscription(sub *Subscription, event *models.ATEvent, receivedAt time.Time) {
-	sub.mu.RLock()
-	connections := make([]*websocket.Conn, 0, len(sub.Connections))
-	for conn := range sub.Connections {
-		connections = append(connections, conn)
-	}
-	sub.mu.RUnlock()
-
-	if len(connections) == 0 {
-		return
+// reserveMessage counts one more message to conn against limit. It reports whether the message
+// is within the limit and whether it is the last one allowed
+func (sub *Subscription) reserveMessage(conn Connection, limit int) (allowed, last bool) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.messagesSent[conn] >= limit {
+		return false, false
 	}
-
-	// Create enriched event with timestamp metadata
-	forwardedAt := time.Now()
-	enrichedEvent := models.EnrichedATEvent{
-		Event: event.Event,
-		Did:   event.Did,
-		Time:  event.Time,
-		Kind:  event.Kind,
-		Ops:   event.Ops,
-		Timestamps: models.EventTimestamps{
-			Original:  event.Time,                           // Original firehose timestamp
-			Received:  receivedAt.Format(time.RFC3339Nano),  // When we received from firehose
-			Forwarded: forwardedAt.Format(time.RFC3339Nano), // When we forward to clients
-			FilterKey: sub.FilterKey,                        // Which filter matched
-		},
+	if sub.messagesSent == nil {
+		sub.messagesSent = make(map[Connection]int)
 	}
+	sub.messagesSent[conn]++
+	return true, sub.messagesSent[conn] == limit
+}
 
-	message := models.WSMessage{
-		Type:      "event",
-		Timestamp: forwardedAt,
-		Data:      enrichedEvent,
+// releaseMessage gives back a message reserved for conn that couldn't be queued
+func (sub *Subscription) releaseMessage(conn Connection) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.messagesSent[conn] > 0 {
+		sub.messagesSent[conn]--
 	}
+}
 
-	deadConnections := make([]*websocket.Conn, 0)
+// closeAtMessageLimit closes a connection that has been sent its filter's
+// MaxMessagesPerConnection, removing it from all of its filters. The connection's writer calls
+// it after writing the last allowed message
+func (m *Manager) closeAtMessageLimit(conn Connection) {
+	m.mu.Lock()
+	m.dropConnection(conn)
+	totalConnections := len(m.connections)
+	m.mu.Unlock()
 
-	// Write timeout for event messages - more generous than handler timeouts
-	const writeTimeout = 30 * time.Second
+	closeWithReason([]Connection{conn}, websocket.CloseNormalClosure, messageLimitCloseReason)
 
-	for _, conn := range connections {
-		// Clear any existing deadline and set a fresh one for this message
-		if err := conn.SetWriteDeadline(time.Time{}); err != nil {
-			log.Printf("⚠️  Failed to clear write deadline: %v", err)
-		}
+	slog.Info("Closed connection at its message limit", "totalConnections", totalConnections)
+}
 
-		if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
-			log.Printf("⚠️  Failed to set write deadline: %v", err)
-			deadConnections = append(deadConnections, conn)
-			continue
+// hasMatchingDelete reports whether an event deletes a record the filter's action, path and
+// collection criteria allow
+func hasMatchingDelete(event *models.ATEvent, options models.FilterOptions) bool {
+	for _, op := range event.Ops {
+		if op.Action == "delete" && options.AllowsAction(op.Action) && options.MatchesPath(op.Path) && options.MatchesCollection(operationCollection(op)) {
+			return true
 		}
+	}
+	return false
+}
 
-		if err := conn.WriteJSON(message); err != nil {
-			log.Printf("⚠️  Failed to send message to connection: %v", err)
-			deadConnections = append(deadConnections, conn)
-		} else {
-			// Log successful forwarding to WebSocket with timing info
-			didPreview := event.Did
-			if len(didPreview) > 20 {
-				didPreview = didPreview[8:20] + "..."
-			} else if len(didPreview) > 8 {
-				didPreview = didPreview[8:] + "..."
-			}
-
-			filterPreview := sub.FilterKey
-			if len(filterPreview) > 8 {
-				filterPreview = filterPreview[:8] + "..."
-			}
-
-			if len(event.Ops) > 0 {
-				op := event.Ops[0] // Log first operation
-				log.Printf("📤 Forwarded event to WebSocket: action=%s, path=%s (repo: %s) [filter: %s, forwarded: %s]",
-					op.Action, op.Path, didPreview, filterPreview, forwardedAt.Format("15:04:05.000"))
-			} else {
-				log.Printf("📤 Forwarded event to WebSocket (repo: %s) [filter: %s, forwarded: %s]",
-					didPreview, filterPreview, forwardedAt.Format("15:04:05.000"))
-			}
+// forwardsOnlyDeletes reports whether every op the filter's actions let through is a delete
+func forwardsOnlyDeletes(event *models.ATEvent, options models.FilterOptions) bool {
+	for _, op := range event.Ops {
+		if op.Action != "delete" && options.AllowsAction(op.Action) {
+			return false
 		}
 	}
+	return true
+}
 
-	// Clean up dead connections
-	if len(deadConnections) > 0 {
-		sub.mu.Lock()
-		removedCount := 0
-		for _, conn := range deadConnections {
-			if _, exists := sub.Connections[conn]; exists {
-				delete(sub.Connections, conn)
-				removedCount++
-			}
-			if err := conn.Close(); err != nil {
-				log.Printf("Failed to close dead connection: %v", err)
-			}
+// onlyDeletes reports whether an event is a commit whose ops all delete records
+func onlyDeletes(event *models.ATEvent) bool {
+	if (event.Kind != "" && event.Kind != models.EventKindCommit) || len(event.Ops) == 0 {
+		return false
+	}
+	for _, op := range event.Ops {
+		if op.Action != "delete" {
+			return false
 		}
-		sub.mu.Unlock()
-
-		// Update total connections count (need to get manager lock)
-		m.mu.Lock()
-		m.totalConnections -= removedCount
-		m.mu.Unlock()
+	}
+	return true
+}
 
-		log.Printf("🧹 Cleaned up %d dead connections from filter %s (total connections: %d/%d)",
-			removedCount, sub.FilterKey[:8]+"...", m.totalConnections, m.maxConnections)
+// deleteMessages turns a delete-only commit into one "delete" message per deleted record
+func deleteMessages(event models.EnrichedATEvent, forwardedAt time.Time) []models.WSMessage {
+	messages := make([]models.WSMessage, 0, len(event.Ops))
+	for _, op := range event.Ops {
+		messages = append(messages, models.WSMessage{
+			Type:      "delete",
+			Timestamp: forwardedAt,
+			Data: models.DeleteNotification{
+				URI:        op.RecordURI(event.Did),
+				Did:        event.Did,
+				Collection: op.Collection,
+				Rkey:       op.Rkey,
+				Time:       event.Time,
+				Timestamps: event.Timestamps,
+			},
+		})
 	}
+	return messages
 }
 
 // GetStats returns statistics about the subscription manager
@@ -508,16 +2015,34 @@ func (m *Manager) GetStats() map[string]interface{} {
 	defer m.mu.RUnlock()
 
 	activeFilters := len(m.subscriptions)
-	connectionUtilization := float64(m.totalConnections) / float64(max(m.maxConnections, 1)) * 100
+	connectionUtilization := float64(len(m.connections)) / float64(max(m.maxConnections, 1)) * 100
+
+	// Per-filter delivery counts help identify hot vs idle filters. Stats are public, so filters
+	// that require a connect token are only counted in the total, keeping their keys unlisted.
+	var messagesDelivered uint64
+	filterMessagesDelivered := make(map[string]uint64, activeFilters)
+	for filterKey, sub := range m.subscriptions {
+		delivered := sub.MessagesDelivered.Load()
+		messagesDelivered += delivered
+		sub.mu.RLock()
+		requiresToken := sub.connectTokens != nil
+		sub.mu.RUnlock()
+		if !requiresToken {
+			filterMessagesDelivered[filterKey] = delivered
+		}
+	}
 
 	return map[string]interface{}{
-		"active_filters":         activeFilters,
-		"total_connections":      m.totalConnections,
-		"max_connections":        m.maxConnections,
-		"connection_utilization": fmt.Sprintf("%.1f%%", connectionUtilization),
-		"available_connections":  m.maxConnections - m.totalConnections,
-		"uptime":                 time.Since(time.Now()).String(), // This would be better tracked at startup
-		"avg_connections":        float64(m.totalConnections) / float64(max(activeFilters, 1)),
+		"active_filters":            activeFilters,
+		"total_connections":         len(m.connections),
+		"max_connections":           m.maxConnections,
+		"connection_utilization":    fmt.Sprintf("%.1f%%", connectionUtilization),
+		"available_connections":     m.maxConnections - len(m.connections),
+		"uptime":                    time.Since(time.Now()).String(), // This would be better tracked at startup
+		"avg_connections":           float64(len(m.connections)) / float64(max(activeFilters, 1)),
+		"messages_delivered":        messagesDelivered,
+		"filter_messages_delivered": filterMessagesDelivered,
+		"tap_connections":           len(m.taps),
 	}
 }
 
@@ -525,7 +2050,7 @@ func (m *Manager) GetStats() map[string]interface{} {
 func generateFilterKey() string {
 	bytes := make([]byte, 16)
 	if _, err := rand.Read(bytes); err != nil {
-		log.Printf("Failed to generate random bytes: %v", err)
+		slog.Error("Failed to generate random bytes", "error", err)
 		// Fallback to time-based key if random fails
 		return hex.EncodeToString([]byte(fmt.Sprintf("%d", time.Now().UnixNano())))
 	}
@@ -540,6 +2065,29 @@ func getFilterDisplayValue(filter string) string {
 	return filter
 }
 
+// keywordPreviewLength caps how many characters of a filter's keywords are logged
+const keywordPreviewLength = 64
+
+// previewText returns up to maxRunes characters of s starting at character offset start, for logging.
+// Offsets count runes rather than bytes so multibyte text is never cut mid-character. "..." marks a
+// preview that omits part of s; strings no longer than start are returned whole.
+func previewText(s string, start, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= start || (start == 0 && len(runes) <= maxRunes) {
+		return s
+	}
+	end := min(start+maxRunes, len(runes))
+	return string(runes[start:end]) + "..."
+}
+
+// getKeywordMatchModeDisplayValue returns the effective keyword match mode
+func getKeywordMatchModeDisplayValue(mode string) string {
+	if mode == "" {
+		return models.KeywordMatchAny
+	}
+	return mode
+}
+
 // max returns the maximum of two integers
 func max(a, b int) int {
 	if a > b {
@@ -548,36 +2096,346 @@ func max(a, b int) int {
 	return b
 }
 
-// validateFilterContent validates that non-empty filter fields contain at least 3 letters
-func validateFilterContent(options models.FilterOptions) string {
-	letterRegex := regexp.MustCompile(`[a-zA-Z]`)
+// langTagRegex matches BCP-47 style language tags
+var langTagRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{1,8})*$`)
+
+// textFieldRegex matches record field names, with dots separating nested fields
+var textFieldRegex = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+// maxTextFields caps how many record fields a filter may search
+const maxTextFields = 10
+
+// letterRegex matches the letters counted towards a path prefix or keyword's 3 letter minimum
+var letterRegex = regexp.MustCompile(`[a-zA-Z]`)
+
+// filterFieldCheck validates one filter option, returning the rejection reason (one of the
+// FilterRejected* constants) and a message for the client, or two empty strings if it's valid
+type filterFieldCheck struct {
+	field string // JSON name of the option
+	check func(options models.FilterOptions) (reason, message string)
+}
+
+// filterFieldChecks are the content checks for each filter option, in the order they're reported
+var filterFieldChecks = []filterFieldCheck{
+	// Each repository entry must be a DID or a handle
+	{"repository", func(options models.FilterOptions) (string, string) {
+		for _, repo := range options.RepositoryList() {
+			if validationErr := ValidateRepository(repo); validationErr != "" {
+				return FilterRejectedInvalidDID, validationErr
+			}
+		}
+		return "", ""
+	}},
+	{"repositoryPrefix", func(options models.FilterOptions) (string, string) {
+		if options.RepositoryPrefix != "" {
+			if validationErr := ValidateRepositoryPrefix(options.RepositoryPrefix); validationErr != "" {
+				return FilterRejectedInvalidDID, validationErr
+			}
+		}
+		return "", ""
+	}},
+	{"pathPrefix", func(options models.FilterOptions) (string, string) {
+		if options.PathPrefix != "" && countLetters(options.PathPrefix, letterRegex) < 3 {
+			return FilterRejectedTooShort, "Path prefix filter must contain at least 3 letters"
+		}
+		if strings.Contains(options.PathPrefix, "*") {
+			if _, err := path.Match(options.PathPrefix, ""); err != nil {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Path prefix pattern '%s' is invalid: %v", options.PathPrefix, err)
+			}
+		}
+		return "", ""
+	}},
+	// Each plain keyword needs 3 letters (regex patterns are validated by compiling them)
+	{"keyword", func(options models.FilterOptions) (string, string) {
+		if options.Keyword == "" || options.KeywordRegex {
+			return "", ""
+		}
+		for _, keyword := range strings.Split(options.Keyword, ",") {
+			keyword = strings.TrimSpace(keyword)
+			if keyword != "" && countLetters(keyword, letterRegex) < 3 {
+				return FilterRejectedTooShort, fmt.Sprintf("Keyword '%s' must contain at least 3 letters", keyword)
+			}
+		}
+		return "", ""
+	}},
+	// Collections are matched exactly, so each must be a full NSID
+	{"collections", func(options models.FilterOptions) (string, string) {
+		for _, collection := range options.Collections {
+			if _, err := syntax.ParseNSID(collection); err != nil {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Collection '%s' is not a valid NSID (e.g. app.bsky.feed.like)", collection)
+			}
+		}
+		return "", ""
+	}},
+	{"actions", func(options models.FilterOptions) (string, string) {
+		for _, action := range options.Actions {
+			switch action {
+			case models.ActionCreate, models.ActionUpdate, models.ActionDelete:
+			default:
+				return FilterRejectedInvalidOption, fmt.Sprintf("Invalid action '%s', must be one of: create, update, delete", action)
+			}
+		}
+		return "", ""
+	}},
+	{"eventKinds", func(options models.FilterOptions) (string, string) {
+		for _, kind := range options.EventKinds {
+			switch kind {
+			case models.EventKindCommit, models.EventKindIdentity, models.EventKindAccount:
+			default:
+				return FilterRejectedInvalidOption, fmt.Sprintf("Invalid event kind '%s', must be one of: commit, identity, account", kind)
+			}
+		}
+		return "", ""
+	}},
+	// Languages are BCP-47 style tags, e.g. "en" or "pt-BR"
+	{"langs", func(options models.FilterOptions) (string, string) {
+		for _, lang := range options.Langs {
+			if !langTagRegex.MatchString(strings.TrimSpace(lang)) {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Invalid language '%s', must be a language tag such as 'en' or 'pt-BR'", lang)
+			}
+		}
+		return "", ""
+	}},
+	// Embed types are matched exactly, so each must be a full NSID
+	{"embedTypes", func(options models.FilterOptions) (string, string) {
+		for _, embedType := range options.EmbedTypes {
+			if _, err := syntax.ParseNSID(embedType); err != nil {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Embed type '%s' is not a valid NSID (e.g. app.bsky.embed.images)", embedType)
+			}
+		}
+		return "", ""
+	}},
+	{"postType", func(options models.FilterOptions) (string, string) {
+		switch options.PostType {
+		case "", models.PostTypeTop, models.PostTypeReply, models.PostTypeQuote:
+			return "", ""
+		}
+		return FilterRejectedInvalidOption, fmt.Sprintf("Invalid post type '%s', must be one of: top, reply, quote", options.PostType)
+	}},
+	// Reply refs name the thread root by DID, so it's compared with them exactly
+	{"replyRootUri", func(options models.FilterOptions) (string, string) {
+		if options.ReplyRootURI != "" {
+			if uri, err := syntax.ParseATURI(options.ReplyRootURI); err != nil || !uri.Authority().IsDID() {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Reply root URI '%s' is not a valid AT URI with a DID (e.g. at://did:plc:example/app.bsky.feed.post/3k2a4b5c6d7e8)", options.ReplyRootURI)
+			}
+		}
+		return "", ""
+	}},
+	{"textFields", func(options models.FilterOptions) (string, string) {
+		if len(options.TextFields) > maxTextFields {
+			return FilterRejectedInvalidOption, fmt.Sprintf("At most %d text fields may be listed", maxTextFields)
+		}
+		for _, field := range options.TextFields {
+			if !textFieldRegex.MatchString(strings.TrimSpace(field)) {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Invalid text field '%s', must be a field name such as 'text' or 'embed.external.title'", field)
+			}
+		}
+		return "", ""
+	}},
+	{"sampleRate", func(options models.FilterOptions) (string, string) {
+		if options.SampleRate < 0 || options.SampleRate > 1 {
+			return FilterRejectedInvalidOption, fmt.Sprintf("Sample rate %g must be between 0 and 1", options.SampleRate)
+		}
+		return "", ""
+	}},
+	{"maxMessagesPerConnection", func(options models.FilterOptions) (string, string) {
+		if options.MaxMessagesPerConnection < 0 {
+			return FilterRejectedInvalidOption, "Max messages per connection must not be negative"
+		}
+		return "", ""
+	}},
+	{"minTextLength", func(options models.FilterOptions) (string, string) {
+		if options.MinTextLength < 0 {
+			return FilterRejectedInvalidOption, "Text length bounds must not be negative"
+		}
+		return "", ""
+	}},
+	{"maxTextLength", func(options models.FilterOptions) (string, string) {
+		if options.MaxTextLength < 0 {
+			return FilterRejectedInvalidOption, "Text length bounds must not be negative"
+		}
+		if options.MaxTextLength > 0 && options.MinTextLength > options.MaxTextLength {
+			return FilterRejectedInvalidOption, fmt.Sprintf("Minimum text length (%d) must not exceed maximum text length (%d)", options.MinTextLength, options.MaxTextLength)
+		}
+		return "", ""
+	}},
+	{"minLinks", func(options models.FilterOptions) (string, string) {
+		if options.MinLinks < 0 {
+			return FilterRejectedInvalidOption, "Link and mention minimums must not be negative"
+		}
+		return "", ""
+	}},
+	{"minMentions", func(options models.FilterOptions) (string, string) {
+		if options.MinMentions < 0 {
+			return FilterRejectedInvalidOption, "Link and mention minimums must not be negative"
+		}
+		return "", ""
+	}},
+	{"since", func(options models.FilterOptions) (string, string) {
+		if options.Since != "" {
+			if _, err := time.Parse(time.RFC3339, options.Since); err != nil {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Since '%s' must be an RFC3339 timestamp, e.g. 2024-01-01T00:00:00Z", options.Since)
+			}
+		}
+		return "", ""
+	}},
+	// Until must parse and, when since parses too, come after it
+	{"until", func(options models.FilterOptions) (string, string) {
+		if options.Until == "" {
+			return "", ""
+		}
+		until, err := time.Parse(time.RFC3339, options.Until)
+		if err != nil {
+			return FilterRejectedInvalidOption, fmt.Sprintf("Until '%s' must be an RFC3339 timestamp, e.g. 2024-01-01T00:00:00Z", options.Until)
+		}
+		if since, err := time.Parse(time.RFC3339, options.Since); err == nil && !since.Before(until) {
+			return FilterRejectedInvalidOption, fmt.Sprintf("Since (%s) must be before until (%s)", options.Since, options.Until)
+		}
+		return "", ""
+	}},
+	{"webhookUrl", func(options models.FilterOptions) (string, string) {
+		if options.WebhookURL != "" {
+			webhookURL, err := url.Parse(options.WebhookURL)
+			if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+				return FilterRejectedInvalidOption, fmt.Sprintf("Webhook URL '%s' must be an absolute http or https URL", options.WebhookURL)
+			}
+		}
+		return "", ""
+	}},
+	// An empty match type defaults to "substring", or "word" with wholeWord
+	{"matchType", func(options models.FilterOptions) (string, string) {
+		switch options.MatchType {
+		case "", models.MatchTypeSubstring, models.MatchTypeWord, models.MatchTypeExactText:
+		default:
+			return FilterRejectedInvalidOption, fmt.Sprintf("Invalid keyword match type '%s', must be one of: substring, word, exact-text", options.MatchType)
+		}
+		if options.WholeWord && options.MatchType != "" && options.MatchType != models.MatchTypeWord {
+			return FilterRejectedInvalidOption, fmt.Sprintf("wholeWord conflicts with match type '%s'", options.MatchType)
+		}
+		return "", ""
+	}},
+	// An empty match mode defaults to "any"
+	{"keywordMatchMode", func(options models.FilterOptions) (string, string) {
+		switch options.KeywordMatchMode {
+		case "", models.KeywordMatchAny, models.KeywordMatchAll:
+			return "", ""
+		default:
+			return FilterRejectedInvalidOption, fmt.Sprintf("Invalid keyword match mode '%s', must be one of: any, all", options.KeywordMatchMode)
+		}
+	}},
+}
 
-	// Validate repository field
-	if options.Repository != "" {
-		if countLetters(options.Repository, letterRegex) < 3 {
-			return "Repository filter must contain at least 3 letters"
+// ValidateFilterContent validates that non-empty filter fields contain at least 3 letters.
+// It returns the rejection reason (one of the FilterRejected* constants) and a message for
+// the client, or two empty strings if the options are valid.
+func ValidateFilterContent(options models.FilterOptions) (reason, message string) {
+	for _, fieldCheck := range filterFieldChecks {
+		if reason, message := fieldCheck.check(options); message != "" {
+			return reason, message
 		}
 	}
+	return "", "" // No validation errors
+}
 
-	// Validate pathPrefix field
-	if options.PathPrefix != "" {
-		if countLetters(options.PathPrefix, letterRegex) < 3 {
-			return "Path prefix filter must contain at least 3 letters"
+// ValidateFilterFields runs every check filter creation applies, including the required keyword
+// and compiling regex keywords, and reports the result for each option instead of stopping at
+// the first error. Options that aren't set are reported as valid.
+func (m *Manager) ValidateFilterFields(options models.FilterOptions) models.FilterValidationResponse {
+	response := models.FilterValidationResponse{
+		Valid:  true,
+		Fields: make([]models.FieldValidation, 0, len(filterFieldChecks)),
+	}
+	for _, fieldCheck := range filterFieldChecks {
+		reason, message := fieldCheck.check(options)
+		if fieldCheck.field == "keyword" && message == "" {
+			reason, message = m.validateKeywordPresence(options)
+		}
+
+		result := models.FieldValidation{Field: fieldCheck.field, Valid: message == ""}
+		if !result.Valid {
+			result.Error = message
+			result.Reason = reason
+			response.Valid = false
+		}
+		response.Fields = append(response.Fields, result)
+	}
+	return response
+}
+
+// validateKeywordPresence checks that the required criteria are given and, for regex keywords,
+// that every pattern compiles: the keyword checks prepareFilter applies on top of ValidateFilterContent
+func (m *Manager) validateKeywordPresence(options models.FilterOptions) (reason, message string) {
+	if reason, message := m.checkRequiredCriteria(options); message != "" {
+		return reason, message
+	}
+	if options.KeywordRegex {
+		if _, err := CompileKeywordPatterns(options.Keyword, options.CaseSensitive); err != nil {
+			return FilterRejectedInvalidOption, fmt.Sprintf("Keyword regex is invalid: %v", err)
 		}
 	}
+	return "", ""
+}
+
+// CheckRequiredCriteria returns why the options would forward too much of the firehose to be a
+// filter, or "" if they're narrow enough: a keyword, or when keywords aren't required, a
+// repository, repository prefix or collection
+func (m *Manager) CheckRequiredCriteria(options models.FilterOptions) string {
+	_, message := m.checkRequiredCriteria(options)
+	return message
+}
 
-	// Validate keyword field - check each keyword individually
+// checkRequiredCriteria is CheckRequiredCriteria, also returning the rejection reason
+func (m *Manager) checkRequiredCriteria(options models.FilterOptions) (reason, message string) {
 	if options.Keyword != "" {
-		keywords := strings.Split(options.Keyword, ",")
-		for _, keyword := range keywords {
-			keyword = strings.TrimSpace(keyword)
-			if keyword != "" && countLetters(keyword, letterRegex) < 3 {
-				return fmt.Sprintf("Keyword '%s' must contain at least 3 letters", keyword)
-			}
+		return "", ""
+	}
+	if m.requireKeyword {
+		return FilterRejectedNoKeyword, "Keyword filter is required. Filters must include keywords to prevent forwarding the entire firehose."
+	}
+	if options.Repository == "" && options.RepositoryPrefix == "" && len(options.Collections) == 0 {
+		return FilterRejectedNoKeyword, "A keyword, repository or collection filter is required to prevent forwarding the entire firehose."
+	}
+	return "", ""
+}
+
+// minRepositoryIDLength is the shortest DID method-specific identifier accepted in a repository filter
+const minRepositoryIDLength = 3
+
+// ValidateRepository checks that a repository filter entry is a did:plc or did:web DID, or an
+// atproto handle (which callers resolve to a DID before matching, since events only carry DIDs).
+// It returns an error message, or "" if the entry is valid.
+func ValidateRepository(repo string) string {
+	if !strings.HasPrefix(repo, "did:") {
+		if _, err := syntax.ParseHandle(repo); err != nil {
+			return fmt.Sprintf("Repository '%s' is not a valid DID or handle", repo)
 		}
+		return ""
+	}
+
+	did, err := syntax.ParseDID(repo)
+	if err != nil {
+		return fmt.Sprintf("Repository '%s' is not a valid DID or handle", repo)
+	}
+	if method := did.Method(); method != "plc" && method != "web" {
+		return fmt.Sprintf("Repository '%s' uses unsupported DID method '%s', must be did:plc or did:web", repo, method)
 	}
+	if len(did.Identifier()) < minRepositoryIDLength {
+		return fmt.Sprintf("Repository '%s' is too short, the DID identifier must have at least %d characters", repo, minRepositoryIDLength)
+	}
+	return ""
+}
 
-	return "" // No validation errors
+// repositoryPrefixRegex matches the start of a did:plc or did:web DID, including at least one
+// character of the identifier so a prefix can't match every repository
+var repositoryPrefixRegex = regexp.MustCompile(`^did:(plc|web):[a-zA-Z0-9._:%-]+$`)
+
+// ValidateRepositoryPrefix checks that a repository prefix is the start of a did:plc or did:web
+// DID. It returns an error message, or "" if the prefix is valid.
+func ValidateRepositoryPrefix(prefix string) string {
+	if !repositoryPrefixRegex.MatchString(prefix) {
+		return fmt.Sprintf("Repository prefix '%s' must be the start of a did:plc or did:web DID, e.g. 'did:web:example.com'", prefix)
+	}
+	return ""
 }
 
 // countLetters counts the number of letters in a string
@@ -598,14 +2456,14 @@ func (m *Manager) startPeriodicCleanup() {
 			case <-m.cleanupTicker.C:
 				m.performPeriodicCleanup()
 			case <-m.cleanupStop:
+				// StopPeriodicCleanup clears cleanupRunning under m.mu
 				m.cleanupTicker.Stop()
-				m.cleanupRunning = false
 				return
 			}
 		}
 	}()
 
-	log.Printf("🧹 Started periodic filter cleanup (every %v)", cleanupInterval)
+	slog.Info("Started periodic filter cleanup", "interval", cleanupInterval)
 }
 
 // StopPeriodicCleanup stops the periodic cleanup routine
@@ -616,7 +2474,7 @@ func (m *Manager) StopPeriodicCleanup() {
 	if m.cleanupRunning && m.cleanupStop != nil {
 		select {
 		case m.cleanupStop <- true:
-			log.Printf("🛑 Stopped periodic filter cleanup")
+			slog.Info("Stopped periodic filter cleanup")
 		default:
 			// Channel might be closed or full, that's OK
 		}
@@ -624,34 +2482,186 @@ func (m *Manager) StopPeriodicCleanup() {
 	}
 }
 
-// Shutdown gracefully shuts down the manager and stops all background processes
+// controlWriter is implemented by connections that can send WebSocket control frames
+// (*websocket.Conn). Shutdown uses it to say goodbye with a close frame; other connections are just closed.
+type controlWriter interface {
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+}
+
+const (
+	shutdownCloseReason     = "server shutting down"    // Reason sent in the close frame on shutdown
+	expiredCloseReason      = "filter expired"          // Reason sent in the close frame when a connection's only filter expires
+	adminCloseReason        = "closed by administrator" // Reason sent in the close frame when an operator kicks a connection
+	messageLimitCloseReason = "message limit reached"   // Reason sent in the close frame once a connection got its filter's maxMessagesPerConnection
+	closeFrameTimeout       = 1 * time.Second           // Time allowed to send a close frame to one connection
+	drainPollInterval       = 50 * time.Millisecond     // How often to check whether queues are flushed and drained connections have closed
+)
+
+// Shutdown gracefully shuts down the manager and stops all background processes.
+// WebSocket clients get a close frame but no time to answer it; see ShutdownWithDrain.
 func (m *Manager) Shutdown() {
-	log.Printf("🔄 Shutting down subscription manager...")
+	m.ShutdownWithDrain(0)
+}
+
+// ShutdownWithDrain shuts down the manager within drainTimeout. It first waits for messages
+// queued for connections and webhooks to be written, then sends every WebSocket client a "going
+// away" close frame and waits for them to finish the close handshake so they can reconnect
+// elsewhere; both phases share the timeout. Connections still open after that are closed
+// abruptly. It returns how many queued messages and webhook events were dropped because the
+// timeout ran out before they were delivered. Stop broadcasting before calling it.
+func (m *Manager) ShutdownWithDrain(drainTimeout time.Duration) int {
+	slog.Info("Shutting down subscription manager")
 	m.StopPeriodicCleanup()
 	m.stopActivityTracking()
 
-	// Close all active connections
+	deadline := time.Now().Add(drainTimeout)
+	dropped := m.flushQueues(deadline)
+
+	notified := m.sendGoingAway()
+	if remaining := time.Until(deadline); len(notified) > 0 && remaining > 0 {
+		m.waitForDrain(notified, remaining)
+	}
+
+	// Close all remaining connections
 	m.mu.Lock()
-	totalConnections := 0
+	totalConnections := len(m.connections)
+	for conn := range m.connections {
+		if err := conn.Close(); err != nil {
+			slog.Warn("Error closing connection", "error", err)
+		}
+	}
+	for _, writer := range m.writers {
+		writer.stop()
+	}
+	m.connections = make(map[Connection]map[string]bool)
+	m.writers = make(map[Connection]*connectionWriter)
+	m.closeTaps()
 	for _, sub := range m.subscriptions {
 		sub.mu.Lock()
-		for conn := range sub.Connections {
-			if err := conn.Close(); err != nil {
-				log.Printf("⚠️  Error closing connection: %v", err)
-			}
-			totalConnections++
+		sub.Connections = make(map[Connection]ConnectionInfo)
+		if sub.webhook != nil {
+			sub.webhook.stop()
 		}
-		sub.Connections = make(map[*websocket.Conn]bool)
 		sub.mu.Unlock()
 	}
-	m.totalConnections = 0
+	publisher := m.publisher
 	m.mu.Unlock()
 
+	if publisher != nil {
+		if err := publisher.Close(); err != nil {
+			slog.Warn("Error closing event publisher", "error", err)
+		}
+	}
+
 	if totalConnections > 0 {
-		log.Printf("🔌 Closed %d active connections during shutdown", totalConnections)
+		slog.Info("Closed active connections during shutdown", "connections", totalConnections)
+	}
+
+	slog.Info("Subscription manager shutdown complete")
+	return dropped
+}
+
+// flushQueues waits until every connection writer and webhook has delivered its queued messages
+// or the deadline passes, returning how many were still undelivered. Those are dropped when the
+// writers stop, so they're counted in shutdown_dropped_messages_total.
+func (m *Manager) flushQueues(deadline time.Time) int {
+	type flusher interface{ unflushed() int64 }
+	var flushers []flusher
+	m.mu.RLock()
+	for _, writer := range m.writers {
+		flushers = append(flushers, writer)
+	}
+	for _, sub := range m.subscriptions {
+		sub.mu.RLock()
+		if sub.webhook != nil {
+			flushers = append(flushers, sub.webhook)
+		}
+		sub.mu.RUnlock()
+	}
+	m.mu.RUnlock()
+
+	for {
+		var pending int64
+		for _, f := range flushers {
+			pending += f.unflushed()
+		}
+
+		if pending == 0 {
+			return 0
+		}
+		if !time.Now().Before(deadline) {
+			slog.Warn("Flush timeout reached, dropping undelivered messages", "dropped", pending)
+			metriks.ShutdownDroppedMessages.Add(float64(pending))
+			return int(pending)
+		}
+		time.Sleep(min(drainPollInterval, time.Until(deadline)))
+	}
+}
+
+// sendGoingAway sends a 1001 (going away) close frame to every WebSocket connection in parallel,
+// returning the connections that were notified
+func (m *Manager) sendGoingAway() []Connection {
+	var candidates []Connection
+	m.mu.RLock()
+	for conn := range m.connections {
+		if _, ok := conn.(controlWriter); ok {
+			candidates = append(candidates, conn)
+		}
+	}
+	m.mu.RUnlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownCloseReason)
+	sent := make([]bool, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func(i int, writer controlWriter) {
+			defer wg.Done()
+			if err := writer.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(closeFrameTimeout)); err != nil {
+				slog.Warn("Failed to send close frame", "error", err)
+				return
+			}
+			sent[i] = true
+		}(i, candidate.(controlWriter))
+	}
+	wg.Wait()
+
+	var notified []Connection
+	for i, candidate := range candidates {
+		if sent[i] {
+			notified = append(notified, candidate)
+		}
+	}
+	if len(notified) > 0 {
+		slog.Info("Sent going-away close frame", "connections", len(notified))
 	}
+	return notified
+}
+
+// waitForDrain waits until every notified connection has been removed (its handler saw the
+// client's close reply) or the timeout expires
+func (m *Manager) waitForDrain(notified []Connection, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := 0
+		m.mu.RLock()
+		for _, conn := range notified {
+			if _, open := m.connections[conn]; open {
+				remaining++
+			}
+		}
+		m.mu.RUnlock()
 
-	log.Printf("✅ Subscription manager shutdown complete")
+		if remaining == 0 {
+			slog.Info("All WebSocket connections drained", "connections", len(notified))
+			return
+		}
+		if time.Now().After(deadline) {
+			slog.Warn("Drain timeout reached", "timeout", timeout, "openConnections", remaining)
+			return
+		}
+		time.Sleep(drainPollInterval)
+	}
 }
 
 // performPeriodicCleanup removes filters that have been empty for a grace period
@@ -660,18 +2670,31 @@ func (m *Manager) performPeriodicCleanup() {
 	now := time.Now()
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	filtersToDelete := make([]string, 0)
+	filtersToExpire := make([]string, 0)
 
 	for filterKey, sub := range m.subscriptions {
 		sub.mu.RLock()
 		connectionCount := len(sub.Connections)
 		createdAt := sub.CreatedAt
 		lastConnectionAt := sub.LastConnectionAt
+		// Polling recent events keeps a filter alive like a connection does
+		if polledAt := sub.lastPolledAt; !polledAt.IsZero() && (lastConnectionAt == nil || polledAt.After(*lastConnectionAt)) {
+			lastConnectionAt = &polledAt
+		}
+		keepForWebhook := sub.hasWebhook()
+		expired := sub.expired(now)
 		sub.mu.RUnlock()
 
-		if connectionCount == 0 {
+		// Expired filters go regardless of connections or webhooks
+		if expired {
+			filtersToExpire = append(filtersToExpire, filterKey)
+			slog.Info("Periodic cleanup removing filter", "filter", filterKey[:8]+"...", "reason", "expired")
+			continue
+		}
+
+		if connectionCount == 0 && !keepForWebhook {
 			var shouldDelete bool
 			var reason string
 
@@ -691,76 +2714,211 @@ func (m *Manager) performPeriodicCleanup() {
 
 			if shouldDelete {
 				filtersToDelete = append(filtersToDelete, filterKey)
-				log.Printf("🗑️  Periodic cleanup: filter %s (%s)", filterKey[:8]+"...", reason)
+				slog.Info("Periodic cleanup removing filter", "filter", filterKey[:8]+"...", "reason", reason)
 			}
 		}
 	}
 
 	for _, filterKey := range filtersToDelete {
-		delete(m.subscriptions, filterKey)
-		metriks.FiltersDeleted.Inc()
+		m.removeSubscription(filterKey)
+	}
+
+	m.pruneIdempotencyKeys(now)
+
+	var closing []Connection
+	for _, filterKey := range filtersToExpire {
+		closing = append(closing, m.expireFilter(filterKey)...)
+	}
+	if len(closing) > 0 {
+		metriks.WebsocketConnections.Set(float64(len(m.connections)))
 	}
+	m.mu.Unlock()
+
+	// Close frames can take a while to send, so they go out without holding the lock
+	closeWithReason(closing, websocket.CloseNormalClosure, expiredCloseReason)
 
 	if len(filtersToDelete) > 0 {
-		log.Printf("🧹 Periodic cleanup removed %d stale filter(s)", len(filtersToDelete))
+		slog.Info("Periodic cleanup removed stale filters", "filters", len(filtersToDelete))
+	}
+	if len(filtersToExpire) > 0 {
+		slog.Info("Periodic cleanup removed expired filters", "filters", len(filtersToExpire), "closedConnections", len(closing))
+	}
+}
+
+// expireFilter removes a filter whose expiry has passed. Connections still subscribed to other
+// filters stay open and get a filter_expired message; the rest are deregistered and returned for
+// the caller to close once it has released m.mu. The caller must hold m.mu.
+func (m *Manager) expireFilter(filterKey string) []Connection {
+	sub := m.subscriptions[filterKey]
+
+	sub.mu.Lock()
+	notice := models.WSMessage{
+		Type:      "filter_expired",
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"filterKey": filterKey,
+			"expiresAt": sub.ExpiresAt,
+		},
+	}
+	var closing []Connection
+	for conn := range sub.Connections {
+		filters := m.connections[conn]
+		delete(filters, filterKey)
+		if len(filters) > 0 {
+			if writer := m.writers[conn]; writer != nil && !writer.enqueue(notice, nil) {
+				slog.Warn("Outbound queue full, dropped filter expiry notice", "filter", filterKey[:8]+"...")
+			}
+			continue
+		}
+		m.forgetConnection(conn)
+		closing = append(closing, conn)
+	}
+	sub.Connections = make(map[Connection]ConnectionInfo)
+	sub.mu.Unlock()
+
+	m.removeSubscription(filterKey)
+	return closing
+}
+
+// closeWithReason closes connections, first sending WebSocket clients a close frame with the
+// given code carrying reason so they can tell why
+func closeWithReason(conns []Connection, code int, reason string) {
+	closeMessage := websocket.FormatCloseMessage(code, reason)
+	for _, conn := range conns {
+		if writer, ok := conn.(controlWriter); ok {
+			if err := writer.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(closeFrameTimeout)); err != nil {
+				slog.Debug("Failed to send close frame", "error", err)
+			}
+		}
+		if err := conn.Close(); err != nil {
+			slog.Warn("Error closing connection", "error", err)
+		}
 	}
 }
 
+const (
+	// keywordActivityWindow is how often the keyword_messages_current gauge is updated with the
+	// count of the window that just ended
+	keywordActivityWindow = 30 * time.Second
+	// keywordActivityMaxLabels is how many of a window's busiest keywords get their own
+	// keyword_messages_current series; the rest are summed under otherKeywordLabel
+	keywordActivityMaxLabels = 100
+	otherKeywordLabel        = "other"
+)
+
 // startActivityTracking starts the keyword activity tracking and reset routine
 func (m *Manager) startActivityTracking() {
-	const activityWindow = 30 * time.Second // Reset activity every 30 seconds
-	m.activityTicker = time.NewTicker(activityWindow)
+	m.activityTicker = time.NewTicker(keywordActivityWindow)
 	m.activityRunning = true
 
 	go func() {
 		for {
 			select {
 			case <-m.activityTicker.C:
-				// First update metrics with current counts
-				m.updateKeywordActivityMetrics()
-				// Then reset counts for next window
-				m.resetKeywordActivityCounts()
+				m.publishKeywordActivity()
 			case <-m.activityStop:
+				// stopActivityTracking clears activityRunning under m.mu
 				m.activityTicker.Stop()
-				m.activityRunning = false
 				return
 			}
 		}
 	}()
 
-	log.Printf("📊 Started keyword activity tracking (window: %v)", activityWindow)
+	slog.Info("Started keyword activity tracking", "window", keywordActivityWindow)
 }
 
-// incrementKeywordActivity increments the current activity count for a keyword
-func (m *Manager) incrementKeywordActivity(keyword string) {
+// incrementKeywordActivity increments the current activity count and rolling rate for a keyword
+func (m *Manager) incrementKeywordActivity(keyword string, now time.Time) {
 	m.keywordCountsMu.Lock()
 	m.keywordCounts[keyword]++
-	m.allSeenKeywords[keyword] = true // Track that we've seen this keyword
+	rate, ok := m.keywordRates[keyword]
+	if !ok {
+		rate = &keywordRate{}
+		m.keywordRates[keyword] = rate
+	}
+	rate.add(now)
 	m.keywordCountsMu.Unlock()
 }
 
-// updateKeywordActivityMetrics updates the metrics with current counts
-func (m *Manager) updateKeywordActivityMetrics() {
-	m.keywordCountsMu.RLock()
-	defer m.keywordCountsMu.RUnlock()
+// GetKeywordThroughput returns the messages sent per keyword over the last minute, busiest
+// first (ties sorted alphabetically). Keywords with no messages in the window are omitted.
+func (m *Manager) GetKeywordThroughput() []models.KeywordThroughput {
+	now := time.Now()
 
-	// Update metrics for all keywords we've ever seen
-	for keyword := range m.allSeenKeywords {
-		count := m.keywordCounts[keyword] // Will be 0 if not in current counts
-		metriks.KeywordActivity.WithLabelValues(keyword).Set(float64(count))
-		if count > 0 {
-			log.Printf("📈 Keyword activity: '%s' = %d messages", keyword, count)
+	m.keywordCountsMu.RLock()
+	throughput := make([]models.KeywordThroughput, 0, len(m.keywordRates))
+	for keyword, rate := range m.keywordRates {
+		messages := rate.total(now)
+		if messages == 0 {
+			continue
 		}
+		throughput = append(throughput, models.KeywordThroughput{
+			Keyword:       keyword,
+			Messages:      messages,
+			RatePerSecond: float64(messages) / KeywordRateWindowSeconds,
+		})
 	}
+	m.keywordCountsMu.RUnlock()
+
+	sort.Slice(throughput, func(i, j int) bool {
+		if throughput[i].Messages != throughput[j].Messages {
+			return throughput[i].Messages > throughput[j].Messages
+		}
+		return throughput[i].Keyword < throughput[j].Keyword
+	})
+	return throughput
 }
 
-// resetKeywordActivityCounts clears the internal counts for the next window
-func (m *Manager) resetKeywordActivityCounts() {
+// publishKeywordActivity sets each keyword's gauge to its count for the window that just ended
+// and starts a new window, so the gauge never shows a partly counted window. Filters can use any
+// keyword, so only the busiest keywordActivityMaxLabels keywords get their own series, and the
+// series of keywords without messages in the window are deleted rather than kept at 0.
+func (m *Manager) publishKeywordActivity() {
 	m.keywordCountsMu.Lock()
 	defer m.keywordCountsMu.Unlock()
 
-	// Clear the internal counts for next window
+	keywords := make([]string, 0, len(m.keywordCounts))
+	for keyword := range m.keywordCounts {
+		keywords = append(keywords, keyword)
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if m.keywordCounts[keywords[i]] != m.keywordCounts[keywords[j]] {
+			return m.keywordCounts[keywords[i]] > m.keywordCounts[keywords[j]]
+		}
+		return keywords[i] < keywords[j]
+	})
+
+	published := make(map[string]bool, min(len(keywords), keywordActivityMaxLabels+1))
+	other := 0
+	for i, keyword := range keywords {
+		count := m.keywordCounts[keyword]
+		slog.Debug("Keyword activity", "keyword", keyword, "messages", count)
+		if i >= keywordActivityMaxLabels {
+			other += count
+			continue
+		}
+		metriks.KeywordActivity.WithLabelValues(keyword).Set(float64(count))
+		published[keyword] = true
+	}
+	if other > 0 {
+		metriks.KeywordActivity.WithLabelValues(otherKeywordLabel).Set(float64(other))
+		published[otherKeywordLabel] = true
+	}
+	for keyword := range m.keywordPublished {
+		if !published[keyword] {
+			metriks.KeywordActivity.DeleteLabelValues(keyword)
+		}
+	}
+	m.keywordPublished = published
 	m.keywordCounts = make(map[string]int)
+
+	// Rates that have gone quiet are dropped so keywords from deleted filters don't linger
+	now := time.Now()
+	for keyword, rate := range m.keywordRates {
+		if rate.total(now) == 0 {
+			delete(m.keywordRates, keyword)
+		}
+	}
 }
 
 // stopActivityTracking stops the keyword activity tracking routine
@@ -771,7 +2929,7 @@ func (m *Manager) stopActivityTracking() {
 	if m.activityRunning && m.activityStop != nil {
 		select {
 		case m.activityStop <- true:
-			log.Printf("📊 Stopped keyword activity tracking")
+			slog.Info("Stopped keyword activity tracking")
 		default:
 			// Channel might be closed or full, that's OK
 		}
@@ -50,6 +50,22 @@ func TestCreateFilterValidation(t *testing.T) {
 	}
 }
 
+func TestCreateFilterKeywordMatchModeValidation(t *testing.T) {
+	manager := NewManager()
+
+	for _, mode := range []string{"", models.KeywordMatchAny, models.KeywordMatchAll} {
+		filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello,world", KeywordMatchMode: mode})
+		if filterKey == "" {
+			t.Errorf("Expected valid filter key for keyword match mode %q", mode)
+		}
+	}
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello,world", KeywordMatchMode: "most"})
+	if filterKey != "" {
+		t.Error("Expected empty filter key for unknown keyword match mode")
+	}
+}
+
 func TestMatchesFilterSafety(t *testing.T) {
 	manager := NewManager()
 
@@ -1,12 +1,117 @@
 package subscription
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
 	"github.com/JWhist/AT_Proto_PubSub/internal/models"
 )
 
+// fakeConnection is an in-memory Connection that records the messages written to it
+type fakeConnection struct {
+	mu       sync.Mutex
+	messages []interface{}
+	closed   bool
+}
+
+func (c *fakeConnection) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, v)
+	return nil
+}
+
+func (c *fakeConnection) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *fakeConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeConnection) messageCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.messages)
+}
+
+func (c *fakeConnection) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// message returns the i-th message written to the connection
+func (c *fakeConnection) message(i int) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.messages[i]
+}
+
+// eventText returns the text of the first op of an event message, or "" for other messages
+func eventText(message interface{}) string {
+	wsMessage, ok := message.(models.WSMessage)
+	if !ok {
+		return ""
+	}
+	event, ok := wsMessage.Data.(models.EnrichedATEvent)
+	if !ok || len(event.Ops) == 0 {
+		return ""
+	}
+	text, _ := event.Ops[0].Record.(map[string]interface{})["text"].(string)
+	return text
+}
+
+// failingConnection is a fakeConnection whose writes always fail, like a dropped client
+type failingConnection struct {
+	fakeConnection
+}
+
+func (c *failingConnection) WriteJSON(interface{}) error { return errors.New("broken pipe") }
+
+// fakeAddrConnection is a fakeConnection that reports a client address
+type fakeAddrConnection struct {
+	fakeConnection
+	addr net.Addr
+}
+
+func (c *fakeAddrConnection) RemoteAddr() net.Addr { return c.addr }
+
+// fakeWebSocketConnection also accepts control frames, like *websocket.Conn
+type fakeWebSocketConnection struct {
+	fakeConnection
+	closeFrames [][]byte
+	onControl   func() // Called after each control frame, e.g. to simulate the client closing
+}
+
+func (c *fakeWebSocketConnection) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.mu.Lock()
+	if messageType == websocket.CloseMessage {
+		c.closeFrames = append(c.closeFrames, data)
+	}
+	c.mu.Unlock()
+	if c.onControl != nil {
+		c.onControl()
+	}
+	return nil
+}
+
 func TestNewManager(t *testing.T) {
 	manager := NewManager()
 	if manager == nil {
@@ -470,180 +575,2615 @@ func TestRecordContainsKeywords(t *testing.T) {
 	}
 }
 
-func TestGetStats(t *testing.T) {
+func TestRecordMatchesKeywordsAllMode(t *testing.T) {
 	manager := NewManager()
 
-	// Test with no filters
-	stats := manager.GetStats()
-	if stats["active_filters"] != 0 {
-		t.Errorf("Expected 0 active filters, got %v", stats["active_filters"])
-	}
-	if stats["total_connections"] != 0 {
-		t.Errorf("Expected 0 total connections, got %v", stats["total_connections"])
+	tests := []struct {
+		name     string
+		record   interface{}
+		keywords string
+		mode     string
+		expected bool
+	}{
+		{
+			name:     "All mode - every keyword present",
+			record:   map[string]interface{}{"text": "Hello world, this is a test"},
+			keywords: "test,hello,world",
+			mode:     models.KeywordMatchAll,
+			expected: true,
+		},
+		{
+			name:     "All mode - one keyword missing",
+			record:   map[string]interface{}{"text": "Hello world"},
+			keywords: "test,hello,world",
+			mode:     models.KeywordMatchAll,
+			expected: false,
+		},
+		{
+			name:     "All mode - ignores empty entries",
+			record:   map[string]interface{}{"text": "Hello world"},
+			keywords: "hello,, world",
+			mode:     models.KeywordMatchAll,
+			expected: true,
+		},
+		{
+			name:     "Any mode - one keyword present",
+			record:   map[string]interface{}{"text": "Hello there"},
+			keywords: "test,hello,world",
+			mode:     models.KeywordMatchAny,
+			expected: true,
+		},
+		{
+			name:     "Empty mode defaults to any",
+			record:   map[string]interface{}{"text": "Hello there"},
+			keywords: "test,hello,world",
+			mode:     "",
+			expected: true,
+		},
 	}
 
-	// Create some filters with required keywords
-	options1 := models.FilterOptions{
-		Repository: "did:plc:test1",
-		Keyword:    "test",
-	}
-	options2 := models.FilterOptions{
-		Repository: "did:plc:test2",
-		Keyword:    "hello",
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := manager.recordMatchesKeywords(tt.record, tt.keywords, models.FilterOptions{KeywordMatchMode: tt.mode})
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for keywords: %s (mode: %s)", tt.expected, result, tt.keywords, tt.mode)
+			}
+		})
 	}
+}
 
-	manager.CreateFilter(options1)
-	manager.CreateFilter(options2)
+func TestDeepTextSearch(t *testing.T) {
+	manager := NewManager()
 
-	stats = manager.GetStats()
-	if stats["active_filters"] != 2 {
-		t.Errorf("Expected 2 active filters, got %v", stats["active_filters"])
+	event := &models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{
+			Action: "create",
+			Path:   "app.bsky.feed.post/abc123",
+			Record: map[string]interface{}{
+				"text": "worth a read",
+				"embed": map[string]interface{}{
+					"$type": "app.bsky.embed.external",
+					"external": map[string]interface{}{
+						"uri":         "https://example.com/article",
+						"title":       "Golang generics explained",
+						"description": "A deep dive",
+					},
+				},
+				"facets": []interface{}{
+					map[string]interface{}{
+						"features": []interface{}{
+							map[string]interface{}{"$type": "app.bsky.richtext.facet#tag", "tag": "programming"},
+						},
+					},
+				},
+			},
+		}},
 	}
-}
 
-func TestGenerateFilterKey(t *testing.T) {
-	// Test that keys are unique
-	keys := make(map[string]bool)
-	for i := 0; i < 100; i++ {
-		key := generateFilterKey()
-		if keys[key] {
-			t.Errorf("Duplicate filter key generated: %s", key)
-		}
-		keys[key] = true
+	tests := []struct {
+		name     string
+		options  models.FilterOptions
+		expected bool
+	}{
+		{name: "Body keyword", options: models.FilterOptions{Keyword: "worth"}, expected: true},
+		{name: "Embed title without deep search", options: models.FilterOptions{Keyword: "golang"}, expected: false},
+		{name: "Embed title with deep search", options: models.FilterOptions{Keyword: "golang", DeepTextSearch: true}, expected: true},
+		{name: "Facet tag with deep search", options: models.FilterOptions{Keyword: "programming", DeepTextSearch: true}, expected: true},
+		{name: "All mode across body and embed", options: models.FilterOptions{Keyword: "worth,dive", KeywordMatchMode: "all", DeepTextSearch: true}, expected: true},
+		{name: "Regex with deep search", options: models.FilterOptions{Keyword: "gener(ic|ics)", KeywordRegex: true, DeepTextSearch: true}, expected: true},
+		{name: "Regex without deep search", options: models.FilterOptions{Keyword: "gener(ic|ics)", KeywordRegex: true}, expected: false},
+	}
 
-		if len(key) != 32 {
-			t.Errorf("Expected filter key length 32, got %d", len(key))
-		}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(event, tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
 	}
 }
 
-func TestConcurrentAccess(t *testing.T) {
+func TestLangFilter(t *testing.T) {
 	manager := NewManager()
 
-	// Test concurrent filter creation and access
-	done := make(chan bool, 4)
-
-	// Multiple creators
-	go func() {
-		for i := 0; i < 50; i++ {
-			options := models.FilterOptions{
-				Repository: "did:plc:test",
-				Keyword:    "test",
-			}
-			manager.CreateFilter(options)
-		}
-		done <- true
-	}()
-
-	go func() {
-		for i := 0; i < 50; i++ {
-			options := models.FilterOptions{
-				PathPrefix: "app.bsky.feed.post",
-				Keyword:    "hello",
-			}
-			manager.CreateFilter(options)
-		}
-		done <- true
-	}()
-
-	// Multiple readers
-	go func() {
-		for i := 0; i < 100; i++ {
-			manager.GetSubscriptions()
+	newEvent := func(record map[string]interface{}) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: record}},
 		}
-		done <- true
-	}()
+	}
 
-	go func() {
-		for i := 0; i < 100; i++ {
-			manager.GetStats()
-		}
-		done <- true
-	}()
+	tests := []struct {
+		name     string
+		langs    []string
+		record   map[string]interface{}
+		expected bool
+	}{
+		{name: "No language filter", langs: nil, record: map[string]interface{}{"text": "hello"}, expected: true},
+		{name: "Matching language", langs: []string{"en"}, record: map[string]interface{}{"text": "hello", "langs": []interface{}{"en"}}, expected: true},
+		{name: "One of several record langs", langs: []string{"ja"}, record: map[string]interface{}{"text": "hello", "langs": []interface{}{"en", "ja"}}, expected: true},
+		{name: "Different language", langs: []string{"ja"}, record: map[string]interface{}{"text": "hello", "langs": []interface{}{"en"}}, expected: false},
+		{name: "Missing langs", langs: []string{"en"}, record: map[string]interface{}{"text": "hello"}, expected: false},
+		{name: "Empty langs", langs: []string{"en"}, record: map[string]interface{}{"text": "hello", "langs": []interface{}{}}, expected: false},
+	}
 
-	// Wait for all goroutines
-	for i := 0; i < 4; i++ {
-		<-done
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{Keyword: "hello", Langs: tt.langs}
+			if result := manager.matchesFilter(newEvent(tt.record), options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
 	}
 
-	// Verify final state
-	subs := manager.GetSubscriptions()
-	if len(subs) != 100 {
-		t.Errorf("Expected 100 subscriptions after concurrent creation, got %d", len(subs))
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", Langs: []string{"e n"}}); key != "" {
+		t.Error("Expected invalid language to be rejected")
 	}
 }
 
-func TestEmptyFilterCleanup(t *testing.T) {
+func TestTextLengthFilter(t *testing.T) {
 	manager := NewManager()
 
-	// Create some filters
-	options1 := models.FilterOptions{Repository: "did:plc:test1", Keyword: "test"}
-	options2 := models.FilterOptions{Repository: "did:plc:test2", Keyword: "hello"}
-	options3 := models.FilterOptions{Repository: "did:plc:test3", Keyword: "world"}
-
-	filterKey1 := manager.CreateFilter(options1)
-	filterKey2 := manager.CreateFilter(options2)
-	filterKey3 := manager.CreateFilter(options3)
+	newEvent := func(records ...interface{}) *models.ATEvent {
+		event := &models.ATEvent{Did: "did:plc:test123"}
+		for _, record := range records {
+			event.Ops = append(event.Ops, models.ATOperation{Action: "create", Path: "app.bsky.feed.post/abc123", Record: record})
+		}
+		return event
+	}
 
-	// Verify all filters exist
-	if len(manager.GetSubscriptions()) != 3 {
-		t.Errorf("Expected 3 filters initially, got %d", len(manager.GetSubscriptions()))
+	tests := []struct {
+		name     string
+		event    *models.ATEvent
+		expected bool
+	}{
+		{name: "Within range", event: newEvent(map[string]interface{}{"text": "hello world"}), expected: true},
+		{name: "Exactly at minimum", event: newEvent(map[string]interface{}{"text": "0123456789"}), expected: true},
+		{name: "Below minimum", event: newEvent(map[string]interface{}{"text": "too short"}), expected: false},
+		{name: "Exactly at maximum", event: newEvent(map[string]interface{}{"text": strings.Repeat("a", 20)}), expected: true},
+		{name: "Above maximum", event: newEvent(map[string]interface{}{"text": strings.Repeat("a", 21)}), expected: false},
+		{name: "Empty text", event: newEvent(map[string]interface{}{"text": ""}), expected: false},
+		{name: "Missing record", event: newEvent(nil), expected: false},
+		{name: "Message fallback", event: newEvent(map[string]interface{}{"message": "hello world"}), expected: true},
+		{name: "Multibyte counted in runes", event: newEvent(map[string]interface{}{"text": strings.Repeat("猫", 20)}), expected: true}, // 60 bytes
+		{name: "Any op in range", event: newEvent(map[string]interface{}{"text": "short"}, map[string]interface{}{"text": "long enough"}), expected: true},
 	}
 
-	// Add a connection to filterKey2 only
-	manager.AddConnection(filterKey2, nil) // Using nil for simplicity in test
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{PathPrefix: "app.bsky.feed.post", MinTextLength: 10, MaxTextLength: 20}
+			if result := manager.matchesFilter(tt.event, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
 
-	// Create a mock event
-	event := &models.ATEvent{
-		Did: "did:plc:test123",
-		Ops: []models.ATOperation{
-			{
-				Action: "create",
-				Path:   "app.bsky.feed.post/test",
-				Record: map[string]interface{}{
-					"text": "test message",
-				},
-			},
-		},
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", MinTextLength: 30, MaxTextLength: 10}); key != "" {
+		t.Error("Expected minimum above maximum to be rejected")
+	}
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", MinTextLength: -1}); key != "" {
+		t.Error("Expected negative minimum to be rejected")
 	}
+}
 
-	// Broadcast event - this should NOT trigger cleanup of empty filters anymore
-	manager.BroadcastEvent(event)
+func TestFacetCountFilter(t *testing.T) {
+	manager := NewManager()
 
-	// Verify that all filters still exist (no cleanup during broadcast)
-	remainingFilters := manager.GetSubscriptions()
-	if len(remainingFilters) != 3 {
-		t.Errorf("Expected 3 filters after broadcast (no cleanup), got %d", len(remainingFilters))
+	newEvent := func(records ...interface{}) *models.ATEvent {
+		event := &models.ATEvent{Did: "did:plc:test123"}
+		for _, record := range records {
+			event.Ops = append(event.Ops, models.ATOperation{Action: "create", Path: "app.bsky.feed.post/abc123", Record: record})
+		}
+		return event
+	}
+	feature := func(featureType string) map[string]interface{} {
+		return map[string]interface{}{"$type": "app.bsky.richtext.facet#" + featureType}
+	}
+	post := func(features ...map[string]interface{}) map[string]interface{} {
+		var facets []interface{}
+		for _, f := range features {
+			facets = append(facets, map[string]interface{}{"features": []interface{}{f}})
+		}
+		return map[string]interface{}{"text": "hello world", "facets": facets}
 	}
 
-	// Now remove the connection from filterKey2 - this should trigger cleanup
-	manager.RemoveConnection(filterKey2, nil)
+	tests := []struct {
+		name     string
+		event    *models.ATEvent
+		expected bool
+	}{
+		{name: "Enough links and mentions", event: newEvent(post(feature("link"), feature("mention"), feature("mention"))), expected: true},
+		{name: "Too few mentions", event: newEvent(post(feature("link"), feature("mention"))), expected: false},
+		{name: "Too few links", event: newEvent(post(feature("mention"), feature("mention"), feature("tag"))), expected: false},
+		{name: "Several features in one facet", event: newEvent(map[string]interface{}{"facets": []interface{}{
+			map[string]interface{}{"features": []interface{}{feature("link"), feature("mention"), feature("mention")}},
+		}}), expected: true},
+		{name: "Raw CBOR maps", event: newEvent(map[interface{}]interface{}{"facets": []interface{}{
+			map[interface{}]interface{}{"features": []interface{}{
+				map[interface{}]interface{}{"$type": "app.bsky.richtext.facet#link"},
+				map[interface{}]interface{}{"$type": "app.bsky.richtext.facet#mention"},
+				map[interface{}]interface{}{"$type": "app.bsky.richtext.facet#mention"},
+			}},
+		}}), expected: true},
+		{name: "No facets", event: newEvent(map[string]interface{}{"text": "hello world"}), expected: false},
+		{name: "Missing record", event: newEvent(nil), expected: false},
+		{name: "Any op with enough facets", event: newEvent(post(), post(feature("link"), feature("mention"), feature("mention"))), expected: true},
+	}
 
-	// Verify filterKey2 was cleaned up when its last connection was removed
-	afterRemoveFilters := manager.GetSubscriptions()
-	if len(afterRemoveFilters) != 2 {
-		t.Errorf("Expected 2 filters after connection removal, got %d", len(afterRemoveFilters))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{PathPrefix: "app.bsky.feed.post", MinLinks: 1, MinMentions: 2}
+			if result := manager.matchesFilter(tt.event, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
 	}
 
-	// Verify filterKey2 no longer exists but others do
-	_, exists2 := manager.GetSubscription(filterKey2)
-	_, exists1 := manager.GetSubscription(filterKey1)
-	_, exists3 := manager.GetSubscription(filterKey3)
+	// Without minimums, records lacking facets still match
+	if !manager.matchesFilter(newEvent(map[string]interface{}{"text": "hello world"}), models.FilterOptions{Keyword: "hello"}) {
+		t.Error("Expected a record without facets to match when no minimums are set")
+	}
 
-	if exists2 {
-		t.Error("Filter with removed connection should have been cleaned up")
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", MinLinks: -1}); key != "" {
+		t.Error("Expected a negative link minimum to be rejected")
 	}
-	if !exists1 || !exists3 {
-		t.Error("Filters without connections should still exist (only cleaned up when last connection is removed)")
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", MinMentions: -1}); key != "" {
+		t.Error("Expected a negative mention minimum to be rejected")
 	}
 }
 
-func TestPeriodicCleanup(t *testing.T) {
-	// Create a manager but we'll manually control the cleanup for testing
-	manager := &Manager{
-		subscriptions:  make(map[string]*Subscription),
-		maxConnections: 1000,
-		cleanupStop:    make(chan bool, 1),
+func TestCreatedAtFilter(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(records ...interface{}) *models.ATEvent {
+		event := &models.ATEvent{Did: "did:plc:test123"}
+		for _, record := range records {
+			event.Ops = append(event.Ops, models.ATOperation{Action: "create", Path: "app.bsky.feed.post/abc123", Record: record})
+		}
+		return event
+	}
+	post := func(createdAt string) map[string]interface{} {
+		return map[string]interface{}{"text": "hello world", "createdAt": createdAt}
+	}
+
+	tests := []struct {
+		name     string
+		event    *models.ATEvent
+		expected bool
+	}{
+		{name: "Within window", event: newEvent(post("2024-06-01T12:00:00Z")), expected: true},
+		{name: "Fractional seconds", event: newEvent(post("2024-06-01T12:00:00.123Z")), expected: true},
+		{name: "Offset timezone", event: newEvent(post("2024-06-01T12:00:00+09:00")), expected: true},
+		{name: "Exactly at since", event: newEvent(post("2024-01-01T00:00:00Z")), expected: true},
+		{name: "Before since", event: newEvent(post("2023-12-31T23:59:59Z")), expected: false},
+		{name: "Exactly at until", event: newEvent(post("2025-01-01T00:00:00Z")), expected: false},
+		{name: "After until", event: newEvent(post("2025-03-01T00:00:00Z")), expected: false},
+		{name: "Missing createdAt", event: newEvent(map[string]interface{}{"text": "hello world"}), expected: false},
+		{name: "Invalid createdAt", event: newEvent(post("yesterday")), expected: false},
+		{name: "Missing record", event: newEvent(nil), expected: false},
+		{name: "Any op in window", event: newEvent(post("2020-01-01T00:00:00Z"), post("2024-06-01T12:00:00Z")), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{Keyword: "hello", Since: "2024-01-01T00:00:00Z", Until: "2025-01-01T00:00:00Z"}
+			if result := manager.matchesFilter(tt.event, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Without bounds, records lacking createdAt still match
+	if !manager.matchesFilter(newEvent(map[string]interface{}{"text": "hello world"}), models.FilterOptions{Keyword: "hello"}) {
+		t.Error("Expected a record without createdAt to match when no bounds are set")
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", Since: "2024-01-01"}); key != "" {
+		t.Error("Expected a non-RFC3339 since to be rejected")
+	}
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", Since: "2025-01-01T00:00:00Z", Until: "2024-01-01T00:00:00Z"}); key != "" {
+		t.Error("Expected since after until to be rejected")
+	}
+}
+
+func TestTextFields(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(record interface{}) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: record}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		options  models.FilterOptions
+		record   interface{}
+		expected bool
+	}{
+		{
+			name:     "Default fields",
+			options:  models.FilterOptions{Keyword: "hello"},
+			record:   map[string]interface{}{"content": "hello world"},
+			expected: true,
+		},
+		{
+			name:     "Default fields are all searched",
+			options:  models.FilterOptions{Keyword: "hello"},
+			record:   map[string]interface{}{"text": "first", "message": "hello world"},
+			expected: true,
+		},
+		{
+			name:     "Default fields skip custom field",
+			options:  models.FilterOptions{Keyword: "hello"},
+			record:   map[string]interface{}{"body": "hello world"},
+			expected: false,
+		},
+		{
+			name:     "Custom field",
+			options:  models.FilterOptions{Keyword: "hello", TextFields: []string{"body"}},
+			record:   map[string]interface{}{"body": "hello world"},
+			expected: true,
+		},
+		{
+			name:     "Custom fields replace defaults",
+			options:  models.FilterOptions{Keyword: "hello", TextFields: []string{"body"}},
+			record:   map[string]interface{}{"text": "hello world"},
+			expected: false,
+		},
+		{
+			name:     "Nested field",
+			options:  models.FilterOptions{Keyword: "hello", TextFields: []string{"embed.external.title"}},
+			record:   map[string]interface{}{"embed": map[string]interface{}{"external": map[string]interface{}{"title": "hello world"}}},
+			expected: true,
+		},
+		{
+			name:     "Non-string field ignored",
+			options:  models.FilterOptions{Keyword: "hello", TextFields: []string{"body", "text"}},
+			record:   map[string]interface{}{"body": 42, "text": "hello world"},
+			expected: true,
+		},
+		{
+			name:     "Regex uses custom fields",
+			options:  models.FilterOptions{Keyword: "^hel+o", KeywordRegex: true, TextFields: []string{"body"}},
+			record:   map[string]interface{}{"body": "hello world"},
+			expected: true,
+		},
+		{
+			name:     "Text length uses first custom field",
+			options:  models.FilterOptions{Keyword: "hello", TextFields: []string{"title", "body"}, MaxTextLength: 5},
+			record:   map[string]interface{}{"title": "hello", "body": "hello world"},
+			expected: true,
+		},
+		{
+			name:     "Struct record",
+			options:  models.FilterOptions{Keyword: "hello"},
+			record:   models.RecordContent{Text: "hello world"},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(newEvent(tt.record), tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Server-wide fields apply to filters that don't list their own
+	manager.SetTextFields([]string{"body"})
+	if !manager.matchesFilter(newEvent(map[string]interface{}{"body": "hello world"}), models.FilterOptions{Keyword: "hello"}) {
+		t.Error("Expected server-wide text fields to be searched")
+	}
+	if manager.matchesFilter(newEvent(map[string]interface{}{"text": "hello world"}), models.FilterOptions{Keyword: "hello"}) {
+		t.Error("Expected server-wide text fields to replace the defaults")
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", TextFields: []string{"bad field"}}); key != "" {
+		t.Error("Expected invalid text field to be rejected")
+	}
+}
+
+func TestWholeWordMatching(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(text string) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": text}}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		options  models.FilterOptions
+		expected bool
+	}{
+		{name: "Substring without whole word", text: "New category!", options: models.FilterOptions{Keyword: "cat"}, expected: true},
+		{name: "Substring with whole word", text: "New category!", options: models.FilterOptions{Keyword: "cat", WholeWord: true}, expected: false},
+		{name: "Punctuation boundary", text: "Look, a cat!", options: models.FilterOptions{Keyword: "cat", WholeWord: true}, expected: true},
+		{name: "Emoji boundary", text: "😺cat😺", options: models.FilterOptions{Keyword: "cat", WholeWord: true}, expected: true},
+		{name: "All mode with whole word", text: "cat and dogs", options: models.FilterOptions{Keyword: "cat,dog", KeywordMatchMode: "all", WholeWord: true}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(newEvent(tt.text), tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Matched keywords honor whole-word matching too
+	keywords := manager.getMatchingKeywords(newEvent("cat in a category"), models.FilterOptions{Keyword: "cat,categ", WholeWord: true})
+	if !reflect.DeepEqual(keywords, []string{"cat"}) {
+		t.Errorf("Expected [cat], got %v", keywords)
+	}
+}
+
+func TestKeywordMatchTypes(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(record map[string]interface{}) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: record}},
+		}
+	}
+	post := func(text string) map[string]interface{} {
+		return map[string]interface{}{"text": text}
+	}
+
+	tests := []struct {
+		name     string
+		record   map[string]interface{}
+		options  models.FilterOptions
+		expected bool
+	}{
+		{name: "Substring matches inside a word", record: post("testing 1 2 3"), options: models.FilterOptions{Keyword: "test"}, expected: true},
+		{name: "Word skips inside a word", record: post("testing 1 2 3"), options: models.FilterOptions{Keyword: "test", MatchType: models.MatchTypeWord}, expected: false},
+		{name: "Word matches a whole word", record: post("just a test"), options: models.FilterOptions{Keyword: "test", MatchType: models.MatchTypeWord}, expected: true},
+		{name: "Exact text skips a whole word", record: post("just a test"), options: models.FilterOptions{Keyword: "test", MatchType: models.MatchTypeExactText}, expected: false},
+		{name: "Exact text matches the whole text", record: post(" Test "), options: models.FilterOptions{Keyword: "test", MatchType: models.MatchTypeExactText}, expected: true},
+		{name: "Exact text with any keyword", record: post("gm"), options: models.FilterOptions{Keyword: "gn,gm", MatchType: models.MatchTypeExactText}, expected: true},
+		{
+			name:     "Exact text compares each field on its own",
+			record:   map[string]interface{}{"text": "gm", "message": "good morning"},
+			options:  models.FilterOptions{Keyword: "gm", MatchType: models.MatchTypeExactText, TextFields: []string{"text", "message"}},
+			expected: true,
+		},
+		{
+			name:     "Exact text in deep search",
+			record:   map[string]interface{}{"text": "look", "embed": map[string]interface{}{"external": map[string]interface{}{"title": "Launch"}}},
+			options:  models.FilterOptions{Keyword: "launch", MatchType: models.MatchTypeExactText, DeepTextSearch: true},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(newEvent(tt.record), tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Matched keywords honor the match type too
+	keywords := manager.getMatchingKeywords(newEvent(post("test")), models.FilterOptions{Keyword: "test,tes", MatchType: models.MatchTypeExactText})
+	if !reflect.DeepEqual(keywords, []string{"test"}) {
+		t.Errorf("Expected [test], got %v", keywords)
+	}
+
+	// Unknown match types, and wholeWord with a different one, are rejected
+	if manager.CreateFilter(models.FilterOptions{Keyword: "test", MatchType: "fuzzy"}) != "" {
+		t.Error("Expected an unknown match type to be rejected")
+	}
+	if manager.CreateFilter(models.FilterOptions{Keyword: "test", WholeWord: true, MatchType: models.MatchTypeExactText}) != "" {
+		t.Error("Expected wholeWord with the exact-text match type to be rejected")
+	}
+	if manager.CreateFilter(models.FilterOptions{Keyword: "test", WholeWord: true, MatchType: models.MatchTypeWord}) == "" {
+		t.Error("Expected wholeWord with the word match type to be accepted")
+	}
+}
+
+func TestNormalizeUnicodeMatching(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(text string) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": text}}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		options  models.FilterOptions
+		expected bool
+	}{
+		{name: "Accent without normalization", text: "Best café in town", options: models.FilterOptions{Keyword: "cafe"}, expected: false},
+		{name: "Accent with normalization", text: "Best café in town", options: models.FilterOptions{Keyword: "cafe", NormalizeUnicode: true}, expected: true},
+		{name: "Full-width with normalization", text: "ｈｅｌｌｏ ｗｏｒｌｄ", options: models.FilterOptions{Keyword: "hello", NormalizeUnicode: true}, expected: true},
+		{name: "All mode", text: "crème brûlée", options: models.FilterOptions{Keyword: "creme,brulee", KeywordMatchMode: "all", NormalizeUnicode: true}, expected: true},
+		{name: "Whole word after folding", text: "catégorie", options: models.FilterOptions{Keyword: "cat", WholeWord: true, NormalizeUnicode: true}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(newEvent(tt.text), tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Matched keywords are reported as the filter spells them
+	keywords := manager.getMatchingKeywords(newEvent("Déjà vu at the café"), models.FilterOptions{Keyword: "deja vu,cafe,tea", NormalizeUnicode: true})
+	if !reflect.DeepEqual(keywords, []string{"deja vu", "cafe"}) {
+		t.Errorf("Expected [deja vu cafe], got %v", keywords)
+	}
+}
+
+func TestCaseSensitiveMatching(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(text string) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": text}}},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		options  models.FilterOptions
+		expected bool
+	}{
+		{name: "Insensitive by default", text: "watching $aapl", options: models.FilterOptions{Keyword: "$AAPL"}, expected: true},
+		{name: "Exact case matches", text: "watching $AAPL", options: models.FilterOptions{Keyword: "$AAPL", CaseSensitive: true}, expected: true},
+		{name: "Different case rejected", text: "watching $aapl", options: models.FilterOptions{Keyword: "$AAPL", CaseSensitive: true}, expected: false},
+		{name: "Any mode needs one exact match", text: "$aapl and $MSFT", options: models.FilterOptions{Keyword: "$AAPL,$MSFT", CaseSensitive: true}, expected: true},
+		{name: "All mode needs every exact match", text: "$aapl and $MSFT", options: models.FilterOptions{Keyword: "$AAPL,$MSFT", KeywordMatchMode: "all", CaseSensitive: true}, expected: false},
+		{name: "Whole word", text: "GOing home", options: models.FilterOptions{Keyword: "GO", WholeWord: true, CaseSensitive: true}, expected: false},
+		{name: "Regex insensitive by default", text: "Ticker: aapl", options: models.FilterOptions{Keyword: `\b[A-Z]{4}\b`, KeywordRegex: true}, expected: true},
+		{name: "Regex with exact case", text: "Ticker: aapl", options: models.FilterOptions{Keyword: `\b[A-Z]{4}\b`, KeywordRegex: true, CaseSensitive: true}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(newEvent(tt.text), tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Case-sensitive and insensitive filters on the same keyword receive different events
+	exact := manager.CreateFilter(models.FilterOptions{Keyword: "$AAPL", CaseSensitive: true})
+	loose := manager.CreateFilter(models.FilterOptions{Keyword: "$AAPL"})
+	if exact == loose {
+		t.Fatal("Expected caseSensitive to produce a different filter key")
+	}
+	exactConn, looseConn := &fakeConnection{}, &fakeConnection{}
+	manager.AddConnection(exact, exactConn)
+	manager.AddConnection(loose, looseConn)
+	manager.BroadcastEvent(newEvent("$AAPL up"))
+	manager.BroadcastEvent(newEvent("$aapl down"))
+	waitFor(t, func() bool { return looseConn.messageCount() == 2 })
+	if count := exactConn.messageCount(); count != 1 {
+		t.Errorf("Expected the case-sensitive filter to receive 1 message, got %d", count)
+	}
+
+	// Matched keywords honor the case too
+	keywords := manager.getMatchingKeywords(newEvent("$aapl and $MSFT"), models.FilterOptions{Keyword: "$AAPL,$MSFT", CaseSensitive: true})
+	if !reflect.DeepEqual(keywords, []string{"$MSFT"}) {
+		t.Errorf("Expected [$MSFT], got %v", keywords)
+	}
+}
+
+func TestKeywordRegexMatching(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name     string
+		record   interface{}
+		options  models.FilterOptions
+		expected bool
+	}{
+		{
+			name:     "Pattern matches text",
+			record:   map[string]interface{}{"text": "Order #12345 shipped"},
+			options:  models.FilterOptions{Keyword: `#\d{5}`, KeywordRegex: true},
+			expected: true,
+		},
+		{
+			name:     "Pattern is case-insensitive",
+			record:   map[string]interface{}{"text": "BLUESKY rocks"},
+			options:  models.FilterOptions{Keyword: `^bluesky`, KeywordRegex: true},
+			expected: true,
+		},
+		{
+			name:     "Pattern does not match",
+			record:   map[string]interface{}{"text": "nothing to see"},
+			options:  models.FilterOptions{Keyword: `^bluesky`, KeywordRegex: true},
+			expected: false,
+		},
+		{
+			name:     "Pattern matches concatenated text fields",
+			record:   map[string]interface{}{"text": "first", "message": "second"},
+			options:  models.FilterOptions{Keyword: `second`, KeywordRegex: true},
+			expected: true,
+		},
+		{
+			name:     "All mode requires every pattern",
+			record:   map[string]interface{}{"text": "cats and dogs"},
+			options:  models.FilterOptions{Keyword: `cats?,birds?`, KeywordRegex: true, KeywordMatchMode: models.KeywordMatchAll},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.ATEvent{
+				Did: "did:plc:test123",
+				Ops: []models.ATOperation{{Path: "app.bsky.feed.post/1", Record: tt.record}},
+			}
+
+			filterKey := manager.CreateFilter(tt.options)
+			if filterKey == "" {
+				t.Fatalf("Expected filter with pattern %q to be created", tt.options.Keyword)
+			}
+
+			manager.mu.RLock()
+			sub := manager.subscriptions[filterKey]
+			manager.mu.RUnlock()
+
+			result := manager.matchesFilterWithPatterns(event, sub.Options, sub.keywordPatterns)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v for pattern: %s", tt.expected, result, tt.options.Keyword)
+			}
+			if uncompiled := manager.matchesFilter(event, tt.options); uncompiled != tt.expected {
+				t.Errorf("matchesFilter expected %v, got %v for pattern: %s", tt.expected, uncompiled, tt.options.Keyword)
+			}
+		})
+	}
+}
+
+func TestCreateFilterInvalidKeywordRegex(t *testing.T) {
+	manager := NewManager()
+
+	if filterKey := manager.CreateFilter(models.FilterOptions{Keyword: `(unclosed`, KeywordRegex: true}); filterKey != "" {
+		t.Error("Expected empty filter key for invalid keyword regex")
+	}
+}
+
+func TestActionFilter(t *testing.T) {
+	manager := NewManager()
+
+	event := &models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{
+			{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello world"}},
+			{Action: "delete", Path: "app.bsky.feed.post/2"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		actions  []string
+		expected bool
+		opsKept  int
+	}{
+		{name: "No actions means all", actions: nil, expected: true, opsKept: 2},
+		{name: "Create only", actions: []string{"create"}, expected: true, opsKept: 1},
+		{name: "Create and delete", actions: []string{"create", "delete"}, expected: true, opsKept: 2},
+		{name: "Update only", actions: []string{"update"}, expected: false, opsKept: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{Keyword: "hello", Actions: tt.actions}
+
+			if result := manager.matchesFilter(event, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v for actions %v", tt.expected, result, tt.actions)
+			}
+
+			filtered := filterEventOpsByAction(event, options)
+			if len(filtered.Ops) != tt.opsKept {
+				t.Errorf("Expected %d ops after action filtering, got %d", tt.opsKept, len(filtered.Ops))
+			}
+		})
+	}
+
+	if len(event.Ops) != 2 {
+		t.Error("Action filtering should not modify the original event")
+	}
+}
+
+func TestCollectionFilter(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(ops ...models.ATOperation) *models.ATEvent {
+		return &models.ATEvent{Did: "did:plc:test123", Ops: ops}
+	}
+	record := map[string]interface{}{"text": "hello world"}
+
+	tests := []struct {
+		name        string
+		collections []string
+		event       *models.ATEvent
+		expected    bool
+	}{
+		{
+			name:        "No collections means all",
+			collections: nil,
+			event:       newEvent(models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Collection: "app.bsky.feed.post", Record: record}),
+			expected:    true,
+		},
+		{
+			name:        "Exact collection",
+			collections: []string{"app.bsky.feed.like"},
+			event:       newEvent(models.ATOperation{Action: "create", Path: "app.bsky.feed.like/1", Collection: "app.bsky.feed.like", Record: record}),
+			expected:    true,
+		},
+		{
+			name:        "Longer NSID with the same prefix",
+			collections: []string{"app.bsky.feed.like"},
+			event:       newEvent(models.ATOperation{Action: "create", Path: "app.bsky.feed.likeX/1", Collection: "app.bsky.feed.likeX", Record: record}),
+			expected:    false,
+		},
+		{
+			name:        "Collection taken from the path when unset",
+			collections: []string{"app.bsky.feed.post"},
+			event:       newEvent(models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Record: record}),
+			expected:    true,
+		},
+		{
+			name:        "Any op in a listed collection",
+			collections: []string{"app.bsky.feed.repost", "app.bsky.feed.post"},
+			event: newEvent(
+				models.ATOperation{Action: "create", Path: "app.bsky.graph.follow/1", Collection: "app.bsky.graph.follow"},
+				models.ATOperation{Action: "create", Path: "app.bsky.feed.post/2", Collection: "app.bsky.feed.post", Record: record},
+			),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{Keyword: "hello", Collections: tt.collections}
+			if result := manager.matchesFilter(tt.event, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v for collections %v", tt.expected, result, tt.collections)
+			}
+		})
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", Collections: []string{"app.bsky.feed.*"}}); key != "" {
+		t.Error("Expected a glob in collections to be rejected")
+	}
+}
+
+func TestDeleteMessages(t *testing.T) {
+	manager := NewManager()
+
+	repoFilter := manager.CreateFilter(models.FilterOptions{Repository: "did:plc:test123", Keyword: "hello"})
+	deletesOnly := manager.CreateFilter(models.FilterOptions{Repository: "did:plc:test123", Keyword: "hello", Actions: []string{"delete"}})
+	keywordOnly := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	repoConn := &fakeConnection{}
+	deletesConn := &fakeConnection{}
+	keywordConn := &fakeConnection{}
+	manager.AddConnection(repoFilter, repoConn)
+	manager.AddConnection(deletesOnly, deletesConn)
+	manager.AddConnection(keywordOnly, keywordConn)
+
+	// A delete-only commit becomes one delete message per record
+	manager.BroadcastEvent(&models.ATEvent{
+		Did:  "did:plc:test123",
+		Time: "2024-01-01T00:00:00Z",
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{
+			{Action: "delete", Path: "app.bsky.feed.post/1", Collection: "app.bsky.feed.post", Rkey: "1"},
+			{Action: "delete", Path: "app.bsky.feed.like/2", Collection: "app.bsky.feed.like", Rkey: "2"},
+		},
+	})
+	waitFor(t, func() bool { return repoConn.messageCount() == 2 })
+	if keywordConn.messageCount() != 0 {
+		t.Error("Expected deletes not to match filters that don't follow specific repositories")
+	}
+
+	for i, uri := range []string{"at://did:plc:test123/app.bsky.feed.post/1", "at://did:plc:test123/app.bsky.feed.like/2"} {
+		message, ok := repoConn.message(i).(models.WSMessage)
+		if !ok || message.Type != "delete" {
+			t.Fatalf("Expected a delete message, got %+v", repoConn.message(i))
+		}
+		notification, ok := message.Data.(models.DeleteNotification)
+		if !ok {
+			t.Fatalf("Expected a DeleteNotification, got %T", message.Data)
+		}
+		if notification.URI != uri || notification.Did != "did:plc:test123" || notification.Time != "2024-01-01T00:00:00Z" {
+			t.Errorf("Unexpected delete notification: %+v", notification)
+		}
+		if notification.Timestamps.FilterKey != repoFilter {
+			t.Errorf("Expected the matching filter in the timestamps, got %q", notification.Timestamps.FilterKey)
+		}
+	}
+
+	// Commits that also create records keep the event shape, unless the filter only wants deletes
+	manager.BroadcastEvent(&models.ATEvent{
+		Did:  "did:plc:test123",
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{
+			{Action: "create", Path: "app.bsky.feed.post/3", Collection: "app.bsky.feed.post", Rkey: "3", Record: map[string]interface{}{"text": "hello"}},
+			{Action: "delete", Path: "app.bsky.feed.post/4", Collection: "app.bsky.feed.post", Rkey: "4"},
+		},
+	})
+	waitFor(t, func() bool { return repoConn.messageCount() == 3 })
+	if message, ok := repoConn.message(2).(models.WSMessage); !ok || message.Type != "event" {
+		t.Errorf("Expected an event message for a mixed commit, got %+v", repoConn.message(2))
+	}
+
+	waitFor(t, func() bool { return deletesConn.messageCount() == 3 })
+	message, ok := deletesConn.message(2).(models.WSMessage)
+	if !ok || message.Type != "delete" {
+		t.Fatalf("Expected the delete-only filter to get a delete message, got %+v", deletesConn.message(2))
+	}
+	if notification := message.Data.(models.DeleteNotification); notification.URI != "at://did:plc:test123/app.bsky.feed.post/4" {
+		t.Errorf("Unexpected URI %q", notification.URI)
+	}
+
+	// A delete doesn't carry creates whose content doesn't match into the filter
+	mixed := &models.ATEvent{
+		Did:  "did:plc:test123",
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{
+			{Action: "create", Path: "app.bsky.feed.post/6", Collection: "app.bsky.feed.post", Rkey: "6", Record: map[string]interface{}{"text": "goodbye"}},
+			{Action: "delete", Path: "app.bsky.feed.post/7", Collection: "app.bsky.feed.post", Rkey: "7"},
+		},
+	}
+	if manager.matchesFilter(mixed, models.FilterOptions{Repository: "did:plc:test123", Keyword: "hello"}) {
+		t.Error("Expected a mixed commit without matching content not to match")
+	}
+	if !manager.matchesFilter(mixed, models.FilterOptions{Repository: "did:plc:test123", Keyword: "hello", Actions: []string{"delete"}}) {
+		t.Error("Expected the delete of a mixed commit to match a delete-only filter")
+	}
+
+	// Path and collection criteria still apply to deletes
+	scoped := models.FilterOptions{Repository: "did:plc:test123", Keyword: "hello", Collections: []string{"app.bsky.feed.like"}}
+	postDelete := &models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "delete", Path: "app.bsky.feed.post/5", Collection: "app.bsky.feed.post", Rkey: "5"}},
+	}
+	if manager.matchesFilter(postDelete, scoped) {
+		t.Error("Expected a delete outside the filter's collections not to match")
+	}
+}
+
+func TestStripNonMatchingOps(t *testing.T) {
+	manager := NewManager()
+
+	full := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	stripped := manager.CreateFilter(models.FilterOptions{Keyword: "hello", StripNonMatchingOps: true})
+	fullConn := &fakeConnection{}
+	strippedConn := &fakeConnection{}
+	manager.AddConnection(full, fullConn)
+	manager.AddConnection(stripped, strippedConn)
+
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{
+			{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "goodbye"}},
+			{Action: "create", Path: "app.bsky.feed.post/2", Record: map[string]interface{}{"text": "hello world"}},
+			{Action: "create", Path: "app.bsky.feed.like/3"},
+		},
+	})
+	waitFor(t, func() bool { return fullConn.messageCount() == 1 && strippedConn.messageCount() == 1 })
+
+	ops := func(conn *fakeConnection) []models.ATOperation {
+		return conn.message(0).(models.WSMessage).Data.(models.EnrichedATEvent).Ops
+	}
+	if got := ops(fullConn); len(got) != 3 {
+		t.Errorf("Expected every op without stripping, got %d", len(got))
+	}
+	if got := ops(strippedConn); len(got) != 1 || got[0].Path != "app.bsky.feed.post/2" {
+		t.Errorf("Expected only the matching op, got %+v", got)
+	}
+}
+
+func TestForwardedOpsCarryURI(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	manager.AddConnection(filterKey, conn)
+
+	event := &models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{
+			{Action: "create", Path: "app.bsky.feed.post/3kabc123", Collection: "app.bsky.feed.post", Rkey: "3kabc123", Record: map[string]interface{}{"text": "hello world"}},
+			{Action: "delete", Path: "app.bsky.feed.like/3kdef456"},
+		},
+	}
+	manager.BroadcastEvent(event)
+	waitFor(t, func() bool { return conn.messageCount() == 1 })
+
+	ops := conn.message(0).(models.WSMessage).Data.(models.EnrichedATEvent).Ops
+	expected := []string{"at://did:plc:test123/app.bsky.feed.post/3kabc123", "at://did:plc:test123/app.bsky.feed.like/3kdef456"}
+	for i, op := range ops {
+		if op.URI != expected[i] {
+			t.Errorf("Expected op %d to carry URI %s, got %q", i, expected[i], op.URI)
+		}
+	}
+
+	// The URIs are set on a copy, so other subscriptions and the caller's event are unaffected
+	for _, op := range event.Ops {
+		if op.URI != "" {
+			t.Errorf("Expected the broadcast event to be left unchanged, got URI %q", op.URI)
+		}
+	}
+}
+
+func TestEmbedTypeFilter(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(record interface{}) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/1", Record: record}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		embedTypes []string
+		record     interface{}
+		expected   bool
+	}{
+		{
+			name:       "No embed types means all",
+			embedTypes: nil,
+			record:     map[string]interface{}{"text": "hello"},
+			expected:   true,
+		},
+		{
+			name:       "Image embed",
+			embedTypes: []string{"app.bsky.embed.images"},
+			record: map[string]interface{}{
+				"text":  "hello",
+				"embed": map[string]interface{}{"$type": "app.bsky.embed.images", "images": []interface{}{}},
+			},
+			expected: true,
+		},
+		{
+			name:       "Images in a recordWithMedia embed",
+			embedTypes: []string{"app.bsky.embed.images"},
+			record: map[string]interface{}{
+				"text": "hello",
+				"embed": map[string]interface{}{
+					"$type":  "app.bsky.embed.recordWithMedia",
+					"record": map[string]interface{}{"$type": "app.bsky.embed.record"},
+					"media":  map[string]interface{}{"$type": "app.bsky.embed.images"},
+				},
+			},
+			expected: true,
+		},
+		{
+			name:       "Raw CBOR map with interface keys",
+			embedTypes: []string{"app.bsky.embed.video"},
+			record: map[interface{}]interface{}{
+				"text":  "hello",
+				"embed": map[interface{}]interface{}{"$type": "app.bsky.embed.video"},
+			},
+			expected: true,
+		},
+		{
+			name:       "Different embed",
+			embedTypes: []string{"app.bsky.embed.images"},
+			record: map[string]interface{}{
+				"text":  "hello",
+				"embed": map[string]interface{}{"$type": "app.bsky.embed.external"},
+			},
+			expected: false,
+		},
+		{
+			name:       "No embed",
+			embedTypes: []string{"app.bsky.embed.images"},
+			record:     map[string]interface{}{"text": "hello"},
+			expected:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := models.FilterOptions{PathPrefix: "app.bsky.feed.post", EmbedTypes: tt.embedTypes}
+			if result := manager.matchesFilter(newEvent(tt.record), options); result != tt.expected {
+				t.Errorf("Expected %v, got %v for embed types %v", tt.expected, result, tt.embedTypes)
+			}
+		})
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", EmbedTypes: []string{"images"}}); key != "" {
+		t.Error("Expected an embed type that isn't an NSID to be rejected")
+	}
+}
+
+func TestReplyRootFilter(t *testing.T) {
+	manager := NewManager()
+	const rootURI = "at://did:plc:root/app.bsky.feed.post/3kroot"
+
+	reply := func(root string) map[string]interface{} {
+		ref := map[string]interface{}{"uri": root, "cid": "bafyreiexample"}
+		return map[string]interface{}{"root": ref, "parent": ref}
+	}
+
+	tests := []struct {
+		name     string
+		did      string
+		op       models.ATOperation
+		expected bool
+	}{
+		{
+			name:     "Reply in the thread",
+			did:      "did:plc:replier",
+			op:       models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello", "reply": reply(rootURI)}},
+			expected: true,
+		},
+		{
+			name: "Raw CBOR map with interface keys",
+			did:  "did:plc:replier",
+			op: models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Record: map[interface{}]interface{}{
+				"text":  "hello",
+				"reply": map[interface{}]interface{}{"root": map[interface{}]interface{}{"uri": rootURI}},
+			}},
+			expected: true,
+		},
+		{
+			name:     "The root post itself",
+			did:      "did:plc:root",
+			op:       models.ATOperation{Action: "create", Path: "app.bsky.feed.post/3kroot", Collection: "app.bsky.feed.post", Rkey: "3kroot", Record: map[string]interface{}{"text": "hello"}},
+			expected: true,
+		},
+		{
+			name:     "Reply in another thread",
+			did:      "did:plc:replier",
+			op:       models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello", "reply": reply("at://did:plc:other/app.bsky.feed.post/3kother")}},
+			expected: false,
+		},
+		{
+			name:     "Not a reply",
+			did:      "did:plc:replier",
+			op:       models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello"}},
+			expected: false,
+		},
+		{
+			name:     "Reply without a root",
+			did:      "did:plc:replier",
+			op:       models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello", "reply": map[string]interface{}{}}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &models.ATEvent{Did: tt.did, Ops: []models.ATOperation{tt.op}}
+			options := models.FilterOptions{Keyword: "hello", ReplyRootURI: rootURI}
+			if result := manager.matchesFilter(event, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", ReplyRootURI: "https://bsky.app/profile/alice/post/3kroot"}); key != "" {
+		t.Error("Expected a reply root that isn't an AT URI to be rejected")
+	}
+}
+
+func TestPostTypeFilter(t *testing.T) {
+	manager := NewManager()
+
+	replyRef := map[string]interface{}{
+		"root":   map[string]interface{}{"uri": "at://did:plc:root/app.bsky.feed.post/3kroot"},
+		"parent": map[string]interface{}{"uri": "at://did:plc:root/app.bsky.feed.post/3kroot"},
+	}
+	quoteEmbed := map[string]interface{}{"$type": "app.bsky.embed.record", "record": map[string]interface{}{"uri": "at://did:plc:other/app.bsky.feed.post/3kquoted"}}
+	post := func(record map[string]interface{}) models.ATOperation {
+		record["text"] = "hello"
+		return models.ATOperation{Action: "create", Path: "app.bsky.feed.post/1", Collection: "app.bsky.feed.post", Record: record}
+	}
+
+	ops := map[string]models.ATOperation{
+		"top":             post(map[string]interface{}{}),
+		"top with images": post(map[string]interface{}{"embed": map[string]interface{}{"$type": "app.bsky.embed.images"}}),
+		"reply":           post(map[string]interface{}{"reply": replyRef}),
+		"quote":           post(map[string]interface{}{"embed": quoteEmbed}),
+		"quote with media": post(map[string]interface{}{"embed": map[interface{}]interface{}{
+			"$type":  "app.bsky.embed.recordWithMedia",
+			"record": quoteEmbed,
+			"media":  map[interface{}]interface{}{"$type": "app.bsky.embed.images"},
+		}}),
+		"quoting reply": post(map[string]interface{}{"reply": replyRef, "embed": quoteEmbed}),
+		"like":          {Action: "create", Path: "app.bsky.feed.like/1", Record: map[string]interface{}{"text": "hello"}},
+		"post delete":   {Action: "delete", Path: "app.bsky.feed.post/1"},
+	}
+
+	tests := []struct {
+		postType string
+		matches  []string
+	}{
+		{postType: models.PostTypeTop, matches: []string{"top", "top with images"}},
+		{postType: models.PostTypeReply, matches: []string{"reply", "quoting reply"}},
+		{postType: models.PostTypeQuote, matches: []string{"quote", "quote with media"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.postType, func(t *testing.T) {
+			options := models.FilterOptions{Keyword: "hello", PostType: tt.postType}
+			for name, op := range ops {
+				expected := slices.Contains(tt.matches, name)
+				event := &models.ATEvent{Did: "did:plc:author", Ops: []models.ATOperation{op}}
+				if result := manager.matchesFilter(event, options); result != expected {
+					t.Errorf("Expected %v for %s, got %v", expected, name, result)
+				}
+			}
+		})
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", PostType: "original"}); key != "" {
+		t.Error("Expected an unknown post type to be rejected")
+	}
+}
+
+func TestCreateFilters(t *testing.T) {
+	manager := NewManager()
+
+	// One invalid entry keeps the whole batch from being created
+	results, ok := manager.CreateFilters([]models.FilterOptions{
+		{Keyword: "hello"},
+		{Keyword: "hi"},
+		{Keyword: "world"},
+	})
+	if ok {
+		t.Fatal("Expected the batch to be rejected")
+	}
+	if results[1].Success || results[1].Reason != FilterRejectedTooShort {
+		t.Errorf("Expected the short keyword to be rejected as too_short, got %+v", results[1])
+	}
+	if results[0].FilterKey != "" || results[0].ErrorMessage != "" || results[2].FilterKey != "" {
+		t.Errorf("Expected valid entries to be neither created nor rejected, got %+v and %+v", results[0], results[2])
+	}
+	if active := manager.GetStats()["active_filters"]; active != 0 {
+		t.Errorf("Expected no filters created, got %v", active)
+	}
+
+	results, ok = manager.CreateFilters([]models.FilterOptions{
+		{Keyword: "hello"},
+		{Keyword: "(world|earth)", KeywordRegex: true},
+	})
+	if !ok {
+		t.Fatalf("Expected the batch to be created, got %+v", results)
+	}
+	for i, result := range results {
+		if !result.Success {
+			t.Fatalf("Expected entry %d to be created, got %+v", i, result)
+		}
+		if _, exists := manager.GetSubscription(result.FilterKey); !exists {
+			t.Errorf("Expected filter %s to exist", result.FilterKey)
+		}
+	}
+	if results[0].FilterKey == results[1].FilterKey {
+		t.Error("Expected distinct filter keys")
+	}
+}
+
+func TestCreateFilterRejectionReasons(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name    string
+		options models.FilterOptions
+		reason  string
+	}{
+		{"Missing keyword", models.FilterOptions{PathPrefix: "app.bsky.feed.post"}, FilterRejectedNoKeyword},
+		{"Short keyword", models.FilterOptions{Keyword: "hi"}, FilterRejectedTooShort},
+		{"Short path prefix", models.FilterOptions{Keyword: "hello", PathPrefix: "a.b"}, FilterRejectedTooShort},
+		{"Invalid repository", models.FilterOptions{Keyword: "hello", Repository: "not a did"}, FilterRejectedInvalidDID},
+		{"Unsupported DID method", models.FilterOptions{Keyword: "hello", Repository: "did:key:z6Mkabc"}, FilterRejectedInvalidDID},
+		{"Invalid action", models.FilterOptions{Keyword: "hello", Actions: []string{"rename"}}, FilterRejectedInvalidOption},
+		{"Invalid regex", models.FilterOptions{Keyword: "(unclosed", KeywordRegex: true}, FilterRejectedInvalidOption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := testutil.ToFloat64(metriks.FiltersRejected.WithLabelValues(tt.reason))
+
+			result := manager.CreateFilterWithResult(tt.options)
+			if result.Success || result.FilterKey != "" {
+				t.Fatalf("Expected the filter to be rejected, got %+v", result)
+			}
+			if result.Reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, result.Reason)
+			}
+			if result.ErrorMessage == "" {
+				t.Error("Expected an error message")
+			}
+			if delta := testutil.ToFloat64(metriks.FiltersRejected.WithLabelValues(tt.reason)) - before; delta != 1 {
+				t.Errorf("Expected filters_rejected_total{reason=%q} to increase by 1, got %v", tt.reason, delta)
+			}
+		})
+	}
+
+	result := manager.CreateFilterWithResult(models.FilterOptions{Keyword: "hello"})
+	if !result.Success || result.FilterKey == "" || result.Reason != "" {
+		t.Errorf("Expected valid options to create a filter, got %+v", result)
+	}
+}
+
+func TestCreateFilterInvalidAction(t *testing.T) {
+	manager := NewManager()
+
+	if filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "test", Actions: []string{"create", "rename"}}); filterKey != "" {
+		t.Error("Expected empty filter key for unknown action")
+	}
+}
+
+func TestMultipleRepositories(t *testing.T) {
+	manager := NewManager()
+
+	options := models.FilterOptions{
+		Repository: "did:plc:alice, did:plc:bob",
+		Keyword:    "hello",
+	}
+
+	for _, tt := range []struct {
+		did      string
+		expected bool
+	}{
+		{did: "did:plc:alice", expected: true},
+		{did: "did:plc:bob", expected: true},
+		{did: "did:plc:carol", expected: false},
+	} {
+		event := &models.ATEvent{
+			Did: tt.did,
+			Ops: []models.ATOperation{{Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello"}}},
+		}
+		if result := manager.matchesFilter(event, options); result != tt.expected {
+			t.Errorf("Expected %v for DID %s, got %v", tt.expected, tt.did, result)
+		}
+	}
+
+	filterKey := manager.CreateFilter(options)
+	subscription, exists := manager.GetSubscription(filterKey)
+	if !exists {
+		t.Fatal("Filter should exist after creation")
+	}
+	if len(subscription.Repositories) != 2 || subscription.Repositories[0] != "did:plc:alice" || subscription.Repositories[1] != "did:plc:bob" {
+		t.Errorf("Expected both configured DIDs, got %v", subscription.Repositories)
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Repository: "did:plc:alice,12", Keyword: "hello"}); key != "" {
+		t.Error("Expected each repository DID to be validated individually")
+	}
+}
+
+func TestRepositoryPrefixFilter(t *testing.T) {
+	manager := NewManager()
+
+	event := func(did string) *models.ATEvent {
+		return &models.ATEvent{
+			Did: did,
+			Ops: []models.ATOperation{{Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello"}}},
+		}
+	}
+
+	options := models.FilterOptions{RepositoryPrefix: "did:web:example.com", Keyword: "hello"}
+	for _, tt := range []struct {
+		did      string
+		expected bool
+	}{
+		{did: "did:web:example.com", expected: true},
+		{did: "did:web:example.com:user:alice", expected: true},
+		{did: "did:web:other.example", expected: false},
+		{did: "did:plc:example", expected: false},
+	} {
+		if result := manager.matchesFilter(event(tt.did), options); result != tt.expected {
+			t.Errorf("Expected %v for DID %s, got %v", tt.expected, tt.did, result)
+		}
+	}
+
+	// Both repository filters apply when set together
+	options.Repository = "did:web:example.com:user:alice"
+	if !manager.matchesFilter(event("did:web:example.com:user:alice"), options) {
+		t.Error("Expected a DID passing both the repository and the prefix to match")
+	}
+	if manager.matchesFilter(event("did:web:example.com"), options) {
+		t.Error("Expected a DID outside the repository list not to match")
+	}
+
+	for _, prefix := range []string{"did:", "did:web:", "did:key:z6Mk", "example.com", "did:web:example.com,did:web:other"} {
+		if key := manager.CreateFilter(models.FilterOptions{RepositoryPrefix: prefix, Keyword: "hello"}); key != "" {
+			t.Errorf("Expected repository prefix %q to be rejected", prefix)
+		}
+	}
+	if key := manager.CreateFilter(models.FilterOptions{RepositoryPrefix: "did:plc:ab", Keyword: "hello"}); key == "" {
+		t.Error("Expected a did:plc prefix to be accepted")
+	}
+}
+
+func TestOptionalKeyword(t *testing.T) {
+	manager := NewManager()
+	manager.SetRequireKeyword(false)
+
+	post := &models.ATEvent{
+		Did: "did:plc:alice",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/1", Collection: "app.bsky.feed.post", Record: map[string]interface{}{"text": "anything at all"}}},
+	}
+
+	tests := []struct {
+		name    string
+		options models.FilterOptions
+		created bool
+		matches bool
+	}{
+		{name: "Repository only", options: models.FilterOptions{Repository: "did:plc:alice"}, created: true, matches: true},
+		{name: "Other repository", options: models.FilterOptions{Repository: "did:plc:bob"}, created: true, matches: false},
+		{name: "Repository prefix only", options: models.FilterOptions{RepositoryPrefix: "did:plc:ali"}, created: true, matches: true},
+		{name: "Collections only", options: models.FilterOptions{Collections: []string{"app.bsky.feed.post"}}, created: true, matches: true},
+		{name: "Path prefix isn't enough", options: models.FilterOptions{PathPrefix: "app.bsky.feed.post"}},
+		{name: "No criteria", options: models.FilterOptions{Langs: []string{"en"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := manager.CreateFilterWithResult(tt.options)
+			if result.Success != tt.created {
+				t.Fatalf("Expected created=%v, got %v (%s)", tt.created, result.Success, result.ErrorMessage)
+			}
+			if !tt.created {
+				if result.Reason != FilterRejectedNoKeyword {
+					t.Errorf("Expected reason %s, got %s", FilterRejectedNoKeyword, result.Reason)
+				}
+				return
+			}
+			if matches := manager.matchesFilter(post, tt.options); matches != tt.matches {
+				t.Errorf("Expected matches=%v, got %v", tt.matches, matches)
+			}
+		})
+	}
+
+	// The default still requires a keyword
+	if key := NewManager().CreateFilter(models.FilterOptions{Repository: "did:plc:alice"}); key != "" {
+		t.Error("Expected a filter without a keyword to be rejected by default")
+	}
+}
+
+func TestValidateFilterFields(t *testing.T) {
+	manager := NewManager()
+
+	tests := []struct {
+		name          string
+		options       models.FilterOptions
+		invalidFields []string
+	}{
+		{name: "Valid", options: models.FilterOptions{Keyword: "hello", Langs: []string{"en"}}},
+		{name: "Missing keyword", options: models.FilterOptions{PathPrefix: "app.bsky.feed.post"}, invalidFields: []string{"keyword"}},
+		{name: "Invalid regex", options: models.FilterOptions{Keyword: "(unclosed", KeywordRegex: true}, invalidFields: []string{"keyword"}},
+		{
+			name: "Several invalid fields",
+			options: models.FilterOptions{
+				Repository:    "did:plc:ab",
+				Keyword:       "hello",
+				EventKinds:    []string{"tombstone"},
+				MinTextLength: 50,
+				MaxTextLength: 10,
+				Since:         "2025-01-01T00:00:00Z",
+				Until:         "2024-01-01T00:00:00Z",
+			},
+			invalidFields: []string{"repository", "eventKinds", "maxTextLength", "until"},
+		},
+		{
+			name:          "Unparseable since doesn't fail until",
+			options:       models.FilterOptions{Keyword: "hello", Since: "yesterday", Until: "2024-01-01T00:00:00Z"},
+			invalidFields: []string{"since"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := manager.ValidateFilterFields(tt.options)
+
+			var invalid []string
+			var first models.FieldValidation
+			for _, field := range response.Fields {
+				if !field.Valid {
+					if invalid == nil {
+						first = field
+					}
+					invalid = append(invalid, field.Field)
+				}
+			}
+			if !reflect.DeepEqual(invalid, tt.invalidFields) {
+				t.Errorf("Expected invalid fields %v, got %v", tt.invalidFields, invalid)
+			}
+			if response.Valid != (len(tt.invalidFields) == 0) {
+				t.Errorf("Expected valid=%v, got %v", len(tt.invalidFields) == 0, response.Valid)
+			}
+
+			// Creation rejects the options with the first error reported
+			result := manager.CreateFilterWithResult(tt.options)
+			if result.Success != response.Valid {
+				t.Fatalf("Expected creation success=%v, got %+v", response.Valid, result)
+			}
+			if !result.Success && (result.ErrorMessage != first.Error || result.Reason != first.Reason) {
+				t.Errorf("Expected creation to fail with %q (%s), got %q (%s)", first.Error, first.Reason, result.ErrorMessage, result.Reason)
+			}
+		})
+	}
+}
+
+func TestValidateRepository(t *testing.T) {
+	tests := []struct {
+		repo        string
+		expectedErr string
+	}{
+		{repo: "did:plc:z72i7hdynmk6r22z27h6tvur"},
+		{repo: "did:plc:123456"},
+		{repo: "did:web:example.com"},
+		{repo: "did:web:localhost%3A8080"},
+		{repo: "alice.bsky.social"},
+		{repo: "not a did", expectedErr: "not a valid DID or handle"},
+		{repo: "12", expectedErr: "not a valid DID or handle"},
+		{repo: "did:plc:", expectedErr: "not a valid DID or handle"},
+		{repo: "did:plc:alice!", expectedErr: "not a valid DID or handle"},
+		{repo: "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK", expectedErr: "unsupported DID method"},
+		{repo: "did:plc:ab", expectedErr: "too short"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			err := ValidateRepository(tt.repo)
+			if tt.expectedErr == "" {
+				if err != "" {
+					t.Errorf("Expected %q to be valid, got %q", tt.repo, err)
+				}
+				return
+			}
+			if !strings.Contains(err, tt.expectedErr) {
+				t.Errorf("Expected error containing %q for %q, got %q", tt.expectedErr, tt.repo, err)
+			}
+		})
+	}
+}
+
+func TestDeleteFilter(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "test"})
+	if filterKey == "" {
+		t.Fatal("Expected filter to be created")
+	}
+
+	closed, exists := manager.DeleteFilter(filterKey)
+	if !exists {
+		t.Error("Expected existing filter to be deleted")
+	}
+	if closed != 0 {
+		t.Errorf("Expected 0 closed connections, got %d", closed)
+	}
+
+	if _, exists := manager.GetSubscription(filterKey); exists {
+		t.Error("Filter should not exist after deletion")
+	}
+
+	if _, exists := manager.DeleteFilter(filterKey); exists {
+		t.Error("Deleting an unknown filter should report it does not exist")
+	}
+}
+
+func TestMultiFilterConnection(t *testing.T) {
+	manager := NewManagerWithConfig(1)
+	manager.SetReplayBufferSize(0) // Without replay, filters go as soon as their last connection does
+
+	helloKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	worldKey := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	conn := &fakeConnection{}
+
+	for _, filterKey := range []string{helloKey, worldKey} {
+		if result := manager.AddConnectionWithResult(filterKey, conn); !result.Success {
+			t.Fatalf("Expected connection to subscribe to %s, got %s", filterKey, result.ErrorCode)
+		}
+	}
+	if total := manager.GetStats()["total_connections"]; total != 1 {
+		t.Errorf("Expected one connection counted against the limit, got %v", total)
+	}
+	if result := manager.AddConnectionWithResult(helloKey, &fakeConnection{}); result.ErrorCode != "MAX_CONNECTIONS_REACHED" {
+		t.Errorf("Expected a second connection to hit the limit, got %+v", result)
+	}
+
+	event := &models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{
+			{Action: "create", Path: "app.bsky.feed.post/test", Record: map[string]interface{}{"text": "hello world"}},
+		},
+	}
+	manager.BroadcastEvent(event)
+	waitFor(t, func() bool { return conn.messageCount() >= 1 })
+
+	if !manager.UnsubscribeConnection(helloKey, conn) {
+		t.Error("Expected unsubscribe from a subscribed filter to succeed")
+	}
+	if manager.UnsubscribeConnection(helloKey, conn) {
+		t.Error("Expected unsubscribe from an unsubscribed filter to fail")
+	}
+	for _, text := range []string{"hello there", "world again"} {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{
+				{Action: "create", Path: "app.bsky.feed.post/test", Record: map[string]interface{}{"text": text}},
+			},
+		})
+	}
+
+	// Messages arrive in order, so the next one after the first event shows what else was delivered
+	waitFor(t, func() bool { return conn.messageCount() >= 2 })
+	if got := eventText(conn.message(1)); got != "world again" {
+		t.Errorf("Expected the first event once and nothing for the unsubscribed filter, got %q next", got)
+	}
+
+	manager.DropConnection(conn)
+	if total := manager.GetStats()["total_connections"]; total != 0 {
+		t.Errorf("Expected no connections after drop, got %v", total)
+	}
+	if _, exists := manager.GetSubscription(worldKey); exists {
+		t.Error("Expected filter to be cleaned up once its last connection dropped")
+	}
+}
+
+func TestDeleteFilterKeepsMultiFilterConnection(t *testing.T) {
+	manager := NewManager()
+
+	helloKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	worldKey := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	shared := &fakeConnection{}
+	single := &fakeConnection{}
+	manager.AddConnection(helloKey, shared)
+	manager.AddConnection(worldKey, shared)
+	manager.AddConnection(helloKey, single)
+
+	closed, exists := manager.DeleteFilter(helloKey)
+	if !exists {
+		t.Fatal("Expected existing filter to be deleted")
+	}
+	if closed != 1 {
+		t.Errorf("Expected 1 closed connection, got %d", closed)
+	}
+	if !single.isClosed() {
+		t.Error("Expected connection subscribed only to the deleted filter to be closed")
+	}
+	if shared.isClosed() {
+		t.Error("Expected connection still subscribed to another filter to stay open")
+	}
+	if total := manager.GetStats()["total_connections"]; total != 1 {
+		t.Errorf("Expected 1 remaining connection, got %v", total)
+	}
+}
+
+func TestBroadcastRemovesDeadConnections(t *testing.T) {
+	manager := NewManager()
+	manager.SetReplayBufferSize(0) // Without replay, filters go as soon as their last connection does
+
+	helloKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	worldKey := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	dead := &failingConnection{}
+	manager.AddConnection(helloKey, dead)
+	manager.AddConnection(worldKey, dead)
+
+	done := make(chan struct{})
+	go func() {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{
+				{Action: "create", Path: "app.bsky.feed.post/test", Record: map[string]interface{}{"text": "hello"}},
+			},
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("BroadcastEvent did not return after a failed write")
+	}
+
+	waitFor(t, dead.isClosed)
+	waitFor(t, func() bool { return manager.GetStats()["total_connections"] == 0 })
+	if _, exists := manager.GetSubscription(worldKey); exists {
+		t.Error("Expected filters left without connections to be cleaned up")
+	}
+}
+
+func TestBroadcastPreservesSequenceOrder(t *testing.T) {
+	manager := NewManager()
+
+	// One connection on several filters, each matching a different share of the events
+	conn := &fakeConnection{}
+	for _, keyword := range []string{"alpha", "beta", "gamma"} {
+		manager.AddConnection(manager.CreateFilter(models.FilterOptions{Keyword: keyword}), conn)
+	}
+
+	const events = 200 // Within the connection queue, so none are dropped
+	keywords := []string{"alpha", "beta", "gamma", "alpha beta gamma"}
+	for seq := 1; seq <= events; seq++ {
+		event := postEvent("did:plc:test123", keywords[seq%len(keywords)])
+		event.Seq = int64(seq)
+		manager.BroadcastEvent(event)
+	}
+
+	waitFor(t, func() bool { return conn.messageCount() == events })
+	for i := 0; i < events; i++ {
+		data := conn.message(i).(models.WSMessage).Data.(models.EnrichedATEvent)
+		if data.Timestamps.Seq != int64(i+1) {
+			t.Fatalf("Expected message %d to carry seq %d, got %d", i, i+1, data.Timestamps.Seq)
+		}
+	}
+}
+
+func TestMaxMessagesPerConnection(t *testing.T) {
+	manager := NewManager()
+
+	limitedKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello", MaxMessagesPerConnection: 2})
+	unlimitedKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	limited := &fakeConnection{}
+	unlimited := &fakeConnection{}
+	manager.AddConnection(limitedKey, limited)
+	manager.AddConnection(unlimitedKey, unlimited)
+
+	for _, text := range []string{"hello one", "hello two", "hello three"} {
+		manager.BroadcastEvent(postEvent("did:plc:test123", text))
+	}
+
+	waitFor(t, limited.isClosed)
+	waitFor(t, func() bool { return unlimited.messageCount() == 3 })
+	if count := limited.messageCount(); count != 2 {
+		t.Fatalf("Expected the limited connection to get 2 messages, got %d", count)
+	}
+	if text := eventText(limited.message(1)); text != "hello two" {
+		t.Errorf("Expected the second event last, got %q", text)
+	}
+	if unlimited.isClosed() {
+		t.Error("Expected the connection without a limit to stay open")
+	}
+	waitFor(t, func() bool { return manager.GetStats()["total_connections"] == 1 })
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", MaxMessagesPerConnection: -1}); key != "" {
+		t.Error("Expected a negative message limit to be rejected")
+	}
+}
+
+func TestListSubscriptions(t *testing.T) {
+	manager := NewManager()
+
+	second := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	first := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	// Distinct creation times keep the order deterministic
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	manager.subscriptions[first].CreatedAt = created
+	manager.subscriptions[second].CreatedAt = created.Add(time.Second)
+
+	subs, total := manager.ListSubscriptions(SubscriptionQuery{})
+	if total != 2 || len(subs) != 2 || subs[0].FilterKey != first || subs[1].FilterKey != second {
+		t.Errorf("Expected both subscriptions oldest first without a limit, got %d of %d", len(subs), total)
+	}
+
+	subs, total = manager.ListSubscriptions(SubscriptionQuery{Offset: 1, Limit: 5})
+	if total != 2 || len(subs) != 1 || subs[0].FilterKey != second {
+		t.Errorf("Expected the second subscription only, got %d of %d", len(subs), total)
+	}
+
+	subs, total = manager.ListSubscriptions(SubscriptionQuery{Keyword: "WOR"})
+	if total != 1 || len(subs) != 1 || subs[0].FilterKey != second {
+		t.Errorf("Expected the keyword to select the second subscription, got %d of %d", len(subs), total)
+	}
+}
+
+func TestGetConnections(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	first := &fakeAddrConnection{addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}}
+	second := &fakeConnection{}
+	manager.AddConnection(filterKey, first)
+	time.Sleep(time.Millisecond) // Distinct connection times keep the order deterministic
+	manager.AddConnection(filterKey, second)
+
+	connections, exists := manager.GetConnections(filterKey)
+	if !exists {
+		t.Fatal("Expected filter to exist")
+	}
+	if len(connections) != 2 {
+		t.Fatalf("Expected 2 connections, got %d", len(connections))
+	}
+	if connections[0].RemoteAddr != "203.0.113.7:51234" {
+		t.Errorf("Expected oldest connection's address first, got %q", connections[0].RemoteAddr)
+	}
+	if connections[1].RemoteAddr != "" {
+		t.Errorf("Expected no address for a connection without one, got %q", connections[1].RemoteAddr)
+	}
+	if !connections[0].ConnectedAt.Before(connections[1].ConnectedAt) {
+		t.Errorf("Expected connections ordered by connection time, got %+v", connections)
+	}
+
+	// Subscribing again keeps the original connection time
+	connectedAt := connections[0].ConnectedAt
+	manager.AddConnection(filterKey, first)
+	if connections, _ := manager.GetConnections(filterKey); !connections[0].ConnectedAt.Equal(connectedAt) {
+		t.Errorf("Expected connectedAt %v to be kept, got %v", connectedAt, connections[0].ConnectedAt)
+	}
+
+	if _, exists := manager.GetConnections("missing"); exists {
+		t.Error("Expected unknown filter to report it does not exist")
+	}
+}
+
+func TestEventKindFilter(t *testing.T) {
+	manager := NewManager()
+
+	commitEvent := &models.ATEvent{
+		Did:  "did:plc:alice",
+		Kind: models.EventKindCommit,
+		Ops:  []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/1", Record: map[string]interface{}{"text": "hello"}}},
+	}
+	accountEvent := &models.ATEvent{
+		Did:     "did:plc:alice",
+		Kind:    models.EventKindAccount,
+		Account: &models.AccountInfo{Active: false, Status: "deactivated"},
+	}
+
+	tests := []struct {
+		name     string
+		options  models.FilterOptions
+		event    *models.ATEvent
+		expected bool
+	}{
+		{name: "Default receives commits", options: models.FilterOptions{Keyword: "hello"}, event: commitEvent, expected: true},
+		{name: "Default ignores account events", options: models.FilterOptions{Keyword: "hello"}, event: accountEvent, expected: false},
+		{name: "Opt in to account events", options: models.FilterOptions{Keyword: "hello", EventKinds: []string{"account"}}, event: accountEvent, expected: true},
+		{name: "Account only ignores commits", options: models.FilterOptions{Keyword: "hello", EventKinds: []string{"account"}}, event: commitEvent, expected: false},
+		{name: "Account events respect repository", options: models.FilterOptions{Repository: "did:plc:bob", Keyword: "hello", EventKinds: []string{"account"}}, event: accountEvent, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := manager.matchesFilter(tt.event, tt.options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", EventKinds: []string{"handle"}}); key != "" {
+		t.Error("Expected unknown event kind to be rejected")
+	}
+}
+
+func TestGetKeywordUsage(t *testing.T) {
+	manager := NewManager()
+
+	if usage := manager.GetKeywordUsage(); len(usage) != 0 {
+		t.Errorf("Expected no keywords without filters, got %v", usage)
+	}
+
+	manager.CreateFilter(models.FilterOptions{Keyword: "bluesky, atproto"})
+	manager.CreateFilter(models.FilterOptions{Keyword: "BlueSky,golang,bluesky"}) // repeated term counts once
+	manager.CreateFilter(models.FilterOptions{Keyword: "golang"})
+	manager.CreateFilter(models.FilterOptions{Keyword: `Go\w+`, KeywordRegex: true})
+
+	expected := []models.KeywordUsage{
+		{Keyword: "bluesky", Filters: 2},
+		{Keyword: "golang", Filters: 2},
+		{Keyword: `Go\w+`, Filters: 1},
+		{Keyword: "atproto", Filters: 1},
+	}
+	if usage := manager.GetKeywordUsage(); !reflect.DeepEqual(usage, expected) {
+		t.Errorf("Expected %v, got %v", expected, usage)
+	}
+}
+
+func TestGetKeywordThroughput(t *testing.T) {
+	manager := NewManager()
+
+	if throughput := manager.GetKeywordThroughput(); len(throughput) != 0 {
+		t.Errorf("Expected no throughput before any events, got %v", throughput)
+	}
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello,world"})
+	manager.AddConnection(filterKey, &fakeConnection{})
+
+	for _, text := range []string{"hello world", "hello there", "hello again"} {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": text}}},
+		})
+	}
+
+	expected := []models.KeywordThroughput{
+		{Keyword: "hello", Messages: 3, RatePerSecond: 3.0 / KeywordRateWindowSeconds},
+		{Keyword: "world", Messages: 1, RatePerSecond: 1.0 / KeywordRateWindowSeconds},
+	}
+	if throughput := manager.GetKeywordThroughput(); !reflect.DeepEqual(throughput, expected) {
+		t.Errorf("Expected %v, got %v", expected, throughput)
+	}
+
+	// Quiet keywords are pruned when the activity window resets
+	manager.keywordCountsMu.Lock()
+	manager.keywordRates["stale"] = &keywordRate{}
+	manager.keywordCountsMu.Unlock()
+	manager.publishKeywordActivity()
+	manager.keywordCountsMu.RLock()
+	_, stale := manager.keywordRates["stale"]
+	_, active := manager.keywordRates["hello"]
+	manager.keywordCountsMu.RUnlock()
+	if stale || !active {
+		t.Errorf("Expected only quiet keywords to be pruned (stale kept: %v, active kept: %v)", stale, active)
+	}
+}
+
+func TestKeywordActivityGauge(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "gaugeword"})
+	manager.AddConnection(filterKey, &fakeConnection{})
+
+	gauge := metriks.KeywordActivity.WithLabelValues("gaugeword")
+	gauge.Set(0)
+	for i := 0; i < 2; i++ {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": "a gaugeword post"}}},
+		})
+	}
+	// The gauge only changes once the window is complete
+	if value := testutil.ToFloat64(gauge); value != 0 {
+		t.Errorf("Expected the gauge to wait for the end of the window, got %v", value)
+	}
+	manager.publishKeywordActivity()
+	if value := testutil.ToFloat64(gauge); value != 2 {
+		t.Errorf("Expected the gauge to show the window's 2 matching messages, got %v", value)
+	}
+
+	// A window without messages deletes the keyword's series
+	manager.publishKeywordActivity()
+	if metriks.KeywordActivity.DeleteLabelValues("gaugeword") {
+		t.Error("Expected the series to be deleted after a quiet window")
+	}
+}
+
+func TestKeywordActivityGaugeLabelCap(t *testing.T) {
+	manager := NewManager()
+	manager.keywordCountsMu.Lock()
+	for i := 0; i < keywordActivityMaxLabels; i++ {
+		manager.keywordCounts[fmt.Sprintf("busy%03d", i)] = 10
+	}
+	manager.keywordCounts["quiet1"] = 2
+	manager.keywordCounts["quiet2"] = 3
+	manager.keywordCountsMu.Unlock()
+
+	manager.publishKeywordActivity()
+	if value := testutil.ToFloat64(metriks.KeywordActivity.WithLabelValues("busy000")); value != 10 {
+		t.Errorf("Expected the busiest keywords to have their own series, got %v", value)
+	}
+	if value := testutil.ToFloat64(metriks.KeywordActivity.WithLabelValues(otherKeywordLabel)); value != 5 {
+		t.Errorf("Expected the keywords past the cap to be summed under %q, got %v", otherKeywordLabel, value)
+	}
+	if metriks.KeywordActivity.DeleteLabelValues("quiet1") {
+		t.Error("Expected no series for keywords past the cap")
+	}
+
+	// A quiet window deletes every series again
+	manager.publishKeywordActivity()
+	for _, keyword := range []string{"busy000", otherKeywordLabel} {
+		if metriks.KeywordActivity.DeleteLabelValues(keyword) {
+			t.Errorf("Expected the %s series to be deleted after a quiet window", keyword)
+		}
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	manager := NewManager()
+
+	// Test with no filters
+	stats := manager.GetStats()
+	if stats["active_filters"] != 0 {
+		t.Errorf("Expected 0 active filters, got %v", stats["active_filters"])
+	}
+	if stats["total_connections"] != 0 {
+		t.Errorf("Expected 0 total connections, got %v", stats["total_connections"])
+	}
+
+	// Create some filters with required keywords
+	options1 := models.FilterOptions{
+		Repository: "did:plc:test1",
+		Keyword:    "test",
+	}
+	options2 := models.FilterOptions{
+		Repository: "did:plc:test2",
+		Keyword:    "hello",
+	}
+
+	manager.CreateFilter(options1)
+	manager.CreateFilter(options2)
+
+	stats = manager.GetStats()
+	if stats["active_filters"] != 2 {
+		t.Errorf("Expected 2 active filters, got %v", stats["active_filters"])
+	}
+}
+
+func TestMessagesDelivered(t *testing.T) {
+	manager := NewManager()
+
+	hotKey := manager.CreateFilter(models.FilterOptions{Keyword: "hot"})
+	idleKey := manager.CreateFilter(models.FilterOptions{Keyword: "idle"})
+
+	manager.mu.RLock()
+	manager.subscriptions[hotKey].MessagesDelivered.Add(3)
+	manager.mu.RUnlock()
+
+	sub, exists := manager.GetSubscription(hotKey)
+	if !exists {
+		t.Fatal("Expected hot filter to exist")
+	}
+	if sub.MessagesDelivered != 3 {
+		t.Errorf("Expected 3 messages delivered, got %d", sub.MessagesDelivered)
+	}
+
+	for _, s := range manager.GetSubscriptions() {
+		expected := uint64(0)
+		if s.FilterKey == hotKey {
+			expected = 3
+		}
+		if s.MessagesDelivered != expected {
+			t.Errorf("Filter %s: expected %d messages delivered, got %d", s.FilterKey, expected, s.MessagesDelivered)
+		}
+	}
+
+	stats := manager.GetStats()
+	if stats["messages_delivered"] != uint64(3) {
+		t.Errorf("Expected 3 total messages delivered, got %v", stats["messages_delivered"])
+	}
+	perFilter, ok := stats["filter_messages_delivered"].(map[string]uint64)
+	if !ok {
+		t.Fatalf("Expected per-filter delivery map, got %T", stats["filter_messages_delivered"])
+	}
+	if perFilter[hotKey] != 3 || perFilter[idleKey] != 0 {
+		t.Errorf("Unexpected per-filter counts: %v", perFilter)
+	}
+
+	// Filters that require a connect token don't reveal their keys in the public stats
+	tokenKey := manager.CreateFilter(models.FilterOptions{Keyword: "secret"})
+	if _, _, err := manager.IssueConnectToken(tokenKey); err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	perFilter = manager.GetStats()["filter_messages_delivered"].(map[string]uint64)
+	if _, listed := perFilter[tokenKey]; listed {
+		t.Errorf("Expected the token filter's key to be left out of the stats, got %v", perFilter)
+	}
+	if len(perFilter) != 2 {
+		t.Errorf("Expected the other filters to stay listed, got %v", perFilter)
+	}
+}
+
+func TestDeliveryLatencyMetric(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	if !manager.AddConnection(filterKey, conn) {
+		t.Fatal("Expected connection to be added")
+	}
+
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": "hello world"}}},
+	})
+
+	waitFor(t, func() bool { return conn.messageCount() == 1 })
+	if count := testutil.CollectAndCount(metriks.DeliveryLatency); count < 1 {
+		t.Errorf("Expected a latency series for the filter, got %d", count)
+	}
+
+	before := testutil.CollectAndCount(metriks.DeliveryLatency)
+	manager.DeleteFilter(filterKey)
+	if after := testutil.CollectAndCount(metriks.DeliveryLatency); after != before-1 {
+		t.Errorf("Expected deleting the filter to drop its latency series (%d -> %d)", before, after)
+	}
+}
+
+func TestBroadcastIncludesMatchedKeywords(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello,world,bluesky"})
+	conn := &fakeConnection{}
+	if !manager.AddConnection(filterKey, conn) {
+		t.Fatal("Expected connection to be added")
+	}
+
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": "Hello world"}}},
+	})
+
+	waitFor(t, func() bool { return conn.messageCount() == 1 })
+
+	message, ok := conn.message(0).(models.WSMessage)
+	if !ok {
+		t.Fatalf("Expected WSMessage, got %T", conn.message(0))
+	}
+	enriched, ok := message.Data.(models.EnrichedATEvent)
+	if !ok {
+		t.Fatalf("Expected EnrichedATEvent, got %T", message.Data)
+	}
+
+	expected := []string{"hello", "world"}
+	if !reflect.DeepEqual(enriched.Timestamps.MatchedKeywords, expected) {
+		t.Errorf("Expected matched keywords %v, got %v", expected, enriched.Timestamps.MatchedKeywords)
+	}
+}
+
+func TestBroadcastShortDid(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	if !manager.AddConnection(filterKey, conn) {
+		t.Fatal("Expected connection to be added")
+	}
+
+	// DIDs around the preview boundaries must be forwarded without panicking
+	dids := []string{"", "did", "did:plc:", "did:plc:a", "did:plc:abcdefghijk", "did:plc:abcdefghijkl"}
+	for _, did := range dids {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: did,
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": "hello world"}}},
+		})
+	}
+
+	waitFor(t, func() bool { return conn.messageCount() == len(dids) })
+}
+
+func TestAddConnectionShortFilterKey(t *testing.T) {
+	manager := NewManager()
+
+	result := manager.AddConnectionWithResult("abc", &fakeConnection{})
+	if result.Success || result.ErrorCode != "INVALID_FILTER_KEY" {
+		t.Errorf("Expected INVALID_FILTER_KEY for unknown short key, got %+v", result)
+	}
+}
+
+func TestUpdateSubscriptionOptions(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	if !manager.AddConnection(filterKey, conn) {
+		t.Fatal("Expected connection to be added")
+	}
+
+	newEvent := func(text string) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": text}}},
+		}
+	}
+
+	// Invalid options are rejected and leave the subscription untouched
+	if _, err := manager.UpdateSubscriptionOptions(filterKey, models.FilterOptions{}); err == nil {
+		t.Error("Expected missing keyword to be rejected")
+	}
+	if _, err := manager.UpdateSubscriptionOptions(filterKey, models.FilterOptions{Keyword: "(", KeywordRegex: true}); err == nil {
+		t.Error("Expected invalid regex to be rejected")
+	}
+	if _, err := manager.UpdateSubscriptionOptions("missing", models.FilterOptions{Keyword: "hello"}); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+	if conn.messageCount() != 0 {
+		t.Fatalf("Expected no notifications for rejected updates, got %d", conn.messageCount())
+	}
+
+	updated, err := manager.UpdateSubscriptionOptions(filterKey, models.FilterOptions{Keyword: "gol(ang)?", KeywordRegex: true})
+	if err != nil {
+		t.Fatalf("Expected update to succeed, got %v", err)
+	}
+	if updated.Options.Keyword != "gol(ang)?" || updated.Connections != 1 {
+		t.Errorf("Unexpected updated subscription: %+v", updated)
+	}
+
+	// Connected clients are notified
+	waitFor(t, func() bool { return conn.messageCount() >= 1 })
+	if message, ok := conn.message(0).(models.WSMessage); !ok || message.Type != "filter_updated" {
+		t.Errorf("Expected filter_updated message, got %+v", conn.message(0))
+	}
+
+	// Broadcasts use the new options and the connection is kept
+	manager.BroadcastEvent(newEvent("hello there"))
+	manager.BroadcastEvent(newEvent("learning golang"))
+	waitFor(t, func() bool { return conn.messageCount() >= 2 })
+	if got := eventText(conn.message(1)); got != "learning golang" {
+		t.Errorf("Expected only the golang event to be delivered after the update, got %q", got)
+	}
+
+	if sub, _ := manager.GetSubscription(filterKey); sub.Options.Keyword != "gol(ang)?" {
+		t.Errorf("Expected stored options to be updated, got %+v", sub.Options)
+	}
+}
+
+func TestSetSubscriptionPaused(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	if !manager.AddConnection(filterKey, conn) {
+		t.Fatal("Expected connection to be added")
+	}
+
+	if _, err := manager.SetSubscriptionPaused("missing", true); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+
+	paused, err := manager.SetSubscriptionPaused(filterKey, true)
+	if err != nil {
+		t.Fatalf("Expected pause to succeed, got %v", err)
+	}
+	if !paused.Paused {
+		t.Error("Expected the subscription to report paused")
+	}
+	waitFor(t, func() bool { return conn.messageCount() >= 1 })
+	if message, ok := conn.message(0).(models.WSMessage); !ok || message.Type != "paused" {
+		t.Errorf("Expected paused message, got %+v", conn.message(0))
+	}
+
+	// Pausing again doesn't notify twice
+	if _, err := manager.SetSubscriptionPaused(filterKey, true); err != nil {
+		t.Fatalf("Expected repeated pause to succeed, got %v", err)
+	}
+
+	// Events are skipped while paused, but the connection stays
+	manager.BroadcastEvent(postEvent("did:plc:bob", "hello while paused"))
+	time.Sleep(50 * time.Millisecond)
+	if count := conn.messageCount(); count != 1 {
+		t.Errorf("Expected no events while paused, got %d messages", count)
+	}
+	if conn.isClosed() {
+		t.Error("Expected the connection to stay open while paused")
+	}
+
+	// Cleanup keeps a paused filter while it has connections
+	manager.mu.Lock()
+	manager.subscriptions[filterKey].CreatedAt = time.Now().Add(-24 * time.Hour)
+	manager.mu.Unlock()
+	manager.performPeriodicCleanup()
+	if _, exists := manager.GetSubscription(filterKey); !exists {
+		t.Fatal("Expected a paused filter with connections to survive cleanup")
+	}
+
+	resumed, err := manager.SetSubscriptionPaused(filterKey, false)
+	if err != nil {
+		t.Fatalf("Expected resume to succeed, got %v", err)
+	}
+	if resumed.Paused {
+		t.Error("Expected the subscription to report resumed")
+	}
+	manager.BroadcastEvent(postEvent("did:plc:bob", "hello again"))
+	waitFor(t, func() bool { return conn.messageCount() >= 3 })
+	if message, ok := conn.message(1).(models.WSMessage); !ok || message.Type != "resumed" {
+		t.Errorf("Expected resumed message, got %+v", conn.message(1))
+	}
+	if got := eventText(conn.message(2)); got != "hello again" {
+		t.Errorf("Expected the event after resuming to be delivered, got %q", got)
+	}
+}
+
+func TestPausedSubscriptionDoesNotBlockOtherFilters(t *testing.T) {
+	manager := NewManager()
+
+	paused := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	active := manager.CreateFilter(models.FilterOptions{Keyword: "hello", WholeWord: true})
+	conn := &fakeConnection{}
+	manager.AddConnection(paused, conn)
+	manager.AddConnection(active, conn)
+	if _, err := manager.SetSubscriptionPaused(paused, true); err != nil {
+		t.Fatalf("Expected pause to succeed, got %v", err)
+	}
+
+	// The connection still gets the event through the filter that isn't paused
+	manager.BroadcastEvent(postEvent("did:plc:bob", "hello world"))
+	waitFor(t, func() bool { return conn.messageCount() >= 2 })
+	message, ok := conn.message(1).(models.WSMessage)
+	if !ok || message.Type != "event" {
+		t.Fatalf("Expected an event message, got %+v", conn.message(1))
+	}
+	if event, ok := message.Data.(models.EnrichedATEvent); !ok || event.Timestamps.FilterKey != active {
+		t.Errorf("Expected the event to be forwarded by the active filter, got %+v", message.Data)
+	}
+}
+
+func TestIncludeRawRecord(t *testing.T) {
+	manager := NewManager()
+
+	withRaw := manager.CreateFilter(models.FilterOptions{Keyword: "hello", IncludeRawRecord: true})
+	withoutRaw := manager.CreateFilter(models.FilterOptions{Keyword: "hello", WholeWord: true})
+	rawConn := &fakeConnection{}
+	plainConn := &fakeConnection{}
+	manager.AddConnection(withRaw, rawConn)
+	manager.AddConnection(withoutRaw, plainConn)
+
+	raw := []byte{0xa1, 0x64, 't', 'e', 'x', 't', 0x65, 'h', 'e', 'l', 'l', 'o'}
+	event := postEvent("did:plc:bob", "hello")
+	event.Ops[0].RawRecord = raw
+	manager.BroadcastEvent(event)
+	waitFor(t, func() bool { return rawConn.messageCount() >= 1 && plainConn.messageCount() >= 1 })
+
+	rawOps := func(conn *fakeConnection) []byte {
+		message, _ := conn.message(0).(models.WSMessage)
+		forwarded, ok := message.Data.(models.EnrichedATEvent)
+		if !ok || len(forwarded.Ops) != 1 {
+			t.Fatalf("Expected an event with one op, got %+v", conn.message(0))
+		}
+		return forwarded.Ops[0].RawRecord
+	}
+	if got := rawOps(rawConn); !bytes.Equal(got, raw) {
+		t.Errorf("Expected the raw record for an includeRawRecord filter, got %x", got)
+	}
+	if got := rawOps(plainConn); got != nil {
+		t.Errorf("Expected no raw record by default, got %x", got)
+	}
+	if !bytes.Equal(event.Ops[0].RawRecord, raw) {
+		t.Error("Expected the broadcast event's ops to be left untouched")
+	}
+
+	// The bytes are forwarded as base64 in JSON
+	message, _ := rawConn.message(0).(models.WSMessage)
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		t.Fatalf("Failed to encode message: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"rawRecord":"`+base64.StdEncoding.EncodeToString(raw)+`"`) {
+		t.Errorf("Expected base64 rawRecord in %s", encoded)
+	}
+}
+
+func TestSetConnectionFilter(t *testing.T) {
+	manager := NewManager()
+
+	newEvent := func(text string) *models.ATEvent {
+		return &models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": text}}},
+		}
+	}
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeConnection{}
+	other := &fakeConnection{}
+	manager.AddConnection(filterKey, conn)
+
+	if _, err := manager.SetConnectionFilter(filterKey, conn, models.FilterOptions{}); err == nil {
+		t.Error("Expected missing keyword to be rejected")
+	}
+	if _, err := manager.SetConnectionFilter("missing", conn, models.FilterOptions{Keyword: "golang"}); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+	if _, err := manager.SetConnectionFilter(filterKey, other, models.FilterOptions{Keyword: "golang"}); !errors.Is(err, ErrNotSubscribed) {
+		t.Errorf("Expected ErrNotSubscribed, got %v", err)
+	}
+	webhookOptions := models.FilterOptions{Keyword: "golang", WebhookURL: "http://169.254.169.254/latest/meta-data"}
+	if _, err := manager.SetConnectionFilter(filterKey, conn, webhookOptions); !errors.Is(err, ErrWebhookOverConnection) {
+		t.Errorf("Expected ErrWebhookOverConnection, got %v", err)
+	}
+
+	// A filter the connection has to itself is updated in place
+	updated, err := manager.SetConnectionFilter(filterKey, conn, models.FilterOptions{Keyword: "golang"})
+	if err != nil {
+		t.Fatalf("Expected the update to succeed, got %v", err)
+	}
+	if updated.FilterKey != filterKey || updated.Options.Keyword != "golang" || updated.Connections != 1 {
+		t.Errorf("Expected the filter updated in place, got %+v", updated)
+	}
+
+	// A shared filter is left alone and the connection moves to a new one
+	manager.AddConnection(filterKey, other)
+	moved, err := manager.SetConnectionFilter(filterKey, conn, models.FilterOptions{Keyword: "rust"})
+	if err != nil {
+		t.Fatalf("Expected the move to succeed, got %v", err)
+	}
+	if moved.FilterKey == filterKey || moved.Options.Keyword != "rust" || moved.Connections != 1 {
+		t.Errorf("Expected the connection on a new filter, got %+v", moved)
+	}
+	if sub, _ := manager.GetSubscription(filterKey); sub.Options.Keyword != "golang" || sub.Connections != 1 {
+		t.Errorf("Expected the shared filter untouched apart from losing the connection, got %+v", sub)
+	}
+	if total := manager.GetStats()["total_connections"]; total != 2 {
+		t.Errorf("Expected the moved connection to count once, got %v connections", total)
+	}
+
+	manager.BroadcastEvent(newEvent("learning golang"))
+	manager.BroadcastEvent(newEvent("learning rust"))
+	waitFor(t, func() bool { return conn.messageCount() == 1 && other.messageCount() == 1 })
+	if got := eventText(conn.message(0)); got != "learning rust" {
+		t.Errorf("Expected the moved connection to receive the rust event, got %q", got)
+	}
+	if got := eventText(other.message(0)); got != "learning golang" {
+		t.Errorf("Expected the other connection to keep receiving golang events, got %q", got)
+	}
+
+	// With the moved connection gone the filter is the other connection's alone
+	if updated, err := manager.SetConnectionFilter(filterKey, other, models.FilterOptions{Keyword: "python"}); err != nil || updated.FilterKey != filterKey {
+		t.Errorf("Expected the filter updated in place, got %+v (err %v)", updated, err)
+	}
+}
+
+func TestPreviewText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		start    int
+		maxRunes int
+		expected string
+	}{
+		{name: "Short text unchanged", text: "hello", start: 0, maxRunes: 8, expected: "hello"},
+		{name: "Exactly max unchanged", text: "abcdefgh", start: 0, maxRunes: 8, expected: "abcdefgh"},
+		{name: "Long text truncated", text: "abcdefghij", start: 0, maxRunes: 8, expected: "abcdefgh..."},
+		{name: "DID prefix skipped", text: "did:plc:abcdefghijklmnop", start: 8, maxRunes: 12, expected: "abcdefghijkl..."},
+		{name: "Short DID suffix", text: "did:plc:abc", start: 8, maxRunes: 12, expected: "abc..."},
+		{name: "Shorter than start unchanged", text: "did:plc", start: 8, maxRunes: 12, expected: "did:plc"},
+		{name: "Empty text", text: "", start: 8, maxRunes: 12, expected: ""},
+		{name: "CJK counted as characters", text: "日本語のテキストです", start: 0, maxRunes: 4, expected: "日本語の..."},
+		{name: "Emoji counted as characters", text: "🦋🦋🦋🦋🦋", start: 0, maxRunes: 3, expected: "🦋🦋🦋..."},
+		{name: "Multibyte offset", text: "did:plc:猫猫猫", start: 8, maxRunes: 2, expected: "猫猫..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := previewText(tt.text, tt.start, tt.maxRunes)
+			if result != tt.expected {
+				t.Errorf("previewText(%q, %d, %d) = %q, want %q", tt.text, tt.start, tt.maxRunes, result, tt.expected)
+			}
+			if !utf8.ValidString(result) {
+				t.Errorf("previewText(%q, %d, %d) produced invalid UTF-8: %q", tt.text, tt.start, tt.maxRunes, result)
+			}
+			if count := utf8.RuneCountInString(strings.TrimSuffix(result, "...")); result != tt.text && count > tt.maxRunes {
+				t.Errorf("Expected at most %d characters, got %d", tt.maxRunes, count)
+			}
+		})
+	}
+}
+
+func TestGenerateFilterKey(t *testing.T) {
+	// Test that keys are unique
+	keys := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		key := generateFilterKey()
+		if keys[key] {
+			t.Errorf("Duplicate filter key generated: %s", key)
+		}
+		keys[key] = true
+
+		if len(key) != 32 {
+			t.Errorf("Expected filter key length 32, got %d", len(key))
+		}
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	manager := NewManager()
+
+	// Test concurrent filter creation and access
+	done := make(chan bool, 4)
+
+	// Multiple creators
+	go func() {
+		for i := 0; i < 50; i++ {
+			options := models.FilterOptions{
+				Repository: "did:plc:test",
+				Keyword:    "test",
+			}
+			manager.CreateFilter(options)
+		}
+		done <- true
+	}()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			options := models.FilterOptions{
+				PathPrefix: "app.bsky.feed.post",
+				Keyword:    "hello",
+			}
+			manager.CreateFilter(options)
+		}
+		done <- true
+	}()
+
+	// Multiple readers
+	go func() {
+		for i := 0; i < 100; i++ {
+			manager.GetSubscriptions()
+		}
+		done <- true
+	}()
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			manager.GetStats()
+		}
+		done <- true
+	}()
+
+	// Wait for all goroutines
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	// Verify final state
+	subs := manager.GetSubscriptions()
+	if len(subs) != 100 {
+		t.Errorf("Expected 100 subscriptions after concurrent creation, got %d", len(subs))
+	}
+}
+
+func TestEmptyFilterCleanup(t *testing.T) {
+	manager := NewManager()
+	manager.SetReplayBufferSize(0) // Without replay, filters go as soon as their last connection does
+
+	// Create some filters
+	options1 := models.FilterOptions{Repository: "did:plc:test1", Keyword: "test"}
+	options2 := models.FilterOptions{Repository: "did:plc:test2", Keyword: "hello"}
+	options3 := models.FilterOptions{Repository: "did:plc:test3", Keyword: "world"}
+
+	filterKey1 := manager.CreateFilter(options1)
+	filterKey2 := manager.CreateFilter(options2)
+	filterKey3 := manager.CreateFilter(options3)
+
+	// Verify all filters exist
+	if len(manager.GetSubscriptions()) != 3 {
+		t.Errorf("Expected 3 filters initially, got %d", len(manager.GetSubscriptions()))
+	}
+
+	// Add a connection to filterKey2 only
+	manager.AddConnection(filterKey2, nil) // Using nil for simplicity in test
+
+	// Create a mock event
+	event := &models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{
+			{
+				Action: "create",
+				Path:   "app.bsky.feed.post/test",
+				Record: map[string]interface{}{
+					"text": "test message",
+				},
+			},
+		},
+	}
+
+	// Broadcast event - this should NOT trigger cleanup of empty filters anymore
+	manager.BroadcastEvent(event)
+
+	// Verify that all filters still exist (no cleanup during broadcast)
+	remainingFilters := manager.GetSubscriptions()
+	if len(remainingFilters) != 3 {
+		t.Errorf("Expected 3 filters after broadcast (no cleanup), got %d", len(remainingFilters))
+	}
+
+	// Now remove the connection from filterKey2 - this should trigger cleanup
+	manager.RemoveConnection(filterKey2, nil)
+
+	// Verify filterKey2 was cleaned up when its last connection was removed
+	afterRemoveFilters := manager.GetSubscriptions()
+	if len(afterRemoveFilters) != 2 {
+		t.Errorf("Expected 2 filters after connection removal, got %d", len(afterRemoveFilters))
+	}
+
+	// Verify filterKey2 no longer exists but others do
+	_, exists2 := manager.GetSubscription(filterKey2)
+	_, exists1 := manager.GetSubscription(filterKey1)
+	_, exists3 := manager.GetSubscription(filterKey3)
+
+	if exists2 {
+		t.Error("Filter with removed connection should have been cleaned up")
+	}
+	if !exists1 || !exists3 {
+		t.Error("Filters without connections should still exist (only cleaned up when last connection is removed)")
+	}
+}
+
+func TestFilterExpiry(t *testing.T) {
+	manager := NewManager()
+
+	expiring := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	other := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	only := &fakeWebSocketConnection{}
+	shared := &fakeConnection{}
+	manager.AddConnection(expiring, only)
+	manager.AddConnection(expiring, shared)
+	manager.AddConnection(other, shared)
+
+	if err := manager.SetFilterExpiry("missing", time.Now()); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+
+	// A filter that hasn't expired yet is kept even though cleanup runs
+	if err := manager.SetFilterExpiry(expiring, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("SetFilterExpiry returned error: %v", err)
+	}
+	manager.performPeriodicCleanup()
+	sub, exists := manager.GetSubscription(expiring)
+	if !exists || sub.ExpiresAt == nil {
+		t.Fatalf("Expected the filter kept with its expiry, got %+v", sub)
+	}
+
+	expiresAt := time.Now().Add(-time.Second)
+	if err := manager.SetFilterExpiry(expiring, expiresAt); err != nil {
+		t.Fatalf("SetFilterExpiry returned error: %v", err)
+	}
+
+	// Expired filters take no new connections or events, even before cleanup removes them
+	if result := manager.AddConnectionWithResult(expiring, &fakeConnection{}); result.Success || result.ErrorCode != "FILTER_EXPIRED" {
+		t.Errorf("Expected FILTER_EXPIRED, got %+v", result)
+	}
+	if _, err := manager.SetConnectionFilter(expiring, only, models.FilterOptions{Keyword: "howdy"}); !errors.Is(err, ErrFilterExpired) {
+		t.Errorf("Expected ErrFilterExpired changing the expired filter, got %v", err)
+	}
+	if _, err := manager.UpdateSubscriptionOptions(expiring, models.FilterOptions{Keyword: "howdy"}); !errors.Is(err, ErrFilterExpired) {
+		t.Errorf("Expected ErrFilterExpired updating the expired filter, got %v", err)
+	}
+	manager.BroadcastEvent(postEvent("did:plc:test123", "hello there"))
+	manager.BroadcastEvent(postEvent("did:plc:test123", "world"))
+	waitFor(t, func() bool { return shared.messageCount() == 1 })
+	if message, ok := shared.message(0).(models.WSMessage); !ok || message.Type != "event" || eventText(message) != "world" {
+		t.Errorf("Expected only the other filter's event, got %+v", shared.message(0))
+	}
+	if only.messageCount() != 0 {
+		t.Errorf("Expected no events for the expired filter, got %d", only.messageCount())
+	}
+
+	// Connected filters are removed too once they expire
+	manager.performPeriodicCleanup()
+	if _, exists := manager.GetSubscription(expiring); exists {
+		t.Fatal("Expected the expired filter to be removed")
+	}
+
+	// The connection subscribed to nothing else is told why and closed
+	if !only.isClosed() {
+		t.Error("Expected the connection on the expired filter to be closed")
+	}
+	only.mu.Lock()
+	closeFrames := only.closeFrames
+	only.mu.Unlock()
+	if len(closeFrames) != 1 || !bytes.Contains(closeFrames[0], []byte("filter expired")) {
+		t.Errorf("Expected a close frame saying the filter expired, got %q", closeFrames)
+	}
+
+	// The connection with another filter stays open and is notified
+	if shared.isClosed() {
+		t.Error("Expected the connection with another filter to stay open")
+	}
+	waitFor(t, func() bool { return shared.messageCount() == 2 })
+	if message, ok := shared.message(1).(models.WSMessage); !ok || message.Type != "filter_expired" {
+		t.Errorf("Expected a filter_expired message, got %+v", shared.message(1))
+	}
+	if total := manager.GetStats()["total_connections"]; total != 1 {
+		t.Errorf("Expected 1 remaining connection, got %v", total)
+	}
+}
+
+func TestPeriodicCleanup(t *testing.T) {
+	// Create a manager but we'll manually control the cleanup for testing
+	manager := &Manager{
+		subscriptions:  make(map[string]*Subscription),
+		maxConnections: 1000,
+		connections:    make(map[Connection]map[string]bool),
+		writers:        make(map[Connection]*connectionWriter),
+		cleanupStop:    make(chan bool, 1),
 	}
 
 	// Create some filters
@@ -696,6 +3236,63 @@ func TestPeriodicCleanup(t *testing.T) {
 	}
 }
 
+func TestShutdownWithDrain(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	// One client answers the close frame right away, one never does, and one is a plain (SSE-style) connection
+	responsive := &fakeWebSocketConnection{}
+	responsive.onControl = func() { go manager.RemoveConnection(filterKey, responsive) }
+	unresponsive := &fakeWebSocketConnection{}
+	plain := &fakeConnection{}
+	for _, conn := range []Connection{responsive, unresponsive, plain} {
+		if !manager.AddConnection(filterKey, conn) {
+			t.Fatal("Expected connection to be added")
+		}
+	}
+
+	expectedFrame := websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownCloseReason)
+	drainTimeout := 200 * time.Millisecond
+	start := time.Now()
+	if dropped := manager.ShutdownWithDrain(drainTimeout); dropped != 0 {
+		t.Errorf("Expected no messages dropped with empty queues, got %d", dropped)
+	}
+
+	// The unresponsive client holds shutdown until the drain timeout
+	if elapsed := time.Since(start); elapsed < drainTimeout {
+		t.Errorf("Expected shutdown to wait for the drain timeout, returned after %v", elapsed)
+	}
+	for name, conn := range map[string]*fakeWebSocketConnection{"responsive": responsive, "unresponsive": unresponsive} {
+		if len(conn.closeFrames) != 1 || !reflect.DeepEqual(conn.closeFrames[0], expectedFrame) {
+			t.Errorf("Expected %s client to get one going-away close frame, got %q", name, conn.closeFrames)
+		}
+	}
+	if !unresponsive.isClosed() || !plain.isClosed() {
+		t.Error("Expected connections still open after draining to be closed")
+	}
+	if stats := manager.GetStats(); stats["total_connections"] != 0 {
+		t.Errorf("Expected no connections after shutdown, got %v", stats["total_connections"])
+	}
+}
+
+func TestShutdownWithDrainReturnsEarly(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &fakeWebSocketConnection{}
+	conn.onControl = func() { go manager.RemoveConnection(filterKey, conn) }
+	if !manager.AddConnection(filterKey, conn) {
+		t.Fatal("Expected connection to be added")
+	}
+
+	start := time.Now()
+	manager.ShutdownWithDrain(5 * time.Second)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected shutdown to finish once clients closed, took %v", elapsed)
+	}
+}
+
 func TestGetMatchingKeywords(t *testing.T) {
 	manager := NewManager()
 	defer manager.Shutdown()
@@ -753,7 +3350,7 @@ func TestGetMatchingKeywords(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			matches := manager.getMatchingKeywords(event, tt.keywords)
+			matches := manager.getMatchingKeywords(event, models.FilterOptions{Keyword: tt.keywords})
 
 			if len(matches) != len(tt.expectedMatches) {
 				t.Errorf("Expected %d matches, got %d. Expected: %v, Got: %v",
@@ -780,3 +3377,32 @@ func TestGetMatchingKeywords(t *testing.T) {
 		})
 	}
 }
+
+func TestSetFilterLabel(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "launch"})
+
+	if err := manager.SetFilterLabel("missing", "label", nil); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound for an unknown filter, got %v", err)
+	}
+
+	metadata := map[string]string{"team": "growth"}
+	if err := manager.SetFilterLabel(filterKey, "Launch day mentions", metadata); err != nil {
+		t.Fatalf("SetFilterLabel returned error: %v", err)
+	}
+	metadata["team"] = "changed"
+
+	sub, exists := manager.GetSubscription(filterKey)
+	if !exists {
+		t.Fatal("Expected the filter to exist")
+	}
+	if sub.Label != "Launch day mentions" || sub.Metadata["team"] != "growth" {
+		t.Errorf("Expected the label and a copy of the metadata, got %q and %v", sub.Label, sub.Metadata)
+	}
+
+	// Labels are informational: they don't change what the filter matches
+	labeled := manager.subscriptions[filterKey]
+	if !manager.matchesFilterWithPatterns(postEvent("did:plc:alice", "launch today"), labeled.Options, labeled.keywordPatterns) {
+		t.Error("Expected a labeled filter to match as before")
+	}
+}
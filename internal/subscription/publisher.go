@@ -0,0 +1,63 @@
+package subscription
+
+import (
+	"errors"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// EventPublisher publishes the event messages a filter forwards to a message bus, so other
+// nodes can fan them out to their own clients without ingesting the firehose themselves.
+// Publish is called on the broadcast path while the manager is locked, so it must not block.
+type EventPublisher interface {
+	Publish(filterKey string, message models.WSMessage) error
+	Close() error
+}
+
+// NoopPublisher is the default EventPublisher; it discards everything
+type NoopPublisher struct{}
+
+// Publish discards the message
+func (NoopPublisher) Publish(string, models.WSMessage) error { return nil }
+
+// Close does nothing
+func (NoopPublisher) Close() error { return nil }
+
+// MultiPublisher publishes every message to each of its publishers, e.g. the message bus and
+// the Kafka sink
+type MultiPublisher []EventPublisher
+
+// Publish publishes to every publisher and returns their errors joined
+func (p MultiPublisher) Publish(filterKey string, message models.WSMessage) error {
+	var errs []error
+	for _, publisher := range p {
+		errs = append(errs, publisher.Publish(filterKey, message))
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every publisher and returns their errors joined
+func (p MultiPublisher) Close() error {
+	var errs []error
+	for _, publisher := range p {
+		errs = append(errs, publisher.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// SetEventPublisher sets where forwarded events are published in addition to local connections.
+// The previous publisher isn't closed; a nil publisher restores the no-op default.
+func (m *Manager) SetEventPublisher(publisher EventPublisher) {
+	if publisher == nil {
+		publisher = NoopPublisher{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.publisher = publisher
+}
+
+// publishing reports whether events are published anywhere; the caller must hold m.mu
+func (m *Manager) publishing() bool {
+	_, noop := m.publisher.(NoopPublisher)
+	return m.publisher != nil && !noop
+}
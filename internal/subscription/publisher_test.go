@@ -0,0 +1,76 @@
+package subscription
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// recordingPublisher is an EventPublisher that records what it was asked to publish
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published map[string][]models.WSMessage
+}
+
+func (p *recordingPublisher) Publish(filterKey string, message models.WSMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.published == nil {
+		p.published = make(map[string][]models.WSMessage)
+	}
+	p.published[filterKey] = append(p.published[filterKey], message)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error { return nil }
+
+func (p *recordingPublisher) messages(filterKey string) []models.WSMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.published[filterKey]
+}
+
+func TestEventPublisher(t *testing.T) {
+	manager := NewManager()
+	manager.SetReplayBufferSize(0)
+	publisher := &recordingPublisher{}
+	manager.SetEventPublisher(publisher)
+
+	// Filters are published even without local connections, since clients may be on other nodes
+	unwatched := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	watched := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	conn := &fakeConnection{}
+	manager.AddConnection(watched, conn)
+
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": "hello world"}}},
+	})
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/def456", Record: map[string]interface{}{"text": "goodbye"}}},
+	})
+
+	for _, filterKey := range []string{unwatched, watched} {
+		messages := publisher.messages(filterKey)
+		if len(messages) != 1 {
+			t.Fatalf("Expected 1 message published for filter %s, got %d", filterKey[:8], len(messages))
+		}
+		event, ok := messages[0].Data.(models.EnrichedATEvent)
+		if messages[0].Type != "event" || !ok || event.Timestamps.FilterKey != filterKey {
+			t.Errorf("Expected the enriched event message for filter %s, got %+v", filterKey[:8], messages[0])
+		}
+	}
+	waitFor(t, func() bool { return conn.messageCount() == 1 })
+
+	// Clearing the publisher restores the no-op default
+	manager.SetEventPublisher(nil)
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/ghi789", Record: map[string]interface{}{"text": "hello again"}}},
+	})
+	if len(publisher.messages(unwatched)) != 1 {
+		t.Errorf("Expected nothing published after the publisher was cleared, got %d", len(publisher.messages(unwatched)))
+	}
+}
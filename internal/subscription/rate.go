@@ -0,0 +1,97 @@
+package subscription
+
+import (
+	"sync"
+	"time"
+)
+
+// KeywordRateWindowSeconds is the span, in one-second buckets, over which keyword throughput is measured
+const KeywordRateWindowSeconds = 60
+
+// keywordRate counts events over the last KeywordRateWindowSeconds in a ring of one-second buckets.
+// Buckets are indexed by Unix second and reset when reused, so idle periods need no upkeep.
+type keywordRate struct {
+	counts  [KeywordRateWindowSeconds]uint64
+	seconds [KeywordRateWindowSeconds]int64 // Unix second each bucket is counting
+}
+
+// add records one event at now
+func (r *keywordRate) add(now time.Time) {
+	second := now.Unix()
+	i := second % KeywordRateWindowSeconds
+	if r.seconds[i] != second {
+		r.seconds[i] = second
+		r.counts[i] = 0
+	}
+	r.counts[i]++
+}
+
+// total returns the number of events in the window ending at now
+func (r *keywordRate) total(now time.Time) uint64 {
+	second := now.Unix()
+	var total uint64
+	for i, count := range r.counts {
+		if age := second - r.seconds[i]; age >= 0 && age < KeywordRateWindowSeconds {
+			total += count
+		}
+	}
+	return total
+}
+
+// deliveryRateBucket and deliveryRateBuckets size the ring behind subscription delivery rates:
+// 90 ten-second buckets cover the longest (15 minute) window
+const (
+	deliveryRateBucket  = 10 * time.Second
+	deliveryRateBuckets = 90
+)
+
+// deliveryRate counts the messages a subscription forwards over the last 15 minutes in a ring of
+// ten-second buckets, reset when reused like keywordRate's, and remembers the last forward
+type deliveryRate struct {
+	mu      sync.Mutex
+	counts  [deliveryRateBuckets]uint64
+	buckets [deliveryRateBuckets]int64 // Bucket number (Unix seconds / bucket width) each slot is counting
+	last    time.Time
+}
+
+// add records n messages forwarded at now
+func (r *deliveryRate) add(now time.Time, n int) {
+	bucket := now.Unix() / int64(deliveryRateBucket/time.Second)
+	i := bucket % deliveryRateBuckets
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buckets[i] != bucket {
+		r.buckets[i] = bucket
+		r.counts[i] = 0
+	}
+	r.counts[i] += uint64(n)
+	r.last = now
+}
+
+// perSecond returns the average messages per second over the window ending at now; the window
+// is rounded down to whole buckets and capped at 15 minutes
+func (r *deliveryRate) perSecond(now time.Time, window time.Duration) float64 {
+	bucket := now.Unix() / int64(deliveryRateBucket/time.Second)
+	windowBuckets := min(int64(window/deliveryRateBucket), deliveryRateBuckets)
+	if windowBuckets <= 0 {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total uint64
+	for i, count := range r.counts {
+		if age := bucket - r.buckets[i]; age >= 0 && age < windowBuckets {
+			total += count
+		}
+	}
+	return float64(total) / (time.Duration(windowBuckets) * deliveryRateBucket).Seconds()
+}
+
+// lastAt returns when a message was last forwarded, or the zero time if none was
+func (r *deliveryRate) lastAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
@@ -0,0 +1,75 @@
+package subscription
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestKeywordRate(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	rate := &keywordRate{}
+
+	if total := rate.total(start); total != 0 {
+		t.Errorf("Expected an empty rate to total 0, got %d", total)
+	}
+
+	rate.add(start)
+	rate.add(start.Add(500 * time.Millisecond)) // Same bucket
+	rate.add(start.Add(30 * time.Second))
+	if total := rate.total(start.Add(30 * time.Second)); total != 3 {
+		t.Errorf("Expected 3 events in the window, got %d", total)
+	}
+
+	// The first bucket ages out once a full window has passed
+	if total := rate.total(start.Add(KeywordRateWindowSeconds * time.Second)); total != 1 {
+		t.Errorf("Expected the oldest events to age out, got %d", total)
+	}
+
+	// Reusing a bucket a window later resets it instead of adding to stale counts
+	rate.add(start.Add(KeywordRateWindowSeconds * time.Second))
+	if total := rate.total(start.Add(KeywordRateWindowSeconds * time.Second)); total != 2 {
+		t.Errorf("Expected the reused bucket to start over, got %d", total)
+	}
+
+	if total := rate.total(start.Add(10 * time.Minute)); total != 0 {
+		t.Errorf("Expected nothing left after a long idle period, got %d", total)
+	}
+}
+
+func TestDeliveryRate(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	rate := &deliveryRate{}
+
+	if perSecond := rate.perSecond(start, time.Minute); perSecond != 0 || !rate.lastAt().IsZero() {
+		t.Errorf("Expected an empty rate, got %v per second, last at %v", perSecond, rate.lastAt())
+	}
+
+	// 60 messages four minutes ago and 60 in the last minute
+	rate.add(start, 60)
+	now := start.Add(4 * time.Minute)
+	rate.add(now.Add(-30*time.Second), 30)
+	rate.add(now, 30)
+
+	tests := []struct {
+		window   time.Duration
+		expected float64
+	}{
+		{time.Minute, 1},
+		{5 * time.Minute, 0.4},
+		{15 * time.Minute, 120.0 / (15 * 60)},
+	}
+	for _, tt := range tests {
+		if perSecond := rate.perSecond(now, tt.window); math.Abs(perSecond-tt.expected) > 1e-9 {
+			t.Errorf("Expected %v per second over %v, got %v", tt.expected, tt.window, perSecond)
+		}
+	}
+	if !rate.lastAt().Equal(now) {
+		t.Errorf("Expected last forward at %v, got %v", now, rate.lastAt())
+	}
+
+	// Everything ages out of the longest window
+	if perSecond := rate.perSecond(now.Add(15*time.Minute), 15*time.Minute); perSecond != 0 {
+		t.Errorf("Expected nothing left after 15 idle minutes, got %v per second", perSecond)
+	}
+}
@@ -0,0 +1,135 @@
+package subscription
+
+import (
+	"sync"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// DefaultReplayBufferSize is how many recent events each subscription keeps for reconnecting clients
+const DefaultReplayBufferSize = 100
+
+// replayBuffer is a fixed-size ring of a subscription's most recently broadcast event messages.
+// A nil buffer (replay disabled) accepts and returns nothing.
+type replayBuffer struct {
+	mu          sync.Mutex
+	messages    []models.WSMessage
+	next        int       // Slot the next message is written to
+	count       int       // Slots in use
+	lastEvicted time.Time // Timestamp of the newest message pushed out of the ring
+}
+
+// newReplayBuffer creates a buffer holding size messages, or returns nil if size is not positive
+func newReplayBuffer(size int) *replayBuffer {
+	if size <= 0 {
+		return nil
+	}
+	return &replayBuffer{messages: make([]models.WSMessage, size)}
+}
+
+// add stores a message, evicting the oldest one when the buffer is full
+func (b *replayBuffer) add(message models.WSMessage) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.count == len(b.messages) {
+		b.lastEvicted = b.messages[b.next].Timestamp
+	} else {
+		b.count++
+	}
+	b.messages[b.next] = message
+	b.next = (b.next + 1) % len(b.messages)
+}
+
+// between returns the buffered messages timestamped after since and before until, oldest first.
+// truncated reports that messages after since were already evicted, so the result has a gap.
+func (b *replayBuffer) between(since, until time.Time) (messages []models.WSMessage, truncated bool) {
+	if b == nil {
+		return nil, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := (b.next - b.count + len(b.messages)) % len(b.messages)
+	for i := 0; i < b.count; i++ {
+		message := b.messages[(oldest+i)%len(b.messages)]
+		if message.Timestamp.After(since) && message.Timestamp.Before(until) {
+			messages = append(messages, message)
+		}
+	}
+	return messages, b.lastEvicted.After(since)
+}
+
+// recent returns the newest limit buffered messages, oldest first
+func (b *replayBuffer) recent(limit int) []models.WSMessage {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := min(limit, b.count)
+	messages := make([]models.WSMessage, 0, count)
+	first := (b.next - count + len(b.messages)) % len(b.messages)
+	for i := 0; i < count; i++ {
+		messages = append(messages, b.messages[(first+i)%len(b.messages)])
+	}
+	return messages
+}
+
+// RecentEvents returns up to limit of the filter's most recently broadcast messages from its
+// replay buffer, oldest first. Polling counts as activity: a filter read this way without any
+// connections isn't cleaned up as long as it is polled within the cleanup grace period.
+func (m *Manager) RecentEvents(filterKey string, limit int) ([]models.WSMessage, error) {
+	m.mu.RLock()
+	sub, exists := m.subscriptions[filterKey]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	sub.mu.Lock()
+	sub.lastPolledAt = time.Now()
+	sub.mu.Unlock()
+	return sub.replay.recent(limit), nil
+}
+
+// ReplayResult describes the buffered events queued for a connection by Replay
+type ReplayResult struct {
+	Events    int  // Events queued for the connection
+	Truncated bool // Some events after since were already evicted from the buffer, so there is a gap
+}
+
+// Replay queues the filter's buffered events forwarded after since to conn, oldest first, as
+// ordinary event messages. Events forwarded after conn subscribed to the filter were already
+// delivered live, so they aren't repeated.
+func (m *Manager) Replay(filterKey string, conn Connection, since time.Time) (ReplayResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return ReplayResult{}, ErrSubscriptionNotFound
+	}
+
+	sub.mu.RLock()
+	info, attached := sub.Connections[conn]
+	sub.mu.RUnlock()
+	writer := m.writers[conn]
+	if !attached || writer == nil {
+		return ReplayResult{}, ErrNotSubscribed
+	}
+
+	messages, truncated := sub.replay.between(since, info.ConnectedAt)
+	result := ReplayResult{Truncated: truncated}
+	for _, message := range messages {
+		if writer.enqueue(message, &sub.MessagesDelivered) {
+			result.Events++
+		}
+	}
+	return result, nil
+}
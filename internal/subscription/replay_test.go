@@ -0,0 +1,234 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestReplayBufferEviction(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+
+	buffer := newReplayBuffer(3)
+	for i := 1; i <= 5; i++ {
+		buffer.add(models.WSMessage{Type: "event", Timestamp: at(i), Data: i})
+	}
+
+	tests := []struct {
+		name      string
+		since     time.Time
+		until     time.Time
+		expected  []int
+		truncated bool
+	}{
+		{"everything buffered", at(0), at(10), []int{3, 4, 5}, true},
+		{"since the last evicted event", at(2), at(10), []int{3, 4, 5}, false},
+		{"since a buffered event", at(3), at(10), []int{4, 5}, false},
+		{"until excludes later events", at(2), at(5), []int{3, 4}, false},
+		{"nothing newer", at(5), at(10), nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, truncated := buffer.between(tt.since, tt.until)
+			var got []int
+			for _, message := range messages {
+				got = append(got, message.Data.(int))
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected events %v, got %v", tt.expected, got)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("Expected events %v, got %v", tt.expected, got)
+				}
+			}
+			if truncated != tt.truncated {
+				t.Errorf("Expected truncated %v, got %v", tt.truncated, truncated)
+			}
+		})
+	}
+}
+
+func TestReplayBufferDisabled(t *testing.T) {
+	buffer := newReplayBuffer(0)
+	if buffer != nil {
+		t.Fatal("Expected no buffer for size 0")
+	}
+	buffer.add(models.WSMessage{Type: "event", Timestamp: time.Now()})
+	if messages, truncated := buffer.between(time.Time{}, time.Now()); len(messages) != 0 || truncated {
+		t.Errorf("Expected nothing from a disabled buffer, got %d messages (truncated %v)", len(messages), truncated)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	broadcast := func(text string) {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/" + text, Record: map[string]interface{}{"text": "hello " + text}}},
+		})
+	}
+
+	since := time.Now()
+	broadcast("missed1")
+	broadcast("missed2")
+
+	conn := &fakeConnection{}
+	manager.AddConnection(filterKey, conn)
+	broadcast("live")
+	waitFor(t, func() bool { return conn.messageCount() == 1 })
+
+	if _, err := manager.Replay("nonexistent", conn, since); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+	if _, err := manager.Replay(filterKey, &fakeConnection{}, since); !errors.Is(err, ErrNotSubscribed) {
+		t.Errorf("Expected ErrNotSubscribed, got %v", err)
+	}
+
+	// The live event was already delivered, so only the two missed ones are replayed
+	result, err := manager.Replay(filterKey, conn, since)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Events != 2 || result.Truncated {
+		t.Errorf("Expected 2 events without truncation, got %+v", result)
+	}
+	waitFor(t, func() bool { return conn.messageCount() == 3 })
+
+	for i, expected := range []string{"live", "missed1", "missed2"} {
+		message, ok := conn.message(i).(models.WSMessage)
+		if !ok {
+			t.Fatalf("Expected message %d to be a WSMessage, got %T", i, conn.message(i))
+		}
+		event := message.Data.(models.EnrichedATEvent)
+		if path := event.Ops[0].Path; path != "app.bsky.feed.post/"+expected {
+			t.Errorf("Expected message %d to be %s, got %s", i, expected, path)
+		}
+	}
+}
+
+func TestReplayAfterReconnect(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	conn := &fakeConnection{}
+	manager.AddConnection(filterKey, conn)
+	manager.DropConnection(conn)
+
+	// The filter outlives its last connection so the client can come back for what it missed
+	since := time.Now()
+	manager.BroadcastEvent(postEvent("did:plc:test123", "hello missed"))
+
+	reconnected := &fakeConnection{}
+	if result := manager.AddConnectionWithResult(filterKey, reconnected); !result.Success {
+		t.Fatalf("Expected to reconnect to the filter, got %+v", result)
+	}
+	result, err := manager.Replay(filterKey, reconnected, since)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Events != 1 {
+		t.Fatalf("Expected 1 replayed event, got %+v", result)
+	}
+	waitFor(t, func() bool { return reconnected.messageCount() == 1 })
+	if text := eventText(reconnected.message(0)); text != "hello missed" {
+		t.Errorf("Expected the missed event, got %q", text)
+	}
+
+	// Once everyone has left for longer than the grace period the filter is cleaned up
+	manager.DropConnection(reconnected)
+	manager.mu.Lock()
+	left := time.Now().Add(-24 * time.Hour)
+	manager.subscriptions[filterKey].LastConnectionAt = &left
+	manager.mu.Unlock()
+	manager.performPeriodicCleanup()
+	if _, exists := manager.GetSubscription(filterKey); exists {
+		t.Error("Expected the filter to be cleaned up after the grace period")
+	}
+}
+
+func TestReplayDisabled(t *testing.T) {
+	manager := NewManager()
+	manager.SetReplayBufferSize(0)
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	since := time.Now()
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc", Record: map[string]interface{}{"text": "hello"}}},
+	})
+
+	conn := &fakeConnection{}
+	manager.AddConnection(filterKey, conn)
+	result, err := manager.Replay(filterKey, conn, since)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Events != 0 {
+		t.Errorf("Expected no events replayed with the buffer disabled, got %d", result.Events)
+	}
+}
+
+func TestRecentEvents(t *testing.T) {
+	manager := NewManager()
+	manager.SetReplayBufferSize(3)
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	// Nobody is connected, but matched events are still kept
+	for _, text := range []string{"one", "two", "three", "four"} {
+		manager.BroadcastEvent(postEvent("did:plc:test123", "hello "+text))
+	}
+
+	tests := []struct {
+		name     string
+		limit    int
+		expected []string
+	}{
+		{"limit below the buffered count", 2, []string{"hello three", "hello four"}},
+		{"limit above the buffered count", 10, []string{"hello two", "hello three", "hello four"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := manager.RecentEvents(filterKey, tt.limit)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(messages) != len(tt.expected) {
+				t.Fatalf("Expected %d events, got %d", len(tt.expected), len(messages))
+			}
+			for i, expected := range tt.expected {
+				if text := eventText(messages[i]); text != expected {
+					t.Errorf("Expected event %d to be %q, got %q", i, expected, text)
+				}
+			}
+		})
+	}
+
+	if _, err := manager.RecentEvents("nonexistent", 10); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+
+	// A filter that is polled survives cleanup past the grace period; an unpolled one doesn't
+	unpolled := manager.CreateFilter(models.FilterOptions{Keyword: "world"})
+	manager.mu.Lock()
+	for _, key := range []string{filterKey, unpolled} {
+		manager.subscriptions[key].CreatedAt = manager.subscriptions[key].CreatedAt.Add(-24 * time.Hour)
+	}
+	manager.mu.Unlock()
+	if _, err := manager.RecentEvents(filterKey, 1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	manager.performPeriodicCleanup()
+	if _, exists := manager.GetSubscription(filterKey); !exists {
+		t.Error("Expected a recently polled filter to be kept")
+	}
+	if _, exists := manager.GetSubscription(unpolled); exists {
+		t.Error("Expected a filter that was never polled or connected to be cleaned up")
+	}
+}
@@ -0,0 +1,33 @@
+package subscription
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// sampledOut reports whether an event falls outside a filter's sample rate. The decision is a
+// deterministic function of the event's identity (repo, time and op paths/CIDs), so every
+// connection on a filter agrees on which events to send. A rate of 0 or 1 keeps every event.
+func sampledOut(event *models.ATEvent, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return false
+	}
+	return float64(eventHash(event)) >= rate*math.MaxUint64
+}
+
+// eventHash hashes the fields that identify an event with 64-bit FNV-1a
+func eventHash(event *models.ATEvent) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(event.Did))
+	h.Write([]byte{0})
+	h.Write([]byte(event.Time))
+	for _, op := range event.Ops {
+		h.Write([]byte{0})
+		h.Write([]byte(op.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(op.Cid))
+	}
+	return h.Sum64()
+}
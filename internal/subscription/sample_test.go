@@ -0,0 +1,91 @@
+package subscription
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func sampleTestEvent(i int) *models.ATEvent {
+	return &models.ATEvent{
+		Did:  "did:plc:test123",
+		Time: "2024-01-01T00:00:00Z",
+		Ops: []models.ATOperation{{
+			Action: "create",
+			Path:   fmt.Sprintf("app.bsky.feed.post/%d", i),
+			Record: map[string]interface{}{"text": "hello world"},
+		}},
+	}
+}
+
+func TestSampledOut(t *testing.T) {
+	tests := []struct {
+		name string
+		rate float64
+		min  int
+		max  int
+	}{
+		{"unset keeps everything", 0, 10000, 10000},
+		{"one keeps everything", 1, 10000, 10000},
+		{"quarter", 0.25, 2200, 2800},
+		{"one percent", 0.01, 50, 150},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept := 0
+			for i := 0; i < 10000; i++ {
+				event := sampleTestEvent(i)
+				out := sampledOut(event, tt.rate)
+				if out != sampledOut(event, tt.rate) {
+					t.Fatal("Expected the same decision for the same event")
+				}
+				if !out {
+					kept++
+				}
+			}
+			if kept < tt.min || kept > tt.max {
+				t.Errorf("Expected between %d and %d of 10000 events kept, got %d", tt.min, tt.max, kept)
+			}
+		})
+	}
+}
+
+func TestSampleRateBroadcast(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello", SampleRate: 0.5})
+	first := &fakeConnection{}
+	second := &fakeConnection{}
+	manager.AddConnection(filterKey, first)
+	manager.AddConnection(filterKey, second)
+
+	const events = 200
+	expected := 0
+	for i := 0; i < events; i++ {
+		event := sampleTestEvent(i)
+		if !sampledOut(event, 0.5) {
+			expected++
+		}
+		manager.BroadcastEvent(event)
+	}
+
+	waitFor(t, func() bool { return first.messageCount() == expected && second.messageCount() == expected })
+	for i := 0; i < expected; i++ {
+		a := first.message(i).(models.WSMessage).Data.(models.EnrichedATEvent).Ops[0].Path
+		b := second.message(i).(models.WSMessage).Data.(models.EnrichedATEvent).Ops[0].Path
+		if a != b {
+			t.Fatalf("Expected both connections to receive the same events, got %s and %s at %d", a, b, i)
+		}
+	}
+	if sampled := testutil.ToFloat64(metriks.SampledOutEvents.WithLabelValues(filterKey)); int(sampled) != events-expected {
+		t.Errorf("Expected %d sampled-out events counted, got %v", events-expected, sampled)
+	}
+
+	if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", SampleRate: 1.5}); key != "" {
+		t.Error("Expected a sample rate above 1 to be rejected")
+	}
+}
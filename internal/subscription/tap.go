@@ -0,0 +1,140 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// Firehose tap limits
+const (
+	DefaultTapRate = 0.001 // Share of events a tap receives when it doesn't ask for a rate
+	MaxTapRate     = 0.01  // Largest share of the firehose a tap may sample
+	MaxTaps        = 5     // Taps open at once; they don't count against the connection limit
+)
+
+var (
+	// ErrInvalidTapRate is returned by AddTap for a rate outside (0, MaxTapRate]
+	ErrInvalidTapRate = fmt.Errorf("tap rate must be greater than 0 and at most %g", MaxTapRate)
+	// ErrTooManyTaps is returned by AddTap when MaxTaps taps are already open
+	ErrTooManyTaps = errors.New("too many tap connections")
+)
+
+// tap is a connection that receives a sample of every broadcast event, whatever the filters
+type tap struct {
+	rate   float64
+	writer *connectionWriter
+}
+
+// AddTap registers a connection to receive a deterministic sample of rate of every event passed
+// to BroadcastEvent, bypassing filters entirely. Taps are tracked apart from filter connections,
+// so they neither count against the connection limit nor show up on any filter.
+func (m *Manager) AddTap(conn Connection, rate float64) error {
+	if rate <= 0 || rate > MaxTapRate {
+		return ErrInvalidTapRate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, exists := m.taps[conn]; exists {
+		t.rate = rate
+		return nil
+	}
+	if len(m.taps) >= MaxTaps {
+		return ErrTooManyTaps
+	}
+	m.taps[conn] = &tap{rate: rate, writer: newConnectionWriter(conn, m.handleTapWriteError).start()}
+	metriks.TapConnections.Set(float64(len(m.taps)))
+	return nil
+}
+
+// RemoveTap deregisters a tap connection and stops its writer; the connection is left open
+func (m *Manager) RemoveTap(conn Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeTap(conn)
+}
+
+// TapCount returns the number of open taps
+func (m *Manager) TapCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.taps)
+}
+
+// removeTap deregisters a tap connection; the caller must hold m.mu
+func (m *Manager) removeTap(conn Connection) {
+	t, exists := m.taps[conn]
+	if !exists {
+		return
+	}
+	t.writer.stop()
+	delete(m.taps, conn)
+	metriks.TapConnections.Set(float64(len(m.taps)))
+}
+
+// handleTapWriteError is called by a tap's writer when a write fails; the tap is removed and closed
+func (m *Manager) handleTapWriteError(conn Connection) {
+	m.RemoveTap(conn)
+	if err := conn.Close(); err != nil {
+		slog.Warn("Failed to close dead tap connection", "error", err)
+	}
+}
+
+// broadcastToTaps queues an event for every tap whose sample it falls in; the caller must hold m.mu
+func (m *Manager) broadcastToTaps(event *models.ATEvent, receivedAt time.Time) {
+	var messages []models.WSMessage
+	for _, t := range m.taps {
+		if sampledOut(event, t.rate) {
+			continue
+		}
+
+		if messages == nil {
+			forwardedAt := time.Now()
+			enrichedEvent := models.EnrichedATEvent{
+				Event:    event.Event,
+				Did:      event.Did,
+				Time:     event.Time,
+				Kind:     event.Kind,
+				Ops:      withOperationURIs(event.Did, event.Ops, false),
+				Identity: event.Identity,
+				Account:  event.Account,
+				Timestamps: models.EventTimestamps{
+					Original:  event.Time,
+					Received:  receivedAt.Format(time.RFC3339Nano),
+					Forwarded: forwardedAt.Format(time.RFC3339Nano),
+					Seq:       event.Seq,
+				},
+			}
+			messages = []models.WSMessage{{
+				Type:      "event",
+				Timestamp: forwardedAt,
+				Data:      enrichedEvent,
+			}}
+			if onlyDeletes(event) {
+				messages = deleteMessages(enrichedEvent, forwardedAt)
+			}
+		}
+
+		for _, message := range messages {
+			t.writer.enqueue(message, nil)
+		}
+	}
+}
+
+// closeTaps closes every tap connection; the caller must hold m.mu
+func (m *Manager) closeTaps() {
+	for conn, t := range m.taps {
+		t.writer.stop()
+		if err := conn.Close(); err != nil {
+			slog.Warn("Error closing tap connection", "error", err)
+		}
+	}
+	m.taps = make(map[Connection]*tap)
+	metriks.TapConnections.Set(0)
+}
@@ -0,0 +1,101 @@
+package subscription
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestTap(t *testing.T) {
+	manager := NewManagerWithConfig(1)
+
+	// Fill the only connection slot; taps are counted separately
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "nothing-matches-this"})
+	if result := manager.AddConnectionWithResult(filterKey, &fakeConnection{}); !result.Success {
+		t.Fatalf("Expected the filter connection to be accepted, got %s", result.ErrorCode)
+	}
+
+	for _, rate := range []float64{0, -0.1, MaxTapRate * 2, 1} {
+		if err := manager.AddTap(&fakeConnection{}, rate); !errors.Is(err, ErrInvalidTapRate) {
+			t.Errorf("Expected ErrInvalidTapRate for rate %g, got %v", rate, err)
+		}
+	}
+
+	tapConn := &fakeConnection{}
+	if err := manager.AddTap(tapConn, MaxTapRate); err != nil {
+		t.Fatalf("AddTap returned error: %v", err)
+	}
+	if taps := manager.GetStats()["tap_connections"]; taps != 1 {
+		t.Errorf("Expected 1 tap in the stats, got %v", taps)
+	}
+	if total := manager.GetStats()["total_connections"]; total != 1 {
+		t.Errorf("Expected the tap not to count as a connection, got %v", total)
+	}
+
+	// Taps receive exactly the events in their sample, whatever the filters
+	expected := 0
+	for i := 0; i < 2000; i++ {
+		event := postEvent(fmt.Sprintf("did:plc:user%d", i), fmt.Sprintf("post %d", i))
+		if !sampledOut(event, MaxTapRate) {
+			expected++
+		}
+		manager.BroadcastEvent(event)
+	}
+	if expected == 0 {
+		t.Fatal("Expected some events to fall in the sample")
+	}
+	waitFor(t, func() bool { return tapConn.messageCount() == expected })
+
+	message, ok := tapConn.message(0).(models.WSMessage)
+	if !ok || message.Type != "event" {
+		t.Fatalf("Expected an event message, got %#v", tapConn.message(0))
+	}
+	if event := message.Data.(models.EnrichedATEvent); event.Timestamps.FilterKey != "" {
+		t.Errorf("Expected tap events not to carry a filter key, got %q", event.Timestamps.FilterKey)
+	}
+
+	manager.RemoveTap(tapConn)
+	if taps := manager.TapCount(); taps != 0 {
+		t.Errorf("Expected no taps after RemoveTap, got %d", taps)
+	}
+	if tapConn.isClosed() {
+		t.Error("Expected RemoveTap to leave the connection open")
+	}
+	manager.BroadcastEvent(postEvent("did:plc:late", "after removal"))
+	time.Sleep(20 * time.Millisecond)
+	if count := tapConn.messageCount(); count != expected {
+		t.Errorf("Expected no events after RemoveTap, got %d more", count-expected)
+	}
+}
+
+func TestTapLimit(t *testing.T) {
+	manager := NewManager()
+
+	conns := make([]*fakeConnection, MaxTaps)
+	for i := range conns {
+		conns[i] = &fakeConnection{}
+		if err := manager.AddTap(conns[i], DefaultTapRate); err != nil {
+			t.Fatalf("AddTap %d returned error: %v", i, err)
+		}
+	}
+	if err := manager.AddTap(&fakeConnection{}, DefaultTapRate); !errors.Is(err, ErrTooManyTaps) {
+		t.Errorf("Expected ErrTooManyTaps, got %v", err)
+	}
+	// Adding an open tap again only changes its rate
+	if err := manager.AddTap(conns[0], MaxTapRate); err != nil {
+		t.Errorf("Expected re-adding a tap to succeed, got %v", err)
+	}
+
+	manager.ShutdownWithDrain(time.Second)
+	for i, conn := range conns {
+		if !conn.isClosed() {
+			t.Errorf("Expected tap %d to be closed on shutdown", i)
+		}
+	}
+	if taps := manager.TapCount(); taps != 0 {
+		t.Errorf("Expected no taps after shutdown, got %d", taps)
+	}
+}
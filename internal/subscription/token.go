@@ -0,0 +1,113 @@
+package subscription
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultConnectTokenTTL is how long a connect token can be used to open connections
+const DefaultConnectTokenTTL = 5 * time.Minute
+
+// ErrInvalidConnectToken is returned when a filter requires a connect token and the one given is
+// missing, unknown or expired
+var ErrInvalidConnectToken = errors.New("invalid or expired connect token")
+
+// SetConnectTokenTTL sets how long connect tokens stay valid; 0 or less restores
+// DefaultConnectTokenTTL. Tokens already issued keep their expiry.
+func (m *Manager) SetConnectTokenTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultConnectTokenTTL
+	}
+	m.mu.Lock()
+	m.connectTokenTTL = ttl
+	m.mu.Unlock()
+}
+
+// IssueConnectToken returns a new connect token for a filter and when it expires. From the first
+// token on, the filter only accepts connections that present a valid one, so knowing the filter
+// key alone no longer grants access to its events. Connections opened with a token stay open
+// after it expires.
+func (m *Manager) IssueConnectToken(filterKey string) (string, time.Time, error) {
+	token, err := generateConnectToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, exists := m.subscriptions[filterKey]
+	if !exists {
+		return "", time.Time{}, ErrSubscriptionNotFound
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(m.connectTokenTTL)
+	sub.mu.Lock()
+	if sub.connectTokens == nil {
+		sub.connectTokens = make(map[string]time.Time)
+	}
+	sub.pruneConnectTokens(now)
+	sub.connectTokens[hashConnectToken(token)] = expiresAt
+	sub.mu.Unlock()
+
+	slog.Debug("Issued connect token", "filter", filterKey[:8]+"...", "expiresAt", expiresAt)
+	return token, expiresAt, nil
+}
+
+// ValidateConnectToken checks a token presented to connect to a filter. Filters that were never
+// issued a token accept any connection; unknown filters are left for AddConnection to report.
+func (m *Manager) ValidateConnectToken(filterKey, token string) error {
+	m.mu.RLock()
+	sub, exists := m.subscriptions[filterKey]
+	m.mu.RUnlock()
+	if !exists {
+		return nil
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.connectTokens == nil {
+		return nil
+	}
+
+	now := time.Now()
+	sub.pruneConnectTokens(now)
+	if token == "" {
+		return ErrInvalidConnectToken
+	}
+	if _, valid := sub.connectTokens[hashConnectToken(token)]; !valid {
+		return ErrInvalidConnectToken
+	}
+	return nil
+}
+
+// pruneConnectTokens forgets connect tokens past their expiry; the caller must hold sub.mu for writing
+func (sub *Subscription) pruneConnectTokens(now time.Time) {
+	for hash, expiresAt := range sub.connectTokens {
+		if !now.Before(expiresAt) {
+			delete(sub.connectTokens, hash)
+		}
+	}
+}
+
+// generateConnectToken returns a random connect token
+func generateConnectToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate connect token: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// hashConnectToken returns the digest tokens are stored under, so the subscription never holds
+// a usable token and lookups don't compare secrets byte by byte
+func hashConnectToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package subscription
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+func TestConnectTokens(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	// Filters that were never issued a token accept any connection
+	if err := manager.ValidateConnectToken(filterKey, ""); err != nil {
+		t.Errorf("Expected no token to be required yet, got %v", err)
+	}
+
+	token, expiresAt, err := manager.IssueConnectToken(filterKey)
+	if err != nil {
+		t.Fatalf("IssueConnectToken returned error: %v", err)
+	}
+	if token == "" || !expiresAt.After(time.Now()) {
+		t.Fatalf("Expected a token expiring in the future, got %q expiring %v", token, expiresAt)
+	}
+	if sub, _ := manager.GetSubscription(filterKey); !sub.RequiresToken {
+		t.Error("Expected the filter to report that it requires a token")
+	}
+
+	if err := manager.ValidateConnectToken(filterKey, token); err != nil {
+		t.Errorf("Expected the issued token to be valid, got %v", err)
+	}
+	// Tokens may be reused until they expire
+	if err := manager.ValidateConnectToken(filterKey, token); err != nil {
+		t.Errorf("Expected the token to stay valid, got %v", err)
+	}
+	for _, invalid := range []string{"", "not-a-token", token + "0"} {
+		if err := manager.ValidateConnectToken(filterKey, invalid); !errors.Is(err, ErrInvalidConnectToken) {
+			t.Errorf("Expected ErrInvalidConnectToken for %q, got %v", invalid, err)
+		}
+	}
+
+	// Issuing another token leaves the first one valid
+	second, _, err := manager.IssueConnectToken(filterKey)
+	if err != nil || second == token {
+		t.Fatalf("Expected a second, different token, got %q, %v", second, err)
+	}
+	if manager.ValidateConnectToken(filterKey, token) != nil || manager.ValidateConnectToken(filterKey, second) != nil {
+		t.Error("Expected both tokens to be valid")
+	}
+
+	// Expired tokens are rejected and forgotten
+	manager.mu.RLock()
+	sub := manager.subscriptions[filterKey]
+	manager.mu.RUnlock()
+	sub.mu.Lock()
+	sub.connectTokens[hashConnectToken(token)] = time.Now().Add(-time.Second)
+	sub.mu.Unlock()
+	if err := manager.ValidateConnectToken(filterKey, token); !errors.Is(err, ErrInvalidConnectToken) {
+		t.Errorf("Expected an expired token to be rejected, got %v", err)
+	}
+	sub.mu.RLock()
+	remaining := len(sub.connectTokens)
+	sub.mu.RUnlock()
+	if remaining != 1 {
+		t.Errorf("Expected only the unexpired token to be kept, got %d", remaining)
+	}
+
+	if _, _, err := manager.IssueConnectToken("missing"); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound, got %v", err)
+	}
+	if err := manager.ValidateConnectToken("missing", ""); err != nil {
+		t.Errorf("Expected unknown filters to be left to AddConnection, got %v", err)
+	}
+}
+
+func TestSetConnectTokenTTL(t *testing.T) {
+	manager := NewManager()
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+
+	manager.SetConnectTokenTTL(time.Hour)
+	if _, expiresAt, _ := manager.IssueConnectToken(filterKey); time.Until(expiresAt) < 59*time.Minute {
+		t.Errorf("Expected the token to expire in an hour, got %v", expiresAt)
+	}
+
+	manager.SetConnectTokenTTL(0)
+	if _, expiresAt, _ := manager.IssueConnectToken(filterKey); time.Until(expiresAt) > DefaultConnectTokenTTL {
+		t.Errorf("Expected a TTL of 0 to restore the default, got expiry %v", expiresAt)
+	}
+}
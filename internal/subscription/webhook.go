@@ -0,0 +1,286 @@
+package subscription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// Webhook delivery defaults
+const (
+	webhookQueueSize              = 256                    // Events buffered per webhook before new ones are dropped
+	webhookTimeout                = 10 * time.Second       // Timeout for a single POST
+	webhookMaxAttempts            = 3                      // Attempts per event (1 + retries)
+	webhookRetryDelay             = 500 * time.Millisecond // Initial retry delay, doubled per attempt
+	webhookMaxConsecutiveFailures = 5                      // Failed events in a row before the webhook is disabled
+	webhookDisableCooldown        = 1 * time.Minute        // How long a disabled webhook waits before it is retried, doubled each time it fails again
+	webhookMaxDisableCooldown     = 1 * time.Hour          // Upper bound for the disable cooldown
+)
+
+// errWebhookAddressNotAllowed is returned when a webhook resolves to an address that isn't public
+var errWebhookAddressNotAllowed = errors.New("webhook address is not public")
+
+// nonPublicPrefixes are shared, benchmarking and reserved ranges that netip doesn't classify as
+// private but that a webhook must not reach either
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// publicAddress reports whether a webhook may connect to ip: loopback, private, link-local
+// (including cloud metadata endpoints), multicast and reserved addresses are refused
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newWebhookClient returns the HTTP client webhooks are posted with. Unless allowPrivate is set it
+// refuses to connect to addresses that aren't public. The check runs on each address as it is
+// dialed, after DNS resolution and for every redirect, so a public hostname that resolves (or is
+// rebound) to an internal address is refused too; proxies from the environment are ignored so
+// the check sees the real destination.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", errWebhookAddressNotAllowed, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// webhookSender delivers enriched events for one subscription to an HTTP endpoint.
+// Events are queued so a slow endpoint never blocks the broadcast path. After too many failures
+// in a row the webhook is disabled for a cooldown, then retried; the cooldown doubles each time
+// it fails again straight away and resets once an event is delivered.
+type webhookSender struct {
+	filterKey              string
+	url                    string
+	client                 *http.Client
+	queue                  chan models.EnrichedATEvent
+	done                   chan struct{}
+	exited                 chan struct{} // Closed when the delivery goroutine returns
+	stopOnce               sync.Once
+	disabled               atomic.Bool
+	pending                atomic.Int64   // Queued events not delivered yet, including one being delivered
+	delivered              *atomic.Uint64 // Subscription's MessagesDelivered counter
+	maxAttempts            int
+	retryDelay             time.Duration
+	maxConsecutiveFailures int
+	disableCooldown        time.Duration
+	maxDisableCooldown     time.Duration
+}
+
+// newWebhookSender creates a webhook sender posting with client and the default delivery
+// settings; call start to begin delivery
+func newWebhookSender(filterKey, url string, client *http.Client, delivered *atomic.Uint64) *webhookSender {
+	return &webhookSender{
+		filterKey:              filterKey,
+		url:                    url,
+		client:                 client,
+		queue:                  make(chan models.EnrichedATEvent, webhookQueueSize),
+		done:                   make(chan struct{}),
+		exited:                 make(chan struct{}),
+		delivered:              delivered,
+		maxAttempts:            webhookMaxAttempts,
+		retryDelay:             webhookRetryDelay,
+		maxConsecutiveFailures: webhookMaxConsecutiveFailures,
+		disableCooldown:        webhookDisableCooldown,
+		maxDisableCooldown:     webhookMaxDisableCooldown,
+	}
+}
+
+// start launches the delivery goroutine
+func (w *webhookSender) start() *webhookSender {
+	go w.run()
+	return w
+}
+
+// stop ends delivery; queued events are discarded
+func (w *webhookSender) stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+// isDisabled reports whether the webhook is disabled after too many consecutive failures and
+// waiting to be retried
+func (w *webhookSender) isDisabled() bool {
+	return w.disabled.Load()
+}
+
+// enqueue queues an event for delivery, dropping it if the webhook is disabled or its queue is full
+func (w *webhookSender) enqueue(event models.EnrichedATEvent) {
+	if w.isDisabled() {
+		return
+	}
+	w.pending.Add(1)
+	select {
+	case w.queue <- event:
+	default:
+		w.pending.Add(-1)
+		slog.Warn("Webhook queue full, dropping event", "filter", w.filterKey[:8]+"...")
+	}
+}
+
+// unflushed returns how many queued events the webhook still has to deliver, or 0 once it has
+// stopped and will deliver no more
+func (w *webhookSender) unflushed() int64 {
+	select {
+	case <-w.exited:
+		return 0
+	default:
+		return w.pending.Load()
+	}
+}
+
+// run delivers queued events until stopped
+func (w *webhookSender) run() {
+	defer close(w.exited)
+	consecutiveFailures := 0
+	cooldown := w.disableCooldown
+	for {
+		select {
+		case <-w.done:
+			return
+		case event := <-w.queue:
+			err := w.deliver(event)
+			w.pending.Add(-1)
+			if err != nil {
+				consecutiveFailures++
+				metriks.WebhookFailures.WithLabelValues(w.filterKey).Inc()
+				slog.Warn("Webhook delivery failed",
+					"filter", w.filterKey[:8]+"...",
+					"consecutiveFailures", consecutiveFailures,
+					"maxConsecutiveFailures", w.maxConsecutiveFailures,
+					"error", err)
+
+				if consecutiveFailures >= w.maxConsecutiveFailures {
+					if !w.disableFor(cooldown, consecutiveFailures) {
+						return
+					}
+					// One more failure right after the cooldown disables the webhook again, for longer
+					consecutiveFailures = w.maxConsecutiveFailures - 1
+					cooldown = min(cooldown*2, w.maxDisableCooldown)
+				}
+				continue
+			}
+
+			consecutiveFailures = 0
+			cooldown = w.disableCooldown
+			w.delivered.Add(1)
+		}
+	}
+}
+
+// disableFor disables the webhook, discarding queued events, and re-enables it once cooldown
+// has passed. It returns false if the sender was stopped in the meantime.
+func (w *webhookSender) disableFor(cooldown time.Duration, failures int) bool {
+	w.disabled.Store(true)
+	slog.Warn("Disabled webhook", "filter", w.filterKey[:8]+"...", "consecutiveFailures", failures, "retryIn", cooldown)
+	for drained := false; !drained; {
+		select {
+		case <-w.queue:
+			w.pending.Add(-1)
+		default:
+			drained = true
+		}
+	}
+
+	timer := time.NewTimer(cooldown)
+	defer timer.Stop()
+	select {
+	case <-w.done:
+		return false
+	case <-timer.C:
+	}
+	w.disabled.Store(false)
+	slog.Info("Re-enabled webhook", "filter", w.filterKey[:8]+"...")
+	return true
+}
+
+// deliver POSTs an event, retrying with exponential backoff
+func (w *webhookSender) deliver(event models.EnrichedATEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	delay := w.retryDelay
+	for attempt := 1; ; attempt++ {
+		err = w.post(body)
+		if err == nil || attempt >= w.maxAttempts {
+			return err
+		}
+
+		select {
+		case <-w.done:
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends a single webhook request, treating non-2xx responses as failures
+func (w *webhookSender) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Filter-Key", w.filterKey)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			slog.Warn("Failed to close webhook response body", "filter", w.filterKey[:8]+"...", "error", closeErr)
+		}
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package subscription
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+)
+
+// webhookRecorder is a test webhook endpoint that fails the first failures requests
+type webhookRecorder struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	requests int
+	failures int
+}
+
+func (r *webhookRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+	if r.failures < 0 || r.requests <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	r.bodies = append(r.bodies, body)
+}
+
+func (r *webhookRecorder) counts() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests, len(r.bodies)
+}
+
+// waitFor polls cond until it returns true or the timeout expires
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	manager := NewManager()
+	manager.SetWebhookAllowPrivateAddresses(true) // The test server listens on loopback
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello", WebhookURL: server.URL})
+	if filterKey == "" {
+		t.Fatal("Expected filter with webhook to be created")
+	}
+
+	manager.BroadcastEvent(&models.ATEvent{
+		Did: "did:plc:test123",
+		Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/abc123", Record: map[string]interface{}{"text": "hello world"}}},
+	})
+
+	waitFor(t, func() bool {
+		_, delivered := recorder.counts()
+		return delivered == 1
+	})
+
+	var event models.EnrichedATEvent
+	if err := json.Unmarshal(recorder.bodies[0], &event); err != nil {
+		t.Fatalf("Failed to decode webhook body: %v", err)
+	}
+	if event.Did != "did:plc:test123" || event.Timestamps.FilterKey != filterKey {
+		t.Errorf("Unexpected webhook event: %+v", event)
+	}
+
+	waitFor(t, func() bool {
+		sub, _ := manager.GetSubscription(filterKey)
+		return sub.MessagesDelivered == 1
+	})
+
+	// Webhook filters aren't cleaned up for lacking connections
+	manager.mu.Lock()
+	manager.subscriptions[filterKey].CreatedAt = time.Now().Add(-time.Hour)
+	manager.mu.Unlock()
+	manager.performPeriodicCleanup()
+	if _, exists := manager.GetSubscription(filterKey); !exists {
+		t.Error("Expected webhook filter to survive periodic cleanup")
+	}
+
+	manager.DeleteFilter(filterKey)
+}
+
+func TestWebhookRetry(t *testing.T) {
+	recorder := &webhookRecorder{failures: 2}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	var delivered atomic.Uint64
+	sender := newWebhookSender("0123456789abcdef", server.URL, newWebhookClient(true), &delivered)
+	sender.retryDelay = time.Millisecond
+	sender.start()
+	defer sender.stop()
+
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:test123"})
+
+	waitFor(t, func() bool { return delivered.Load() == 1 })
+	if requests, _ := recorder.counts(); requests != 3 {
+		t.Errorf("Expected 3 attempts, got %d", requests)
+	}
+}
+
+func TestWebhookDisabledAfterConsecutiveFailures(t *testing.T) {
+	recorder := &webhookRecorder{failures: -1} // Always fail
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	filterKey := "fedcba9876543210"
+	var delivered atomic.Uint64
+	sender := newWebhookSender(filterKey, server.URL, newWebhookClient(true), &delivered)
+	sender.maxAttempts = 1
+	sender.maxConsecutiveFailures = 2
+	sender.start()
+	defer sender.stop()
+
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:one"})
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:two"})
+
+	waitFor(t, sender.isDisabled)
+
+	// Events for a disabled webhook are dropped
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:three"})
+	time.Sleep(20 * time.Millisecond)
+	if requests, _ := recorder.counts(); requests != 2 {
+		t.Errorf("Expected 2 requests before disabling, got %d", requests)
+	}
+	if failures := testutil.ToFloat64(metriks.WebhookFailures.WithLabelValues(filterKey)); failures != 2 {
+		t.Errorf("Expected 2 recorded failures, got %v", failures)
+	}
+	if delivered.Load() != 0 {
+		t.Errorf("Expected no deliveries, got %d", delivered.Load())
+	}
+}
+
+func TestWebhookReenabledAfterCooldown(t *testing.T) {
+	recorder := &webhookRecorder{failures: 3}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	var delivered atomic.Uint64
+	sender := newWebhookSender("0123456789abcdef", server.URL, newWebhookClient(true), &delivered)
+	sender.maxAttempts = 1
+	sender.maxConsecutiveFailures = 2
+	sender.disableCooldown = 20 * time.Millisecond
+	sender.start()
+	defer sender.stop()
+
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:one"})
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:two"})
+	waitFor(t, sender.isDisabled)
+	waitFor(t, func() bool { return !sender.isDisabled() })
+
+	// A failure right after the cooldown disables it again straight away
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:three"})
+	waitFor(t, sender.isDisabled)
+	waitFor(t, func() bool { return !sender.isDisabled() })
+
+	sender.enqueue(models.EnrichedATEvent{Did: "did:plc:four"})
+	waitFor(t, func() bool { return delivered.Load() == 1 })
+	if requests, _ := recorder.counts(); requests != 4 {
+		t.Errorf("Expected 4 requests, got %d", requests)
+	}
+}
+
+func TestWebhookRefusesNonPublicAddresses(t *testing.T) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	var delivered atomic.Uint64
+	sender := newWebhookSender("0123456789abcdef", server.URL, newWebhookClient(false), &delivered)
+	if err := sender.post([]byte("{}")); !errors.Is(err, errWebhookAddressNotAllowed) {
+		t.Errorf("Expected a loopback webhook to be refused, got %v", err)
+	}
+	if requests, _ := recorder.counts(); requests != 0 {
+		t.Errorf("Expected no requests to reach the server, got %d", requests)
+	}
+
+	for address, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if got := publicAddress(netip.MustParseAddr(address)); got != public {
+			t.Errorf("publicAddress(%s) = %v, want %v", address, got, public)
+		}
+	}
+}
+
+func TestWebhookURLValidation(t *testing.T) {
+	manager := NewManager()
+
+	for _, webhookURL := range []string{"ftp://example.com/hook", "example.com/hook", "http://"} {
+		if key := manager.CreateFilter(models.FilterOptions{Keyword: "hello", WebhookURL: webhookURL}); key != "" {
+			t.Errorf("Expected webhook URL %q to be rejected", webhookURL)
+		}
+	}
+}
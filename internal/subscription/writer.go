@@ -0,0 +1,158 @@
+package subscription
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/msgpack"
+)
+
+// Outbound queue defaults
+const (
+	connectionQueueSize    = 256              // Messages buffered per connection before new ones are dropped
+	connectionWriteTimeout = 30 * time.Second // Deadline for writing a single message
+)
+
+// Message encodings a connection can ask for
+const (
+	EncodingJSON    = "json"    // JSON text frames, the default
+	EncodingMsgpack = "msgpack" // MessagePack binary frames
+)
+
+// EncodedConnection is a Connection that chooses how its messages are encoded.
+// Connections that don't implement it always receive JSON
+type EncodedConnection interface {
+	Connection
+	MessageEncoding() string
+	WriteMessage(messageType int, data []byte) error
+}
+
+// outboundMessage is a queued message and the counter to bump once it has been written
+type outboundMessage struct {
+	message   models.WSMessage
+	delivered *atomic.Uint64   // Subscription's MessagesDelivered counter, nil for notices
+	onWritten func(Connection) // Called after the message was written, nil if nothing follows it
+}
+
+// connectionWriter writes the manager's messages to one client connection.
+// Messages are queued so a slow client only delays itself, never the broadcast to everyone else.
+type connectionWriter struct {
+	conn         Connection
+	queue        chan outboundMessage
+	done         chan struct{}
+	stopOnce     sync.Once
+	onError      func(Connection) // Called from the writer goroutine after a failed write
+	writeTimeout time.Duration
+	pending      atomic.Int64  // Queued messages not written yet, including one being written
+	exited       chan struct{} // Closed when the writer goroutine returns
+}
+
+// newConnectionWriter creates a writer with the default queue size; call start to begin writing
+func newConnectionWriter(conn Connection, onError func(Connection)) *connectionWriter {
+	return &connectionWriter{
+		conn:         conn,
+		queue:        make(chan outboundMessage, connectionQueueSize),
+		done:         make(chan struct{}),
+		exited:       make(chan struct{}),
+		onError:      onError,
+		writeTimeout: connectionWriteTimeout,
+	}
+}
+
+// start launches the writer goroutine
+func (w *connectionWriter) start() *connectionWriter {
+	go w.run()
+	return w
+}
+
+// stop ends writing; queued messages are discarded. The connection itself is left open
+func (w *connectionWriter) stop() {
+	w.stopOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+// enqueue queues a message without blocking. If the queue is full the message is dropped,
+// counted in dropped_messages_total, and false is returned
+func (w *connectionWriter) enqueue(message models.WSMessage, delivered *atomic.Uint64) bool {
+	return w.enqueueOutbound(outboundMessage{message: message, delivered: delivered})
+}
+
+// enqueueOutbound queues a message like enqueue, along with what to do once it is written
+func (w *connectionWriter) enqueueOutbound(out outboundMessage) bool {
+	w.pending.Add(1)
+	select {
+	case w.queue <- out:
+		return true
+	default:
+		w.pending.Add(-1)
+		metriks.DroppedMessages.Inc()
+		return false
+	}
+}
+
+// unflushed returns how many queued messages the writer still has to write, or 0 once it has
+// stopped and will write no more
+func (w *connectionWriter) unflushed() int64 {
+	select {
+	case <-w.exited:
+		return 0
+	default:
+		return w.pending.Load()
+	}
+}
+
+// run writes queued messages until stopped or a write fails
+func (w *connectionWriter) run() {
+	defer close(w.exited)
+	for {
+		select {
+		case <-w.done:
+			return
+		case out := <-w.queue:
+			// Don't write to a connection that was dropped while this message waited
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+
+			err := w.write(out.message)
+			w.pending.Add(-1)
+			if err != nil {
+				slog.Warn("Failed to send message to connection", "error", err)
+				w.onError(w.conn)
+				return
+			}
+			if out.delivered != nil {
+				out.delivered.Add(1)
+			}
+			if out.onWritten != nil {
+				out.onWritten(w.conn)
+			}
+		}
+	}
+}
+
+// write sends a single message with a fresh write deadline, as a binary MessagePack frame
+// if the connection asked for one and as JSON otherwise
+func (w *connectionWriter) write(message models.WSMessage) error {
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+		return err
+	}
+
+	if conn, ok := w.conn.(EncodedConnection); ok && conn.MessageEncoding() == EncodingMsgpack {
+		data, err := msgpack.Marshal(message)
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.BinaryMessage, data)
+	}
+	return w.conn.WriteJSON(message)
+}
@@ -0,0 +1,282 @@
+package subscription
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	metriks "github.com/JWhist/AT_Proto_PubSub/internal/metrics"
+	"github.com/JWhist/AT_Proto_PubSub/internal/models"
+	"github.com/JWhist/AT_Proto_PubSub/internal/msgpack"
+)
+
+// blockingConnection is a fakeConnection whose writes hang until released, like a stalled client
+type blockingConnection struct {
+	fakeConnection
+	release chan struct{}
+}
+
+func (c *blockingConnection) WriteJSON(v interface{}) error {
+	<-c.release
+	return c.fakeConnection.WriteJSON(v)
+}
+
+// slowConnection is a fakeConnection that takes a while to write each message
+type slowConnection struct {
+	fakeConnection
+	delay time.Duration
+}
+
+func (c *slowConnection) WriteJSON(v interface{}) error {
+	time.Sleep(c.delay)
+	return c.fakeConnection.WriteJSON(v)
+}
+
+// broadcastPosts broadcasts n posts containing "hello"
+func broadcastPosts(manager *Manager, n int) {
+	for i := 0; i < n; i++ {
+		manager.BroadcastEvent(&models.ATEvent{
+			Did: "did:plc:test123",
+			Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/test", Record: map[string]interface{}{"text": "hello"}}},
+		})
+	}
+}
+
+func TestShutdownFlushesQueuedMessages(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	conn := &slowConnection{delay: 5 * time.Millisecond}
+	manager.AddConnection(filterKey, conn)
+	broadcastPosts(manager, 20)
+
+	if dropped := manager.ShutdownWithDrain(5 * time.Second); dropped != 0 {
+		t.Errorf("Expected every queued message to be flushed, %d were dropped", dropped)
+	}
+	if conn.messageCount() != 20 {
+		t.Errorf("Expected 20 messages written before the connection closed, got %d", conn.messageCount())
+	}
+	if !conn.isClosed() {
+		t.Error("Expected the connection to be closed after flushing")
+	}
+}
+
+func TestShutdownReportsUnflushedMessages(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	stalled := &blockingConnection{release: make(chan struct{})}
+	defer close(stalled.release)
+	manager.AddConnection(filterKey, stalled)
+	broadcastPosts(manager, 10)
+
+	droppedBefore := testutil.ToFloat64(metriks.ShutdownDroppedMessages)
+	drainTimeout := 100 * time.Millisecond
+	start := time.Now()
+	dropped := manager.ShutdownWithDrain(drainTimeout)
+
+	if elapsed := time.Since(start); elapsed > drainTimeout+time.Second {
+		t.Errorf("Expected shutdown to give up flushing after the drain timeout, took %v", elapsed)
+	}
+	if dropped != 10 {
+		t.Errorf("Expected 10 undelivered messages reported, got %d", dropped)
+	}
+	if counted := testutil.ToFloat64(metriks.ShutdownDroppedMessages) - droppedBefore; counted != 10 {
+		t.Errorf("Expected 10 dropped messages counted, got %v", counted)
+	}
+}
+
+func TestConnectionWriterDropsWhenFull(t *testing.T) {
+	conn := &blockingConnection{release: make(chan struct{})}
+	writer := newConnectionWriter(conn, func(Connection) {})
+	writer.queue = make(chan outboundMessage, 2)
+	writer.start()
+	defer writer.stop()
+
+	var delivered atomic.Uint64
+	dropsBefore := testutil.ToFloat64(metriks.DroppedMessages)
+
+	// One message is taken by the stalled write, two fill the queue and the rest are dropped
+	accepted := 0
+	for i := 0; i < 5; i++ {
+		if writer.enqueue(models.WSMessage{Type: "event"}, &delivered) {
+			accepted++
+		}
+		if i == 0 {
+			waitFor(t, func() bool { return len(writer.queue) == 0 })
+		}
+	}
+
+	if accepted != 3 {
+		t.Errorf("Expected 3 messages accepted, got %d", accepted)
+	}
+	if drops := testutil.ToFloat64(metriks.DroppedMessages) - dropsBefore; drops != 2 {
+		t.Errorf("Expected 2 dropped messages counted, got %v", drops)
+	}
+
+	close(conn.release)
+	waitFor(t, func() bool { return delivered.Load() == 3 })
+	if conn.messageCount() != 3 {
+		t.Errorf("Expected the accepted messages to be written, got %d", conn.messageCount())
+	}
+}
+
+func TestSlowConnectionDoesNotBlockBroadcast(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	slow := &blockingConnection{release: make(chan struct{})}
+	defer close(slow.release)
+	fast := &fakeConnection{}
+	manager.AddConnection(filterKey, slow)
+	manager.AddConnection(filterKey, fast)
+
+	broadcast := func(events int) {
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < events; i++ {
+				manager.BroadcastEvent(&models.ATEvent{
+					Did: "did:plc:test123",
+					Ops: []models.ATOperation{{Action: "create", Path: "app.bsky.feed.post/test", Record: map[string]interface{}{"text": "hello"}}},
+				})
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("BroadcastEvent blocked on a stalled connection")
+		}
+	}
+
+	dropsBefore := testutil.ToFloat64(metriks.DroppedMessages)
+
+	// The stalled connection's queue fills up, then it starts dropping while the other keeps receiving
+	broadcast(connectionQueueSize)
+	waitFor(t, func() bool { return fast.messageCount() == connectionQueueSize })
+	broadcast(10)
+	waitFor(t, func() bool { return fast.messageCount() == connectionQueueSize+10 })
+
+	if drops := testutil.ToFloat64(metriks.DroppedMessages) - dropsBefore; drops < 9 {
+		t.Errorf("Expected events for the stalled connection to be dropped, got %v drops", drops)
+	}
+	if slow.messageCount() != 0 {
+		t.Errorf("Expected nothing written to the stalled connection yet, got %d", slow.messageCount())
+	}
+	if total := manager.GetStats()["total_connections"]; total != 2 {
+		t.Errorf("Expected the stalled connection to stay connected, got %v connections", total)
+	}
+}
+
+func TestConnectionWriterReportsFailedWrite(t *testing.T) {
+	conn := &failingConnection{}
+	failed := make(chan Connection, 1)
+	writer := newConnectionWriter(conn, func(c Connection) { failed <- c }).start()
+	defer writer.stop()
+
+	var delivered atomic.Uint64
+	writer.enqueue(models.WSMessage{Type: "event"}, &delivered)
+
+	select {
+	case c := <-failed:
+		if c != conn {
+			t.Error("Expected the failing connection to be reported")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the failed write to be reported")
+	}
+	if delivered.Load() != 0 {
+		t.Errorf("Expected failed writes not to count as delivered, got %d", delivered.Load())
+	}
+}
+
+// msgpackConnection is a fakeConnection that asked for MessagePack and records binary frames
+type msgpackConnection struct {
+	fakeConnection
+	frameTypes []int
+}
+
+func (c *msgpackConnection) MessageEncoding() string { return EncodingMsgpack }
+
+func (c *msgpackConnection) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frameTypes = append(c.frameTypes, messageType)
+	c.messages = append(c.messages, data)
+	return nil
+}
+
+func TestMsgpackEventRoundTrip(t *testing.T) {
+	manager := NewManager()
+
+	filterKey := manager.CreateFilter(models.FilterOptions{Keyword: "hello"})
+	binary := &msgpackConnection{}
+	text := &fakeConnection{}
+	manager.AddConnection(filterKey, binary)
+	manager.AddConnection(filterKey, text)
+
+	manager.BroadcastEvent(&models.ATEvent{
+		Did:  "did:plc:test123",
+		Time: "2024-01-01T00:00:00Z",
+		Kind: models.EventKindCommit,
+		Ops: []models.ATOperation{{
+			Action: "create",
+			Path:   "app.bsky.feed.post/abc123",
+			Record: map[string]interface{}{"text": "hello world", "langs": []interface{}{"en"}},
+		}},
+	})
+	waitFor(t, func() bool { return binary.messageCount() == 1 && text.messageCount() == 1 })
+
+	if _, ok := text.message(0).(models.WSMessage); !ok {
+		t.Errorf("Expected JSON connections to keep receiving WriteJSON messages, got %T", text.message(0))
+	}
+
+	binary.mu.Lock()
+	frameType := binary.frameTypes[0]
+	frame := binary.messages[0].([]byte)
+	binary.mu.Unlock()
+	if frameType != websocket.BinaryMessage {
+		t.Fatalf("Expected a binary frame, got type %d", frameType)
+	}
+
+	decoded, err := msgpack.Decode(frame)
+	if err != nil {
+		t.Fatalf("Failed to decode frame: %v", err)
+	}
+	// Decoded values have the JSON layout, so they map back onto the JSON types
+	remarshaled, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("Failed to remarshal frame: %v", err)
+	}
+	var message struct {
+		Type      string                 `json:"type"`
+		Timestamp time.Time              `json:"timestamp"`
+		Data      models.EnrichedATEvent `json:"data"`
+	}
+	if err := json.Unmarshal(remarshaled, &message); err != nil {
+		t.Fatalf("Failed to unmarshal frame: %v", err)
+	}
+
+	if message.Type != "event" || message.Timestamp.IsZero() {
+		t.Errorf("Expected a timestamped event message, got type %q at %v", message.Type, message.Timestamp)
+	}
+	event := message.Data
+	if event.Did != "did:plc:test123" || event.Kind != models.EventKindCommit || event.Time != "2024-01-01T00:00:00Z" {
+		t.Errorf("Unexpected event fields: %+v", event)
+	}
+	if len(event.Ops) != 1 || event.Ops[0].Path != "app.bsky.feed.post/abc123" {
+		t.Fatalf("Expected the operation to survive the round trip, got %+v", event.Ops)
+	}
+	record, ok := event.Ops[0].Record.(map[string]interface{})
+	if !ok || record["text"] != "hello world" {
+		t.Errorf("Expected the record text to survive the round trip, got %#v", event.Ops[0].Record)
+	}
+	if event.Timestamps.FilterKey != filterKey || len(event.Timestamps.MatchedKeywords) != 1 || event.Timestamps.MatchedKeywords[0] != "hello" {
+		t.Errorf("Unexpected timestamps: %+v", event.Timestamps)
+	}
+}